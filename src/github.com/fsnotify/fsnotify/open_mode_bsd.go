@@ -2,10 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build dragonfly freebsd netbsd openbsd
+// +build freebsd openbsd netbsd dragonfly
 
-package unix
+package fsnotify
 
-const ImplementsGetwd = false
+import "golang.org/x/sys/unix"
 
-func Getwd() (string, error) { return "", ENOTSUP }
+const openMode = unix.O_NONBLOCK | unix.O_RDONLY | unix.O_CLOEXEC
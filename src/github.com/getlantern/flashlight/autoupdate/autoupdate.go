@@ -99,5 +99,9 @@ func applyNext() {
 			return
 		}
 		log.Debugf("Got update.")
+		// Make sure config changes survive the restart into the new version
+		if err := config.Flush(); err != nil {
+			log.Errorf("Unable to save config: %v", err)
+		}
 	}
 }
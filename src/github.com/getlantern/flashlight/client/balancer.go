@@ -2,6 +2,10 @@ package client
 
 import "github.com/getlantern/balancer"
 
+// deprioritizedWeightDivisor is how much less often the balancer uses chained
+// servers other than the ones preferred for our territory.
+const deprioritizedWeightDivisor = 10
+
 // getBalancer waits for a message from client.balCh to arrive and then it
 // writes it back to client.balCh before returning it as a value. This way we
 // always have a balancer at client.balCh and, if we don't have one, it would
@@ -45,9 +49,21 @@ func (client *Client) initBalancer(cfg *ClientConfig) {
 	if len(cfg.ChainedServers) == 0 {
 		log.Error("NO CHAINED SERVERS!")
 	}
-	for _, s := range cfg.ChainedServers {
+	preferred := make(map[string]bool)
+	for _, name := range cfg.PreferredChainedServers() {
+		preferred[name] = true
+	}
+	for name, s := range cfg.ChainedServers {
 		dialer, err := s.Dialer()
 		if err == nil {
+			if !preferred[name] && dialer.Weight > 1 {
+				// Still use servers that aren't meant for us if the preferred
+				// ones are unavailable, just less often
+				dialer.Weight = dialer.Weight / deprioritizedWeightDivisor
+				if dialer.Weight < 1 {
+					dialer.Weight = 1
+				}
+			}
 			dialers = append(dialers, dialer)
 		} else {
 			log.Errorf("Unable to configure chained server. Received error: %v", err)
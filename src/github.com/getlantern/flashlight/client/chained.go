@@ -32,10 +32,10 @@ type ChainedServerInfo struct {
 	// Cert: optional PEM encoded certificate for the server. If specified,
 	// server will be dialed using TLS over tcp. Otherwise, server will be
 	// dialed using plain tcp.
-	Cert string
+	Cert Secret
 
 	// AuthToken: the authtoken to present to the upstream server.
-	AuthToken string
+	AuthToken Secret
 
 	// Weight: relative weight versus other servers (for round-robin)
 	Weight int
@@ -46,6 +46,14 @@ type ChainedServerInfo struct {
 
 	// Trusted: Determines if a host can be trusted with plain HTTP traffic.
 	Trusted bool
+
+	// Territories: optional 2-letter codes of the territories this server is
+	// meant for. Servers without any are meant for everyone.
+	Territories []string
+
+	// Priority: optional relative priority versus other servers meant for the
+	// same territory. Higher priority servers are preferred.
+	Priority int
 }
 
 // Dialer creates a *balancer.Dialer backed by a chained server.
@@ -98,7 +106,7 @@ func (s *ChainedServerInfo) Dialer() (*balancer.Dialer, error) {
 
 	ccfg.OnRequest = func(req *http.Request) {
 		if s.AuthToken != "" {
-			req.Header.Set("X-LANTERN-AUTH-TOKEN", s.AuthToken)
+			req.Header.Set("X-LANTERN-AUTH-TOKEN", string(s.AuthToken))
 		}
 		req.Header.Set("X-LANTERN-DEVICE-ID", settings.GetInstanceID())
 	}
@@ -122,6 +130,6 @@ func (s *ChainedServerInfo) Dialer() (*balancer.Dialer, error) {
 			})
 			return withStats(conn, err)
 		},
-		AuthToken: s.AuthToken,
+		AuthToken: string(s.AuthToken),
 	}, nil
 }
@@ -2,6 +2,7 @@ package client
 
 import (
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/getlantern/fronted"
@@ -18,11 +19,97 @@ type ClientConfig struct {
 	FrontedServers []*FrontedServerInfo
 	ChainedServers map[string]*ChainedServerInfo
 	MasqueradeSets map[string][]*fronted.Masquerade
+	// DefaultMasqueradeSet: the masquerade set to use for fronted servers that
+	// don't specify one, and to load from the built-in sets if none are
+	// configured
+	DefaultMasqueradeSet string
+
+	// Territory: the 2-letter code of the territory the client is in, used to
+	// prefer the servers meant for it. Empty if unknown.
+	Territory string
 }
 
-// SortServers sorts the Servers array in place, ordered by host
+// SortServers sorts the Servers array in place, with the servers meant for our
+// Territory first, then by descending priority and then by host, and each of
+// the MasqueradeSets in place, ordered by domain. Together with the map keys
+// being sorted when marshaling, this makes the YAML for a ClientConfig
+// deterministic.
 func (c *ClientConfig) SortServers() {
 	sort.Sort(ByHost(c.FrontedServers))
+	sort.Stable(&byRank{c.FrontedServers, c.Territory})
+	for _, masquerades := range c.MasqueradeSets {
+		sort.Sort(ByDomain(masquerades))
+	}
+}
+
+// PreferredChainedServers returns the names of the chained servers that rank
+// highest for our Territory, in order. The balancer favors these over the
+// rest.
+func (c *ClientConfig) PreferredChainedServers() []string {
+	var preferred []string
+	var best serverRank
+	for name, s := range c.ChainedServers {
+		r := rankServer(s.Territories, s.Priority, c.Territory)
+		switch {
+		case preferred == nil || best.less(r):
+			preferred, best = []string{name}, r
+		case r == best:
+			preferred = append(preferred, name)
+		}
+	}
+	sort.Strings(preferred)
+	return preferred
+}
+
+// serverRank is how well a server suits a client, servers meant for the
+// client's territory ranking above those that aren't and then by priority.
+type serverRank struct {
+	inTerritory bool
+	priority    int
+}
+
+func rankServer(territories []string, priority int, territory string) serverRank {
+	return serverRank{servesTerritory(territories, territory), priority}
+}
+
+// less returns whether r ranks below other.
+func (r serverRank) less(other serverRank) bool {
+	if r.inTerritory != other.inTerritory {
+		return other.inTerritory
+	}
+	return r.priority < other.priority
+}
+
+// servesTerritory returns whether a server meant for the given territories
+// serves clients in territory. Servers that don't name any serve everyone, as
+// does every server when we don't know where we are.
+func servesTerritory(territories []string, territory string) bool {
+	if len(territories) == 0 || territory == "" {
+		return true
+	}
+	for _, t := range territories {
+		if strings.EqualFold(t, territory) {
+			return true
+		}
+	}
+	return false
+}
+
+// byRank implements sort.Interface for []*FrontedServerInfo, putting the
+// servers that rank highest for territory first.
+type byRank struct {
+	servers   []*FrontedServerInfo
+	territory string
+}
+
+func (a *byRank) Len() int      { return len(a.servers) }
+func (a *byRank) Swap(i, j int) { a.servers[i], a.servers[j] = a.servers[j], a.servers[i] }
+func (a *byRank) Less(i, j int) bool {
+	return a.rank(j).less(a.rank(i))
+}
+
+func (a *byRank) rank(i int) serverRank {
+	return rankServer(a.servers[i].Territories, a.servers[i].Priority, a.territory)
 }
 
 // ByHost implements sort.Interface for []*ServerInfo based on the host
@@ -31,3 +118,16 @@ type ByHost []*FrontedServerInfo
 func (a ByHost) Len() int           { return len(a) }
 func (a ByHost) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByHost) Less(i, j int) bool { return a[i].Host < a[j].Host }
+
+// ByDomain implements sort.Interface for []*fronted.Masquerade based on the
+// domain and then the ip address
+type ByDomain []*fronted.Masquerade
+
+func (a ByDomain) Len() int      { return len(a) }
+func (a ByDomain) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByDomain) Less(i, j int) bool {
+	if a[i].Domain != a[j].Domain {
+		return a[i].Domain < a[j].Domain
+	}
+	return a[i].IpAddress < a[j].IpAddress
+}
@@ -51,6 +51,10 @@ type FrontedServerInfo struct {
 	// Weight: relative weight versus other servers (for round-robin)
 	Weight int
 
+	// CloudWeight: the Weight assigned by the cloud config, which Weight is
+	// adjusted relative to based on observed performance
+	CloudWeight int
+
 	// QOS: relative quality of service offered. Should be >= 0, with higher
 	// values indicating higher QOS.
 	QOS int
@@ -58,6 +62,14 @@ type FrontedServerInfo struct {
 	// Trusted: Determines if a host can be trusted with unencrypted HTTP
 	// traffic.
 	Trusted bool
+
+	// Territories: optional 2-letter codes of the territories this server is
+	// meant for. Servers without any are meant for everyone.
+	Territories []string
+
+	// Priority: optional relative priority versus other servers meant for the
+	// same territory. Higher priority servers are preferred.
+	Priority int
 }
 
 // dialer creates a dialer for domain fronting and and balanced dialer that can
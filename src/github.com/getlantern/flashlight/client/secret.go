@@ -0,0 +1,25 @@
+package client
+
+const (
+	redactedSecret = "<redacted>"
+)
+
+// Secret is a string, like an auth token, that mustn't end up in logs. Its
+// String method masks it, so formatting a Secret, or a struct holding one,
+// with %v or %s doesn't give it away. YAML and JSON still encode the actual
+// value, so configs holding Secrets save and load as before. Use string(s)
+// where the actual value is needed.
+type Secret string
+
+// String returns <redacted>, or an empty string if the Secret is empty.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// GoString is like String, so that %#v doesn't give the Secret away either.
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/statreporter"
+)
+
+// The accessors in this file are safe to call concurrently with updates to
+// the configuration. Updates never modify the current Config in place, so
+// each accessor works from a consistent snapshot and returns copies that
+// callers are free to modify.
+
+// ChainedServers returns a copy of the configured chained servers, keyed by
+// name. It returns an empty map if there are none.
+func ChainedServers() map[string]*client.ChainedServerInfo {
+	servers := make(map[string]*client.ChainedServerInfo)
+	cfg := current()
+	if cfg == nil || cfg.Client == nil {
+		return servers
+	}
+	for name, server := range cfg.Client.ChainedServers {
+		copied := *server
+		servers[name] = &copied
+	}
+	return servers
+}
+
+// ProxiedSiteList returns the sorted list of sites that are proxied, which is
+// the cloud list plus the user's additions minus the user's deletions. It
+// returns an empty list if there are none.
+func ProxiedSiteList() []string {
+	cfg := current()
+	if cfg == nil {
+		return make([]string, 0)
+	}
+	return cfg.effectiveProxiedSites()
+}
+
+// StatsConfig returns a copy of the stats reporting settings, which are zero
+// if there are none.
+func StatsConfig() statreporter.Config {
+	cfg := current()
+	if cfg == nil || cfg.Stats == nil {
+		return statreporter.Config{}
+	}
+	return *cfg.Stats
+}
+
+// AutoReportEnabled returns whether to report usage and debugging data, which
+// is the case unless the user has turned it off.
+func AutoReportEnabled() bool {
+	cfg := current()
+	if cfg == nil || cfg.AutoReport == nil {
+		return true
+	}
+	return *cfg.AutoReport
+}
+
+// IsCustomDeployment returns whether this Lantern keeps the chained servers it
+// was distributed with rather than taking those in cloud config, see
+// Config.PreserveCustomServers.
+func IsCustomDeployment() bool {
+	cfg := current()
+	return cfg != nil && cfg.PreserveCustomServers
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/statreporter"
+)
+
+func TestAccessorsWithoutConfig(t *testing.T) {
+	origM := m
+	m = nil
+	defer func() {
+		m = origM
+	}()
+
+	servers := ChainedServers()
+	if assert.NotNil(t, servers) {
+		assert.Empty(t, servers)
+	}
+	sites := ProxiedSiteList()
+	if assert.NotNil(t, sites) {
+		assert.Empty(t, sites)
+	}
+	assert.Equal(t, statreporter.Config{}, StatsConfig())
+	assert.True(t, AutoReportEnabled(), "Auto reporting should be on unless turned off")
+}
+
+func TestAccessors(t *testing.T) {
+	defer initTestConfig(t, `
+autoreport: false
+stats:
+  statshubaddr: stats.example.com
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.1.1.1:443
+      authtoken: token
+proxiedsites:
+  cloud:
+  - b.com
+  - a.com
+  delta:
+    additions:
+    - c.com
+    deletions:
+    - b.com
+`)()
+
+	servers := ChainedServers()
+	if assert.Len(t, servers, 1) {
+		assert.Equal(t, "token", string(servers["fallback-1"].AuthToken))
+	}
+	// Modifying what we got shouldn't affect the config
+	servers["fallback-1"].AuthToken = "modified"
+	servers["fallback-2"] = servers["fallback-1"]
+	assert.Len(t, ChainedServers(), 1)
+	assert.Equal(t, "token", string(ChainedServers()["fallback-1"].AuthToken))
+
+	assert.Equal(t, []string{"a.com", "c.com"}, ProxiedSiteList())
+	assert.Equal(t, "stats.example.com", StatsConfig().StatshubAddr)
+	assert.False(t, AutoReportEnabled())
+}
+
+func TestAccessorsConcurrentWithUpdates(t *testing.T) {
+	defer initTestConfig(t, "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n")()
+
+	var wg sync.WaitGroup
+	stop := make(chan interface{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Bounded, and yielding, so that readers don't starve the updates
+			for j := 0; j < 20; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, server := range ChainedServers() {
+					server.Addr = "modified"
+				}
+				sites := ProxiedSiteList()
+				if len(sites) > 0 {
+					sites[0] = "modified"
+				}
+				StatsConfig()
+				AutoReportEnabled()
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		update := []byte(fmt.Sprintf(`
+client:
+  chainedservers:
+    fallback-%d:
+      addr: 1.1.1.%d:443
+proxiedsites:
+  cloud:
+  - site%d.com
+`, i, i, i))
+		assert.NoError(t, Update(func(cfg *Config) error {
+			return cfg.updateFrom(update)
+		}))
+	}
+	close(stop)
+	wg.Wait()
+
+	servers := ChainedServers()
+	if assert.Len(t, servers, 1) {
+		assert.Equal(t, "1.1.1.4:443", servers["fallback-4"].Addr)
+	}
+	assert.Contains(t, ProxiedSiteList(), "site4.com")
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	userIDHeader    = "X-Lantern-User-Id"
+	userTokenHeader = "X-Lantern-Pro-Token"
+)
+
+var (
+	// Who the last cloud config fetched from each URL was for, see
+	// cloudConfigIdentity, if it was for someone in particular. Since cloud
+	// config varies by user, what we know about the last fetch only applies
+	// to the same user.
+	lastCloudConfigIdentity = map[string]string{}
+)
+
+// cloudConfigIdentity identifies who we fetch cloud config for, which is empty
+// if we don't know who the user is. It includes a hash of the UserToken
+// rather than the token itself.
+func (cfg *Config) cloudConfigIdentity() string {
+	if cfg.UserID == 0 && cfg.UserToken == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%x", cfg.UserID, sha256.Sum256([]byte(cfg.UserToken)))
+}
+
+// setUserHeaders identifies the user on the given request for cloud config,
+// if we know who they are.
+func setUserHeaders(req *http.Request) {
+	cfg := current()
+	if cfg == nil {
+		return
+	}
+	if cfg.UserID != 0 {
+		req.Header.Set(userIDHeader, strconv.FormatInt(cfg.UserID, 10))
+	}
+	if cfg.UserToken != "" {
+		req.Header.Set(userTokenHeader, string(cfg.UserToken))
+	}
+}
+
+// scopeCloudConfigTo forgets what we know about the last cloud config fetched
+// from the given URL if it was for someone other than the given identity, so
+// that we don't make a fetch for one user conditional on the config of
+// another. pollMx must be held.
+func scopeCloudConfigTo(url string, identity string) {
+	// Anything we know without knowing who it was for was for nobody in
+	// particular
+	if lastCloudConfigIdentity[url] == identity {
+		return
+	}
+	if _, fetched := lastCloudConfigETag[url]; fetched {
+		log.Debugf("Last cloud config from %v was for another user, fetching it again", withoutCredentials(url))
+	}
+	forgetCloudConfig(url)
+	if identity != "" {
+		lastCloudConfigIdentity[url] = identity
+	}
+}
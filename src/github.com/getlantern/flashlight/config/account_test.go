@@ -0,0 +1,194 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// userConfigServer serves cloud config that varies by user, with an ETag for
+// each user, recording the headers of each request.
+type userConfigServer struct {
+	*httptest.Server
+	headers []http.Header
+	mx      sync.Mutex
+}
+
+func newUserConfigServer(t *testing.T) *userConfigServer {
+	s := &userConfigServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		s.mx.Lock()
+		s.headers = append(s.headers, req.Header)
+		s.mx.Unlock()
+		tag := "etag-" + req.Header.Get(userIDHeader)
+		if req.Header.Get(ifNoneMatch) == tag {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		resp.Header().Set(etag, tag)
+		resp.Write(gzipped(t, fmt.Sprintf("proxiedsites:\n  cloud:\n  - user%s.com\n", req.Header.Get(userIDHeader))))
+	}))
+	return s
+}
+
+// requests returns the headers of the requests the server has received.
+func (s *userConfigServer) requests() []http.Header {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]http.Header{}, s.headers...)
+}
+
+func TestUserHeadersOnEveryPath(t *testing.T) {
+	defer initTestConfig(t, "userid: 42\nusertoken: secret-token\n")()
+	defer useTestFetcher()()
+	srv := newUserConfigServer(t)
+	defer srv.Close()
+	configURL := "http://config.example.com/cloud.yaml.gz"
+
+	// Through the local proxy
+	cf = &redirectingFetcher{srv.Server}
+	_, err := fetchCloudConfig(context.Background(), configURL)
+	assert.NoError(t, err)
+
+	// Through a bootstrap server, which we have to fall back to
+	origServers, origDial := bootstrapServers, chainedDial
+	defer func() {
+		bootstrapServers, chainedDial = origServers, origDial
+	}()
+	var attempts []string
+	cf = &recordingFetcher{&attempts}
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{
+			"bootstrap": &client.ChainedServerInfo{Addr: "127.0.0.1:1", AuthToken: "server-token"},
+		}
+	}
+	srvURL, _ := url.Parse(srv.URL)
+	chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+		return func(network, addr string) (net.Conn, error) {
+			return net.Dial("tcp", srvURL.Host)
+		}, nil
+	}
+	forgetCloudConfig(configURL)
+	_, err = fetchCloudConfig(context.Background(), configURL)
+	assert.NoError(t, err)
+
+	requests := srv.requests()
+	if assert.Len(t, requests, 2) {
+		for _, header := range requests {
+			assert.Equal(t, "42", header.Get(userIDHeader))
+			assert.Equal(t, "secret-token", header.Get(userTokenHeader))
+		}
+		assert.Equal(t, "server-token", requests[1].Get(authTokenHeader))
+	}
+
+	// Nothing is sent for anonymous users. This skips Update so as not to
+	// refresh.
+	assert.NoError(t, m.Update(func(ycfg yamlconf.Config) error {
+		cfg := ycfg.(*Config)
+		cfg.UserID, cfg.UserToken = 0, ""
+		return nil
+	}))
+	req, err := newCloudConfigRequest(context.Background(), configURL, configURL, "", "")
+	if assert.NoError(t, err) {
+		assert.Empty(t, req.Header.Get(userIDHeader))
+		assert.Empty(t, req.Header.Get(userTokenHeader))
+	}
+}
+
+func TestCloudConfigPerUser(t *testing.T) {
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\nuserid: 42\nusertoken: token-42\n")()
+	defer useTestFetcher()()
+	srv := newUserConfigServer(t)
+	defer srv.Close()
+	cf = &redirectingFetcher{srv.Server}
+	diffs, restore := captureDiffs()
+	defer restore()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+	poll()
+	poll()
+	requests := srv.requests()
+	if assert.Len(t, requests, 2) {
+		assert.Empty(t, requests[0].Get(ifNoneMatch))
+		assert.Equal(t, "etag-42", requests[1].Get(ifNoneMatch), "Same user's fetch should be conditional")
+	}
+	assert.Contains(t, current().ProxiedSites.Cloud, "user42.com")
+
+	// Changing the token alone is enough to refresh
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UserToken = "token-42-renewed"
+		return nil
+	}))
+	assert.True(t, awaitRequests(srv, 3), "Changing token should have refreshed")
+	requests = srv.requests()
+	assert.Empty(t, requests[2].Get(ifNoneMatch), "Fetch for new token should not be conditional on the old one")
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UserID, cfg.UserToken = 43, "token-43"
+		return nil
+	}))
+	assert.True(t, awaitRequests(srv, 4), "Changing user should have refreshed")
+	requests = srv.requests()
+	assert.Equal(t, "43", requests[3].Get(userIDHeader))
+	assert.Empty(t, requests[3].Get(ifNoneMatch), "Fetch for new user should not be conditional on the old user's config")
+	deadline := time.Now().Add(5 * time.Second)
+	for current().UserID != 43 || !hasCloudSite(current(), "user43.com") {
+		if time.Now().After(deadline) {
+			t.Fatal("New user's cloud config was not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Cloud config can't change who the user is, and the token never shows
+	candidate, err := current().candidateFrom([]byte("userid: 44\nusertoken: cloud-token\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(43), candidate.UserID)
+		assert.Equal(t, "token-43", string(candidate.UserToken))
+	}
+	redactedCfg, err := current().redactedCopy()
+	if assert.NoError(t, err) {
+		assert.Equal(t, redacted, string(redactedCfg.UserToken))
+	}
+	for _, diff := range *diffs {
+		assert.False(t, strings.Contains(diff.String(), "token-4"), "Diffs should not include the token: %v", diff)
+	}
+}
+
+func hasCloudSite(cfg *Config, site string) bool {
+	for _, s := range cfg.ProxiedSites.Cloud {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitRequests waits for the given server to have received the given number
+// of requests, returning whether it did.
+func awaitRequests(srv *userConfigServer, n int) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.requests()) < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	adminServiceName = "lantern.config.ConfigAdmin"
+
+	// adminTokenFile is the file in the config directory to which the token
+	// that callers of the admin API need is written while it's served.
+	adminTokenFile = "config-admin-token"
+
+	// adminTokenMetadata is the metadata in which callers pass the token, as
+	// "Bearer <token>".
+	adminTokenMetadata = "authorization"
+	bearerPrefix       = "Bearer "
+)
+
+var (
+	adminStreams   = make(map[chan struct{}]bool)
+	adminStreamsMx sync.Mutex
+)
+
+// configAdminServer is the server API of the ConfigAdmin service described in
+// admin.proto. Configs are passed as the JSON form of a Config in a
+// google.protobuf.Struct, since there's no protobuf definition of a Config.
+type configAdminServer interface {
+	GetConfig(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	UpdateConfig(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Subscribe(*emptypb.Empty, grpc.ServerStream) error
+	ReloadNow(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+}
+
+// adminServiceDesc describes the ConfigAdmin service as protoc-gen-go-grpc
+// would generate it from admin.proto.
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: adminServiceName,
+	HandlerType: (*configAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetConfig",
+			Handler: unaryAdminHandler("GetConfig", func() interface{} { return &emptypb.Empty{} }, func(srv configAdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return srv.GetConfig(ctx, in.(*emptypb.Empty))
+			}),
+		},
+		{
+			MethodName: "UpdateConfig",
+			Handler: unaryAdminHandler("UpdateConfig", func() interface{} { return &structpb.Struct{} }, func(srv configAdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return srv.UpdateConfig(ctx, in.(*structpb.Struct))
+			}),
+		},
+		{
+			MethodName: "ReloadNow",
+			Handler: unaryAdminHandler("ReloadNow", func() interface{} { return &emptypb.Empty{} }, func(srv configAdminServer, ctx context.Context, in interface{}) (interface{}, error) {
+				return srv.ReloadNow(ctx, in.(*emptypb.Empty))
+			}),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Subscribe",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := &emptypb.Empty{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(configAdminServer).Subscribe(in, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "admin.proto",
+}
+
+// unaryAdminHandler returns the handler of the unary method with the given
+// name, which decodes the request into what newIn returns and passes it to
+// handle, through the server's interceptor if it has one.
+func unaryAdminHandler(method string, newIn func() interface{}, handle func(srv configAdminServer, ctx context.Context, in interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newIn()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return handle(srv.(configAdminServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + adminServiceName + "/" + method,
+		}
+		return interceptor(ctx, in, info, func(ctx context.Context, in interface{}) (interface{}, error) {
+			return handle(srv.(configAdminServer), ctx, in)
+		})
+	}
+}
+
+// adminServer serves the ConfigAdmin service from the current config.
+type adminServer struct{}
+
+// ServeAdminAPI serves the ConfigAdmin gRPC service described in admin.proto
+// on the loopback address given with the -config-admin-addr flag, so that
+// tooling, the UI and tests can read and change the config, and follow its
+// changes, without editing the config file. It returns a function that stops
+// the server, which does nothing if the flag wasn't given. Like the config
+// handler, the service only lets callers change the fields in
+// patchableFields.
+//
+// Since any local process can connect to a loopback address, callers must
+// pass a token that's generated for each run and written to the
+// config-admin-token file in the config directory, readable only by the
+// current user. The file is removed when the server stops.
+func ServeAdminAPI() (stop func(), err error) {
+	if *configAdminAddr == "" {
+		return func() {}, nil
+	}
+	l, err := listenAdmin(*configAdminAddr)
+	if err != nil {
+		return nil, err
+	}
+	token, err := writeAdminToken()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	stopServer := serveAdmin(l, token)
+	return func() {
+		stopServer()
+		removeAdminToken()
+	}, nil
+}
+
+// writeAdminToken generates a new token for the admin API and writes it to
+// the token file, which only the current user may read.
+func writeAdminToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Unable to generate config admin token: %v", err)
+	}
+	token := hex.EncodeToString(b)
+	_, path, err := InConfigDir(adminTokenFile)
+	if err != nil {
+		return "", err
+	}
+	// WriteFile keeps the permissions of an existing file, so remove any
+	// left over from a run that didn't stop cleanly
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("Unable to remove old config admin token at %v: %v", path, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("Unable to write config admin token to %v: %v", path, err)
+	}
+	return token, nil
+}
+
+func removeAdminToken() {
+	_, path, err := InConfigDir(adminTokenFile)
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Unable to remove config admin token: %v", err)
+	}
+}
+
+// listenAdmin listens at the given address, which must be a loopback address.
+func listenAdmin(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config admin address %v: %v", addr, err)
+	}
+	if host != "localhost" && !isLoopback(host) {
+		return nil, fmt.Errorf("Config admin address %v is not a loopback address", addr)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to listen for config admin requests at %v: %v", addr, err)
+	}
+	return l, nil
+}
+
+// serveAdmin serves the ConfigAdmin service on the given listener to callers
+// that pass the given token, returning a function that stops it.
+func serveAdmin(l net.Listener, token string) func() {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkAdminToken(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkAdminToken(stream.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	srv.RegisterService(&adminServiceDesc, &adminServer{})
+	log.Debugf("Serving config admin API at %v", l.Addr())
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Errorf("Unable to serve config admin API: %v", err)
+		}
+	}()
+	return srv.Stop
+}
+
+// checkAdminToken checks that the call with the given context passed the
+// given token.
+func checkAdminToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get(adminTokenMetadata) {
+		if strings.HasPrefix(auth, bearerPrefix) && subtle.ConstantTimeCompare([]byte(auth[len(bearerPrefix):]), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Missing or wrong config admin token")
+}
+
+// GetConfig returns the current config, with secrets masked.
+func (s *adminServer) GetConfig(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	cfg := current()
+	if cfg == nil {
+		return nil, status.Error(codes.Unavailable, "Config not initialized")
+	}
+	return redactedStruct(cfg)
+}
+
+// UpdateConfig applies the given patch, in the form accepted by PATCH
+// /config, returning the updated config with secrets masked.
+func (s *adminServer) UpdateConfig(ctx context.Context, patch *structpb.Struct) (*structpb.Struct, error) {
+	if current() == nil {
+		return nil, status.Error(codes.Unavailable, "Config not initialized")
+	}
+	data, err := patch.MarshalJSON()
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Unable to encode patch: %v", err)
+	}
+	updated, err := applyPatch(data)
+	switch err.(type) {
+	case nil:
+		return redactedStruct(updated)
+	case *forbiddenFieldError, *LockedFieldsError:
+		return nil, status.Errorf(codes.PermissionDenied, "Unable to update config: %v", err)
+	case *badPatchError, *ValidationError:
+		return nil, status.Errorf(codes.InvalidArgument, "Unable to update config: %v", err)
+	default:
+		return nil, status.Errorf(codes.Internal, "Unable to update config: %v", err)
+	}
+}
+
+// Subscribe sends the current config, with secrets masked, followed by the
+// config after each update that Run applies until the caller goes away.
+// Updates that follow each other quickly may be seen as one.
+func (s *adminServer) Subscribe(_ *emptypb.Empty, stream grpc.ServerStream) error {
+	changed := make(chan struct{}, 1)
+	changed <- struct{}{}
+	adminStreamsMx.Lock()
+	adminStreams[changed] = true
+	adminStreamsMx.Unlock()
+	defer func() {
+		adminStreamsMx.Lock()
+		delete(adminStreams, changed)
+		adminStreamsMx.Unlock()
+	}()
+
+	for {
+		select {
+		case <-changed:
+			cfg := current()
+			if cfg == nil {
+				continue
+			}
+			redactedCfg, err := redactedStruct(cfg)
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(redactedCfg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// ReloadNow reloads the config file, in case it changed, and then polls for
+// cloud config right away rather than waiting for the next poll.
+func (s *adminServer) ReloadNow(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if current() == nil {
+		return nil, status.Error(codes.Unavailable, "Config not initialized")
+	}
+	if err := m.Reload(); err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to reload config: %v", err)
+	}
+	Refresh()
+	return &emptypb.Empty{}, nil
+}
+
+// notifyAdminStreams tells the Subscribe streams that the config changed.
+func notifyAdminStreams() {
+	adminStreamsMx.Lock()
+	defer adminStreamsMx.Unlock()
+	for changed := range adminStreams {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// Already notified, the stream will send the latest config
+		}
+	}
+}
+
+// redactedStruct returns the given Config, with secrets masked, as a Struct.
+func redactedStruct(cfg *Config) (*structpb.Struct, error) {
+	redactedCfg, err := cfg.redactedCopy()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	data, err := json.Marshal(redactedCfg)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to encode config: %v", err)
+	}
+	result := &structpb.Struct{}
+	if err := result.UnmarshalJSON(data); err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to encode config: %v", err)
+	}
+	return result, nil
+}
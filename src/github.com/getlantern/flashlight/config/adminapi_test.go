@@ -0,0 +1,176 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	testAdminToken = "test-admin-token"
+)
+
+// useAdminClient serves the admin API on a loopback port with testAdminToken
+// and returns a connection to it, and a function that stops both.
+func useAdminClient(t *testing.T) (*grpc.ClientConn, func()) {
+	l, err := listenAdmin("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	stop := serveAdmin(l, testAdminToken)
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		stop()
+		t.Fatalf("Unable to connect to admin API: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		stop()
+	}
+}
+
+func adminMethod(name string) string {
+	return "/" + adminServiceName + "/" + name
+}
+
+func withAdminToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, adminTokenMetadata, bearerPrefix+token)
+}
+
+func TestAdminAPI(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+	conn, stop := useAdminClient(t)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = withAdminToken(ctx, testAdminToken)
+
+	stream, err := conn.NewStream(ctx, &adminServiceDesc.Streams[0], adminMethod("Subscribe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, stream.SendMsg(&emptypb.Empty{}))
+	assert.NoError(t, stream.CloseSend())
+	initial := &structpb.Struct{}
+	if assert.NoError(t, stream.RecvMsg(initial), "Should get the current config on subscribing") {
+		assert.True(t, initial.Fields["AutoReport"].GetNullValue() == structpb.NullValue_NULL_VALUE)
+	}
+
+	cfg := &structpb.Struct{}
+	if assert.NoError(t, conn.Invoke(ctx, adminMethod("GetConfig"), &emptypb.Empty{}, cfg)) {
+		data, _ := cfg.MarshalJSON()
+		assert.Contains(t, string(data), "1.2.3.4:443")
+		assert.NotContains(t, string(data), "supersecret", "Auth token should be redacted")
+	}
+
+	patch, _ := structpb.NewStruct(map[string]interface{}{"AutoReport": false})
+	if assert.NoError(t, conn.Invoke(ctx, adminMethod("UpdateConfig"), patch, cfg)) {
+		assert.False(t, cfg.Fields["AutoReport"].GetBoolValue())
+	}
+	if assert.NotNil(t, current().AutoReport) {
+		assert.False(t, *current().AutoReport)
+	}
+	// Run tells streams about each update it applies
+	notifyAdminStreams()
+	updated := &structpb.Struct{}
+	if assert.NoError(t, stream.RecvMsg(updated), "Should get the updated config") {
+		_, isBool := updated.Fields["AutoReport"].GetKind().(*structpb.Value_BoolValue)
+		assert.True(t, isBool, "Update should have been streamed")
+	}
+
+	forbidden, _ := structpb.NewStruct(map[string]interface{}{"UIAddr": "0.0.0.0:80"})
+	err = conn.Invoke(ctx, adminMethod("UpdateConfig"), forbidden, cfg)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "Fields that may not be patched should be refused")
+	bad, _ := structpb.NewStruct(map[string]interface{}{"AutoReport": "maybe"})
+	err = conn.Invoke(ctx, adminMethod("UpdateConfig"), bad, cfg)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Patches that don't decode should be refused")
+}
+
+func TestAdminAPIOnlyOnLoopback(t *testing.T) {
+	_, err := listenAdmin("0.0.0.0:0")
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "not a loopback"), err.Error())
+	}
+	l, err := listenAdmin("localhost:0")
+	if assert.NoError(t, err) {
+		assert.True(t, l.Addr().(*net.TCPAddr).IP.IsLoopback())
+		l.Close()
+	}
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+	conn, stop := useAdminClient(t)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := &structpb.Struct{}
+	err := conn.Invoke(ctx, adminMethod("GetConfig"), &emptypb.Empty{}, cfg)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Calls without the token should be refused")
+	err = conn.Invoke(withAdminToken(ctx, "wrong"), adminMethod("GetConfig"), &emptypb.Empty{}, cfg)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Calls with the wrong token should be refused")
+	err = conn.Invoke(metadata.AppendToOutgoingContext(ctx, adminTokenMetadata, testAdminToken), adminMethod("GetConfig"), &emptypb.Empty{}, cfg)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Token should be passed as a bearer token")
+
+	stream, err := conn.NewStream(ctx, &adminServiceDesc.Streams[0], adminMethod("Subscribe"))
+	if assert.NoError(t, err) {
+		assert.NoError(t, stream.SendMsg(&emptypb.Empty{}))
+		assert.NoError(t, stream.CloseSend())
+		err = stream.RecvMsg(&structpb.Struct{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "Subscribing without the token should be refused")
+	}
+}
+
+func TestServeAdminAPIWritesToken(t *testing.T) {
+	defer useTempConfigDir(t)()
+	defer initTestConfig(t, handlerTestConfig)()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	origAddr := *configAdminAddr
+	*configAdminAddr = addr
+	defer func() {
+		*configAdminAddr = origAddr
+	}()
+
+	stop, err := ServeAdminAPI()
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(*configdir, adminTokenFile)
+	info, err := os.Stat(path)
+	if assert.NoError(t, err, "Token file should have been written") {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Only the current user should be able to read the token")
+	}
+	token, _ := ioutil.ReadFile(path)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if assert.NoError(t, err) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = conn.Invoke(withAdminToken(ctx, string(token)), adminMethod("GetConfig"), &emptypb.Empty{}, &structpb.Struct{})
+		assert.NoError(t, err, "Token from the file should be accepted")
+		conn.Close()
+	}
+
+	stop()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "Token file should have been removed on stopping")
+}
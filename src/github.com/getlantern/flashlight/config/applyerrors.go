@@ -0,0 +1,84 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/getlantern/flashlight/statreporter"
+)
+
+var (
+	// reportApplyStat ships the dimensions of a cloud config that failed to
+	// apply, swapped out by tests.
+	reportApplyStat = func(dims *statreporter.DimGroup) {
+		dims.Increment("cloudConfigApplyErrors").Add(1)
+	}
+
+	// The names of the sections in apply error stats
+	sectionStatNames = map[Section]string{
+		ClientSection:       "client",
+		ProxiedSitesSection: "proxiedsites",
+		StatsSection:        "stats",
+		TrustedCAsSection:   "trustedcas",
+		OtherSection:        "other",
+		FeaturesSection:     "features",
+	}
+)
+
+// reportApplyError tells statreporter that the cloud config with the given
+// ETag couldn't be applied, by the class of the error and the sections of the
+// config it was about, so that whoever published it can see what fraction of
+// clients it breaks.
+func reportApplyError(etag string, err error) {
+	dims := statreporter.Dim("etag", etag).
+		And("errorclass", string(categoryOf(err))).
+		And("section", sectionsOf(err)).
+		WithCountry()
+	reportApplyStat(dims)
+}
+
+// categoryOf returns the category of an error from applying cloud config.
+// Errors that aren't known to come from anywhere else come from parsing or
+// merging it.
+func categoryOf(err error) ErrorCategory {
+	switch err.(type) {
+	case *ValidationError:
+		return ValidateError
+	case *unhealthyError, *rolledBackError, *flappingError:
+		return HealthError
+	case *VersionRequiredError:
+		return VersionError
+	}
+	return ParseError
+}
+
+// sectionsOf returns the names of the sections of the config that the given
+// error is about, joined with +, or unknown if that can't be told from the
+// error.
+func sectionsOf(err error) string {
+	found := make(map[string]bool)
+	switch e := err.(type) {
+	case *ValidationError:
+		for _, issue := range e.Issues {
+			field := strings.SplitN(issue.Field, ".", 2)[0]
+			section, ok := fieldSections[field]
+			if !ok {
+				section = OtherSection
+			}
+			if name, ok := sectionStatNames[section]; ok {
+				found[name] = true
+			}
+		}
+	case *flappingError:
+		found[sectionStatNames[ClientSection]] = true
+	}
+	if len(found) == 0 {
+		return "unknown"
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+	"github.com/getlantern/flashlight/statreporter"
+)
+
+func TestSectionsOf(t *testing.T) {
+	invalid := &ValidationError{Issues: []Issue{
+		{Field: "Client.ChainedServers.fallback-1.Addr", Message: "missing"},
+		{Field: "ProxiedSites.Cloud", Message: "too many"},
+		{Field: "Client.MasqueradeSets", Message: "empty"},
+		{Field: "UIAddr", Message: "bad"},
+		{Field: "CloudPollInterval", Message: "negative"},
+	}}
+	assert.Equal(t, "client+other+proxiedsites", sectionsOf(invalid))
+	assert.Equal(t, "client", sectionsOf(&flappingError{3, time.Now()}))
+	assert.Equal(t, "unknown", sectionsOf(&ValidationError{Issues: []Issue{{Field: "CloudPollInterval"}}}), "Bookkeeping isn't a section")
+	assert.Equal(t, "unknown", sectionsOf(assert.AnError))
+
+	assert.Equal(t, ValidateError, categoryOf(invalid))
+	assert.Equal(t, HealthError, categoryOf(&flappingError{}))
+	assert.Equal(t, ParseError, categoryOf(assert.AnError))
+}
+
+func TestApplyErrorsReported(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	_, restoreErrs := collectErrors()
+	defer restoreErrs()
+	var reported []string
+	origReportApplyStat := reportApplyStat
+	reportApplyStat = func(dims *statreporter.DimGroup) {
+		reported = append(reported, dims.String())
+	}
+	defer func() {
+		reportApplyStat = origReportApplyStat
+	}()
+	poll := func() error {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return err
+		}
+		return m.Update(mutate)
+	}
+
+	assert.NoError(t, poll())
+	assert.Empty(t, reported, "Nothing should be reported for config that applies")
+
+	srv.SetConfig("proxiedsites:\n  cloud: [\n")
+	assert.Error(t, poll())
+	if assert.Len(t, reported, 1) {
+		etag := DebugState().QuarantinedETag
+		assert.NotEmpty(t, etag)
+		assert.True(t, strings.Contains(reported[0], "etag="+etag), reported[0])
+		assert.True(t, strings.Contains(reported[0], "errorclass=parse"), reported[0])
+		assert.True(t, strings.Contains(reported[0], "section=unknown"), reported[0])
+	}
+
+	assert.NoError(t, poll(), "Quarantined config isn't applied again")
+	assert.Len(t, reported, 1, "Skipping quarantined config shouldn't be reported again")
+}
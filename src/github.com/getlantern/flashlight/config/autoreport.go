@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	autoReportHandlers   []func(enabled bool)
+	autoReportHandlersMx sync.Mutex
+)
+
+// OnAutoReportChange registers a function that's called whenever an update to
+// the config, whether from the cloud or through Update, turns reporting of
+// usage and debugging data off or back on, so that turning it off takes effect
+// right away rather than after a restart. Setting AutoReport for the first
+// time to what it already defaulted to doesn't count as a change. Handlers are
+// called synchronously and must not call Update.
+func OnAutoReportChange(onChange func(enabled bool)) {
+	autoReportHandlersMx.Lock()
+	autoReportHandlers = append(autoReportHandlers, onChange)
+	autoReportHandlersMx.Unlock()
+}
+
+// autoReportChanged tells the handlers registered with OnAutoReportChange and
+// our own reporting of poll state whether to report if the given diff turned
+// reporting on or off.
+func autoReportChanged(diff *ConfigDiff) {
+	for _, field := range diff.Fields {
+		if !strings.HasPrefix(field, "AutoReport: ") {
+			continue
+		}
+		values := strings.SplitN(strings.TrimPrefix(field, "AutoReport: "), " -> ", 2)
+		if len(values) != 2 {
+			return
+		}
+		enabled := autoReportValue(values[1])
+		if autoReportValue(values[0]) == enabled {
+			return
+		}
+		log.Debugf("Reporting usage and debugging data: %v", enabled)
+		pollStateMx.Lock()
+		publishPollState(enabled)
+		pollStateMx.Unlock()
+		autoReportHandlersMx.Lock()
+		handlers := make([]func(bool), len(autoReportHandlers))
+		copy(handlers, autoReportHandlers)
+		autoReportHandlersMx.Unlock()
+		for _, handler := range handlers {
+			handler(enabled)
+		}
+		return
+	}
+}
+
+// autoReportValue returns whether the given value of AutoReport, as given in
+// ConfigDiff.Fields, means to report, which is the default when it's not set.
+func autoReportValue(value string) bool {
+	return value != "false"
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoReportChanges(t *testing.T) {
+	defer initTestConfig(t, "addr: localhost:8787\n")()
+	var calls []bool
+	OnAutoReportChange(func(enabled bool) {
+		calls = append(calls, enabled)
+	})
+	defer func() {
+		autoReportHandlers = nil
+	}()
+	update := func(autoReport *bool, uiAddr string) {
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.AutoReport = autoReport
+			cfg.UIAddr = uiAddr
+			return nil
+		}))
+	}
+	on, off := true, false
+
+	// Setting it to the default isn't a change
+	update(&on, "localhost:16823")
+	update(&off, "localhost:16824")
+	update(&off, "localhost:16825")
+	update(&on, "localhost:16825")
+	update(&on, "localhost:16826")
+	// Neither is clearing it while it's on
+	update(nil, "localhost:16827")
+	update(&off, "localhost:16827")
+	// But clearing it while it's off turns it back on
+	update(nil, "localhost:16828")
+	assert.Equal(t, []bool{false, true, false, true}, calls)
+}
+
+func TestAutoReportSuppressesPollState(t *testing.T) {
+	defer initTestConfig(t, "addr: localhost:8787\n")()
+	setAutoReport := func(enabled bool) {
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.AutoReport = &enabled
+			return nil
+		}))
+	}
+
+	recordPoll("http://config.example.com/cloud.yaml", time.Now(), nil)
+	assert.NotNil(t, pollVars.Get("polls"), "Poll state should be published")
+
+	setAutoReport(false)
+	assert.Nil(t, pollVars.Get("polls"), "Poll state should have been withdrawn")
+	recordPoll("http://config.example.com/cloud.yaml", time.Now(), nil)
+	assert.Nil(t, pollVars.Get("polls"), "Poll state should not be published with reporting off")
+	assert.True(t, DebugState().Polls > 0, "Poll state should still be kept for diagnostics")
+
+	setAutoReport(true)
+	assert.NotNil(t, pollVars.Get("polls"), "Poll state should be published again")
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -11,6 +12,12 @@ import (
 	"github.com/getlantern/appdir"
 	"github.com/getlantern/tarfs"
 	"github.com/getlantern/yaml"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+const (
+	preserveCustomServersKey = "preservecustomservers"
 )
 
 var (
@@ -45,7 +52,7 @@ func ReadBootstrapSettings() (*BootstrapSettings, error) {
 
 	ps, er := readSettingsFromFile(yamlPath)
 	if er != nil {
-		return readSettingsFromFile(local)
+		return readSettingsFromFile(localCopy())
 	}
 	return ps, nil
 }
@@ -81,10 +88,58 @@ func readSettingsFromFile(yamlPath string) (*BootstrapSettings, error) {
 
 // MakeInitialConfig save baked-in config to the file specified by configPath
 func MakeInitialConfig(configPath string) error {
+	bytes, err := initialConfig()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(configPath, bytes, 0644)
+	if err != nil {
+		log.Errorf("Could not write bootstrap file %v", err)
+		return err
+	}
+	return nil
+}
+
+// initialConfig returns the baked-in lantern.yaml, marked as described in
+// markPackagedConfig.
+func initialConfig() ([]byte, error) {
+	bytes, err := packagedConfig()
+	if err != nil {
+		return nil, err
+	}
+	return markPackagedConfig(bytes)
+}
+
+// markPackagedConfig marks the given packaged config with where it was
+// installed from if it doesn't say so itself. If it says it's from a custom
+// distribution, it's also marked with keeping its chained servers unless it
+// says otherwise. Guesses at custom distributions don't count, since the
+// standard packaged config has a few chained servers too.
+func markPackagedConfig(bytes []byte) ([]byte, error) {
+	tree := make(map[string]interface{})
+	if err := yaml.Unmarshal(bytes, &tree); err != nil {
+		return nil, fmt.Errorf("Unable to parse packaged config: %v", err)
+	}
+	provenance, marked := tree[provenanceKey]
+	_, decided := tree[preserveCustomServersKey]
+	if !marked {
+		if err := markProvenance(tree); err != nil {
+			return nil, err
+		}
+	} else if provenance == provenanceCustom && !decided {
+		tree[preserveCustomServersKey] = true
+	} else {
+		return bytes, nil
+	}
+	return yaml.Marshal(tree)
+}
+
+// packagedConfig returns the baked-in lantern.yaml.
+func packagedConfig() ([]byte, error) {
 	dir, _, err := bootstrapPath(lanternYamlName)
 	if err != nil {
 		log.Errorf("Could not get bootstrap path %v", err)
-		return err
+		return nil, err
 	}
 
 	// We need to use tarfs here because the lantern.yaml needs to embedded
@@ -93,23 +148,42 @@ func MakeInitialConfig(configPath string) error {
 	fs, err := tarfs.New(Resources, dir)
 	if err != nil {
 		log.Errorf("Could not read resources? %v", err)
-		return err
+		return nil, err
 	}
 
 	// Get the yaml file from either the local file system or from an
 	// embedded resource, but ignore local file system files if they're
 	// empty.
-	bytes, err := fs.GetIgnoreLocalEmpty("lantern.yaml")
+	bytes, err := fs.GetIgnoreLocalEmpty(lanternYamlName)
 	if err != nil {
 		log.Errorf("Could not read bootstrap file %v", err)
-		return err
+		return nil, err
 	}
-	err = ioutil.WriteFile(configPath, bytes, 0644)
+	return bytes, nil
+}
+
+// packagedChainedServers returns the chained servers from the baked-in
+// lantern.yaml along with the compiled-in fallbacks.
+func packagedChainedServers() map[string]*client.ChainedServerInfo {
+	servers := make(map[string]*client.ChainedServerInfo)
+	for key, fb := range fallbacks {
+		servers[key] = fb
+	}
+	bytes, err := packagedConfig()
 	if err != nil {
-		log.Errorf("Could not write bootstrap file %v", err)
-		return err
+		return servers
 	}
-	return nil
+	cfg := &Config{}
+	if err := yaml.Unmarshal(bytes, cfg); err != nil {
+		log.Errorf("Could not parse bootstrap file %v", err)
+		return servers
+	}
+	if cfg.Client != nil {
+		for key, server := range cfg.Client.ChainedServers {
+			servers[key] = server
+		}
+	}
+	return servers
 }
 
 func bootstrapPath(fileName string) (string, string, error) {
@@ -146,10 +220,20 @@ func writeToDisk(ps *BootstrapSettings) (string, error) {
 		log.Errorf("Could not write to disk: %v", err)
 		return "", err
 	}
-	err = ioutil.WriteFile(local, data, 0644)
+	path := localCopy()
+	err = ioutil.WriteFile(path, data, 0644)
 	if err != nil {
 		log.Errorf("Could not write to disk: %v", err)
 		return "", err
 	}
-	return local, nil
+	return path, nil
+}
+
+// localCopy returns the path to the local copy of our embedded ration file,
+// which is kept in the portable dir in portable mode.
+func localCopy() string {
+	if dir, ok := PortableDir(); ok {
+		return filepath.Join(dir, name)
+	}
+	return local
 }
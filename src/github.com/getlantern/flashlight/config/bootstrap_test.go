@@ -1,14 +1,26 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/getlantern/chained"
 	"github.com/getlantern/yaml"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
 )
 
 func TestBootstrapSettings(t *testing.T) {
@@ -74,3 +86,204 @@ func TestBootstrapSettings(t *testing.T) {
 		assert.Equal(t, dir+"/"+name, path, "Unexpected settings dir")
 	}
 }
+
+type failingFetcher struct{}
+
+func (f *failingFetcher) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("Local proxy unavailable")
+}
+
+func TestFetchFallsBackToBootstrapServers(t *testing.T) {
+	defer useTestFetcher()()
+	cf = &failingFetcher{}
+
+	body := "proxiedsites:\n  cloud:\n  - a.com\n"
+	// The handlers run on the servers' goroutines
+	var tokensMx sync.Mutex
+	var fetchAuthTokens []string
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		tokensMx.Lock()
+		fetchAuthTokens = append(fetchAuthTokens, req.Header.Get(authTokenHeader))
+		tokensMx.Unlock()
+		resp.Write(gzipped(t, body))
+	}))
+	defer backend.Close()
+
+	backendAddr, _ := url.Parse(backend.URL)
+
+	var authTokens []string
+	// This proxy tunnels every CONNECT to the backend
+	dialBackend := func(network, addr string) (net.Conn, error) {
+		return net.Dial(network, backendAddr.Host)
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		tokensMx.Lock()
+		authTokens = append(authTokens, req.Header.Get(authTokenHeader))
+		tokensMx.Unlock()
+		(&chained.Server{Dial: dialBackend}).ServeHTTP(resp, req)
+	}))
+	defer proxy.Close()
+	proxyAddr, _ := url.Parse(proxy.URL)
+
+	origServers, origDial, origLastGood := bootstrapServers, chainedDial, lastGoodBootstrapServer
+	defer func() {
+		bootstrapServers, chainedDial, lastGoodBootstrapServer = origServers, origDial, origLastGood
+	}()
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{
+			"broken":  &client.ChainedServerInfo{Addr: "127.0.0.1:1", AuthToken: "broken"},
+			"working": &client.ChainedServerInfo{Addr: proxyAddr.Host, AuthToken: "token"},
+		}
+	}
+	chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+		d := chained.NewDialer(chained.Config{
+			DialServer: func() (net.Conn, error) {
+				return net.Dial("tcp", server.Addr)
+			},
+			OnRequest: func(req *http.Request) {
+				req.Header.Set(authTokenHeader, string(server.AuthToken))
+			},
+		})
+		return d.Dial, nil
+	}
+
+	// The chained dialer can't build CONNECT requests for bare IP addresses
+	b, err := fetchCloudConfig(context.Background(), "http://config.example.com/cloud.yaml.gz")
+	if assert.NoError(t, err) {
+		assert.Equal(t, body, string(b))
+	}
+	tokensMx.Lock()
+	assert.Equal(t, []string{"token"}, authTokens, "Should have authenticated with bootstrap server")
+	assert.Equal(t, []string{"token"}, fetchAuthTokens, "Should have sent bootstrap server's auth token with fetch")
+	tokensMx.Unlock()
+	assert.Equal(t, proxyAddr.Host, lastGoodBootstrapServer, "Should have remembered working bootstrap server")
+
+	clients := loadBootstrapHttpClients(bootstrapServers())
+	assert.Equal(t, proxyAddr.Host, clients[0].addr, "Last good bootstrap server should be tried first")
+}
+
+func TestFetchFailsWithoutBootstrapServers(t *testing.T) {
+	defer useTestFetcher()()
+	cf = &failingFetcher{}
+
+	origServers := bootstrapServers
+	defer func() {
+		bootstrapServers = origServers
+	}()
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{}
+	}
+
+	_, err := fetchCloudConfig(context.Background(), "http://localhost/cloud.yaml.gz")
+	assert.Error(t, err)
+}
+
+func TestBootstrapFallbackStaysWithinBudget(t *testing.T) {
+	defer useTestFetcher()()
+	cf = &failingFetcher{}
+
+	// Accepts connections but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	var connsMx sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			connsMx.Lock()
+			conns = append(conns, conn)
+			connsMx.Unlock()
+		}
+	}()
+	defer func() {
+		connsMx.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		connsMx.Unlock()
+	}()
+
+	origServers, origDial, origTimeout := bootstrapServers, chainedDial, bootstrapFallbackTimeout
+	defer func() {
+		bootstrapServers, chainedDial, bootstrapFallbackTimeout = origServers, origDial, origTimeout
+	}()
+	bootstrapFallbackTimeout = 300 * time.Millisecond
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{
+			"hanging-1": &client.ChainedServerInfo{Addr: "10.0.0.1:443"},
+			"hanging-2": &client.ChainedServerInfo{Addr: "10.0.0.2:443"},
+		}
+	}
+	chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+		return func(network, addr string) (net.Conn, error) {
+			return net.Dial("tcp", l.Addr().String())
+		}, nil
+	}
+
+	start := time.Now()
+	_, err = fetchCloudConfigViaBootstrap(context.Background(), "http://config.example.com/cloud.yaml.gz")
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "Timed out trying bootstrap servers"), err.Error())
+	}
+	assert.True(t, time.Since(start) < 5*time.Second, "Attempts should have been cut short at the end of the budget, took %v", time.Since(start))
+}
+
+func TestSystemProxyOnlyUsedForDirectFetches(t *testing.T) {
+	defer useTestFetcher()()
+	cf = &failingFetcher{}
+
+	// This proxy records what it's asked to CONNECT to and refuses
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		proxied = append(proxied, req.Method+" "+req.Host)
+		resp.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	origEnv := os.Getenv("HTTPS_PROXY")
+	os.Setenv("HTTPS_PROXY", proxy.URL)
+	defer os.Setenv("HTTPS_PROXY", origEnv)
+	origProxyFromEnvironment, origUseSystemProxy := proxyFromEnvironment, *useSystemProxyFlag
+	origServers, origDial := bootstrapServers, chainedDial
+	defer func() {
+		proxyFromEnvironment, *useSystemProxyFlag = origProxyFromEnvironment, origUseSystemProxy
+		bootstrapServers, chainedDial = origServers, origDial
+	}()
+	// http.ProxyFromEnvironment only reads the environment once per process
+	proxyFromEnvironment = func(req *http.Request) (*url.URL, error) {
+		return url.Parse(os.Getenv("HTTPS_PROXY"))
+	}
+
+	var bootstrapDials []string
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{
+			"bootstrap": &client.ChainedServerInfo{Addr: "127.0.0.1:1"},
+		}
+	}
+	chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+		return func(network, addr string) (net.Conn, error) {
+			bootstrapDials = append(bootstrapDials, addr)
+			return nil, fmt.Errorf("Bootstrap server unavailable")
+		}, nil
+	}
+
+	configUrl := "https://config.example.com/cloud.yaml.gz"
+	for _, enabled := range []bool{false, true} {
+		proxied, bootstrapDials = nil, nil
+		*useSystemProxyFlag = enabled
+		_, err := fetchCloudConfig(context.Background(), configUrl)
+		assert.Error(t, err)
+		assert.Equal(t, []string{"config.example.com:443"}, bootstrapDials, "Bootstrap servers should never be reached through system proxy")
+		if enabled {
+			assert.Equal(t, []string{"CONNECT config.example.com:443"}, proxied, "Direct fetch should have gone through system proxy")
+		} else {
+			assert.Empty(t, proxied, "Nothing should go through system proxy unless enabled")
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"strings"
+	"sync"
+)
+
+// Section is a part of the config that a part of Lantern reconfigures itself
+// for, which Subscribe can watch for changes.
+type Section int
+
+const (
+	// Changes that don't reconfigure anything outside of this package
+	bookkeeping Section = iota - 1
+	// ClientSection is the client config, like the chained servers or
+	// masquerades.
+	ClientSection
+	// ProxiedSitesSection is the proxied sites.
+	ProxiedSitesSection
+	// StatsSection is the stats reporting config.
+	StatsSection
+	// TrustedCAsSection is which CAs are trusted.
+	TrustedCAsSection
+	// OtherSection is everything outside of the other sections that isn't
+	// bookkeeping, like the server config or the UI address.
+	OtherSection
+	// FeaturesSection is which features are enabled, see FeatureEnabled.
+	FeaturesSection
+)
+
+var (
+	// The top level fields of Config in each section other than
+	// OtherSection. Fields that only the config package itself uses, like the
+	// poll intervals, and bookkeeping fields aren't in any section, so
+	// changing them doesn't reconfigure anything.
+	fieldSections = map[string]Section{
+		"Client":           ClientSection,
+		"ProxiedSites":     ProxiedSitesSection,
+		"Stats":            StatsSection,
+		"TrustedCAs":       TrustedCAsSection,
+		"IncludeSystemCAs": TrustedCAsSection,
+		"Features":         FeaturesSection,
+		"FeatureRollouts":  FeaturesSection,
+
+		"Version":              bookkeeping,
+		"SchemaVersion":        bookkeeping,
+		"Provenance":           bookkeeping,
+		"CloudConfigs":         bookkeeping,
+		"CpuProfile":           bookkeeping,
+		"MemProfile":           bookkeeping,
+		"VerifyMasquerades":    bookkeeping,
+		"CloudPollInterval":    bookkeeping,
+		"FilePollInterval":     bookkeeping,
+		"UseSystemProxy":       bookkeeping,
+		"DisableDoH":           bookkeeping,
+		"DoHResolvers":         bookkeeping,
+		"DNSConfigDomain":      bookkeeping,
+		"ConfigProxy":          bookkeeping,
+		"StaleConfigThreshold": bookkeeping,
+		"CloudProvenance":      bookkeeping,
+		"CloudCacheMaxAge":     bookkeeping,
+		"MovedCloudConfigs":    bookkeeping,
+		"HeadBeforeFetch":      bookkeeping,
+		"DryRunCloudUpdates":   bookkeeping,
+		"MaxProxiedSites":      bookkeeping,
+		"TruncateProxiedSites": bookkeeping,
+		"AllowProxiedIPs":      bookkeeping,
+		"KeepConfigVersions":   bookkeeping,
+		"KeepConfigBackups":    bookkeeping,
+		"Rollout":              bookkeeping,
+		"MinClientVersion":     bookkeeping,
+		"MeteredDownloadLimit": bookkeeping,
+		"MeteredMaxAge":        bookkeeping,
+		"LastCloudUpdate":      bookkeeping,
+		"LastCloudAttempt":     bookkeeping,
+		"LastCloudError":       bookkeeping,
+		"ClockSkew":            bookkeeping,
+		"CloudETags":           bookkeeping,
+		"CAOverlapWindow":      bookkeeping,
+		"LastMergeChecksum":    bookkeeping,
+
+		"UnhealthyRollbackWindow": bookkeeping,
+		"KeepCloudConfigs":        bookkeeping,
+
+		// Only takes effect with the next cloud config
+		"PreserveCustomServers": bookkeeping,
+		"UserID":                bookkeeping,
+		"UserToken":             bookkeeping,
+	}
+
+	subscribers   = make(map[Section][]func(old *Config, updated *Config))
+	subscribersMx sync.Mutex
+
+	// The Config that Init returned, which Run compares the first update to
+	applied *Config
+)
+
+// Subscribe registers a function that Run calls with the Config from before
+// and after each update that changes the given section, as found by diffing
+// them, so that subscribers don't tear down what an update didn't touch.
+// Updates to other sections, or that only change bookkeeping like when cloud
+// config was last fetched, don't call it.
+func Subscribe(section Section, onChanged func(old *Config, updated *Config)) {
+	subscribersMx.Lock()
+	subscribers[section] = append(subscribers[section], onChanged)
+	subscribersMx.Unlock()
+}
+
+// changedSections returns the sections that changed from before to after,
+// which is empty if only bookkeeping changed.
+func changedSections(before *Config, after *Config) (map[Section]bool, error) {
+	changed, err := diffConfigs(before, after)
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[Section]bool)
+	for _, entry := range changed {
+		field := strings.SplitN(strings.SplitN(entry, ":", 2)[0], ".", 2)[0]
+		section, found := fieldSections[field]
+		if !found {
+			section = OtherSection
+		}
+		if section != bookkeeping {
+			sections[section] = true
+		}
+	}
+	return sections, nil
+}
+
+// reconfigure calls the subscribers to each section that changed from before
+// to updated, in the order of the sections.
+func reconfigure(before *Config, updated *Config) {
+	sections, err := changedSections(before, updated)
+	if err != nil {
+		log.Errorf("Unable to tell what changed, reconfiguring everything: %v", err)
+		sections = map[Section]bool{ClientSection: true, ProxiedSitesSection: true, StatsSection: true, TrustedCAsSection: true, OtherSection: true, FeaturesSection: true}
+	}
+	if len(sections) == 0 {
+		log.Debug("Only bookkeeping changed, not reconfiguring")
+		return
+	}
+	subscribersMx.Lock()
+	var handlers []func(*Config, *Config)
+	for _, section := range []Section{ClientSection, ProxiedSitesSection, StatsSection, TrustedCAsSection, OtherSection, FeaturesSection} {
+		if sections[section] {
+			handlers = append(handlers, subscribers[section]...)
+		}
+	}
+	subscribersMx.Unlock()
+	for _, handler := range handlers {
+		handler(before, updated)
+	}
+}
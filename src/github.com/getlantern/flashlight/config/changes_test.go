@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/proxiedsites"
+)
+
+func TestReconfigureOnlyWhatChanged(t *testing.T) {
+	base := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\nproxiedsites:\n  cloud:\n  - a.com\n"
+	fromCloud := func(updates ...string) *Config {
+		cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+		for _, update := range updates {
+			if err := cfg.updateFrom([]byte(update)); err != nil {
+				t.Fatalf("Unable to update config: %v", err)
+			}
+		}
+		return cfg
+	}
+
+	var fired []string
+	record := func(name string) func(*Config, *Config) {
+		return func(*Config, *Config) {
+			fired = append(fired, name)
+		}
+	}
+	Subscribe(ClientSection, record("servers"))
+	Subscribe(ProxiedSitesSection, record("proxiedsites"))
+	Subscribe(StatsSection, record("stats"))
+	Subscribe(OtherSection, record("other"))
+	defer func() {
+		subscribers = make(map[Section][]func(*Config, *Config))
+	}()
+
+	before := fromCloud(base)
+	var old, updated *Config
+	Subscribe(ProxiedSitesSection, func(o *Config, u *Config) {
+		old, updated = o, u
+	})
+	after := fromCloud(base, "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\nproxiedsites:\n  cloud:\n  - a.com\n  - b.com\n")
+	reconfigure(before, after)
+	assert.Equal(t, []string{"proxiedsites"}, fired, "Proxied sites only cloud update should only reconfigure proxied sites")
+	assert.True(t, before == old, "Subscribers should get the config from before the update")
+	assert.True(t, after == updated, "Subscribers should get the updated config")
+
+	fired = nil
+	after = fromCloud(base)
+	after.LastCloudUpdate = "2015-06-01T00:00:00Z"
+	after.CloudProvenance = cloudProvenanceFetched
+	after.Version = before.Version + 1
+	reconfigure(before, after)
+	assert.Empty(t, fired, "Bookkeeping changes should not reconfigure anything")
+
+	fired = nil
+	after = fromCloud(base, "client:\n  chainedservers:\n    fallback-2:\n      addr: 2.2.2.2:443\n")
+	after.UIAddr = "127.0.0.1:16823"
+	reconfigure(before, after)
+	assert.Equal(t, []string{"servers", "other"}, fired, "Changes outside of the sections should go to OtherSection")
+
+	fired = nil
+	reconfigure(before, fromCloud(base+fmt.Sprintf("trustedcas:\n- commonname: ca-1\n  cert: %q\n", defaultTrustedCAs[0].Cert)))
+	assert.Empty(t, fired, "Sections nobody subscribed to should not call anything")
+}
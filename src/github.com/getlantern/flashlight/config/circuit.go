@@ -0,0 +1,146 @@
+package config
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitFailureThreshold is how many fetches from a URL in a row have to
+	// fail before we stop fetching from it for a while.
+	circuitFailureThreshold = 3
+
+	// minCircuitOpenTime and maxCircuitOpenTime bound how long we stop
+	// fetching from a failing URL, which doubles each time a probe fails.
+	minCircuitOpenTime = 5 * time.Minute
+	maxCircuitOpenTime = 6 * time.Hour
+
+	// States of circuits
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+var (
+	circuits = newCircuitBreaker()
+)
+
+// URLFetchState is a snapshot of how fetching from one config URL has been
+// going, for diagnostics.
+type URLFetchState struct {
+	URL                 string    // The URL, without any credentials
+	ConsecutiveFailures int       // How many fetches have failed since the last success
+	Circuit             string    // closed if we fetch normally, open if we've stopped fetching for a while or half-open if the next fetch is a probe
+	NextAttempt         time.Time // When we'll fetch again if the circuit is open
+	LastError           string    // Why the last fetch failed, if it did
+}
+
+// circuitBreaker keeps track of fetches from each config URL separately, so
+// that one that keeps failing only slows down fetches from itself. After
+// circuitFailureThreshold failures in a row, we stop fetching from a URL until
+// it's time for a single probe, which closes the circuit again if it works and
+// keeps it open for twice as long if it doesn't.
+type circuitBreaker struct {
+	urls map[string]*urlCircuit
+	mx   sync.Mutex
+}
+
+type urlCircuit struct {
+	failures    int
+	openFor     time.Duration
+	nextAttempt time.Time
+	lastError   string
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{urls: make(map[string]*urlCircuit)}
+}
+
+// allow returns whether we may fetch from the given URL at the given time,
+// and if not, when we may.
+func (b *circuitBreaker) allow(url string, now time.Time) (bool, time.Time) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	c := b.urls[url]
+	if c == nil || c.nextAttempt.IsZero() || !now.Before(c.nextAttempt) {
+		return true, time.Time{}
+	}
+	return false, c.nextAttempt
+}
+
+// record records the outcome of fetching from the given URL at the given
+// time, which failed if err is not nil.
+func (b *circuitBreaker) record(url string, now time.Time, err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	c := b.urls[url]
+	if c == nil {
+		c = &urlCircuit{}
+		b.urls[url] = c
+	}
+	if err == nil {
+		if c.state() != circuitClosed {
+			log.Debugf("Closed circuit for %v", withoutCredentials(url))
+		}
+		*c = urlCircuit{}
+		return
+	}
+	c.failures++
+	c.lastError = redactURLCredentials(err.Error())
+	if c.failures < circuitFailureThreshold {
+		return
+	}
+	switch {
+	case c.openFor == 0:
+		c.openFor = minCircuitOpenTime
+	case c.openFor*2 > maxCircuitOpenTime:
+		c.openFor = maxCircuitOpenTime
+	default:
+		c.openFor *= 2
+	}
+	c.nextAttempt = now.Add(c.openFor)
+	log.Debugf("Opened circuit for %v after %d failures, next attempt in %v", withoutCredentials(url), c.failures, c.openFor)
+}
+
+// states returns the states of the URLs we've fetched from at the given
+// time, sorted by URL.
+func (b *circuitBreaker) states(now time.Time) []URLFetchState {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	states := make([]URLFetchState, 0, len(b.urls))
+	for url, c := range b.urls {
+		state := URLFetchState{
+			URL:                 withoutCredentials(url),
+			ConsecutiveFailures: c.failures,
+			Circuit:             c.state(),
+			LastError:           c.lastError,
+		}
+		if state.Circuit == circuitOpen {
+			if now.Before(c.nextAttempt) {
+				state.NextAttempt = c.nextAttempt
+			} else {
+				state.Circuit = circuitHalfOpen
+			}
+		}
+		states = append(states, state)
+	}
+	sort.Sort(byURL(states))
+	return states
+}
+
+// state returns the state of the circuit, not counting whether it's time for
+// a probe.
+func (c *urlCircuit) state() string {
+	if c.nextAttempt.IsZero() {
+		return circuitClosed
+	}
+	return circuitOpen
+}
+
+// byURL implements sort.Interface for []URLFetchState based on the URL
+type byURL []URLFetchState
+
+func (a byURL) Len() int           { return len(a) }
+func (a byURL) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byURL) Less(i, j int) bool { return a[i].URL < a[j].URL }
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// defaultKeepConfigVersions is how many versioned config files we keep,
+	// counting the running version's, when the config doesn't say.
+	defaultKeepConfigVersions = 3
+
+	// defaultKeepConfigBackups is how many backups we keep of each config
+	// file we keep when the config doesn't say.
+	defaultKeepConfigBackups = 2
+
+	// backupInfix is what separates a config file's name from the schema
+	// version in the names of its backups, see migrateFile.
+	backupInfix  = ".schema"
+	backupSuffix = ".bak"
+)
+
+// cleanupConfigDir removes the config files that older versions of Lantern
+// left in the config dir, which contain old auth tokens among other things,
+// keeping those of the most recent versions up to the running one in case
+// the user downgrades. It also removes backups of the config files it
+// removes and all but the most recent backups of the others. Files from
+// versions newer than the running one and files we can't positively identify
+// as ours, by their name and by their parsing as YAML, are never removed.
+// The -no-config-cleanup flag turns this off.
+func cleanupConfigDir(dir string, version string, cfg *Config) {
+	if *noConfigCleanup {
+		log.Debug("Not cleaning up config dir")
+		return
+	}
+	keepVersions, keepBackups := defaultKeepConfigVersions, defaultKeepConfigBackups
+	if cfg != nil && cfg.KeepConfigVersions > 0 {
+		keepVersions = cfg.KeepConfigVersions
+	}
+	if cfg != nil && cfg.KeepConfigBackups > 0 {
+		keepBackups = cfg.KeepConfigBackups
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Unable to clean up config dir: %v", err)
+		return
+	}
+
+	running := parseVersion(version)
+	versions := make([]string, 0)
+	// Backups by the name of the config they're of, then by schema version
+	backups := make(map[string]map[int]string)
+	// Config files of which the previous version was kept when saving them
+	var previous []string
+	kept := make(map[string]bool)
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		name := file.Name()
+		if configName, schema, ok := backupOf(name); ok {
+			if backups[configName] == nil {
+				backups[configName] = make(map[int]string)
+			}
+			backups[configName][schema] = name
+		} else if configName, ok := previousVersionOf(name); ok {
+			previous = append(previous, configName)
+		} else if fileVersion, ok := versionOfConfigFile(name); ok {
+			if v := parseVersion(fileVersion); !v.valid || v.compare(running) > 0 {
+				// Not versioned, like lantern-local.yaml, or a newer version's
+				kept[name] = true
+			} else {
+				versions = append(versions, fileVersion)
+			}
+		}
+	}
+
+	sortVersionsNewestFirst(versions)
+	for i, fileVersion := range versions {
+		name := configFileName(fileVersion)
+		if i < keepVersions || !removeConfigFile(dir, name) {
+			kept[name] = true
+		}
+	}
+
+	for _, configName := range previous {
+		configVersion, _ := versionOfConfigFile(configName)
+		if !kept[configName] && parseVersion(configVersion).compare(running) <= 0 {
+			// Orphaned
+			removeConfigFile(dir, configName+yamlconf.BackupSuffix)
+		}
+	}
+
+	for configName, bySchema := range backups {
+		configVersion, _ := versionOfConfigFile(configName)
+		if parseVersion(configVersion).compare(running) > 0 {
+			continue
+		}
+		limit := keepBackups
+		if !kept[configName] {
+			// Orphaned
+			limit = 0
+		}
+		schemas := make([]int, 0, len(bySchema))
+		for schema := range bySchema {
+			schemas = append(schemas, schema)
+		}
+		// Most recent migration first
+		sort.Sort(sort.Reverse(sort.IntSlice(schemas)))
+		for i, schema := range schemas {
+			if i >= limit {
+				removeConfigFile(dir, bySchema[schema])
+			}
+		}
+	}
+}
+
+// previousVersionOf returns the name of the config file of which the file
+// with the given name is the previous version, kept by the config file store
+// when saving it, or false if it's not one.
+func previousVersionOf(name string) (string, bool) {
+	if !strings.HasSuffix(name, yamlconf.BackupSuffix) {
+		return "", false
+	}
+	configName := strings.TrimSuffix(name, yamlconf.BackupSuffix)
+	if _, ok := versionOfConfigFile(configName); !ok {
+		return "", false
+	}
+	return configName, true
+}
+
+// backupOf returns the name of the config file of which the file with the
+// given name is a backup, along with the schema version from which the config
+// was migrated, or false if it's not a backup.
+func backupOf(name string) (string, int, bool) {
+	if !strings.HasSuffix(name, backupSuffix) {
+		return "", 0, false
+	}
+	i := strings.LastIndex(name, backupInfix)
+	if i < 0 {
+		return "", 0, false
+	}
+	schema, err := strconv.Atoi(strings.TrimSuffix(name[i+len(backupInfix):], backupSuffix))
+	if err != nil {
+		return "", 0, false
+	}
+	configName := name[:i]
+	if _, ok := versionOfConfigFile(configName); !ok {
+		return "", 0, false
+	}
+	return configName, schema, true
+}
+
+// removeConfigFile removes the file with the given name from the given dir if
+// it's one of our configs, returning whether it did.
+func removeConfigFile(dir string, name string) bool {
+	path := filepath.Join(dir, name)
+	if !isOurConfig(path) {
+		log.Debugf("Not removing %v, which doesn't look like a config", path)
+		return false
+	}
+	if err := os.Remove(path); err != nil {
+		log.Errorf("Unable to remove stale config file: %v", err)
+		return false
+	}
+	log.Debugf("Removed stale config file %v", path)
+	return true
+}
+
+// isOurConfig returns whether the file at the given path is a config we
+// wrote, either encrypted or as YAML.
+func isOurConfig(path string) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if isEncrypted(data) {
+		return true
+	}
+	data, err = flattenDocuments(data)
+	if err != nil {
+		return false
+	}
+	tree := make(map[string]interface{})
+	return yaml.Unmarshal(data, &tree) == nil && len(tree) > 0
+}
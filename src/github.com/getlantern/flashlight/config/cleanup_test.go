@@ -0,0 +1,162 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// populateConfigDir fills the given dir with the files that years of upgrades
+// might leave behind, along with some that aren't ours.
+func populateConfigDir(t *testing.T, dir string) {
+	config := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n      authtoken: old-token\n"
+	files := map[string]string{
+		"lantern-2.1.0.yaml":             config,
+		"lantern-2.0.10.yaml":            config,
+		"lantern-2.0.9.yaml":             config,
+		"lantern-2.0.1.yaml":             config,
+		"lantern-1.5.0.yaml":             config,
+		"lantern-1.0.0.yaml":             encryptedHeader + "sealed",
+		"lantern-2.0.0.yaml":             "Not a config: [",
+		"lantern-3.0.0.yaml":             config,
+		"lantern-2.1.1-beta1.yaml":       config,
+		"lantern-local.yaml":             config,
+		"lantern-2.1.0.yaml.schema0.bak": config,
+		"lantern-2.1.0.yaml.schema1.bak": config,
+		"lantern-2.1.0.yaml.schema2.bak": config,
+		"lantern-2.0.1.yaml.schema0.bak": config,
+		"lantern-1.4.0.yaml.schema0.bak": config,
+		"lantern-3.0.0.yaml.schema0.bak": config,
+		"lantern-3.0.0.yaml.schema1.bak": config,
+		"lantern-3.0.0.yaml.schema2.bak": config,
+		"lantern-2.0.1.yaml.tmp":         config,
+		"lantern-2.1.0.yaml.bak":         config,
+		"lantern-1.5.0.yaml.bak":         config,
+		"lantern-1.2.0.yaml.bak":         config,
+		"lantern-3.0.0.yaml.bak":         config,
+		"cloud-cache.yaml.gz":            "cache",
+		"config-history.jsonl":           "{}\n",
+		"notes.txt":                      config,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "lantern-0.9.0.yaml"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func filesIn(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCleanupConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	populateConfigDir(t, dir)
+
+	cleanupConfigDir(dir, "2.1.0", &Config{})
+	assert.Equal(t, []string{
+		"cloud-cache.yaml.gz",
+		"config-history.jsonl",
+		"lantern-0.9.0.yaml",
+		// Not ours
+		"lantern-2.0.0.yaml",
+		"lantern-2.0.1.yaml.tmp",
+		// The most recent versions up to the running one
+		"lantern-2.0.10.yaml",
+		"lantern-2.0.9.yaml",
+		"lantern-2.1.0.yaml",
+		// The previous version of the running version's
+		"lantern-2.1.0.yaml.bak",
+		// The most recent backups
+		"lantern-2.1.0.yaml.schema1.bak",
+		"lantern-2.1.0.yaml.schema2.bak",
+		// Newer than the running version
+		"lantern-2.1.1-beta1.yaml",
+		"lantern-3.0.0.yaml",
+		"lantern-3.0.0.yaml.bak",
+		"lantern-3.0.0.yaml.schema0.bak",
+		"lantern-3.0.0.yaml.schema1.bak",
+		"lantern-3.0.0.yaml.schema2.bak",
+		"lantern-local.yaml",
+		"notes.txt",
+	}, filesIn(t, dir))
+}
+
+func TestCleanupConfigDirRetention(t *testing.T) {
+	dir := t.TempDir()
+	populateConfigDir(t, dir)
+
+	cleanupConfigDir(dir, "2.1.0", &Config{KeepConfigVersions: 1, KeepConfigBackups: 3})
+	assert.Equal(t, []string{
+		"cloud-cache.yaml.gz",
+		"config-history.jsonl",
+		"lantern-0.9.0.yaml",
+		"lantern-2.0.0.yaml",
+		"lantern-2.0.1.yaml.tmp",
+		"lantern-2.1.0.yaml",
+		"lantern-2.1.0.yaml.bak",
+		"lantern-2.1.0.yaml.schema0.bak",
+		"lantern-2.1.0.yaml.schema1.bak",
+		"lantern-2.1.0.yaml.schema2.bak",
+		"lantern-2.1.1-beta1.yaml",
+		"lantern-3.0.0.yaml",
+		"lantern-3.0.0.yaml.bak",
+		"lantern-3.0.0.yaml.schema0.bak",
+		"lantern-3.0.0.yaml.schema1.bak",
+		"lantern-3.0.0.yaml.schema2.bak",
+		"lantern-local.yaml",
+		"notes.txt",
+	}, filesIn(t, dir))
+}
+
+func TestNoConfigCleanup(t *testing.T) {
+	dir := t.TempDir()
+	populateConfigDir(t, dir)
+	before := filesIn(t, dir)
+	*noConfigCleanup = true
+	defer func() {
+		*noConfigCleanup = false
+	}()
+
+	cleanupConfigDir(dir, "2.1.0", &Config{})
+	assert.Equal(t, before, filesIn(t, dir))
+}
+
+func TestInitCleansUpConfigDir(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+	for _, version := range []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, configFileName(version)), []byte("client:\n  chainedservers: {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	Stop()
+	names := filesIn(t, dir)
+	assert.Contains(t, names, configFileName("2.1.0"))
+	assert.Contains(t, names, configFileName("1.3.0"))
+	assert.Contains(t, names, configFileName("1.2.0"))
+	assert.NotContains(t, names, configFileName("1.1.0"))
+	assert.NotContains(t, names, configFileName("1.0.0"))
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Many of our users have system clocks that are off by hours or even years, so
+// we don't trust the wall clock for anything that matters. Polling and how
+// long it's been since cloud config was fetched this session are measured
+// with the monotonic clock, which time.Now includes and which is unaffected by
+// the wall clock being wrong or changed. Times that we save, like when cloud
+// config was last fetched, are corrected by how far our clock is off from the
+// Date headers of cloud config responses, so that they can be compared in
+// later sessions even if the clock has been fixed in between.
+
+const (
+	// minClockSkew is how far our clock has to be off before we correct for
+	// it, so that network latency and the one second resolution of Date
+	// headers don't make us jitter.
+	minClockSkew = time.Minute
+)
+
+var (
+	// wallClock returns the current time, including a monotonic clock reading.
+	// Tests replace it to simulate wrong clocks.
+	wallClock = time.Now
+
+	clockSkews   = make(map[string]time.Duration)
+	lastSkew     *time.Duration
+	clockSkewsMx sync.Mutex
+)
+
+// URLClockSkew is how far ahead of our clock the server at a config URL was,
+// going by the Date header of its last response.
+type URLClockSkew struct {
+	URL  string        // The URL, without any credentials
+	Skew time.Duration // Negative if the server's clock was behind ours
+}
+
+// recordClockSkew records how far ahead of our clock at the given time the
+// given Date header of a response from the given URL is.
+func recordClockSkew(url string, date string, received time.Time) {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	skew := serverTime.Sub(received).Round(time.Second)
+	if skew > -minClockSkew && skew < minClockSkew {
+		skew = 0
+	}
+	clockSkewsMx.Lock()
+	defer clockSkewsMx.Unlock()
+	if previous, found := clockSkews[url]; !found || previous != skew {
+		log.Debugf("Clock is off by %v from %v", skew, withoutCredentials(url))
+	}
+	clockSkews[url] = skew
+	lastSkew = &skew
+}
+
+// estimatedClockSkew returns how far our clock is off, going by the last
+// response to a fetch this session or, failing that, by what was saved in
+// this Config.
+func (cfg *Config) estimatedClockSkew() time.Duration {
+	clockSkewsMx.Lock()
+	defer clockSkewsMx.Unlock()
+	if lastSkew != nil {
+		return *lastSkew
+	}
+	return cfg.ClockSkew
+}
+
+// correctedNow returns the current time corrected by how far our clock is off,
+// for comparing with and saving as times that outlive this session.
+func (cfg *Config) correctedNow() time.Time {
+	return wallClock().Add(cfg.estimatedClockSkew())
+}
+
+// clockSkewStates returns the clock skews we've seen for each URL, sorted by
+// URL.
+func clockSkewStates() []URLClockSkew {
+	clockSkewsMx.Lock()
+	defer clockSkewsMx.Unlock()
+	states := make([]URLClockSkew, 0, len(clockSkews))
+	for url, skew := range clockSkews {
+		states = append(states, URLClockSkew{withoutCredentials(url), skew})
+	}
+	sort.Sort(bySkewURL(states))
+	return states
+}
+
+// forgetClockSkews forgets the clock skews we've seen this session.
+func forgetClockSkews() {
+	clockSkewsMx.Lock()
+	clockSkews = make(map[string]time.Duration)
+	lastSkew = nil
+	clockSkewsMx.Unlock()
+}
+
+// bySkewURL implements sort.Interface for []URLClockSkew based on the URL
+type bySkewURL []URLClockSkew
+
+func (a bySkewURL) Len() int           { return len(a) }
+func (a bySkewURL) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a bySkewURL) Less(i, j int) bool { return a[i].URL < a[j].URL }
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	cloudCacheName = "cloud-cache.yaml.gz"
+
+	// defaultCloudCacheMaxAge is how old the cached cloud config can be for us
+	// to use it when we don't have any cloud settings.
+	defaultCloudCacheMaxAge = 7 * 24 * time.Hour
+)
+
+var (
+	// A cached cloud config that was too old to use as is, which we use once
+	// the first fetch finds that it's still current
+	staleCloudCache   []byte
+	staleCloudCacheMx sync.Mutex
+)
+
+// cloudCachePath returns the path of the cache of the last cloud config we
+// fetched.
+func cloudCachePath() (string, error) {
+	_, path, err := InConfigDir(cloudCacheName)
+	return path, err
+}
+
+// saveCloudCache caches the given cloud config payload, which was fetched at
+// the given time with the given ETag.
+func saveCloudCache(payload []byte, etag string, fetched time.Time) error {
+	path, err := cloudCachePath()
+	if err != nil {
+		return err
+	}
+	if err := writeCloudPayload(path, payload, etag, fetched); err != nil {
+		return err
+	}
+	log.Debugf("Cached cloud config at %v", path)
+	return nil
+}
+
+// loadCloudCache loads the cached cloud config payload along with the ETag
+// and time with which it was fetched.
+func loadCloudCache() (payload []byte, etag string, fetched time.Time, err error) {
+	path, err := cloudCachePath()
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return readCloudPayload(path)
+}
+
+// writeCloudPayload saves the given cloud config payload, which was fetched at
+// the given time with the given ETag, to the file at path. The ETag and time
+// are kept in the gzip header. The file is replaced atomically, so it's never
+// left half written.
+func writeCloudPayload(path string, payload []byte, etag string, fetched time.Time) error {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	gzWriter.Comment = etag
+	gzWriter.ModTime = fetched
+	if _, err := gzWriter.Write(payload); err != nil {
+		return fmt.Errorf("Unable to compress cloud config: %v", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return fmt.Errorf("Unable to compress cloud config: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("Unable to create temp file for %v: %v", filepath.Base(path), err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Unable to write %v: %v", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Unable to replace %v: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// readCloudPayload reads a cloud config payload saved by writeCloudPayload
+// along with the ETag and time with which it was fetched.
+func readCloudPayload(path string) (payload []byte, etag string, fetched time.Time, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("Unable to open %v: %v", filepath.Base(path), err)
+	}
+	payload, err = ioutil.ReadAll(gzReader)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("Unable to read %v: %v", filepath.Base(path), err)
+	}
+	return payload, gzReader.Comment, gzReader.ModTime, nil
+}
+
+// applyCloudCache merges the cached cloud config into this Config if it has
+// no cloud settings of its own, for example after a reinstall or after
+// recovering from a corrupt config, and the cache is younger than
+// CloudCacheMaxAge. The Config is treated as last updated when the cache was
+// fetched, so the staleness watchdog judges it by the cache's age.
+func (cfg *Config) applyCloudCache(now time.Time) error {
+	if cfg.LastCloudUpdate != "" || cfg.CloudProvenance != "" {
+		return nil
+	}
+	payload, cachedETag, fetched, err := loadCloudCache()
+	if os.IsNotExist(err) {
+		log.Debugf("No cached cloud config")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	maxAge := cfg.CloudCacheMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultCloudCacheMaxAge
+	}
+	if age := now.Sub(fetched); age > maxAge {
+		if cachedETag == "" {
+			log.Debugf("Not using cached cloud config from %v ago", age)
+			return nil
+		}
+		// A new version of Lantern may have been installed long after the
+		// last one ran. Rather than downloading the whole cloud config again,
+		// we ask whether the cached one is still current.
+		log.Debugf("Cached cloud config from %v ago is too old to use as is, checking whether it's still current", age)
+		holdStaleCloudCache(payload, cachedETag)
+		lastCloudConfigIdentity[chainedCloudConfigUrl] = cfg.cloudConfigIdentity()
+		return nil
+	}
+	log.Debugf("Merging cached cloud configuration from %v", fetched)
+	cfg.CloudProvenance = cloudProvenanceCached
+	if err := cfg.updateFrom(payload); err != nil {
+		cfg.CloudProvenance = ""
+		return fmt.Errorf("Rejected cached cloud config: %v", err)
+	}
+	cfg.LastCloudUpdate = fetched.UTC().Format(time.RFC3339)
+	if cachedETag != "" {
+		lastCloudConfigETag[chainedCloudConfigUrl] = cachedETag
+		lastCloudConfigPayload[chainedCloudConfigUrl] = payload
+		lastCloudConfigIdentity[chainedCloudConfigUrl] = cfg.cloudConfigIdentity()
+	}
+	return nil
+}
+
+// holdStaleCloudCache keeps the given cached cloud config, which was fetched
+// with the given ETag, and makes the next fetch conditional on it, so that if
+// it's still current, takeStaleCloudCache gives it back instead of us
+// downloading it again.
+func holdStaleCloudCache(payload []byte, etag string) {
+	staleCloudCacheMx.Lock()
+	staleCloudCache = payload
+	staleCloudCacheMx.Unlock()
+	lastCloudConfigETag[chainedCloudConfigUrl] = etag
+	// Also catch servers that answer with the same config rather than a 304
+	lastCloudConfigChecksum[chainedCloudConfigUrl] = sha256.Sum256(payload)
+}
+
+// takeStaleCloudCache returns the cached cloud config held by
+// holdStaleCloudCache, if any, and stops holding it.
+func takeStaleCloudCache() []byte {
+	staleCloudCacheMx.Lock()
+	defer staleCloudCacheMx.Unlock()
+	payload := staleCloudCache
+	staleCloudCache = nil
+	return payload
+}
+
+// applyRevalidatedCloudCache merges the given cached cloud config, which a
+// fetch at the given time found to still be current, into this Config, and
+// refreshes the cache.
+func (cfg *Config) applyRevalidatedCloudCache(payload []byte, etag string, fetched time.Time) {
+	log.Debugf("Cached cloud config is still current, merging it")
+	cfg.CloudProvenance = cloudProvenanceCached
+	if err := cfg.updateFrom(payload); err != nil {
+		cfg.CloudProvenance = ""
+		reportError(ParseError, fmt.Errorf("Rejected cached cloud config: %v", err), false)
+		return
+	}
+	if err := saveCloudCache(payload, etag, fetched); err != nil {
+		log.Errorf("Unable to refresh cloud config cache: %v", err)
+	}
+}
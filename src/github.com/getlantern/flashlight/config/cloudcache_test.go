@@ -0,0 +1,156 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestPollCachesCloudConfig(t *testing.T) {
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")()
+	defer useTestFetcher()()
+
+	body := "client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set(etag, "etag-1")
+		resp.Write(gzipped(t, body))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+
+	before := time.Now().Add(-1 * time.Second)
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+	payload, cachedETag, fetched, err := loadCloudCache()
+	if assert.NoError(t, err) {
+		assert.Equal(t, body, string(payload))
+		assert.Equal(t, "etag-1", cachedETag)
+		assert.True(t, fetched.After(before), "Cache should record when config was fetched")
+	}
+}
+
+func TestInitUsesCloudCacheOffline(t *testing.T) {
+	defer useTestFetcher()()
+	defer useTempConfigDir(t)()
+
+	initWithCache := func(fetched time.Time) *Config {
+		if !assert.NoError(t, saveCloudCache([]byte("client:\n  chainedservers:\n    cached-1:\n      addr: 1.1.1.1:443\n"), "etag-1", fetched)) {
+			return nil
+		}
+		// There's no config file, as after a reinstall
+		_, path, _ := InConfigDir(configFileName("2.1.0"))
+		os.Remove(path)
+		cfg, err := Init("2.1.0")
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		Stop()
+		return cfg
+	}
+
+	fetched := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+	cfg := initWithCache(fetched)
+	if assert.NotNil(t, cfg) {
+		assert.NotNil(t, cfg.Client.ChainedServers["cached-1"], "Cached servers should be in config")
+		assert.Equal(t, cloudProvenanceCached, cfg.CloudProvenance)
+		lastUpdate, _, _ := CloudUpdateStatus()
+		assert.True(t, lastUpdate.Equal(fetched), "Config should be as old as the cache")
+		assert.Equal(t, "etag-1", lastCloudConfigETag[chainedCloudConfigUrl], "Cached ETag should be used for the next fetch")
+	}
+
+	cfg = initWithCache(time.Now().Add(-2 * defaultCloudCacheMaxAge))
+	if assert.NotNil(t, cfg) {
+		assert.Nil(t, cfg.Client.ChainedServers["cached-1"], "Old cache should not be used")
+		assert.Empty(t, cfg.CloudProvenance)
+	}
+}
+
+// initAfterUpgrade simulates the first run of a new version of Lantern long
+// after the last one ran, with the cloud config it cached, fetched with the
+// ETag of the given server's current config, in the config dir. It returns the
+// number of requests the server has seen beforehand.
+func initAfterUpgrade(t *testing.T, srv *configtest.CloudConfigServer, cached string) int {
+	resp, err := http.Get(srv.ConfigURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	dir := t.TempDir()
+	*configdir = dir
+	if err := ioutil.WriteFile(filepath.Join(dir, configFileName("1.0.0")), []byte("client:\n  chainedservers: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCloudCache([]byte(cached), resp.Header.Get(etag), time.Now().Add(-2*defaultCloudCacheMaxAge)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Init("2.1.0",
+		WithConfigDir(dir),
+		WithCloudConfigURLs(srv.ConfigURL(), ""),
+		WithBootstrapServers(noBootstrapServers),
+		WithHTTPFetcher(&http.Client{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, cfg.CloudProvenance, "Old cache should not be used before it's checked")
+	return srv.Requests()
+}
+
+func TestUpgradeRevalidatesOldCloudCache(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	yml := "client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n"
+	srv := configtest.NewCloudConfigServer(yml)
+	defer srv.Close()
+	requestsBefore := initAfterUpgrade(t, srv, yml)
+	defer Stop()
+
+	before := time.Now().Add(-1 * time.Second)
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+	assert.Equal(t, 1, srv.Requests()-requestsBefore)
+	assert.Equal(t, 1, srv.NotModified(), "Should not have downloaded the config again")
+	cfg := current()
+	assert.NotNil(t, cfg.Client.ChainedServers["cloud-1"], "Cached config should have been applied")
+	assert.Equal(t, cloudProvenanceCached, cfg.CloudProvenance)
+	lastUpdate, _, _ := CloudUpdateStatus()
+	assert.True(t, lastUpdate.After(before), "Config should be as fresh as the check")
+	_, _, fetched, err := loadCloudCache()
+	if assert.NoError(t, err) {
+		assert.True(t, fetched.After(before), "Cache should have been refreshed")
+	}
+}
+
+func TestUpgradeDownloadsChangedCloudConfig(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n")
+	defer srv.Close()
+	requestsBefore := initAfterUpgrade(t, srv, "client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n")
+	defer Stop()
+	srv.SetConfig("client:\n  chainedservers:\n    cloud-2:\n      addr: 2.2.2.2:443\n")
+
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+	assert.Equal(t, 1, srv.Requests()-requestsBefore)
+	assert.Equal(t, 0, srv.NotModified())
+	cfg := current()
+	assert.Nil(t, cfg.Client.ChainedServers["cloud-1"], "Outdated cache should not have been applied")
+	assert.NotNil(t, cfg.Client.ChainedServers["cloud-2"])
+	assert.Equal(t, cloudProvenanceFetched, cfg.CloudProvenance)
+}
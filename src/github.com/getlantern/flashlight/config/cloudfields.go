@@ -0,0 +1,113 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+var (
+	// The fields of Config that cloud config manages. updateFrom leaves the
+	// rest, like the user's preferences and our own bookkeeping, as they
+	// were, whatever the update says about them.
+	cloudFields = map[string]bool{
+		"CloudConfigs":      true,
+		"CloudConfigCA":     true,
+		"CloudPollInterval": true,
+		"DNSConfigDomain":   true,
+		"Client":            true,
+		"ProxiedSites":      true,
+		"TrustedCAs":        true,
+		"Rollout":           true,
+		"VerifyMasquerades": true,
+		"MinClientVersion":  true,
+		"Features":          true,
+		"FeatureRollouts":   true,
+	}
+
+	// The fields of Client that cloud config manages
+	cloudClientFields = map[string]bool{
+		"FrontedServers":       true,
+		"ChainedServers":       true,
+		"MasqueradeSets":       true,
+		"DefaultMasqueradeSet": true,
+	}
+
+	// The fields of ProxiedSites that cloud config manages, leaving the
+	// user's Delta alone
+	cloudProxiedSitesFields = map[string]bool{
+		"Cloud": true,
+	}
+)
+
+// localFields holds the fields of a Config that cloud config doesn't manage
+// while an update is merged into it, see setAsideLocalFields.
+type localFields struct {
+	config       reflect.Value
+	client       reflect.Value
+	proxiedSites reflect.Value
+}
+
+// setAsideLocalFields zeroes the fields of this Config that cloud config
+// doesn't manage, returning them so that restoreLocalFields can put them back
+// once an update has been unmarshaled into this Config. Since they're zero in
+// between, anything the update set them to can be told apart from what we
+// had.
+func (cfg *Config) setAsideLocalFields() *localFields {
+	local := &localFields{config: setAside(cfg, cloudFields)}
+	if cfg.Client != nil {
+		local.client = setAside(cfg.Client, cloudClientFields)
+	}
+	if cfg.ProxiedSites != nil {
+		local.proxiedSites = setAside(cfg.ProxiedSites, cloudProxiedSitesFields)
+	}
+	return local
+}
+
+// restoreLocalFields puts back the fields set aside by setAsideLocalFields,
+// returning the YAML keys of those that the update tried to set, sorted by
+// where they appear in Config.
+func (cfg *Config) restoreLocalFields(local *localFields) []string {
+	ignored := restore(cfg, local.config, cloudFields, "")
+	if local.client.IsValid() && cfg.Client != nil {
+		ignored = append(ignored, restore(cfg.Client, local.client, cloudClientFields, "client.")...)
+	}
+	if local.proxiedSites.IsValid() && cfg.ProxiedSites != nil {
+		ignored = append(ignored, restore(cfg.ProxiedSites, local.proxiedSites, cloudProxiedSitesFields, "proxiedsites.")...)
+	}
+	return ignored
+}
+
+// setAside zeroes the exported fields of the struct pointed to by ptr that
+// aren't among the given managed ones, returning a struct of the same type
+// holding what they were.
+func setAside(ptr interface{}, managed map[string]bool) reflect.Value {
+	val := reflect.ValueOf(ptr).Elem()
+	saved := reflect.New(val.Type()).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.PkgPath != "" || managed[field.Name] {
+			continue
+		}
+		saved.Field(i).Set(val.Field(i))
+		val.Field(i).Set(reflect.Zero(field.Type))
+	}
+	return saved
+}
+
+// restore undoes setAside, returning the YAML keys, with the given prefix,
+// of the fields that were set in between.
+func restore(ptr interface{}, saved reflect.Value, managed map[string]bool, prefix string) []string {
+	var set []string
+	val := reflect.ValueOf(ptr).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.PkgPath != "" || managed[field.Name] {
+			continue
+		}
+		if !val.Field(i).IsZero() {
+			set = append(set, prefix+strings.ToLower(field.Name))
+		}
+		val.Field(i).Set(saved.Field(i))
+	}
+	return set
+}
@@ -1,20 +1,18 @@
 package config
 
 import (
-	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
-	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/getlantern/appdir"
+	"github.com/getlantern/deepcopy"
 	"github.com/getlantern/fronted"
 	"github.com/getlantern/golog"
 	"github.com/getlantern/keyman"
@@ -25,34 +23,85 @@ import (
 	"github.com/getlantern/flashlight/client"
 	"github.com/getlantern/flashlight/server"
 	"github.com/getlantern/flashlight/statreporter"
-	"github.com/getlantern/flashlight/util"
 )
 
 const (
 	CloudConfigPollInterval = 1 * time.Minute
-	cloudfront              = "cloudfront"
-	etag                    = "X-Lantern-Etag"
-	ifNoneMatch             = "X-Lantern-If-None-Match"
-	chainedCloudConfigUrl   = "http://config.getiantem.org/cloud.yaml.gz"
-
-	// This is over HTTP because proxies do not forward X-Forwarded-For with HTTPS
-	// and because we only support falling back to direct domain fronting through
-	// the local proxy for HTTP.
-	frontedCloudConfigUrl = "http://d2wi0vwulmtn99.cloudfront.net/cloud.yaml.gz"
+	// Bounds for configured poll intervals, so that a bad config can neither
+	// effectively disable polling nor spin the CPU.
+	minCloudPollInterval = 15 * time.Second
+	maxCloudPollInterval = 6 * time.Hour
+	maxCloudPollBackoff  = 1 * time.Hour
+	minFilePollInterval  = 1 * time.Second
+	maxFilePollInterval  = 1 * time.Minute
+	cloudfront           = "cloudfront"
+
+	// The addresses on which servers listen by default, which match the ports
+	// with which they register.
+	defaultServerAddr            = ":443"
+	defaultUnencryptedServerAddr = ":80"
+
+	// Defaults for servers that don't specify these. Zero isn't a meaningful
+	// setting for any of them: a server with zero weight is never picked and
+	// can't be balanced against other servers with zero weight, and the lowest
+	// QOS worth configuring explicitly is 1.
+	defaultServerQOS      = 5
+	defaultServerWeight   = 100
+	defaultRedialAttempts = 2
+
+	// Provenances of configs. Custom distributions mark their packaged config
+	// with provenanceCustom, while configs seeded from -bootstrap-url on the
+	// first run are marked with provenanceOperatorSeeded.
+	provenanceCustom         = "custom"
+	provenanceStandard       = "standard"
+	provenanceOperatorSeeded = "operator-seeded"
+
+	// configWriteInterval is the minimum time between writes of the config
+	// file, so that bursts of updates don't each rewrite it.
+	configWriteInterval = 5 * time.Second
 )
 
 var (
-	log                 = golog.LoggerFor("flashlight.config")
-	m                   *yamlconf.Manager
-	lastCloudConfigETag = map[string]string{}
-	r                   = regexp.MustCompile("\\d+\\.\\d+")
-	// Request the config via either chained servers or direct fronted servers.
-	cf = util.NewChainedAndFronted()
+	log = golog.LoggerFor("flashlight.config")
+	m   *yamlconf.Manager
+	// Where we fetch cloud config from, see WithCloudConfigURLs
+	chainedCloudConfigUrl = "http://config.getiantem.org/cloud.yaml.gz"
+	// How often to poll when the config doesn't say, see WithPollIntervals
+	defaultCloudPollInterval = CloudConfigPollInterval
+	defaultFilePollInterval  = yamlconf.DefaultFilePollInterval
+	// The config file, if we're keeping the config in one
+	configFile *yamlconf.FileStore
+	// The masquerade sets we know without being told, by name. We don't have
+	// any masquerades for cloudflare built in.
+	builtinMasqueradeSets = map[string][]*fronted.Masquerade{
+		cloudfront: cloudfrontMasquerades,
+	}
+	// Closed to stop adjusting server weights
+	stopReweighting     = make(chan struct{})
+	stopReweightingOnce sync.Once
+	// Held for the whole of each poll for cloud config, so that polls outside
+	// of the regular schedule don't overlap with it. Only polls take it.
+	pollingMx sync.Mutex
+	// Guards what polls know about the cloud configs they've fetched, like
+	// their ETags. Polls hold it except while fetching, which can take
+	// minutes, so anything else that changes that state takes it and then
+	// interrupts the fetch with interruptFetch rather than waiting on the
+	// network.
+	pollMx sync.Mutex
+	// Cancels the fetch of the poll in progress, if any, and is closed once
+	// that fetch returns. Guarded by pollMx.
+	cancelFetch context.CancelFunc
+	fetchDone   chan struct{}
+	// How many polls in a row failed to fetch cloud config, for backing off.
+	// Guarded by pollMx.
+	failedPolls int
 )
 
 type Config struct {
 	Version       int
-	CloudConfig   string
+	SchemaVersion int      // Version of the layout of this config, used for migrating old config files
+	Provenance    string   // Where this config was installed from, either custom, standard or operator-seeded, empty if it predates this setting
+	CloudConfigs  []string // Prioritized list of URLs from which to fetch cloud config
 	CloudConfigCA string
 	Addr          string
 	Role          string
@@ -64,18 +113,132 @@ type Config struct {
 	Client        *client.ClientConfig
 	ProxiedSites  *proxiedsites.Config // List of proxied site domains that get routed through Lantern rather than accessed directly
 	TrustedCAs    []*CA
+	AutoReport    *bool // Whether to report usage and debugging data, nil means not set by the user
+	AutoLaunch    *bool // Whether to launch Lantern on system startup, nil means not set by the user
+
+	PreserveCustomServers bool // Whether cloud config leaves the chained servers alone, set for configs installed from a custom distribution until cleared with Update
+
+	IncludeSystemCAs bool // Whether to trust the platform's root CAs in addition to TrustedCAs
+
+	CAOverlapWindow time.Duration // How long to keep trusting a CA after cloud config stops listing it, zero means 30 days
+
+	UnhealthyRollbackWindow time.Duration // How long a cloud config update can be reported unhealthy with MarkUnhealthy before we roll back to the last one confirmed healthy, zero means 15 minutes and negative never
+
+	// Who the user is, set with Update by the account subsystem so that cloud
+	// config can be tailored to them, like giving Pro users their own servers
+	UserID    int64
+	UserToken client.Secret
+
+	VerifyMasquerades bool // Whether to probe a sample of new masquerade sets from the cloud before using them
+
+	CloudPollInterval time.Duration // How often to poll for cloud config, zero means CloudConfigPollInterval. Polls back off while they fail.
+	FilePollInterval  time.Duration // How often to check the config file for changes where it can't be watched, zero means yamlconf.DefaultFilePollInterval
+
+	UseSystemProxy bool // Whether to fetch cloud config directly through the proxy in HTTP(S)_PROXY when the local proxy does not work
+
+	DisableDoH   bool     // Whether to skip resolving the cloud config host with DNS-over-HTTPS when fetching it directly
+	DoHResolvers []string // DNS-over-HTTPS resolvers (JSON API) to race when resolving the cloud config host, defaults to well-known public resolvers
+
+	DNSConfigDomain string // Domain under which cloud config is also published in DNS TXT records, fetched over DoH when fetching over HTTP is slow or blocked, empty to not
+
+	ConfigProxy string // SOCKS proxy through which to fetch cloud config when the local proxy doesn't work, as socks5://[user:password@]host:port
+
+	StaleConfigThreshold time.Duration // How long to go without fetching cloud config before raising a StaleConfigEvent
+
+	CloudProvenance  string        // Where the cloud settings in this config came from: fetched, cached if from the cloud config cached on disk, embedded if from the snapshot embedded in the binary or rolledback if from the last cloud config confirmed healthy, see MarkUnhealthy
+	CloudCacheMaxAge time.Duration // How old the cached cloud config can be for us to use it when we have no cloud settings, zero means a week
+
+	MeteredDownloadLimit int64         // The largest cloud config in bytes, as sent over the wire, to download on a metered connection, zero means 256KB
+	MeteredMaxAge        time.Duration // How old cloud settings can get before we download cloud config on a metered connection regardless of its size, zero means a day
+	MeteredConnection    string        // Whether to treat the connection as metered: auto, the default, to go by what the platform and the host app say, always or never
+	PauseMeteredPolling  bool          // Whether to stop polling for cloud config on a metered connection until it's unmetered, rather than polling less often, while cloud settings are younger than MeteredMaxAge
+
+	MovedCloudConfigs map[string]string // Cloud config URLs that redirected permanently, mapped to where they moved, so that we skip the redirect
+
+	MaxProxiedSites      int  // The most cloud proxied sites to accept, zero means 50000
+	TruncateProxiedSites bool // Whether to drop the cloud proxied sites beyond MaxProxiedSites rather than reject the update
+	AllowProxiedIPs      bool // Whether to accept IP addresses among the cloud proxied sites
+
+	DryRunCloudUpdates bool // Whether to check cloud config updates on a copy of the config, refusing those that would leave us without servers, trusted CAs or proxied sites, before applying them
+
+	HeadBeforeFetch bool // Whether to check with a HEAD request that cloud config changed before downloading it, for networks whose caches answer conditional requests with the full config
+
+	KeepConfigVersions int // How many config files of the most recent versions of Lantern, up to the running one, to keep in the config dir, zero means 3
+	KeepConfigBackups  int // How many backups made by migrations to keep of each config file, zero means 2
+
+	KeepCloudConfigs int // How many of the cloud configs applied most recently to keep for Rollback, zero means 3
+
+	MaxServerSetChanges int // How many times an hour cloud config can change the chained servers before we hold on to the ones we have, zero means 6
+
+	Rollout *Rollout // Limits some sections of a cloud config update to a share of clients, only ever set while applying an update
+
+	MinClientVersion string // The oldest version of Lantern that can apply the cloud config this config was last updated with, empty if any can
+
+	Features        map[string]bool // Client behaviors turned on or off by name, see FeatureEnabled
+	FeatureRollouts map[string]int  // The share of clients in percent to turn each feature in Features on for, all if not given
+
+	// Bookkeeping about polling for cloud config. Times are in RFC 3339 format.
+	LastCloudUpdate  string // When cloud config was last fetched successfully
+	LastCloudAttempt string // When fetching cloud config was last attempted
+	LastCloudError   string // Why the last attempt to fetch cloud config failed, if it did
+
+	// How far ahead of our clock the cloud config server's clock was when we
+	// last fetched from it, for correcting times in the next session
+	ClockSkew time.Duration
+
+	// The ETag of the cloud config we last applied, by the URL we fetched it
+	// from, so that the first fetch in the next session is conditional on it
+	CloudETags map[string]string
+
+	// The SHA-256 of the last update merged by updateFrom, in hex, so that
+	// merging the same update again can be skipped
+	LastMergeChecksum string
+
+	// What candidateFrom filtered out of the cloud proxied sites, for logging
+	filtered *siteFilter
+
+	// Where the cloud config being merged was fetched from, for the history
+	fetchedFrom *cloudSource
+
+	// Counts the configs applied in this session, see Revision
+	revision int64
+}
+
+// Revision returns which config applied in this session this is. Each config
+// passed to Run's handlers has a higher revision than the one before.
+func (cfg *Config) Revision() int64 {
+	return cfg.revision
+}
+
+// SetRevision implements the method from interface yamlconf.Revisioned
+func (cfg *Config) SetRevision(revision int64) {
+	cfg.revision = revision
 }
 
 // StartPolling starts the process of polling for new configuration files.
 func StartPolling() {
+	if readOnly {
+		log.Debug("Not polling for cloud config with config owned by another Lantern")
+		return
+	}
 	// No-op if already started.
 	m.StartPolling()
+	watchMeteredConnection()
 }
 
 // CA represents a certificate authority
 type CA struct {
 	CommonName string
 	Cert       string // PEM-encoded
+	SHA256     string // Optional hex-encoded SHA-256 fingerprint of the certificate, which it then has to match, see check
+
+	// To rotate a CA, its replacement is published alongside it, marked as
+	// Superseded and optionally with a NotAfter, and it's later published as
+	// Removed or left out. See mergeTrustedCAs.
+	Superseded    bool   // Whether the CA is being replaced, so that it's no longer trusted once NotAfter passes or its certificate expires
+	NotAfter      string // When to stop trusting the CA if it's Superseded, in RFC 3339 format
+	Removed       bool   // Whether to stop trusting the CA right away
+	RetainedSince string // When cloud config first left out the CA, which we keep trusting for CAOverlapWindow after that, in RFC 3339 format; never published
 }
 
 func exists(file string) (os.FileInfo, bool) {
@@ -88,27 +251,45 @@ func exists(file string) (os.FileInfo, bool) {
 	}
 }
 
-// hasCustomChainedServer returns whether or not the config file at the specified
-// path includes a custom chained server or not.
-func hasCustomChainedServer(configPath, name string) bool {
+// isCustomConfig returns whether or not the config file at the specified path
+// was installed from a custom distribution, going by its Provenance or, for
+// files that predate that, by whether it has a custom chained server list.
+func isCustomConfig(configPath, name string) bool {
 	if !(strings.HasPrefix(name, "lantern") && strings.HasSuffix(name, ".yaml")) {
 		log.Debugf("File name does not match")
 		return false
 	}
-	bytes, err := ioutil.ReadFile(configPath)
+	bytes, err := readConfigFile(configPath)
 	if err != nil {
 		log.Errorf("Could not read file %v", err)
 		return false
 	}
 	cfg := &Config{}
-	err = yaml.Unmarshal(bytes, cfg)
+	if bytes, err = flattenDocuments(bytes); err == nil {
+		err = yaml.Unmarshal(bytes, cfg)
+	}
 	if err != nil {
 		log.Errorf("Could not unmarshal config %v", err)
 		return false
 	}
 
-	nc := len(cfg.Client.ChainedServers)
+	switch cfg.Provenance {
+	case provenanceCustom, provenanceOperatorSeeded:
+		return true
+	case provenanceStandard:
+		return false
+	}
+	if cfg.Client == nil {
+		log.Debugf("No client config")
+		return false
+	}
+	return hasCustomChainedServers(len(cfg.Client.ChainedServers))
+}
 
+// hasCustomChainedServers guesses whether a config with the given number of
+// chained servers has a custom chained server list, for configs that predate
+// Provenance.
+func hasCustomChainedServers(nc int) bool {
 	log.Debugf("Found %v chained servers", nc)
 	// The config will have more than one but fewer than 10 chained servers
 	// if it has been given a custom config with a custom chained server
@@ -119,16 +300,34 @@ func hasCustomChainedServer(configPath, name string) bool {
 func isGoodConfig(configPath string) bool {
 	log.Debugf("Checking config path: %v", configPath)
 	fi, exists := exists(configPath)
-	return exists && hasCustomChainedServer(configPath, fi.Name())
+	return exists && isCustomConfig(configPath, fi.Name())
+}
+
+// configFileName returns the name of the config file for the given version
+// of Lantern.
+func configFileName(version string) string {
+	return "lantern-" + version + ".yaml"
 }
 
-func majorVersion(version string) string {
-	return r.FindString(version)
+// versionOfConfigFile returns the version of Lantern encoded in the given
+// config file name, or false if the name isn't that of a versioned config
+// file.
+func versionOfConfigFile(name string) (string, bool) {
+	if !(strings.HasPrefix(name, "lantern-") && strings.HasSuffix(name, ".yaml")) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, "lantern-"), ".yaml"), true
 }
 
-// useGoodOldConfig is a one-time function for using older config files in the 2.x series.
-// It returns true if the file specified by configPath is ready, false otherwise.
-func useGoodOldConfig(configDir, configPath string) bool {
+// useGoodOldConfig is a one-time function for using config files from other
+// versions of Lantern with the same major version as the running one. It
+// prefers the newest config from the same or an older version, which it moves
+// into place. If there's only a config from a newer version, for example
+// because an update was rolled back, it copies the oldest one with the fields
+// this version doesn't know about stripped and leaves the original for when
+// the user upgrades again. It returns true if the file specified by
+// configPath is ready, false otherwise.
+func useGoodOldConfig(configDir, configPath, version string) bool {
 	// If we already have a config file with the latest name, use that one.
 	// Otherwise, copy the most recent config file available.
 	exists := isGoodConfig(configPath)
@@ -143,67 +342,173 @@ func useGoodOldConfig(configDir, configPath string) bool {
 		return false
 	}
 
+	running := parseVersion(version)
+	candidates := make(map[string]string)
+	versions := make([]string, 0)
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 		name := file.Name()
-		path := filepath.Join(configDir, name)
-		if isGoodConfig(path) {
-			// Just use the old config since configs in the 2.x series haven't changed.
-			if err := os.Rename(path, configPath); err != nil {
-				log.Errorf("Could not rename file from %v to %v: %v", path, configPath, err)
-			} else {
-				log.Debugf("Copied old config at %v to %v", path, configPath)
-				return true
+		fileVersion, ok := versionOfConfigFile(name)
+		if !ok || !parseVersion(fileVersion).sameMajor(running) {
+			continue
+		}
+		candidates[fileVersion] = filepath.Join(configDir, name)
+		versions = append(versions, fileVersion)
+	}
+
+	// Use the newest good config that's no newer than us, since configs within
+	// a major version are compatible, falling back to the closest newer one
+	sortVersionsNewestFirst(versions)
+	var older, newer []string
+	for _, fileVersion := range versions {
+		if running.compare(parseVersion(fileVersion)) < 0 {
+			newer = append([]string{fileVersion}, newer...)
+		} else {
+			older = append(older, fileVersion)
+		}
+	}
+	for _, fileVersion := range append(older, newer...) {
+		path := candidates[fileVersion]
+		if !isGoodConfig(path) {
+			continue
+		}
+		if running.compare(parseVersion(fileVersion)) < 0 {
+			if err := copyNewerConfig(path, configPath); err != nil {
+				log.Errorf("Could not use newer config at %v: %v", path, err)
+				continue
 			}
+			log.Debugf("Copied newer config at %v to %v", path, configPath)
+			return true
+		}
+		if err := os.Rename(path, configPath); err != nil {
+			log.Errorf("Could not rename file from %v to %v: %v", path, configPath, err)
+		} else {
+			log.Debugf("Copied old config at %v to %v", path, configPath)
+			return true
 		}
 	}
 	return false
 }
 
-// Init initializes the configuration system.
-func Init(version string) (*Config, error) {
-	file := "lantern-" + version + ".yaml"
-	_, configPath, err := InConfigDir(file)
-	if err != nil {
-		log.Errorf("Could not get config path? %v", err)
+// Init initializes the configuration system. By default, the configuration is
+// kept in a file in the config directory, but this can be changed with
+// WithStore. If that file can't be used, like when the config directory can't
+// be read, Init falls back to the packaged config, or the one built into
+// Lantern if that's broken too, keeping it in memory for the session.
+func Init(version string, opts ...Option) (*Config, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.apply()
+	runningVersion = version
+	loadEmbeddedCloudConfig()
+	loadSigningKeys()
+	RegisterFetcher(dnsFetcherName, &dnsFetcher{doh})
+	store := o.store
+	readOnly = false
+	profilesSupported = false
+	configFile = nil
+	serverSetChanges = &flapTracker{}
+	if store == nil {
+		if err := lockConfig(o.readOnlyIfRunning); err != nil {
+			reportError(PersistError, err, true)
+			return nil, err
+		}
+		var err error
+		if readOnly {
+			store, err = newReadOnlyStore(version)
+		} else if dir, ok := PortableDir(); ok && *configdir == "" {
+			store, err = newPortableStore(dir, version)
+		} else {
+			store, err = newFileStore(version)
+		}
+		if err != nil && !isDecryptError(err) {
+			// Rather than leave us unable to run
+			store, err = newFallbackStore(err)
+		}
+		if err != nil {
+			unlockConfigDir()
+			reportError(PersistError, err, true)
+			return nil, err
+		}
+		if profilesSupported {
+			store = openSelectedProfile(store)
+		}
+	} else if err := prepareStore(store); err != nil {
+		reportError(PersistError, err, true)
 		return nil, err
 	}
-	run := isGoodConfig(configPath)
-	if !run {
 
-		// If this is our first run of this version of Lantern, use the embedded configuration
-		// file and use it to download our custom config file on this first poll for our
-		// config.
-		if err := MakeInitialConfig(configPath); err != nil {
-			return nil, err
+	m = newManager(store)
+	initial, err := m.Init()
+	if err != nil && o.store == nil && configFile != nil {
+		// The config file may have turned out to be unusable, though if we
+		// can't decrypt it, falling back would lose it
+		if _, readErr := readConfigFile(configFile.Path); isDecryptError(readErr) {
+			err = readErr
+		} else if store, err = newFallbackStore(err); err == nil {
+			m = newManager(store)
+			initial, err = m.Init()
+		}
+	}
+
+	var cfg *Config
+	if err != nil {
+		log.Errorf("Error initializing config: %v", err)
+		reportError(PersistError, err, true)
+	} else {
+		cfg = initial.(*Config)
+		applied = cfg
+		if o.store == nil && !readOnly {
+			if dir, _, err := InConfigDir(""); err == nil {
+				cleanupConfigDir(dir, version, cfg)
+			}
+		}
+		applyFilePollInterval(cfg)
+		for _, issue := range cfg.Validate() {
+			reportError(ValidateError, fmt.Errorf("%v", issue), false)
 		}
+		watchLocalOverrides()
 	}
+	log.Debugf("Returning config")
+	return cfg, err
+}
 
-	m = &yamlconf.Manager{
-		FilePath: configPath,
+// newManager creates a yamlconf.Manager for the config kept in store.
+func newManager(store ConfigStore) *yamlconf.Manager {
+	return &yamlconf.Manager{
+		Store: &reportingStore{store},
 		EmptyConfig: func() yamlconf.Config {
 			return &Config{}
 		},
 		PerSessionSetup: func(ycfg yamlconf.Config) error {
 			cfg := ycfg.(*Config)
-			return cfg.applyFlags()
+			if err := cfg.applyCloudCache(cfg.correctedNow()); err != nil {
+				log.Errorf("Unable to use cached cloud config: %v", err)
+				reportError(ParseError, err, false)
+			}
+			cfg.restoreCloudETags()
+			cfg.applyLocalOverrides()
+			locked := cfg.snapshotLockedFields()
+			if err := cfg.applyFlags(); err != nil {
+				return err
+			}
+			if err := cfg.applyEnvOverrides(); err != nil {
+				return err
+			}
+			if restored := cfg.restoreLockedFields(locked); len(restored) > 0 {
+				log.Errorf("Ignoring flags and environment variables for locked fields: %v", strings.Join(restored, ", "))
+			}
+			return nil
 		},
 		CustomPoll: func(ycfg yamlconf.Config) (mutate func(yamlconf.Config) error, waitTime time.Duration, err error) {
 			return pollForConfig(ycfg)
 		},
+		WriteInterval: configWriteInterval,
 	}
-	initial, err := m.Init()
-
-	var cfg *Config
-	if err != nil {
-		log.Errorf("Error initializing config: %v", err)
-	} else {
-		cfg = initial.(*Config)
-	}
-	log.Debugf("Returning config")
-	return cfg, err
 }
 
 func pollForConfig(currentCfg yamlconf.Config) (mutate func(yamlconf.Config) error, waitTime time.Duration, err error) {
@@ -213,9 +518,20 @@ func pollForConfig(currentCfg yamlconf.Config) (mutate func(yamlconf.Config) err
 		// do nothing
 		return nil
 	}
+	// Polls outside of the regular schedule, like after a deferred download,
+	// may overlap with it
+	pollingMx.Lock()
+	defer pollingMx.Unlock()
+	pollMx.Lock()
+	defer pollMx.Unlock()
 	cfg := currentCfg.(*Config)
-	waitTime = cfg.cloudPollSleepTime()
-	if cfg.CloudConfig == "" {
+	attempted := wallClock()
+	endLapsedQuarantine(cfg.correctedNow())
+	waitTime = meteredPollSleepTime(cfg.cloudPollSleepTime())
+	defer func() {
+		recordNextPoll(attempted, waitTime)
+	}()
+	if len(cfg.CloudConfigs) == 0 {
 		log.Debugf("No cloud config URL!")
 		// Config doesn't have a CloudConfig, just ignore
 		return mutate, waitTime, nil
@@ -224,48 +540,424 @@ func pollForConfig(currentCfg yamlconf.Config) (mutate func(yamlconf.Config) err
 		log.Debugf("Not downloading remote config with sticky config flag set")
 		return mutate, waitTime, nil
 	}
+	if cfg.pollingPaused() {
+		log.Debugf("Not polling for cloud config until the connection is unmetered")
+		deferDownload()
+		return mutate, waitTime, nil
+	}
 
-	if bytes, err := fetchCloudConfig(chainedCloudConfigUrl); err == nil {
+	fetch := fetchCloudConfig
+	if staleness.isStale() {
+		log.Debugf("Config is stale, trying bootstrap servers first")
+		fetch = fetchCloudConfigViaBootstrapFirst
+	}
+	// Fail over to the next URL when one is blocked or failing
+	var url, moved string
+	var bytes []byte
+	var fetchErr error
+	var hasMoved bool
+	fetched := false
+	urls := cfg.cloudConfigURLs()
+	for _, configured := range urls {
+		url = cfg.movedCloudConfigURL(configured)
+		scopeCloudConfigTo(url, cfg.cloudConfigIdentity())
+		if allowed, next := circuits.allow(url, attempted); !allowed {
+			log.Debugf("Not fetching cloud config from %v until %v", withoutCredentials(url), next)
+			continue
+		}
+		fetched = true
+		var interrupted bool
+		bytes, interrupted, fetchErr = fetchUnlocked(url, fetch)
+		if interrupted {
+			log.Debugf("Fetch of cloud config from %v interrupted, discarding it", withoutCredentials(url))
+			return mutate, waitTime, nil
+		}
+		moved, hasMoved = movedCloudConfigUrl[url]
+		delete(movedCloudConfigUrl, url)
+		if isDeferred(fetchErr) {
+			log.Debugf("%v", fetchErr)
+			deferDownload()
+			return mutate, waitTime, nil
+		}
+		circuits.record(url, attempted, fetchErr)
+		recordPoll(url, attempted, fetchErr)
+		if fetchErr == nil {
+			break
+		}
+		log.Errorf("Could not fetch cloud config %v", fetchErr)
+		reportError(FetchError, fetchErr, false)
+	}
+	if !fetched {
+		if failedPolls > 0 {
+			// Every URL is failing, so keep backing off until one comes back
+			waitTime = meteredPollSleepTime(cfg.cloudPollBackoffTime(failedPolls))
+		}
+		return mutate, waitTime, nil
+	}
+	// Fetching tells us how far our clock is off, so times we save are
+	// corrected by what we just learned
+	skew := cfg.estimatedClockSkew()
+	corrected := attempted.Add(skew)
+	if fetchErr != nil {
+		failedPolls++
+		waitTime = meteredPollSleepTime(cfg.cloudPollBackoffTime(failedPolls))
+		log.Debugf("%d polls in a row failed, polling again in %v", failedPolls, waitTime)
+		staleness.failed(cfg, attempted, fetchErr)
+		// Record the failure without touching the rest of the config, unless
+		// we've never had any cloud settings
+		useEmbedded := cfg.shouldUseEmbeddedCloudConfig()
+		mutate = func(ycfg yamlconf.Config) error {
+			cfg := ycfg.(*Config)
+			cfg.recordCloudAttempt(corrected, fetchErr)
+			cfg.ClockSkew = skew
+			if useEmbedded {
+				cfg.applyEmbeddedCloudConfig()
+			}
+			return nil
+		}
+		return mutate, waitTime, nil
+	}
+	failedPolls = 0
+	staleness.refreshed(attempted, formatCloudTime(corrected))
+	if bytes != nil {
+		// What the other URLs last served is no longer what's applied, so
+		// don't let their ETags keep us from fetching it from them again
+		for _, other := range urls {
+			if other = cfg.movedCloudConfigURL(other); other != url {
+				forgetCloudConfig(other)
+			}
+		}
+	}
+	fetchedETag := lastCloudConfigETag[url]
+	var revalidated []byte
+	if url == chainedCloudConfigUrl {
+		revalidated = takeStaleCloudCache()
+	}
+	var remerge []byte
+	if bytes == nil && hasOverlays(lastCloudConfigPayload[url]) {
+		// The cloud config hasn't changed, but where we are may have, and
+		// with it the overlay that applies
+		remerge = lastCloudConfigPayload[url]
+	}
+	if hasMoved {
+		learnCloudConfigMove(url, moved)
+	}
+	mutate = func(ycfg yamlconf.Config) error {
+		cfg := ycfg.(*Config)
+		cfg.recordCloudAttempt(corrected, nil)
+		cfg.ClockSkew = skew
+		if hasMoved && *cloudconfig == "" {
+			// Moves of a URL we're only using for this session aren't saved
+			cfg.recordCloudConfigMove(url, moved)
+		}
 		// bytes will be nil if the config is unchanged (not modified)
-		if bytes != nil {
-			//log.Debugf("Downloaded config:\n %v", string(bytes))
-			mutate = func(ycfg yamlconf.Config) error {
-				log.Debugf("Merging cloud configuration")
-				cfg := ycfg.(*Config)
-				return cfg.updateFrom(bytes)
+		if bytes == nil {
+			if revalidated != nil && cfg.CloudProvenance == "" {
+				cfg.applyRevalidatedCloudCache(revalidated, fetchedETag, corrected)
+				cfg.recordCloudETag(url, fetchedETag)
+			}
+			if remerge != nil && cfg.CloudProvenance == cloudProvenanceFetched && !cfg.alreadyMerged(remerge) {
+				log.Debugf("Merging cloud configuration again for overlay of %v", cfg.overlayCountry())
+				if err := cfg.applyCloudUpdate(remerge); err != nil {
+					// What's applied is still what this URL served
+					log.Errorf("Unable to merge cloud config overlay: %v", err)
+					reportError(ParseError, err, false)
+					reportApplyError(fetchedETag, err)
+				}
 			}
+			stillQuarantined(url)
+			return nil
 		}
-	} else {
-		log.Errorf("Could not fetch cloud config %v", err)
-		return mutate, waitTime, err
+		log.Debugf("Merging cloud configuration")
+		cfg.CloudProvenance = cloudProvenanceFetched
+		cfg.fetchedFrom = &cloudSource{url: url, etag: fetchedETag, payload: bytes}
+		servers := cfg.chainedServerSet()
+		err := cfg.applyCloudUpdate(bytes)
+		if err == nil {
+			// Like a failed dry run, this leaves the merged config to be
+			// thrown away
+			err = serverSetChanges.check(servers, cfg.chainedServerSet(), corrected, cfg.maxServerSetChanges())
+		}
+		cfg.fetchedFrom = nil
+		if err != nil {
+			quarantineCloudConfig(url, fetchedETag, err, attempted)
+			reportApplyError(fetchedETag, err)
+			return err
+		}
+		clearQuarantine()
+		cloudConfigApplied(url, fetchedETag, bytes, corrected)
+		cfg.traceEffective("Config with downloaded cloud config")
+		cfg.recordCloudETag(url, fetchedETag)
+		if *cloudconfig != "" {
+			// Don't let config from a server we're only using for this session
+			// outlive it
+			return nil
+		}
+		rememberAppliedCloudConfig(bytes, fetchedETag, corrected, cfg.keepCloudConfigs())
+		if err := saveCloudCache(bytes, fetchedETag, corrected); err != nil {
+			log.Errorf("Unable to cache cloud config: %v", err)
+			reportError(PersistError, err, false)
+		}
+		return nil
 	}
 	return mutate, waitTime, nil
 }
 
-// Run runs the configuration system.
-func Run(updateHandler func(updated *Config)) error {
+// fetchUnlocked fetches the cloud config at url without holding pollMx, so
+// that nothing waits on the network for it, and reports whether the fetch was
+// interrupted by interruptFetch, in which case what it fetched is stale.
+// pollMx must be held.
+func fetchUnlocked(url string, fetch func(ctx context.Context, url string) ([]byte, error)) ([]byte, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	cancelFetch, fetchDone = cancel, done
+	pollMx.Unlock()
+	bytes, err := raceFetchers(ctx, url, fetch)
+	close(done)
+	pollMx.Lock()
+	cancelFetch, fetchDone = nil, nil
+	return bytes, ctx.Err() != nil, err
+}
+
+// interruptFetch cancels the fetch of the poll in progress, if any, and waits
+// for it to return, so that the caller can change what polls know about the
+// cloud configs they've fetched. The poll discards what it fetched. pollMx
+// must be held.
+func interruptFetch() {
+	if cancelFetch == nil {
+		return
+	}
+	cancelFetch()
+	<-fetchDone
+}
+
+// normalizedCloudConfigs returns the given cloud config URLs without blank
+// ones or duplicates, keeping their order.
+func normalizedCloudConfigs(urls []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		normalized = append(normalized, url)
+	}
+	return normalized
+}
+
+// recordCloudAttempt records an attempt at fetching cloud config made at the
+// given time, which failed if err is not nil.
+func (cfg *Config) recordCloudAttempt(attempted time.Time, err error) {
+	cfg.LastCloudAttempt = formatCloudTime(attempted)
+	if err != nil {
+		cfg.LastCloudError = err.Error()
+		return
+	}
+	cfg.LastCloudUpdate = cfg.LastCloudAttempt
+	cfg.LastCloudError = ""
+}
+
+// recordCloudETag records that the cloud config we just applied was fetched
+// from the given URL with the given ETag, which is empty if we don't know it.
+// What we applied before from other URLs no longer matters.
+func (cfg *Config) recordCloudETag(url string, etag string) {
+	if etag == "" {
+		cfg.CloudETags = nil
+		return
+	}
+	cfg.CloudETags = map[string]string{url: etag}
+}
+
+// restoreCloudETags makes the first fetch from each URL in CloudETags in this
+// session conditional on the ETag of the cloud config we last applied from
+// it, which this Config still has, so that we don't download it again after a
+// restart if it hasn't changed. What we know from the cloud cache takes
+// precedence.
+func (cfg *Config) restoreCloudETags() {
+	if cfg.CloudProvenance != cloudProvenanceFetched {
+		return
+	}
+	for url, etag := range cfg.CloudETags {
+		if _, known := lastCloudConfigETag[url]; known || etag == "" {
+			continue
+		}
+		log.Debugf("Last applied cloud config from %v had ETag %v", withoutCredentials(url), etag)
+		lastCloudConfigETag[url] = etag
+		lastCloudConfigIdentity[url] = cfg.cloudConfigIdentity()
+	}
+}
+
+// formatCloudTime formats the given time for the bookkeeping about polling for
+// cloud config.
+func formatCloudTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ClearBookkeeping implements the method from interface yamlconf.Bookkeeper
+func (cfg *Config) ClearBookkeeping() {
+	cfg.LastCloudUpdate = ""
+	cfg.LastCloudAttempt = ""
+	cfg.LastCloudError = ""
+	cfg.ClockSkew = 0
+	cfg.CloudETags = nil
+	cfg.LastMergeChecksum = ""
+}
+
+// CloudUpdateStatus returns when cloud config was last fetched successfully,
+// when fetching it was last attempted and, if that attempt failed, why. Times
+// are zero if unknown.
+func CloudUpdateStatus() (lastUpdate time.Time, lastAttempt time.Time, lastErr string) {
+	cfg := current()
+	if cfg == nil {
+		return
+	}
+	lastUpdate, _ = time.Parse(time.RFC3339, cfg.LastCloudUpdate)
+	lastAttempt, _ = time.Parse(time.RFC3339, cfg.LastCloudAttempt)
+	return lastUpdate, lastAttempt, cfg.LastCloudError
+}
+
+// Run runs the configuration system. For each update, it calls the
+// subscribers to the sections that the update changed, see Subscribe.
+func Run() error {
+	go reweightServersPeriodically(stopReweighting)
+	prev := applied
+	if prev == nil {
+		prev = current()
+	}
 	for {
 		next := m.Next()
 		nextCfg := next.(*Config)
-		updateHandler(nextCfg)
+		applyFilePollInterval(nextCfg)
+		reconfigure(prev, nextCfg)
+		notifyAdminStreams()
+		prev = nextCfg
+	}
+}
+
+// current returns the most recently applied Config, or nil if the
+// configuration system hasn't been initialized. The returned Config is shared
+// and must not be modified.
+func current() *Config {
+	if m == nil {
+		return nil
 	}
+	cfg, _ := m.Current().(*Config)
+	return cfg
 }
 
-// Update updates the configuration using the given mutator function.
+// Update updates the configuration using the given mutator function. If the
+// mutator introduces problems that Validate finds, the update is rejected with
+// a *ValidationError and the configuration is left as it was. Otherwise, the
+// fields that changed are logged, with secrets masked. Concurrent updates are
+// applied one at a time in the order they were made, each to the
+// configuration left by the one before, and Update returns once its update
+// has been applied, though not necessarily written to disk. Updates that
+// would change fields locked by an administrator are rejected with a
+// *LockedFieldsError.
 func Update(mutate func(cfg *Config) error) error {
-	return m.Update(func(ycfg yamlconf.Config) error {
-		return mutate(ycfg.(*Config))
+	return update(mutate, true)
+}
+
+// update is Update, optionally letting the update change locked fields, as
+// the local overrides file can.
+func update(mutate func(cfg *Config) error, enforceLocks bool) error {
+	userChanged := false
+	err := m.Update(func(ycfg yamlconf.Config) error {
+		cfg := ycfg.(*Config)
+		before, err := cfg.redactedCopy()
+		if err != nil {
+			return err
+		}
+		identity := cfg.cloudConfigIdentity()
+		var locked lockedValues
+		if enforceLocks {
+			locked = cfg.snapshotLockedFields()
+		}
+		if err := mutate(cfg); err != nil {
+			return err
+		}
+		if changed := cfg.changedLockedFields(locked); len(changed) > 0 {
+			err := &LockedFieldsError{changed}
+			log.Errorf("Rejecting update: %v", err)
+			return err
+		}
+		if issues := newIssues(before.Validate(), cfg.Validate()); len(issues) > 0 {
+			err := &ValidationError{issues}
+			log.Errorf("Rejecting update: %v", err)
+			reportError(ValidateError, err, false)
+			return err
+		}
+		after, err := cfg.redactedCopy()
+		if err != nil {
+			return err
+		}
+		userChanged = cfg.cloudConfigIdentity() != identity
+		// Merging the last update again could now have a different result
+		cfg.LastMergeChecksum = ""
+		diff, err := newConfigDiff(before, after)
+		if err != nil {
+			log.Errorf("Unable to diff updated config: %v", err)
+			return nil
+		}
+		configChanged(historySourceUpdate, cfg, diff)
+		return nil
 	})
+	if err == nil && userChanged {
+		// The user's cloud config may be different from what we have
+		log.Debugf("User changed, refreshing cloud config")
+		go Refresh()
+	}
+	return err
 }
 
-// InConfigDir returns the path to the given filename inside of the configdir.
-func InConfigDir(filename string) (string, string, error) {
-	cdir := *configdir
+// UpdateAndFlush is like Update but also returns only once the updated
+// configuration has been written to disk. Update returns as soon as the update
+// has been applied, while writes are coalesced to spare the disk.
+func UpdateAndFlush(mutate func(cfg *Config) error) error {
+	if err := Update(mutate); err != nil {
+		return err
+	}
+	return Flush()
+}
+
+// Flush writes any pending changes to the configuration to disk, for example
+// before restarting to apply an update.
+func Flush() error {
+	if m == nil {
+		return nil
+	}
+	return m.Flush()
+}
 
-	if cdir == "" {
-		cdir = appdir.General("Lantern")
+// Stop stops polling for configuration and writes any pending changes to disk.
+func Stop() {
+	if m == nil {
+		return
+	}
+	stopReweightingOnce.Do(func() {
+		close(stopReweighting)
+	})
+	stopMeteredWatchOnce.Do(func() {
+		close(stopMeteredWatch)
+	})
+	unwatchLocalOverrides()
+	flushHistory()
+	if err := m.Stop(); err != nil {
+		log.Errorf("Unable to save config: %v", err)
 	}
+	unlockConfigDir()
+	readOnly = false
+	profileMx.Lock()
+	profilesSupported = false
+	profileMx.Unlock()
+}
 
+// InConfigDir returns the path to the given filename inside of the configdir.
+func InConfigDir(filename string) (string, string, error) {
+	cdir := configDirPath()
 	log.Debugf("Using config dir %v", cdir)
 	if _, err := os.Stat(cdir); err != nil {
 		if os.IsNotExist(err) {
@@ -279,11 +971,29 @@ func InConfigDir(filename string) (string, string, error) {
 	return cdir, filepath.Join(cdir, filename), nil
 }
 
+// configDirPath returns the path to the configdir, without creating it.
+func configDirPath() string {
+	if *configdir != "" {
+		return *configdir
+	}
+	if dir, ok := PortableDir(); ok {
+		return dir
+	}
+	return defaultConfigDir()
+}
+
 func (cfg *Config) GetTrustedCACerts() (pool *x509.CertPool, err error) {
 	certs := make([]string, 0, len(cfg.TrustedCAs))
 	for _, ca := range cfg.TrustedCAs {
+		if err := ca.check(); err != nil {
+			log.Errorf("Not trusting CA %v: %v", ca.CommonName, err)
+			continue
+		}
 		certs = append(certs, ca.Cert)
 	}
+	if cfg.IncludeSystemCAs {
+		return poolWithSystemCAs(certs)
+	}
 	pool, err = keyman.PoolContainingCerts(certs...)
 	if err != nil {
 		log.Errorf("Could not create pool %v", err)
@@ -312,6 +1022,10 @@ func (cfg *Config) ApplyDefaults() {
 		cfg.Role = "client"
 	}
 
+	if cfg.Role == "server" {
+		cfg.applyServerDefaults()
+	}
+
 	if cfg.Addr == "" {
 		cfg.Addr = "127.0.0.1:8787"
 	}
@@ -320,8 +1034,13 @@ func (cfg *Config) ApplyDefaults() {
 		cfg.UIAddr = "127.0.0.1:16823"
 	}
 
-	if cfg.CloudConfig == "" {
-		cfg.CloudConfig = chainedCloudConfigUrl
+	cfg.CloudConfigs = normalizedCloudConfigs(cfg.CloudConfigs)
+	if len(cfg.CloudConfigs) == 0 {
+		cfg.CloudConfigs = []string{chainedCloudConfigUrl}
+	}
+
+	if cfg.StaleConfigThreshold == 0 {
+		cfg.StaleConfigThreshold = defaultStaleConfigThreshold
 	}
 
 	// Make sure we always have a stats config
@@ -359,12 +1078,8 @@ func (cfg *Config) ApplyDefaults() {
 }
 
 func (cfg *Config) applyClientDefaults() {
-	// Make sure we always have at least one masquerade set
-	if cfg.Client.MasqueradeSets == nil {
-		cfg.Client.MasqueradeSets = make(map[string][]*fronted.Masquerade)
-	}
-	if len(cfg.Client.MasqueradeSets) == 0 {
-		cfg.Client.MasqueradeSets[cloudfront] = cloudfrontMasquerades
+	if cfg.Client.DefaultMasqueradeSet == "" {
+		cfg.Client.DefaultMasqueradeSet = cloudfront
 	}
 
 	// Make sure we always have at least one server
@@ -393,27 +1108,102 @@ func (cfg *Config) applyClientDefaults() {
 		}
 	}
 
-	// Make sure all servers have a QOS and Weight configured
+	// Always make sure we have a map of ChainedServers
+	if cfg.Client.ChainedServers == nil {
+		cfg.Client.ChainedServers = make(map[string]*client.ChainedServerInfo)
+	}
+
+	cfg.applyServerInfoDefaults()
+	cfg.applyMasqueradeSetDefaults()
+	cfg.Client.Territory = strings.ToUpper(strings.TrimSpace(cfg.Client.Territory))
+
+	// Sort servers so that they're always in a predictable order
+	cfg.Client.SortServers()
+
+}
+
+// applyServerInfoDefaults makes sure all fronted and chained servers have a
+// QOS and Weight configured, plus a masquerade set, redial attempts and a
+// CloudWeight for fronted servers.
+func (cfg *Config) applyServerInfoDefaults() {
 	for _, server := range cfg.Client.FrontedServers {
+		if server.MasqueradeSet == "" {
+			server.MasqueradeSet = cfg.Client.DefaultMasqueradeSet
+		}
 		if server.QOS == 0 {
-			server.QOS = 5
+			server.QOS = defaultServerQOS
 		}
 		if server.Weight == 0 {
-			server.Weight = 100
+			server.Weight = defaultServerWeight
 		}
 		if server.RedialAttempts == 0 {
-			server.RedialAttempts = 2
+			server.RedialAttempts = defaultRedialAttempts
+		}
+		if server.CloudWeight == 0 {
+			server.CloudWeight = server.Weight
+		}
+	}
+	for _, server := range cfg.Client.ChainedServers {
+		if server.QOS == 0 {
+			server.QOS = defaultServerQOS
+		}
+		if server.Weight == 0 {
+			server.Weight = defaultServerWeight
 		}
 	}
+}
 
-	// Always make sure we have a map of ChainedServers
-	if cfg.Client.ChainedServers == nil {
-		cfg.Client.ChainedServers = make(map[string]*client.ChainedServerInfo)
+// applyMasqueradeSetDefaults makes sure we always have at least one masquerade
+// set, using the built-in DefaultMasqueradeSet if none are configured, and
+// adds the built-in sets that fronted servers use but that aren't configured.
+func (cfg *Config) applyMasqueradeSetDefaults() {
+	if cfg.Client.MasqueradeSets == nil {
+		cfg.Client.MasqueradeSets = make(map[string][]*fronted.Masquerade)
+	}
+	if len(cfg.Client.MasqueradeSets) == 0 {
+		cfg.addBuiltinMasqueradeSet(cfg.Client.DefaultMasqueradeSet)
+	}
+	for _, server := range cfg.Client.FrontedServers {
+		if _, found := cfg.Client.MasqueradeSets[server.MasqueradeSet]; !found {
+			cfg.addBuiltinMasqueradeSet(server.MasqueradeSet)
+		}
 	}
+}
 
-	// Sort servers so that they're always in a predictable order
-	cfg.Client.SortServers()
+func (cfg *Config) addBuiltinMasqueradeSet(name string) {
+	masquerades, found := builtinMasqueradeSets[name]
+	if !found {
+		log.Debugf("No built-in masquerade set %q", name)
+		return
+	}
+	log.Debugf("Loading built-in masquerade set %q", name)
+	cfg.Client.MasqueradeSets[name] = masquerades
+}
+
+// applyServerDefaults makes sure that a server has everything it needs to
+// run.
+func (cfg *Config) applyServerDefaults() {
+	if cfg.Server == nil {
+		cfg.Server = &server.ServerConfig{}
+	}
+
+	// Listen on all interfaces on the port that we register
+	if cfg.Addr == "" {
+		if cfg.Server.Unencrypted {
+			cfg.Addr = defaultUnencryptedServerAddr
+		} else {
+			cfg.Addr = defaultServerAddr
+		}
+	}
+
+	if cfg.Server.FrontFQDNs == nil {
+		cfg.Server.FrontFQDNs = make(map[string]string)
+	}
 
+	// Servers don't use client settings, so just point out leftovers
+	if cfg.Client != nil && (len(cfg.Client.ChainedServers) > 0 || len(cfg.Client.FrontedServers) > 0) {
+		log.Debugf("Ignoring client settings in server config")
+	}
 }
 
 func (cfg *Config) IsDownstream() bool {
@@ -424,89 +1214,269 @@ func (cfg *Config) IsUpstream() bool {
 	return !cfg.IsDownstream()
 }
 
+// cloudPollSleepTime returns how long to wait before polling for cloud config
+// again, which is randomized around the cloud poll interval by pollJitter.
 func (cfg Config) cloudPollSleepTime() time.Duration {
-	return time.Duration((CloudConfigPollInterval.Nanoseconds() / 2) + rand.Int63n(CloudConfigPollInterval.Nanoseconds()))
+	return jitter.sleepTime(cfg.cloudPollInterval())
 }
 
-func fetchCloudConfig(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to construct request for cloud config at %s: %s", url, err)
+// cloudPollBackoffTime returns how long to wait before polling for cloud
+// config again after the given number of polls in a row failed, which is the
+// cloud poll interval doubled for each failure up to maxCloudPollBackoff,
+// randomized by pollJitter so that clients that lost the config server
+// together don't all come back to it together.
+func (cfg Config) cloudPollBackoffTime(failures int) time.Duration {
+	interval := cfg.cloudPollInterval()
+	backoff := interval
+	for i := 0; i < failures && backoff < maxCloudPollBackoff; i++ {
+		backoff *= 2
 	}
-	if lastCloudConfigETag[url] != "" {
-		// Don't bother fetching if unchanged
-		req.Header.Set(ifNoneMatch, lastCloudConfigETag[url])
+	if backoff > maxCloudPollBackoff && interval < maxCloudPollBackoff {
+		backoff = maxCloudPollBackoff
 	}
+	return jitter.sleepTime(backoff)
+}
 
-	req.Header.Set("Accept", "application/x-gzip")
-	// Prevents intermediate nodes (domain-fronters) from caching the content
-	req.Header.Set("Cache-Control", "no-cache")
-	// Set the fronted URL to lookup the config in parallel using chained and domain fronted servers.
-	req.Header.Set("Lantern-Fronted-URL", frontedCloudConfigUrl)
+// cloudPollInterval returns how often to poll for cloud config. The
+// -cloudpollinterval flag takes precedence over the config so that cloud
+// updates can't override it.
+func (cfg Config) cloudPollInterval() time.Duration {
+	interval := cfg.CloudPollInterval
+	if *cloudPollInterval > 0 {
+		interval = *cloudPollInterval
+	}
+	if interval <= 0 {
+		return defaultCloudPollInterval
+	}
+	return clampDuration(interval, minCloudPollInterval, maxCloudPollInterval)
+}
 
-	// make sure to close the connection after reading the Body
-	// this prevents the occasional EOFs errors we're seeing with
-	// successive requests
-	req.Close = true
+// filePollInterval returns how often to check the config file for changes
+// where it can't be watched. Like with cloudPollInterval, the flag takes
+// precedence.
+func (cfg Config) filePollInterval() time.Duration {
+	interval := cfg.FilePollInterval
+	if *filePollInterval > 0 {
+		interval = *filePollInterval
+	}
+	if interval <= 0 {
+		return defaultFilePollInterval
+	}
+	return clampDuration(interval, minFilePollInterval, maxFilePollInterval)
+}
 
-	resp, err := cf.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to fetch cloud config at %s: %s", url, err)
+func clampDuration(d time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if d < min {
+		return min
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Debugf("Error closing response body: %v", err)
-		}
-	}()
+	if d > max {
+		return max
+	}
+	return d
+}
 
-	if resp.StatusCode == 304 {
-		log.Debugf("Config unchanged in cloud")
-		return nil, nil
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Unexpected response status: %d", resp.StatusCode)
+// applyFilePollInterval makes the config file, if we're using one, get
+// checked for changes at the interval configured in cfg.
+func applyFilePollInterval(cfg *Config) {
+	if configFile != nil {
+		configFile.SetPollInterval(cfg.filePollInterval())
 	}
+	if localOverridesFile != nil {
+		localOverridesFile.SetPollInterval(cfg.filePollInterval())
+	}
+}
 
-	lastCloudConfigETag[url] = resp.Header.Get(etag)
-	gzReader, err := gzip.NewReader(resp.Body)
+// updateFrom 'merges' the given yaml into this Config. The masquerade sets,
+// the collections of servers, and the trusted CAs in the update yaml
+// completely replace the ones in the original Config, unless the update only
+// carries some of them, see sectionsKey. Only the fields that
+// cloud config manages are merged, see cloudFields, so that a bad update
+// can't change the user's preferences. If the update can't be merged, this
+// Config is left as it was.
+func (cfg *Config) updateFrom(updateBytes []byte) error {
+	if cfg.alreadyMerged(updateBytes) {
+		log.Debugf("Update is the same as the last one merged, skipping it")
+		return nil
+	}
+	candidate, err := cfg.candidateFrom(updateBytes)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to open gzip reader: %s", err)
+		return err
 	}
-	log.Debugf("Fetched cloud config")
-	return ioutil.ReadAll(gzReader)
+	return cfg.commit(candidate)
 }
 
-// updateFrom creates a new Config by 'merging' the given yaml into this Config.
-// The masquerade sets, the collections of servers, and the trusted CAs in the
-// update yaml  completely replace the ones in the original Config.
-func (updated *Config) updateFrom(updateBytes []byte) error {
-	// XXX: does this need a mutex, along with everyone that uses the config?
+// candidateFrom returns a copy of this Config into which the given yaml has
+// been merged like updateFrom does, leaving this Config alone.
+func (cfg *Config) candidateFrom(updateBytes []byte) (*Config, error) {
+	return cfg.mergedWith(updateBytes, true)
+}
+
+// mergedWith returns a copy of this Config into which the given yaml has been
+// merged. With cloudOnly, fields that cloud config doesn't manage are left as
+// they were, otherwise the yaml can set any of them.
+func (cfg *Config) mergedWith(updateBytes []byte, cloudOnly bool) (*Config, error) {
+	updateBytes, err := flattenDocuments(updateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal YAML for update: %s", err)
+	}
+	country := cfg.overlayCountry()
+	overlaid, err := applyCountryOverlay(updateBytes, country)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to apply overlay for %v to update: %v", country, err)
+	}
+	overlaid, sections, err := selectUpdateSections(overlaid)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to select sections of update: %v", err)
+	}
+	updated := &Config{}
+	if err := deepcopy.Copy(updated, withoutCloudSites(cfg)); err != nil {
+		return nil, fmt.Errorf("Unable to copy config for update: %v", err)
+	}
+	if updated.ProxiedSites != nil && cfg.ProxiedSites.Cloud != nil {
+		// Copying tens of thousands of sites like the rest of the config is
+		// much slower than copying the slice
+		updated.ProxiedSites.Cloud = append(make([]string, 0, len(cfg.ProxiedSites.Cloud)), cfg.ProxiedSites.Cloud...)
+	}
 	oldFrontedServers := updated.Client.FrontedServers
 	oldChainedServers := updated.Client.ChainedServers
 	oldMasqueradeSets := updated.Client.MasqueradeSets
 	oldTrustedCAs := updated.TrustedCAs
-	updated.Client.FrontedServers = []*client.FrontedServerInfo{}
-	updated.Client.ChainedServers = map[string]*client.ChainedServerInfo{}
-	updated.Client.MasqueradeSets = map[string][]*fronted.Masquerade{}
-	updated.TrustedCAs = []*CA{}
-	err := yaml.Unmarshal(updateBytes, updated)
-	if err != nil {
-		updated.Client.FrontedServers = oldFrontedServers
+	provenance := updated.Provenance
+	preserveCustomServers := updated.PreserveCustomServers
+	userID, userToken := updated.UserID, updated.UserToken
+	// The sections in the update replace ours rather than being merged
+	if sections.carries(rolloutFrontedServers) {
+		updated.Client.FrontedServers = []*client.FrontedServerInfo{}
+	}
+	if sections.carries(rolloutChainedServers) {
+		updated.Client.ChainedServers = map[string]*client.ChainedServerInfo{}
+	}
+	if sections.carries(rolloutMasqueradeSets) {
+		updated.Client.MasqueradeSets = map[string][]*fronted.Masquerade{}
+	}
+	if sections.carries(rolloutTrustedCAs) {
+		updated.TrustedCAs = []*CA{}
+	}
+	if sections.carries(sectionFeatures) {
+		updated.Features = nil
+		updated.FeatureRollouts = nil
+	}
+	updated.Rollout = nil
+	updated.MinClientVersion = ""
+	var local *localFields
+	if cloudOnly {
+		local = updated.setAsideLocalFields()
+	}
+	if err := yaml.Unmarshal(overlaid, updated); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal YAML for update: %s", err)
+	}
+	// An update with a CA we can't use or that doesn't match its fingerprint
+	// may well have been tampered with
+	if sections.carries(rolloutTrustedCAs) {
+		if issues := caIssues(updated.TrustedCAs); len(issues) > 0 {
+			return nil, &ValidationError{issues}
+		}
+	}
+	if local != nil {
+		if ignored := updated.restoreLocalFields(local); len(ignored) > 0 {
+			log.Debugf("Ignoring settings in update that cloud config doesn't manage: %v", strings.Join(ignored, ", "))
+		}
+	}
+	if restored := updated.restoreLockedFields(cfg.snapshotLockedFields()); len(restored) > 0 {
+		log.Errorf("Ignoring changes to locked fields in update: %v", strings.Join(restored, ", "))
+	}
+	// Rather than half apply an update we may not understand
+	if err := checkMinClientVersion(updated.MinClientVersion); err != nil {
+		return nil, err
+	}
+	// Where the config came from doesn't change with cloud updates, and
+	// neither does whether it keeps its custom servers or who the user is
+	updated.Provenance = provenance
+	updated.PreserveCustomServers = preserveCustomServers
+	updated.UserID, updated.UserToken = userID, userToken
+	updated.applyRollout(oldChainedServers, oldFrontedServers, oldMasqueradeSets, oldTrustedCAs)
+	if preserveCustomServers && len(oldChainedServers) > 0 {
+		log.Debugf("Keeping %d custom chained servers", len(oldChainedServers))
 		updated.Client.ChainedServers = oldChainedServers
-		updated.Client.MasqueradeSets = oldMasqueradeSets
-		updated.TrustedCAs = oldTrustedCAs
-		return fmt.Errorf("Unable to unmarshal YAML for update: %s", err)
 	}
+	updated.mergeTrustedCAs(oldTrustedCAs, cfg.correctedNow())
+	updated.TrustedCAs = dedupCAs(updated.TrustedCAs)
+	updated.checkMasqueradeSets(oldMasqueradeSets)
+	// The servers in the update replaced ours wholesale, so they haven't had
+	// defaults applied yet
+	updated.applyServerInfoDefaults()
+	updated.applyMasqueradeSetDefaults()
 	// Deduplicate global proxiedsites
 	if len(updated.ProxiedSites.Cloud) > 0 {
-		wlDomains := make(map[string]bool)
-		for _, domain := range updated.ProxiedSites.Cloud {
-			wlDomains[domain] = true
-		}
-		updated.ProxiedSites.Cloud = make([]string, 0, len(wlDomains))
-		for domain, _ := range wlDomains {
-			updated.ProxiedSites.Cloud = append(updated.ProxiedSites.Cloud, domain)
-		}
-		sort.Strings(updated.ProxiedSites.Cloud)
+		updated.ProxiedSites.Cloud = sortedUnique(updated.ProxiedSites.Cloud)
+	}
+	updated.fetchedFrom = cfg.fetchedFrom
+	updated.filtered, err = updated.filterProxiedSites()
+	if err != nil {
+		return nil, err
 	}
+	// Local overrides win over whatever the update said
+	updated.applyLocalOverrides()
+	updated.LastMergeChecksum = cfg.mergeChecksumOf(updateBytes)
+	return updated, nil
+}
+
+// alreadyMerged returns whether the given update is the one this Config last
+// merged, in which case merging it again would change nothing. That's unless
+// the settings it was merged with have since been changed with Update, which
+// forgets the last merge, or time has run out for CAs we keep trusting during
+// a rotation.
+func (cfg *Config) alreadyMerged(updateBytes []byte) bool {
+	if cfg.LastMergeChecksum == "" || cfg.LastMergeChecksum != cfg.mergeChecksumOf(updateBytes) {
+		return false
+	}
+	return !cfg.trustedCAsExpired(cfg.correctedNow())
+}
+
+// mergeChecksumOf returns the checksum of the given update for
+// LastMergeChecksum. For updates with overlays, it also covers the country
+// whose overlay applies, so that we merge the update again once we find
+// ourselves somewhere else.
+func (cfg *Config) mergeChecksumOf(updateBytes []byte) string {
+	checksum := sha256.New()
+	checksum.Write(updateBytes)
+	if hasOverlays(updateBytes) {
+		checksum.Write([]byte("\x00" + cfg.overlayCountry()))
+	}
+	return fmt.Sprintf("%x", checksum.Sum(nil))
+}
+
+// commit replaces this Config with the given candidate from candidateFrom,
+// logging and reporting the changes.
+func (cfg *Config) commit(candidate *Config) error {
+	// XXX: does this need a mutex, along with everyone that uses the config?
+	before, err := cfg.redactedCopy()
+	if err != nil {
+		return err
+	}
+	*cfg = *candidate
+	cfg.logUpdateFrom(before)
 	return nil
 }
+
+// logUpdateFrom logs and reports the changes that updateFrom made, given a
+// redacted copy of the Config from before the update.
+func (updated *Config) logUpdateFrom(before *Config) {
+	after, err := updated.redactedCopy()
+	if err != nil {
+		log.Errorf("Unable to copy updated config: %v", err)
+		return
+	}
+	diff, err := newConfigDiff(before, after)
+	if err != nil {
+		log.Errorf("Unable to diff updated config: %v", err)
+		return
+	}
+	if updated.filtered != nil {
+		diff.IgnoredProxiedSites = updated.filtered.implausible
+		diff.TruncatedProxiedSites = updated.filtered.truncated
+		updated.filtered = nil
+	}
+	configChanged(historySourceCloud, updated, diff)
+	updated.fetchedFrom = nil
+}
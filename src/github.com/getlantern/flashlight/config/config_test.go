@@ -1,11 +1,39 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/getlantern/fronted"
+	"github.com/getlantern/proxiedsites"
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/server"
 )
 
+func TestMain(tests *testing.M) {
+	// Keep tests out of the real config dir, for example when caching cloud
+	// config
+	dir, err := ioutil.TempDir("", "lantern-config-test")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create temp dir: %v\n", err)
+		os.Exit(1)
+	}
+	*configdir = dir
+	code := tests.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 /*
 func TestInitialConfig(t *testing.T) {
 	path, _ := ioutil.TempFile("", "config")
@@ -58,8 +86,473 @@ func TestCopyOldConfig(t *testing.T) {
 }
 */
 
-func TestMajorVersion(t *testing.T) {
-	ver := "222.00.1"
-	maj := majorVersion(ver)
-	assert.Equal(t, "222.00", maj, "Unexpected major version")
+func TestUseGoodOldConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := "client:\n  chainedservers:\n    custom:\n      addr: %v\n"
+	write := func(version string, addr string) {
+		yml := fmt.Sprintf(good, addr)
+		if err := ioutil.WriteFile(filepath.Join(dir, configFileName(version)), []byte(yml), 0644); err != nil {
+			t.Fatalf("Unable to write config: %v", err)
+		}
+	}
+	write("2.0.9", "1.1.1.1:443")
+	write("2.0.10", "2.2.2.2:443")
+	write("2.1.0-beta1", "3.3.3.3:443")
+	write("3.0.0", "4.4.4.4:443")
+	write("garbage", "5.5.5.5:443")
+
+	configPath := filepath.Join(dir, configFileName("2.1.0"))
+	assert.True(t, useGoodOldConfig(dir, configPath, "2.1.0"))
+	b, err := ioutil.ReadFile(configPath)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(b), "3.3.3.3:443", "Should have used the newest config from the same major version")
+	}
+	assert.False(t, useGoodOldConfig(dir, filepath.Join(dir, configFileName("4.0.0")), "4.0.0"), "Should not reuse config from another major version")
+}
+
+func TestIsGoodConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, provenance string, servers int) string {
+		yml := ""
+		if provenance != "" {
+			yml += "provenance: " + provenance + "\n"
+		}
+		yml += "client:\n  chainedservers:\n"
+		for i := 0; i < servers; i++ {
+			yml += fmt.Sprintf("    server-%d:\n      addr: 1.1.1.%d:443\n", i, i)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(yml), 0644); err != nil {
+			t.Fatalf("Unable to write config: %v", err)
+		}
+		return path
+	}
+
+	assert.True(t, isGoodConfig(write("lantern-old-few.yaml", "", 3)), "Old config with few servers should be considered custom")
+	assert.False(t, isGoodConfig(write("lantern-old-many.yaml", "", 20)), "Old config with many servers should not be considered custom")
+	assert.False(t, isGoodConfig(write("lantern-standard.yaml", provenanceStandard, 3)), "Standard config should not be considered custom however many servers it has")
+	assert.True(t, isGoodConfig(write("lantern-custom.yaml", provenanceCustom, 3)), "Custom config should be considered custom")
+	assert.True(t, isGoodConfig(write("lantern-custom-large.yaml", provenanceCustom, 50)), "Custom config with many servers should be considered custom")
+
+	// Migrating an old config records the guess so that cloud updates to the
+	// chained servers don't change it
+	path := write("lantern-migrated.yaml", "", 3)
+	defer os.Remove(path + ".schema0.bak")
+	if assert.NoError(t, migrateConfigFile(path)) {
+		assert.Equal(t, provenanceCustom, readTree(t, path)[provenanceKey])
+	}
+}
+
+func TestProvenanceSurvivesUpdate(t *testing.T) {
+	cfg := &Config{Provenance: provenanceCustom, Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	if assert.NoError(t, cfg.updateFrom([]byte("provenance: standard\nclient:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n"))) {
+		assert.Equal(t, provenanceCustom, cfg.Provenance)
+	}
+}
+
+func TestUpdateLeavesLocalFieldsAlone(t *testing.T) {
+	autoReport := false
+	cfg := &Config{
+		UIAddr:       "127.0.0.1:16823",
+		AutoReport:   &autoReport,
+		Client:       &client.ClientConfig{DumpHeaders: true},
+		ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{Additions: []string{"mine.com"}}},
+	}
+	malicious := "autoreport: true\nuiaddr: 0.0.0.0:80\nlastcloudupdate: 2000-01-01T00:00:00Z\n" +
+		"client:\n  dumpheaders: false\n  minqos: 10\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n" +
+		"proxiedsites:\n  delta:\n    deletions:\n    - mine.com\n  cloud:\n  - a.com\n"
+	if !assert.NoError(t, cfg.updateFrom([]byte(malicious))) {
+		return
+	}
+	assert.False(t, *cfg.AutoReport, "Cloud shouldn't turn on auto reporting")
+	assert.Equal(t, "127.0.0.1:16823", cfg.UIAddr, "Cloud shouldn't move the UI")
+	assert.Empty(t, cfg.LastCloudUpdate, "Cloud shouldn't touch bookkeeping")
+	assert.True(t, cfg.Client.DumpHeaders)
+	assert.Equal(t, 0, cfg.Client.MinQOS)
+	assert.Equal(t, []string{"mine.com"}, cfg.ProxiedSites.Delta.Additions)
+	assert.Empty(t, cfg.ProxiedSites.Delta.Deletions, "Cloud shouldn't touch the user's proxied sites")
+	if assert.Len(t, cfg.Client.ChainedServers, 1, "Servers should still be updated") {
+		assert.Equal(t, "1.1.1.1:443", cfg.Client.ChainedServers["fallback-1"].Addr)
+	}
+	assert.Equal(t, []string{"a.com"}, cfg.ProxiedSites.Cloud)
+}
+
+// initTestConfig initializes the configuration system using an in-memory store
+// containing the given yaml. The returned function stops the configuration
+// system.
+func initTestConfig(t *testing.T, yml string) func() {
+	// Keep whatever the test caches to itself
+	restoreConfigDir := useTempConfigDir(t)
+	serverSetChanges = &flapTracker{}
+	m = newManager(yamlconf.NewMemoryStore([]byte(yml)))
+	if _, err := m.Init(); err != nil {
+		t.Fatalf("Unable to init config: %v", err)
+	}
+	// Consume updates like Run would
+	mgr := m
+	go func() {
+		for {
+			mgr.Next()
+		}
+	}()
+
+	return func() {
+		mgr.Stop()
+		// Write history while the temp config dir is still around
+		flushHistory()
+		restoreConfigDir()
+	}
+}
+
+func TestDeterministicYAML(t *testing.T) {
+	names := []string{"fallback-1", "fallback-2", "fallback-3", "fallback-4", "fallback-5"}
+	domains := []string{"a.com", "b.com", "c.com", "d.com", "e.com"}
+	build := func(order []int) *Config {
+		cfg := &Config{Client: &client.ClientConfig{
+			ChainedServers: make(map[string]*client.ChainedServerInfo),
+			MasqueradeSets: make(map[string][]*fronted.Masquerade),
+		}}
+		for _, i := range order {
+			cfg.Client.ChainedServers[names[i]] = &client.ChainedServerInfo{Addr: fmt.Sprintf("1.2.3.%d:443", i)}
+			cfg.Client.MasqueradeSets[names[i]] = nil
+			cfg.Client.MasqueradeSets[cloudfront] = append(cfg.Client.MasqueradeSets[cloudfront], &fronted.Masquerade{Domain: domains[i], IpAddress: fmt.Sprintf("5.6.7.%d", i)})
+		}
+		cfg.ApplyDefaults()
+		return cfg
+	}
+
+	first, err := yaml.Marshal(build([]int{0, 1, 2, 3, 4}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	second, err := yaml.Marshal(build([]int{3, 1, 4, 0, 2}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, string(first), string(second), "Same config built in a different order should marshal identically")
+}
+
+func TestCloudConfigsNormalized(t *testing.T) {
+	cfg := &Config{CloudConfigs: []string{"http://a.example.com/cloud.yaml.gz", " ", "http://b.example.com/cloud.yaml.gz", " http://a.example.com/cloud.yaml.gz"}}
+	cfg.ApplyDefaults()
+	assert.Equal(t, []string{"http://a.example.com/cloud.yaml.gz", "http://b.example.com/cloud.yaml.gz"}, cfg.CloudConfigs)
+
+	cfg = &Config{CloudConfigs: []string{""}}
+	cfg.ApplyDefaults()
+	assert.Equal(t, []string{chainedCloudConfigUrl}, cfg.CloudConfigs, "Should have fallen back to the default URL")
+}
+
+func TestPollIntervalsClamped(t *testing.T) {
+	for _, c := range []struct {
+		configured time.Duration
+		cloud      time.Duration
+		file       time.Duration
+	}{
+		{0, CloudConfigPollInterval, yamlconf.DefaultFilePollInterval},
+		{time.Millisecond, minCloudPollInterval, minFilePollInterval},
+		{30 * time.Second, 30 * time.Second, 30 * time.Second},
+		{100 * time.Hour, maxCloudPollInterval, maxFilePollInterval},
+	} {
+		cfg := &Config{CloudPollInterval: c.configured, FilePollInterval: c.configured}
+		assert.Equal(t, c.cloud, cfg.cloudPollInterval(), "Wrong cloud poll interval for %v", c.configured)
+		assert.Equal(t, c.file, cfg.filePollInterval(), "Wrong file poll interval for %v", c.configured)
+	}
+
+	origCloud, origFile := *cloudPollInterval, *filePollInterval
+	defer func() {
+		*cloudPollInterval, *filePollInterval = origCloud, origFile
+	}()
+	*cloudPollInterval = 20 * time.Second
+	*filePollInterval = time.Millisecond
+	cfg := &Config{CloudPollInterval: time.Hour, FilePollInterval: 30 * time.Second}
+	assert.Equal(t, 20*time.Second, cfg.cloudPollInterval(), "Flag should override config")
+	assert.Equal(t, minFilePollInterval, cfg.filePollInterval(), "Flag should be clamped too")
+}
+
+func TestCloudPollSleepTimeJitter(t *testing.T) {
+	defer useJitterSeed(1)()
+	cfg := &Config{CloudPollInterval: 20 * time.Minute}
+	// The first sleep after startup is spread differently, see
+	// TestFirstPollSpread
+	cfg.cloudPollSleepTime()
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		sleep := cfg.cloudPollSleepTime()
+		assert.True(t, sleep >= 10*time.Minute && sleep < 30*time.Minute, "Sleep time %v should be around configured interval", sleep)
+		seen[sleep] = true
+	}
+	assert.True(t, len(seen) > 1, "Sleep times should be randomized")
+}
+
+func TestServerDefaults(t *testing.T) {
+	cfg := &Config{Role: "server"}
+	cfg.ApplyDefaults()
+	if assert.NotNil(t, cfg.Server, "Server should have a ServerConfig") {
+		assert.NotNil(t, cfg.Server.FrontFQDNs)
+	}
+	assert.Equal(t, defaultServerAddr, cfg.Addr, "Server should listen on all interfaces")
+	assert.Empty(t, cfg.Validate(), "Server config should be valid")
+	assert.True(t, cfg.IsUpstream())
+	assert.False(t, cfg.IsDownstream())
+
+	cfg = &Config{Role: "server", Server: &server.ServerConfig{Unencrypted: true}}
+	cfg.ApplyDefaults()
+	assert.Equal(t, defaultUnencryptedServerAddr, cfg.Addr, "Unencrypted server should listen on port 80")
+
+	cfg = &Config{Role: "server", Addr: "10.0.0.1:8443", Client: &client.ClientConfig{
+		ChainedServers: map[string]*client.ChainedServerInfo{
+			"fallback-1": &client.ChainedServerInfo{Addr: "1.1.1.1:443"},
+		},
+	}}
+	cfg.ApplyDefaults()
+	assert.Equal(t, "10.0.0.1:8443", cfg.Addr, "Configured address should be kept")
+	assert.Nil(t, cfg.Client.MasqueradeSets, "Client defaults should not be applied to server")
+}
+
+func TestChainedServerDefaults(t *testing.T) {
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	update := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n    fallback-2:\n      addr: 2.2.2.2:443\n      qos: 10\n      weight: 4000\n"
+	if !assert.NoError(t, cfg.updateFrom([]byte(update))) {
+		return
+	}
+	bare := cfg.Client.ChainedServers["fallback-1"]
+	if assert.NotNil(t, bare) {
+		assert.Equal(t, defaultServerQOS, bare.QOS, "Chained server from update should get default QOS")
+		assert.Equal(t, defaultServerWeight, bare.Weight, "Chained server from update should get default weight")
+	}
+	explicit := cfg.Client.ChainedServers["fallback-2"]
+	if assert.NotNil(t, explicit) {
+		assert.Equal(t, 10, explicit.QOS, "Configured QOS should be kept")
+		assert.Equal(t, 4000, explicit.Weight, "Configured weight should be kept")
+	}
+}
+
+func TestMixedMasqueradeProviders(t *testing.T) {
+	cfg := &Config{Client: &client.ClientConfig{}}
+	cfg.ApplyDefaults()
+	update := `
+client:
+  masqueradesets:
+    akamai:
+    - domain: a.akamai.example.com
+      ipaddress: 1.2.3.4
+  frontedservers:
+  - host: akamai.example.com
+    masqueradeset: akamai
+  - host: cloudfront.example.com
+    masqueradeset: cloudfront
+`
+	if !assert.NoError(t, cfg.updateFrom([]byte(update))) {
+		return
+	}
+	assert.Len(t, cfg.Client.MasqueradeSets["akamai"], 1, "Update should introduce new masquerade set")
+	assert.Equal(t, cloudfrontMasquerades, cfg.Client.MasqueradeSets[cloudfront], "Built-in masquerade set used by a server should be loaded")
+	assert.Empty(t, cfg.Validate())
+}
+
+// useTempConfigDir points the config dir at a new temporary directory until
+// the returned function is called.
+func useTempConfigDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	origConfigdir := *configdir
+	*configdir = dir
+	return func() {
+		*configdir = origConfigdir
+		os.RemoveAll(dir)
+	}
+}
+
+// largeCloudConfig returns cloud config YAML the size of what's published,
+// with the given number of proxied sites and a generation that changes the
+// servers and masquerades.
+func largeCloudConfig(sites int, generation int) []byte {
+	var b bytes.Buffer
+	b.WriteString("client:\n  chainedservers:\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, "    fallback-%d-%d:\n      addr: 10.0.%d.%d:443\n      authtoken: token-%d\n", generation, i, generation%256, i, i)
+	}
+	b.WriteString("  masqueradesets:\n    cloudflare:\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "    - domain: masquerade%04d-%d.com\n      ipaddress: 10.1.%d.%d\n", i, generation, i/256, i%256)
+	}
+	b.Write(proxiedSitesUpdate(sites))
+	return b.Bytes()
+}
+
+func BenchmarkUpdateFromLargeConfig(b *testing.B) {
+	updates := [][]byte{largeCloudConfig(defaultMaxProxiedSites, 1), largeCloudConfig(defaultMaxProxiedSites, 2)}
+	cfg := configWithProxiedSites()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cfg.updateFrom(updates[i%2]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateFromUnchangedLargeConfig(b *testing.B) {
+	update := largeCloudConfig(defaultMaxProxiedSites, 1)
+	cfg := configWithProxiedSites()
+	if err := cfg.updateFrom(update); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cfg.updateFrom(update); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPersistLargeConfig(b *testing.B) {
+	dir, err := ioutil.TempDir("", "persist-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := configWithProxiedSites()
+	if err := cfg.updateFrom(largeCloudConfig(defaultMaxProxiedSites, 1)); err != nil {
+		b.Fatal(err)
+	}
+	mgr := &yamlconf.Manager{
+		EmptyConfig: func() yamlconf.Config {
+			return &Config{}
+		},
+		Store: yamlconf.NewFileStore(filepath.Join(dir, "lantern.yaml")),
+		CustomPoll: func(currentCfg yamlconf.Config) (func(cfg yamlconf.Config) error, time.Duration, error) {
+			return func(yamlconf.Config) error { return nil }, time.Hour, nil
+		},
+	}
+	initial, err := yaml.Marshal(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "lantern.yaml"), initial, 0644); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := mgr.Init(); err != nil {
+		b.Fatal(err)
+	}
+	defer mgr.Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := mgr.Update(func(ycfg yamlconf.Config) error {
+			ycfg.(*Config).LastCloudAttempt = time.Unix(int64(i), 0).UTC().Format(time.RFC3339)
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUnchangedUpdateSkipsMerge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Benchmarks large config updates")
+	}
+	full := testing.Benchmark(BenchmarkUpdateFromLargeConfig)
+	unchanged := testing.Benchmark(BenchmarkUpdateFromUnchangedLargeConfig)
+	t.Logf("Changed: %v %v, unchanged: %v %v", full, full.MemString(), unchanged, unchanged.MemString())
+	assert.True(t, unchanged.AllocsPerOp()*2 <= full.AllocsPerOp(), "Unchanged update should allocate at most half as much as merging")
+	assert.True(t, unchanged.NsPerOp()*2 <= full.NsPerOp(), "Unchanged update should take at most half as long as merging")
+
+	// Skipping the merge leaves the config as merging would
+	update := largeCloudConfig(100, 1)
+	merged := configWithProxiedSites()
+	assert.NoError(t, merged.updateFrom(update))
+	skipped, err := merged.candidateFrom(update)
+	if assert.NoError(t, err) {
+		assert.NoError(t, merged.updateFrom(update))
+		skipped.filtered, merged.filtered = nil, nil
+		assert.Equal(t, skipped, merged)
+	}
+
+	// Changing settings with Update makes the next update merge again
+	defer initTestConfig(t, "addr: localhost:8787\n")()
+	assert.NoError(t, m.Update(func(ycfg yamlconf.Config) error {
+		return ycfg.(*Config).updateFrom(update)
+	}))
+	assert.NotEmpty(t, current().LastMergeChecksum)
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.MaxProxiedSites = 50
+		return nil
+	}))
+	assert.Empty(t, current().LastMergeChecksum)
+	assert.Error(t, m.Update(func(ycfg yamlconf.Config) error {
+		return ycfg.(*Config).updateFrom(update)
+	}), "Merging again should apply the new maximum")
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	defer useTempConfigDir(t)()
+	m = newManager(yamlconf.NewMemoryStore([]byte("addr: localhost:8787\n")))
+	if _, err := m.Init(); err != nil {
+		t.Fatalf("Unable to init config: %v", err)
+	}
+	mgr := m
+	defer mgr.Stop()
+	published := make(chan *Config)
+	go func() {
+		for {
+			published <- mgr.Next().(*Config)
+		}
+	}()
+
+	const updates = 40
+	var wg sync.WaitGroup
+	wg.Add(updates)
+	for i := 0; i < updates; i++ {
+		site := fmt.Sprintf("site%02d.com", i)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, Update(func(cfg *Config) error {
+				cfg.ProxiedSites.Delta.Additions = append(cfg.ProxiedSites.Delta.Additions, site)
+				return nil
+			}))
+		}()
+	}
+
+	var last *Config
+	for i := 0; i < updates; i++ {
+		select {
+		case next := <-published:
+			if last != nil {
+				if next.Revision() <= last.Revision() {
+					t.Fatalf("Revision %d published after %d", next.Revision(), last.Revision())
+				}
+				assert.Len(t, next.ProxiedSites.Delta.Additions, len(last.ProxiedSites.Delta.Additions)+1, "Each update should apply to the one before")
+			}
+			last = next
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Only saw %d of %d updates", i, updates)
+		}
+	}
+	wg.Wait()
+	assert.Len(t, last.ProxiedSites.Delta.Additions, updates)
+	assert.Equal(t, current().Revision(), last.Revision(), "Last config published should be the current one")
+
+	assert.NoError(t, UpdateAndFlush(func(cfg *Config) error {
+		cfg.UIAddr = "127.0.0.1:16824"
+		return nil
+	}))
+	saved, err := mgr.Store.Load()
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(saved), "127.0.0.1:16824", "UpdateAndFlush should have saved the update")
+	}
+	<-published
 }
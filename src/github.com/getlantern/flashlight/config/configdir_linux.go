@@ -0,0 +1,134 @@
+// +build linux,!android
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/getlantern/appdir"
+)
+
+const (
+	// migratedMarkerName is the name of the file we leave in the legacy config
+	// dir once we've copied its contents to the XDG config dir.
+	migratedMarkerName = ".migrated-to-xdg"
+)
+
+var (
+	// The config dir used by older versions, ~/.lantern
+	legacyConfigDir = func() string {
+		return appdir.General("Lantern")
+	}
+
+	// The config dirs we've settled on, keyed by legacy and XDG config dir, so
+	// that we only check for a migration once
+	resolvedConfigDirs   = make(map[string]string)
+	resolvedConfigDirsMx sync.Mutex
+)
+
+// defaultConfigDir returns the config dir to use when -configdir isn't given.
+// That's $XDG_CONFIG_HOME/lantern (normally ~/.config/lantern), after copying
+// the contents of the legacy config dir there if it has a config. If that
+// copy fails, we keep using the legacy config dir.
+func defaultConfigDir() string {
+	legacy := legacyConfigDir()
+	xdg := xdgConfigDir()
+	if xdg == "" {
+		return legacy
+	}
+	key := legacy + "|" + xdg
+	resolvedConfigDirsMx.Lock()
+	defer resolvedConfigDirsMx.Unlock()
+	if dir, found := resolvedConfigDirs[key]; found {
+		return dir
+	}
+	dir := xdg
+	if err := migrateLegacyConfigDir(legacy, xdg); err != nil {
+		log.Errorf("Unable to move config from %v to %v, still using %v: %v", legacy, xdg, legacy, err)
+		dir = legacy
+	}
+	resolvedConfigDirs[key] = dir
+	return dir
+}
+
+// xdgConfigDir returns the config dir that the XDG Base Directory
+// specification calls for, or an empty string if there's no home directory.
+func xdgConfigDir() string {
+	if base := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(base) {
+		return filepath.Join(base, "lantern")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "lantern")
+	}
+	return ""
+}
+
+// migrateLegacyConfigDir copies the files in the legacy config dir, like
+// config files, their backups and caches, to the XDG config dir if the legacy
+// config dir has a config that we haven't already copied. It then leaves a
+// marker in the legacy config dir so that we don't copy it again. The legacy
+// config dir is otherwise left alone, in case we're downgraded.
+func migrateLegacyConfigDir(legacy string, xdg string) error {
+	if _, err := os.Stat(filepath.Join(legacy, migratedMarkerName)); err == nil {
+		return nil
+	}
+	files, err := ioutil.ReadDir(legacy)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hasConfig := false
+	for _, file := range files {
+		if _, ok := versionOfConfigFile(file.Name()); ok {
+			hasConfig = true
+		}
+	}
+	if !hasConfig {
+		return nil
+	}
+
+	log.Debugf("Moving config from %v to %v", legacy, xdg)
+	if err := os.MkdirAll(xdg, 0750); err != nil {
+		return fmt.Errorf("Unable to create %v: %v", xdg, err)
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		dst := filepath.Join(xdg, file.Name())
+		if _, err := os.Stat(dst); err == nil {
+			// Don't overwrite anything newer
+			continue
+		}
+		if err := copyFile(filepath.Join(legacy, file.Name()), dst, file.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	marker := fmt.Sprintf("Config moved to %v\n", xdg)
+	return ioutil.WriteFile(filepath.Join(legacy, migratedMarkerName), []byte(marker), 0644)
+}
+
+func copyFile(src string, dst string, perm os.FileMode) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("Unable to read %v: %v", src, err)
+	}
+	// Write to a temp file first so that an interrupted copy isn't mistaken
+	// for a complete one next time
+	tmp := dst + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to write %v: %v", dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to write %v: %v", dst, err)
+	}
+	return nil
+}
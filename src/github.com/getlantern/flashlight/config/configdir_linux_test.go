@@ -0,0 +1,127 @@
+//go:build linux && !android
+// +build linux,!android
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useTempHome points the legacy and XDG config dirs at fresh temp dirs,
+// returning the legacy dir and the XDG config home.
+func useTempHome(t *testing.T) (string, string) {
+	legacy := filepath.Join(t.TempDir(), ".lantern")
+	xdgHome := t.TempDir()
+	origLegacy := legacyConfigDir
+	legacyConfigDir = func() string { return legacy }
+	t.Cleanup(func() { legacyConfigDir = origLegacy })
+	origXDG, hadXDG := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", xdgHome)
+	t.Cleanup(func() {
+		if hadXDG {
+			os.Setenv("XDG_CONFIG_HOME", origXDG)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	})
+	origConfigDir := *configdir
+	*configdir = ""
+	t.Cleanup(func() { *configdir = origConfigDir })
+	return legacy, xdgHome
+}
+
+func TestConfigDirFreshInstall(t *testing.T) {
+	legacy, xdgHome := useTempHome(t)
+
+	dir, path, err := InConfigDir("lantern-2.2.0.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(xdgHome, "lantern"), dir)
+		assert.Equal(t, filepath.Join(xdgHome, "lantern", "lantern-2.2.0.yaml"), path)
+	}
+	_, err = os.Stat(legacy)
+	assert.True(t, os.IsNotExist(err), "Legacy config dir should not have been created")
+
+	os.Unsetenv("XDG_CONFIG_HOME")
+	home := t.TempDir()
+	origHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", origHome)
+	os.Setenv("HOME", home)
+	assert.Equal(t, filepath.Join(home, ".config", "lantern"), defaultConfigDir(), "Should default to ~/.config without XDG_CONFIG_HOME")
+}
+
+func TestConfigDirMigratesLegacy(t *testing.T) {
+	legacy, xdgHome := useTempHome(t)
+	if err := os.MkdirAll(legacy, 0750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"lantern-2.1.0.yaml":     "provenance: custom\n",
+		"lantern-2.1.0.yaml.bak": "provenance: backup\n",
+		"cloud.yaml.gz":          "cached",
+		".packaged-lantern.yaml": "startupurl: http://example.com\n",
+		"config-history.jsonl":   "{}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(legacy, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	xdg := filepath.Join(xdgHome, "lantern")
+	dir, _, err := InConfigDir("lantern-2.2.0.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, xdg, dir)
+	for name, content := range files {
+		b, err := ioutil.ReadFile(filepath.Join(xdg, name))
+		if assert.NoError(t, err, "%v should have been copied", name) {
+			assert.Equal(t, content, string(b))
+		}
+		info, err := os.Stat(filepath.Join(xdg, name))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Permissions of %v should be kept", name)
+		}
+	}
+	_, err = os.Stat(filepath.Join(legacy, migratedMarkerName))
+	assert.NoError(t, err, "Marker should have been left in legacy config dir")
+	_, err = os.Stat(filepath.Join(legacy, "lantern-2.1.0.yaml"))
+	assert.NoError(t, err, "Legacy config should have been left in place")
+
+	// Changes made since aren't clobbered by migrating again
+	if err := ioutil.WriteFile(filepath.Join(xdg, "lantern-2.1.0.yaml"), []byte("provenance: changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	resolvedConfigDirsMx.Lock()
+	resolvedConfigDirs = make(map[string]string)
+	resolvedConfigDirsMx.Unlock()
+	assert.Equal(t, xdg, defaultConfigDir())
+	b, _ := ioutil.ReadFile(filepath.Join(xdg, "lantern-2.1.0.yaml"))
+	assert.Equal(t, "provenance: changed\n", string(b), "Should only have migrated once")
+}
+
+func TestConfigDirFlagWins(t *testing.T) {
+	legacy, xdgHome := useTempHome(t)
+	if err := os.MkdirAll(legacy, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(legacy, "lantern-2.1.0.yaml"), []byte("provenance: custom\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flagged := t.TempDir()
+	*configdir = flagged
+
+	dir, _, err := InConfigDir("lantern-2.2.0.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, flagged, dir, "-configdir should win")
+	}
+	_, err = os.Stat(filepath.Join(xdgHome, "lantern"))
+	assert.True(t, os.IsNotExist(err), "Should not have migrated with -configdir")
+	_, err = os.Stat(filepath.Join(legacy, migratedMarkerName))
+	assert.True(t, os.IsNotExist(err), "Should not have left a marker with -configdir")
+}
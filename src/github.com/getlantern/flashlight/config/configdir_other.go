@@ -0,0 +1,12 @@
+// +build !linux android
+
+package config
+
+import (
+	"github.com/getlantern/appdir"
+)
+
+// defaultConfigDir returns the config dir to use when -configdir isn't given.
+func defaultConfigDir() string {
+	return appdir.General("Lantern")
+}
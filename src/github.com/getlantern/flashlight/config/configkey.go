@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	configKeyFile = "config.key"
+	configKeySize = 32
+)
+
+var (
+	// loadConfigKey loads the key used to encrypt the config file, creating it
+	// if create is true and there isn't one yet. Where possible, the key is
+	// kept in the platform's keychain (Keychain on OS X, a DPAPI protected key
+	// file on Windows or the Secret Service through libsecret on Linux).
+	// Elsewhere, or if that fails, the key is kept in a key file in the config
+	// directory that's readable only by the current user. Note that the plain
+	// key file only keeps the config from being read on its own, not by
+	// someone with access to the whole config directory.
+	loadConfigKey = platformConfigKey
+
+	// loadConfigKeys loads the keys with which an existing config may have been
+	// encrypted, without creating any. That's the keychain's key followed by
+	// the key file's, since a config may have been encrypted with the key file
+	// while the keychain was unavailable.
+	loadConfigKeys = platformConfigKeys
+
+	errNoConfigKey = fmt.Errorf("No config key found")
+)
+
+// configKeyPath returns the path of the config key file.
+func configKeyPath() (string, error) {
+	_, path, err := InConfigDir(configKeyFile)
+	return path, err
+}
+
+// fileConfigKey loads the config key from the key file, creating a new random
+// key if there isn't one and create is true. protect and unprotect transform
+// the key as it's written to and read from the file.
+func fileConfigKey(create bool, protect func([]byte) ([]byte, error), unprotect func([]byte) ([]byte, error)) ([]byte, error) {
+	path, err := configKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := ioutil.ReadFile(path)
+	if err == nil {
+		key, err := unprotect(stored)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read config key from %v: %v", path, err)
+		}
+		if len(key) != configKeySize {
+			return nil, fmt.Errorf("Config key in %v is corrupt", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to read config key from %v: %v", path, err)
+	}
+	if !create {
+		return nil, errNoConfigKey
+	}
+
+	key, err := newConfigKey()
+	if err != nil {
+		return nil, err
+	}
+	protected, err := protect(key)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to protect config key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create directory for config key: %v", err)
+	}
+	if err := ioutil.WriteFile(path, protected, 0600); err != nil {
+		return nil, fmt.Errorf("Unable to save config key to %v: %v", path, err)
+	}
+	log.Debugf("Created config key at %v", path)
+	return key, nil
+}
+
+// keychainOrFileConfigKeys returns the config key from the keychain, as
+// loaded by keychainKey, followed by the one in the key file if that's
+// different. It fails only if neither is available.
+func keychainOrFileConfigKeys(keychainKey func() ([]byte, error)) ([][]byte, error) {
+	var keys [][]byte
+	key, err := keychainKey()
+	if err == nil {
+		keys = append(keys, key)
+	} else {
+		log.Debugf("Unable to get config key from keychain: %v", err)
+	}
+	fileKey, err := fileConfigKey(false, unprotected, unprotected)
+	if err != nil {
+		if len(keys) > 0 {
+			return keys, nil
+		}
+		return nil, err
+	}
+	if len(keys) > 0 && bytes.Equal(keys[0], fileKey) {
+		return keys, nil
+	}
+	return append(keys, fileKey), nil
+}
+
+func newConfigKey() ([]byte, error) {
+	key := make([]byte, configKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("Unable to generate config key: %v", err)
+	}
+	return key, nil
+}
+
+func unprotected(key []byte) ([]byte, error) {
+	return key, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	keychainService = "Lantern"
+	keychainAccount = "config-key"
+)
+
+var (
+	// The command line tool for the keychain
+	securityTool = "security"
+)
+
+// platformConfigKey keeps the config key in the user's login keychain,
+// falling back to the key file if the keychain isn't available.
+func platformConfigKey(create bool) ([]byte, error) {
+	key, err := keychainConfigKey()
+	if err == nil {
+		return key, nil
+	}
+	log.Debugf("Unable to get config key from keychain: %v", err)
+	key, err = fileConfigKey(false, unprotected, unprotected)
+	if err != errNoConfigKey || !create {
+		return key, err
+	}
+
+	key, err = newConfigKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := saveKeychainConfigKey(key); err != nil {
+		log.Errorf("Unable to save config key to keychain, using key file instead: %v", err)
+		return fileConfigKey(true, unprotected, unprotected)
+	}
+	return key, nil
+}
+
+func platformConfigKeys() ([][]byte, error) {
+	return keychainOrFileConfigKeys(keychainConfigKey)
+}
+
+// saveKeychainConfigKey saves the given key to the keychain. The command that
+// adds it is passed to security's interactive mode on stdin, since anyone can
+// see the arguments of a running command with ps. Interactive mode doesn't
+// fail when a command does, so this reads the key back to check that it was
+// saved.
+func saveKeychainConfigKey(key []byte) error {
+	cmd := exec.Command(securityTool, "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %v -a %v -w %v\n", keychainService, keychainAccount, hex.EncodeToString(key)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v\n%s", err, out)
+	}
+	saved, err := keychainConfigKey()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(saved, key) {
+		return fmt.Errorf("Config key in keychain doesn't match the one saved")
+	}
+	return nil
+}
+
+func keychainConfigKey() ([]byte, error) {
+	cmd := exec.Command(securityTool, "find-generic-password", "-s", keychainService, "-a", keychainAccount, "-w")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to run security command: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil || len(key) != configKeySize {
+		return nil, fmt.Errorf("Config key in keychain is corrupt")
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+)
+
+// useFakeSecurityTool replaces security with a script that keeps the secret
+// in a file in a temp dir, returning that file and the file to which the
+// script appends its arguments.
+func useFakeSecurityTool(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	args := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "security")
+	err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> "`+args+`"
+case "$1" in
+-i) read cmd; echo "${cmd##* -w }" > "`+secret+`" ;;
+find-generic-password) cat "`+secret+`" 2>/dev/null || exit 1 ;;
+esac
+`), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := securityTool
+	securityTool = script
+	t.Cleanup(func() { securityTool = orig })
+	return secret, args
+}
+
+func TestKeychainConfigKey(t *testing.T) {
+	secret, args := useFakeSecurityTool(t)
+	origConfigdir := *configdir
+	*configdir = t.TempDir()
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	_, err := platformConfigKey(false)
+	assert.Equal(t, errNoConfigKey, err, "Key shouldn't be created unless asked")
+
+	key, err := platformConfigKey(true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, key, configKeySize)
+	stored, err := ioutil.ReadFile(secret)
+	if assert.NoError(t, err, "Key should have been stored in the keychain") {
+		hexKey := strings.TrimSpace(string(stored))
+		passed, _ := ioutil.ReadFile(args)
+		assert.False(t, strings.Contains(string(passed), hexKey), "Key shouldn't have been passed as an argument")
+	}
+	_, err = os.Stat(filepath.Join(*configdir, configKeyFile))
+	assert.True(t, os.IsNotExist(err), "Key file shouldn't have been needed")
+
+	reloaded, err := platformConfigKey(false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key, reloaded)
+	}
+}
+
+func TestKeychainUnavailableForEncryptedConfig(t *testing.T) {
+	secret, _ := useFakeSecurityTool(t)
+	origConfigdir := *configdir
+	*configdir = t.TempDir()
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	encrypt := true
+	mem := yamlconf.NewMemoryStore(nil)
+	if !assert.NoError(t, newEncryptingStore(mem, &encrypt).Save([]byte(plaintextConfig))) {
+		return
+	}
+	stored, _ := ioutil.ReadFile(secret)
+	sealed, _ := mem.Load()
+
+	// While the keychain lookup fails, saving shouldn't encrypt the config with
+	// a new key
+	fakeSecurityTool := securityTool
+	securityTool = filepath.Join(t.TempDir(), "missing")
+	store := newEncryptingStore(mem, nil)
+	_, err := store.Load()
+	assert.Error(t, err)
+	assert.Error(t, store.Save([]byte(plaintextConfig)))
+	_, err = os.Stat(filepath.Join(*configdir, configKeyFile))
+	assert.True(t, os.IsNotExist(err), "No key file should have been created")
+	raw, _ := mem.Load()
+	assert.Equal(t, sealed, raw, "Config should have been left alone")
+
+	securityTool = fakeSecurityTool
+	reloaded, _ := ioutil.ReadFile(secret)
+	assert.Equal(t, stored, reloaded, "Key in keychain should have been left alone")
+	loaded, err := newEncryptingStore(mem, nil).Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, plaintextConfig, string(loaded))
+	}
+}
@@ -0,0 +1,67 @@
+//go:build linux && !android
+// +build linux,!android
+
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	secretService = "Lantern"
+	secretAccount = "config-key"
+)
+
+var (
+	// The libsecret command line tool, which talks to whatever implements the
+	// Secret Service, like GNOME Keyring or KWallet
+	secretTool = "secret-tool"
+)
+
+// platformConfigKey keeps the config key with the Secret Service through
+// libsecret, falling back to the key file if there's no Secret Service, like
+// on headless machines.
+func platformConfigKey(create bool) ([]byte, error) {
+	key, err := secretServiceConfigKey()
+	if err == nil {
+		return key, nil
+	}
+	log.Debugf("Unable to get config key from Secret Service: %v", err)
+	key, err = fileConfigKey(false, unprotected, unprotected)
+	if err != errNoConfigKey || !create {
+		return key, err
+	}
+
+	key, err = newConfigKey()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(secretTool, "store", "--label=Lantern config key", "service", secretService, "account", secretAccount)
+	cmd.Stdin = strings.NewReader(hex.EncodeToString(key))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Errorf("Unable to save config key to Secret Service, using key file instead: %s\n%s", err, out)
+		return fileConfigKey(true, unprotected, unprotected)
+	}
+	return key, nil
+}
+
+func platformConfigKeys() ([][]byte, error) {
+	return keychainOrFileConfigKeys(secretServiceConfigKey)
+}
+
+func secretServiceConfigKey() ([]byte, error) {
+	cmd := exec.Command(secretTool, "lookup", "service", secretService, "account", secretAccount)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to run %v: %v", secretTool, err)
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(out)))
+	if err != nil || len(key) != configKeySize {
+		return nil, fmt.Errorf("Config key in Secret Service is corrupt")
+	}
+	return key, nil
+}
@@ -0,0 +1,134 @@
+//go:build linux && !android
+// +build linux,!android
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+)
+
+// useFakeSecretTool replaces secret-tool with a script that keeps the secret in
+// a file in a temp dir, returning that file.
+func useFakeSecretTool(t *testing.T) string {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	script := filepath.Join(dir, "secret-tool")
+	err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+case "$1" in
+store) cat > "`+secret+`" ;;
+lookup) cat "`+secret+`" 2>/dev/null || exit 1 ;;
+esac
+`), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := secretTool
+	secretTool = script
+	t.Cleanup(func() { secretTool = orig })
+	return secret
+}
+
+func TestSecretServiceConfigKey(t *testing.T) {
+	secret := useFakeSecretTool(t)
+	origConfigdir := *configdir
+	*configdir = t.TempDir()
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	_, err := platformConfigKey(false)
+	assert.Equal(t, errNoConfigKey, err, "Key shouldn't be created unless asked")
+
+	key, err := platformConfigKey(true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, key, configKeySize)
+	_, err = os.Stat(secret)
+	assert.NoError(t, err, "Key should have been stored with the Secret Service")
+	_, err = os.Stat(filepath.Join(*configdir, configKeyFile))
+	assert.True(t, os.IsNotExist(err), "Key file shouldn't have been needed")
+
+	reloaded, err := platformConfigKey(false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key, reloaded)
+	}
+
+	// Without a Secret Service, we make do with the key file
+	secretTool = filepath.Join(t.TempDir(), "missing")
+	key, err = platformConfigKey(true)
+	if assert.NoError(t, err) {
+		assert.Len(t, key, configKeySize)
+		_, err = os.Stat(filepath.Join(*configdir, configKeyFile))
+		assert.NoError(t, err)
+	}
+}
+
+func TestSecretServiceUnavailableForEncryptedConfig(t *testing.T) {
+	secret := useFakeSecretTool(t)
+	origConfigdir := *configdir
+	*configdir = t.TempDir()
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	encrypt := true
+	mem := yamlconf.NewMemoryStore(nil)
+	if !assert.NoError(t, newEncryptingStore(mem, &encrypt).Save([]byte(plaintextConfig))) {
+		return
+	}
+	stored, _ := ioutil.ReadFile(secret)
+	sealed, _ := mem.Load()
+
+	// While the Secret Service is unavailable, saving shouldn't encrypt the
+	// config with a new key
+	fakeSecretTool := secretTool
+	secretTool = filepath.Join(t.TempDir(), "missing")
+	store := newEncryptingStore(mem, nil)
+	_, err := store.Load()
+	assert.Error(t, err)
+	assert.Error(t, store.Save([]byte(plaintextConfig)))
+	_, err = os.Stat(filepath.Join(*configdir, configKeyFile))
+	assert.True(t, os.IsNotExist(err), "No key file should have been created")
+	raw, _ := mem.Load()
+	assert.Equal(t, sealed, raw, "Config should have been left alone")
+
+	secretTool = fakeSecretTool
+	reloaded, _ := ioutil.ReadFile(secret)
+	assert.Equal(t, stored, reloaded, "Key in Secret Service should have been left alone")
+	loaded, err := newEncryptingStore(mem, nil).Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, plaintextConfig, string(loaded))
+	}
+}
+
+func TestConfigEncryptedWithKeyFileWhileSecretServiceHasKey(t *testing.T) {
+	useFakeSecretTool(t)
+	origConfigdir := *configdir
+	*configdir = t.TempDir()
+	defer func() {
+		*configdir = origConfigdir
+	}()
+	if _, err := platformConfigKey(true); err != nil {
+		t.Fatalf("Unable to create key in Secret Service: %v", err)
+	}
+	fileKey, err := fileConfigKey(true, unprotected, unprotected)
+	if err != nil {
+		t.Fatalf("Unable to create key file: %v", err)
+	}
+	sealed, err := seal(fileKey, []byte(plaintextConfig))
+	if err != nil {
+		t.Fatalf("Unable to seal config: %v", err)
+	}
+
+	loaded, err := newEncryptingStore(yamlconf.NewMemoryStore(sealed), nil).Load()
+	if assert.NoError(t, err, "Should have fallen back to the key file") {
+		assert.Equal(t, plaintextConfig, string(loaded))
+	}
+}
@@ -0,0 +1,16 @@
+//go:build (!darwin && !windows && !linux) || android
+// +build !darwin,!windows,!linux android
+
+package config
+
+func platformConfigKey(create bool) ([]byte, error) {
+	return fileConfigKey(create, unprotected, unprotected)
+}
+
+func platformConfigKeys() ([][]byte, error) {
+	key, err := platformConfigKey(false)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{key}, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	cryptProtectUIForbidden = 0x1
+)
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+// dataBlob is a DATA_BLOB as used by the DPAPI functions.
+type dataBlob struct {
+	cbData uint32
+	pbData *byte
+}
+
+func newDataBlob(data []byte) *dataBlob {
+	if len(data) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{cbData: uint32(len(data)), pbData: &data[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	data := make([]byte, b.cbData)
+	copy(data, (*[1 << 30]byte)(unsafe.Pointer(b.pbData))[:b.cbData:b.cbData])
+	return data
+}
+
+// platformConfigKey keeps the config key in the key file, protected with DPAPI
+// so that only the current Windows user can use it.
+func platformConfigKey(create bool) ([]byte, error) {
+	return fileConfigKey(create, dpapiProtect, dpapiUnprotect)
+}
+
+func platformConfigKeys() ([][]byte, error) {
+	key, err := platformConfigKey(false)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{key}, nil
+}
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	return dpapi(procCryptProtectData, data)
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	return dpapi(procCryptUnprotectData, data)
+}
+
+func dpapi(proc *syscall.LazyProc, data []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := proc.Call(uintptr(unsafe.Pointer(newDataBlob(data))), 0, 0, 0, 0, cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("%v failed: %v", proc.Name, err)
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.pbData)))
+	return out.bytes(), nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// parseConfigProxy parses the given ConfigProxy setting, which must be a
+// socks5://[user:password@]host:port URL.
+func parseConfigProxy(configProxy string) (*url.URL, error) {
+	u, err := url.Parse(configProxy)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid URL: %v", err)
+	}
+	if u.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported scheme %q, only socks5 is supported", u.Scheme)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return nil, fmt.Errorf("not a valid host:port: %v", err)
+	}
+	return u, nil
+}
+
+// configProxy returns the SOCKS proxy through which to fetch cloud config
+// when the local proxy doesn't work, or nil if there isn't one. The
+// -config-proxy flag takes precedence over the config so that cloud updates
+// can't override it.
+func configProxy() (*url.URL, error) {
+	configured := *configProxyFlag
+	if configured == "" {
+		if cfg := current(); cfg != nil {
+			configured = cfg.ConfigProxy
+		}
+	}
+	if configured == "" {
+		return nil, nil
+	}
+	u, err := parseConfigProxy(configured)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config proxy %v: %v", configured, err)
+	}
+	return u, nil
+}
+
+// fetchCloudConfigViaSOCKS fetches the cloud config at the given URL through
+// the given SOCKS proxy.
+func fetchCloudConfigViaSOCKS(ctx context.Context, url string, proxyURL *url.URL) ([]byte, error) {
+	dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create dialer for config proxy %v: %v", proxyURL.Host, err)
+	}
+	client := &http.Client{
+		// The SOCKS proxy takes the place of the system proxy
+		Transport: newTransport(dialer.Dial, false),
+		Timeout:   bootstrapAttemptTimeout,
+	}
+	// The SOCKS proxy isn't one of ours, so don't send it an auth token
+	bytes, err := fetchCloudConfigWith(ctx, client, url, "", "")
+	if err != nil {
+		err = fmt.Errorf("Unable to fetch cloud config through config proxy %v: %v", proxyURL.Host, err)
+		reportError(FetchError, err, false)
+		return nil, err
+	}
+	log.Debugf("Fetched cloud config through config proxy %v", proxyURL.Host)
+	return bytes, nil
+}
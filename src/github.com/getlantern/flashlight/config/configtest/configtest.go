@@ -0,0 +1,202 @@
+// Package configtest provides a fixture cloud config server for testing code
+// that fetches cloud config, without going to the network.
+package configtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+const (
+	// The headers with which cloud config servers pass ETags, which are
+	// custom so that intermediate proxies leave them alone
+	etagHeader        = "X-Lantern-Etag"
+	ifNoneMatchHeader = "X-Lantern-If-None-Match"
+
+	// The header with which cloud config servers pass the signature of the
+	// config
+	signatureHeader = "X-Lantern-Signature"
+
+	// The headers with which clients ask for deltas and servers say they sent
+	// one
+	acceptDeltaHeader = "X-Lantern-Accept-Delta"
+	deltaBaseHeader   = "X-Lantern-Delta-Base"
+
+	// Path is the path at which the server serves cloud config.
+	Path = "/cloud.yaml.gz"
+)
+
+// CloudConfigServer is an HTTP server that serves gzipped cloud config YAML
+// like the real cloud config server, including answering with 304 Not
+// Modified to requests with the current ETag. Failures can be scripted with
+// FailNext, the config can be signed with SignWith and deltas can be served
+// with SetConfigWithDelta.
+type CloudConfigServer struct {
+	*httptest.Server
+
+	yml         []byte
+	config      []byte
+	etag        string
+	sign        func(yml []byte) []byte
+	signature   string
+	failures    []int
+	requests    int
+	notModified int
+	mx          sync.Mutex
+
+	delta          []byte
+	deltaGzipped   []byte
+	deltaBase      string
+	deltaSignature string
+	deltas         int
+}
+
+// NewCloudConfigServer starts a CloudConfigServer serving the given YAML. Call
+// Close when done with it.
+func NewCloudConfigServer(yml string) *CloudConfigServer {
+	s := &CloudConfigServer{}
+	s.SetConfig(yml)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// ConfigURL returns the URL of the cloud config.
+func (s *CloudConfigServer) ConfigURL() string {
+	return s.URL + Path
+}
+
+// SetConfig changes the YAML being served, which gets a new ETag.
+func (s *CloudConfigServer) SetConfig(yml string) {
+	config := gzipped([]byte(yml))
+	sum := sha256.Sum256([]byte(yml))
+
+	s.mx.Lock()
+	s.yml = []byte(yml)
+	s.config = config
+	s.etag = hex.EncodeToString(sum[:8])
+	s.signature = s.signed()
+	s.delta, s.deltaGzipped, s.deltaBase, s.deltaSignature = nil, nil, "", ""
+	s.mx.Unlock()
+}
+
+// SetConfigWithDelta changes the YAML being served like SetConfig, and serves
+// the given JSON Patch instead to clients that ask for a delta against the
+// YAML that was being served until now.
+func (s *CloudConfigServer) SetConfigWithDelta(yml string, delta string) {
+	s.mx.Lock()
+	base := s.etag
+	s.mx.Unlock()
+	s.SetConfig(yml)
+
+	s.mx.Lock()
+	s.delta = []byte(delta)
+	s.deltaGzipped = gzipped([]byte(delta))
+	s.deltaBase = base
+	s.deltaSignature = s.signedDelta()
+	s.mx.Unlock()
+}
+
+// Deltas returns how many requests the server has answered with a delta.
+func (s *CloudConfigServer) Deltas() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.deltas
+}
+
+// SignWith makes the server sign the config it serves with the given
+// function, which returns the raw signature of the YAML. nil stops signing.
+func (s *CloudConfigServer) SignWith(sign func(yml []byte) []byte) {
+	s.mx.Lock()
+	s.sign = sign
+	s.signature = s.signed()
+	s.deltaSignature = s.signedDelta()
+	s.mx.Unlock()
+}
+
+func (s *CloudConfigServer) signed() string {
+	if s.sign == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.sign(s.yml))
+}
+
+func (s *CloudConfigServer) signedDelta() string {
+	if s.sign == nil || s.delta == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.sign(s.delta))
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// FailNext makes the server answer the next requests with the given HTTP
+// statuses, one per request, before serving config again.
+func (s *CloudConfigServer) FailNext(statuses ...int) {
+	s.mx.Lock()
+	s.failures = append(s.failures, statuses...)
+	s.mx.Unlock()
+}
+
+// Requests returns how many requests the server has had.
+func (s *CloudConfigServer) Requests() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests
+}
+
+// NotModified returns how many requests the server has answered with 304 Not
+// Modified.
+func (s *CloudConfigServer) NotModified() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.notModified
+}
+
+func (s *CloudConfigServer) serve(resp http.ResponseWriter, req *http.Request) {
+	s.mx.Lock()
+	s.requests++
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mx.Unlock()
+		resp.WriteHeader(status)
+		return
+	}
+	if req.URL.Path != Path {
+		s.mx.Unlock()
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.Header.Get(ifNoneMatchHeader) == s.etag {
+		s.notModified++
+		s.mx.Unlock()
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+	config, etag, signature := s.config, s.etag, s.signature
+	if s.delta != nil && req.Header.Get(acceptDeltaHeader) != "" && req.Header.Get(ifNoneMatchHeader) == s.deltaBase {
+		config, signature = s.deltaGzipped, s.deltaSignature
+		resp.Header().Set(deltaBaseHeader, s.deltaBase)
+		s.deltas++
+	}
+	s.mx.Unlock()
+
+	resp.Header().Set(etagHeader, etag)
+	if signature != "" {
+		resp.Header().Set(signatureHeader, signature)
+	}
+	resp.Header().Set("Content-Type", "application/x-gzip")
+	resp.Write(config)
+}
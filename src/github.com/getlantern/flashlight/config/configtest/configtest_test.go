@@ -0,0 +1,56 @@
+package configtest
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudConfigServer(t *testing.T) {
+	srv := NewCloudConfigServer("addr: 127.0.0.1:8787\n")
+	defer srv.Close()
+
+	get := func(etag string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.ConfigURL(), nil)
+		if etag != "" {
+			req.Header.Set(ifNoneMatchHeader, etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return resp
+	}
+
+	resp := get("")
+	if assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		gzReader, err := gzip.NewReader(resp.Body)
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(gzReader)
+			assert.Equal(t, "addr: 127.0.0.1:8787\n", string(body))
+		}
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get(etagHeader)
+	assert.NotEmpty(t, etag)
+
+	resp = get(etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, 1, srv.NotModified())
+
+	srv.FailNext(http.StatusInternalServerError)
+	resp = get(etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Scripted failure should come first")
+
+	srv.SetConfig("addr: 127.0.0.1:8788\n")
+	resp = get(etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Changed config should be served")
+	assert.NotEqual(t, etag, resp.Header.Get(etagHeader))
+	assert.Equal(t, 4, srv.Requests())
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestMarkPackagedConfig(t *testing.T) {
+	marked := func(packaged string) map[string]interface{} {
+		data, err := markPackagedConfig([]byte(packaged))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+
+	tree := marked("provenance: custom\n")
+	assert.Equal(t, true, tree[preserveCustomServersKey], "Custom config should keep its servers")
+	tree = marked("client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n")
+	assert.Equal(t, provenanceCustom, tree[provenanceKey])
+	_, found := tree[preserveCustomServersKey]
+	assert.False(t, found, "Config guessed to be custom should not be marked")
+	tree = marked("provenance: custom\npreservecustomservers: false\n")
+	assert.Equal(t, false, tree[preserveCustomServersKey], "Should not override an explicit setting")
+	tree = marked("provenance: standard\n")
+	_, found = tree[preserveCustomServersKey]
+	assert.False(t, found, "Standard config should not be marked")
+}
+
+func TestPreserveCustomServersSurvivesMigration(t *testing.T) {
+	path := writeTempConfig(t, "cloudconfig: http://example.com/cloud.yaml.gz\npreservecustomservers: true\n")
+	defer os.Remove(path)
+	defer os.Remove(path + ".schema0.bak")
+	assert.NoError(t, migrateConfigFile(path))
+	assert.Equal(t, true, readTree(t, path)[preserveCustomServersKey])
+}
+
+func TestCustomDeploymentKeepsServers(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("client:\n  chainedservers:\n    fallback-public:\n      addr: 2.2.2.2:443\nproxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	// As if installed from a custom distribution
+	seeded, err := markPackagedConfig([]byte("provenance: custom\nclient:\n  chainedservers:\n    custom-1:\n      addr: 1.1.1.1:443\n      authtoken: custom-token\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, seeded, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Init("2.1.0", WithConfigDir(dir), WithCloudConfigURLs(srv.ConfigURL(), ""), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer Stop()
+	// Consume updates like Run would
+	mgr := m
+	go func() {
+		for {
+			mgr.Next()
+		}
+	}()
+	assert.True(t, cfg.PreserveCustomServers)
+	assert.True(t, IsCustomDeployment())
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	poll()
+	srv.SetConfig("preservecustomservers: false\nclient:\n  chainedservers:\n    fallback-other:\n      addr: 3.3.3.3:443\nproxiedsites:\n  cloud:\n  - b.com\n")
+	poll()
+	poll()
+	assert.Equal(t, 3, srv.Requests())
+	servers := ChainedServers()
+	if assert.Len(t, servers, 1, "Should have kept custom servers across polls") {
+		assert.Equal(t, "custom-token", string(servers["custom-1"].AuthToken))
+	}
+	assert.Contains(t, ProxiedSiteList(), "b.com", "Should have merged other sections")
+	assert.True(t, IsCustomDeployment(), "Cloud config should not clear the flag")
+	assert.NoError(t, Flush())
+	assert.Equal(t, true, readTree(t, path)[preserveCustomServersKey], "Flag should have been saved")
+
+	// Rejoining the public pool
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.PreserveCustomServers = false
+		return nil
+	}))
+	assert.False(t, IsCustomDeployment())
+	srv.SetConfig("client:\n  chainedservers:\n    fallback-public:\n      addr: 2.2.2.2:443\nproxiedsites:\n  cloud:\n  - a.com\n")
+	poll()
+	servers = ChainedServers()
+	assert.Len(t, servers, 1)
+	assert.NotNil(t, servers["fallback-public"], "Should have taken cloud servers once the flag was cleared")
+}
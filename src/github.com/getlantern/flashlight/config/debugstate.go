@@ -0,0 +1,192 @@
+package config
+
+import (
+	"expvar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PollState is a snapshot of the state of polling for cloud config, for
+// diagnosing clients that don't get updates. It never includes secrets.
+type PollState struct {
+	CloudConfigURL      string        // The URL we poll, without any credentials
+	Polls               int64         // How many times we've polled this session
+	Successes           int64         // How many polls fetched cloud config or found it unchanged
+	Failures            int64         // How many polls failed
+	ConsecutiveFailures int64         // How many polls have failed since the last success
+	LastStatusCode      int           // The HTTP status of the last response to a fetch, zero if there's been none
+	LastError           string        // Why the last poll failed, if it did
+	LastETag            string        // The ETag of the cloud config we last fetched
+	Provenance          string        // Where the cloud settings in the current config came from, see Config.CloudProvenance
+	LastPoll            time.Time     // When we last polled
+	NextPoll            time.Time     // When we'll poll next
+	Backoff             time.Duration // How long we're waiting between the last poll and the next
+	QuarantinedETag     string        // The ETag of the cloud config we rejected and won't download again until a new one is published, if any
+	QuarantineReason    string        // Why we rejected the quarantined cloud config
+	QuarantinedSince    time.Time     // When we first rejected the quarantined cloud config
+	RequiredVersion     string        // The version of Lantern that the quarantined cloud config requires, if it was quarantined for needing a newer one
+
+	// The cloud config last confirmed healthy with MarkHealthy, by ETag and by
+	// the revision of the config in which it was confirmed, see
+	// Config.Revision
+	HealthyETag     string
+	HealthyRevision int64
+
+	// Since when, and why, the current config has been reported unhealthy
+	// with MarkUnhealthy, zero if it hasn't
+	UnhealthySince  time.Time
+	UnhealthyReason string
+
+	// How fetching from each config URL has been going
+	URLs []URLFetchState
+
+	// How far ahead of our clock we think the servers' clocks are, going by
+	// the Date headers of their responses, overall and for each URL
+	ClockSkew  time.Duration
+	ClockSkews []URLClockSkew
+
+	// How each direct fronter fared the last time we fetched cloud config via
+	// domain fronting
+	FrontedAttempts []FrontedAttempt
+}
+
+var (
+	pollState   PollState
+	pollStateMx sync.Mutex
+
+	// Published as config.* in expvar, like config.polls
+	pollVars = expvar.NewMap("config")
+)
+
+// DebugState returns a snapshot of the state of polling for cloud config, for
+// example for a diagnostics page.
+func DebugState() PollState {
+	pollStateMx.Lock()
+	state := pollState
+	pollStateMx.Unlock()
+	if cfg := current(); cfg != nil {
+		state.Provenance = cfg.CloudProvenance
+		state.ClockSkew = cfg.estimatedClockSkew()
+	}
+	state.URLs = circuits.states(time.Now())
+	state.ClockSkews = clockSkewStates()
+	return state
+}
+
+// recordPoll records the outcome of polling the given URL at the given time.
+func recordPoll(cloudURL string, attempted time.Time, fetchErr error) {
+	updatePollState(func(state *PollState) {
+		state.CloudConfigURL = withoutCredentials(cloudURL)
+		state.Polls++
+		if fetchErr != nil {
+			state.Failures++
+			state.ConsecutiveFailures++
+			state.LastError = redactURLCredentials(fetchErr.Error())
+		} else {
+			state.Successes++
+			state.ConsecutiveFailures = 0
+			state.LastError = ""
+			state.LastETag = lastCloudConfigETag[cloudURL]
+		}
+		state.LastPoll = attempted
+	})
+}
+
+// recordNextPoll records that, as of the given time, we'll wait for the given
+// time before polling again.
+func recordNextPoll(now time.Time, waitTime time.Duration) {
+	updatePollState(func(state *PollState) {
+		state.Backoff = waitTime
+		state.NextPoll = now.Add(waitTime)
+	})
+}
+
+// recordStatusCode records the HTTP status of a response to a fetch.
+func recordStatusCode(status int) {
+	updatePollState(func(state *PollState) {
+		state.LastStatusCode = status
+	})
+}
+
+// updatePollState changes the poll state with the given function and
+// publishes the result to expvar.
+func updatePollState(update func(state *PollState)) {
+	pollStateMx.Lock()
+	defer pollStateMx.Unlock()
+	update(&pollState)
+	publishPollState(AutoReportEnabled())
+}
+
+// publishPollState publishes the poll state to expvar if enabled is true, or
+// clears what we've published otherwise, since the user has asked us not to
+// report usage data. pollStateMx must be held.
+func publishPollState(enabled bool) {
+	if !enabled {
+		pollVars.Init()
+		return
+	}
+	setString := func(name string, value string) {
+		v := new(expvar.String)
+		v.Set(value)
+		pollVars.Set(name, v)
+	}
+	setInt := func(name string, value int64) {
+		v := new(expvar.Int)
+		v.Set(value)
+		pollVars.Set(name, v)
+	}
+	setString("cloudConfigURL", pollState.CloudConfigURL)
+	setInt("polls", pollState.Polls)
+	setInt("successes", pollState.Successes)
+	setInt("failures", pollState.Failures)
+	setInt("consecutiveFailures", pollState.ConsecutiveFailures)
+	setInt("lastStatusCode", int64(pollState.LastStatusCode))
+	setString("lastError", pollState.LastError)
+	setString("lastETag", pollState.LastETag)
+	setString("lastPoll", formatPollTime(pollState.LastPoll))
+	setString("nextPoll", formatPollTime(pollState.NextPoll))
+	setString("backoff", pollState.Backoff.String())
+	setString("quarantinedETag", pollState.QuarantinedETag)
+	setString("quarantineReason", pollState.QuarantineReason)
+	setString("quarantinedSince", formatPollTime(pollState.QuarantinedSince))
+	setString("requiredVersion", pollState.RequiredVersion)
+	setString("healthyETag", pollState.HealthyETag)
+	setInt("healthyRevision", pollState.HealthyRevision)
+	setString("unhealthySince", formatPollTime(pollState.UnhealthySince))
+	setString("unhealthyReason", pollState.UnhealthyReason)
+}
+
+func formatPollTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// withoutCredentials returns the given URL with any user and password
+// removed.
+func withoutCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// redactURLCredentials masks the credentials in any URLs in the given
+// message, like those of a ConfigProxy.
+func redactURLCredentials(msg string) string {
+	words := strings.Fields(msg)
+	for _, word := range words {
+		trimmed := strings.Trim(word, `"',:;()[]`)
+		u, err := url.Parse(trimmed)
+		if err != nil || u.User == nil || u.Host == "" {
+			continue
+		}
+		msg = strings.Replace(msg, u.User.String()+"@", redacted+"@", -1)
+	}
+	return msg
+}
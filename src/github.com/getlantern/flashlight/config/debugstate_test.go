@@ -0,0 +1,75 @@
+package config
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestPollStateInExpvar(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	defer restoreOptions()()
+	// Credentials in the URL must not be published
+	configURL := strings.Replace(srv.ConfigURL(), "http://", "http://user:secret@", 1)
+	(&options{
+		chainedURL:       configURL,
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+configURL+"\n")()
+	origState := pollState
+	pollState = PollState{}
+	defer func() {
+		pollState = origState
+	}()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+	vars := func() map[string]string {
+		published := make(map[string]string)
+		expvar.Get("config").(*expvar.Map).Do(func(kv expvar.KeyValue) {
+			published[kv.Key] = kv.Value.String()
+		})
+		return published
+	}
+
+	poll()
+	srv.FailNext(http.StatusInternalServerError, http.StatusBadGateway)
+	poll()
+	poll()
+	published := vars()
+	assert.Equal(t, "3", published["polls"])
+	assert.Equal(t, "1", published["successes"])
+	assert.Equal(t, "2", published["failures"])
+	assert.Equal(t, "2", published["consecutiveFailures"])
+	assert.Equal(t, "502", published["lastStatusCode"])
+	assert.Contains(t, published["lastError"], "502")
+	assert.Equal(t, fmt.Sprintf("%q", strings.Replace(configURL, "user:secret@", "", 1)), published["cloudConfigURL"])
+	assert.NotEqual(t, `""`, published["lastETag"])
+	assert.NotEqual(t, `""`, published["nextPoll"])
+
+	poll()
+	published = vars()
+	assert.Equal(t, "0", published["consecutiveFailures"], "Success should reset consecutive failures")
+	assert.Equal(t, "304", published["lastStatusCode"], "Unchanged config should have been reported as not modified")
+	assert.Equal(t, `""`, published["lastError"])
+	for name, value := range published {
+		assert.NotContains(t, value, "secret", "%v should not include secrets", name)
+	}
+
+	state := DebugState()
+	assert.Equal(t, int64(4), state.Polls)
+	assert.Equal(t, cloudProvenanceFetched, state.Provenance)
+	assert.True(t, state.NextPoll.After(state.LastPoll))
+}
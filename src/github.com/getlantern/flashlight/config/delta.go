@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// The header with which we tell the cloud config server that it may answer
+	// with a delta against the config with our If-None-Match ETag, and the
+	// format of delta we understand
+	acceptDeltaHeader = "X-Lantern-Accept-Delta"
+	deltaFormat       = "json-patch"
+
+	// The header with which the cloud config server says that it answered with
+	// a delta (a JSON Patch, RFC 6902, to the YAML as a tree) and which ETag
+	// it's against
+	deltaBaseHeader = "X-Lantern-Delta-Base"
+)
+
+var (
+	// The last cloud config fetched from each URL, which deltas apply to
+	lastCloudConfigPayload = map[string][]byte{}
+)
+
+// deltaError indicates that a cloud config delta couldn't be applied, in which
+// case we fetch the whole config instead.
+type deltaError struct {
+	err error
+}
+
+func (e *deltaError) Error() string {
+	return fmt.Sprintf("Unable to apply cloud config delta: %v", e.err)
+}
+
+// applyCloudConfigDeltaFor applies the delta fetched from url against the
+// config with the ETag base, returning the whole new config.
+func applyCloudConfigDeltaFor(url string, base string, delta []byte) ([]byte, error) {
+	payload := lastCloudConfigPayload[url]
+	if payload == nil || base != lastCloudConfigETag[url] {
+		return nil, &deltaError{fmt.Errorf("delta is against %q but we have %q", base, lastCloudConfigETag[url])}
+	}
+	patched, err := applyCloudConfigDelta(payload, delta)
+	if err != nil {
+		return nil, &deltaError{err}
+	}
+	return patched, nil
+}
+
+// patchOperation is an operation of a JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyCloudConfigDelta applies the given JSON Patch to the given cloud config
+// YAML, returning the patched YAML.
+func applyCloudConfigDelta(yml []byte, delta []byte) ([]byte, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(delta, &ops); err != nil {
+		return nil, fmt.Errorf("malformed JSON Patch: %v", err)
+	}
+	var tree interface{}
+	if err := yaml.Unmarshal(yml, &tree); err != nil {
+		return nil, fmt.Errorf("unable to parse config to patch: %v", err)
+	}
+	doc := jsonTree(tree)
+	for i, op := range ops {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%v %v): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return yaml.Marshal(doc)
+}
+
+func (op *patchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return addAt(doc, path, value)
+		case "replace":
+			if doc, _, err = removeAt(doc, path); err != nil {
+				return nil, err
+			}
+			return addAt(doc, path, value)
+		}
+		actual, err := getAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !sameJSON(actual, value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	case "remove":
+		doc, _, err = removeAt(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if op.Op == "move" {
+			doc, value, err = removeAt(doc, from)
+		} else {
+			value, err = getAt(doc, from)
+			if err == nil {
+				value = jsonTree(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+	}
+	return nil, fmt.Errorf("unknown operation")
+}
+
+// value decodes the operation's value. Numbers become ints where they can be,
+// since YAML keeps more precision for those.
+func (op *patchOperation) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	dec := json.NewDecoder(bytes.NewReader(op.Value))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return jsonTree(value), nil
+}
+
+// jsonTree returns a copy of the given YAML or JSON value with string keys
+// throughout, as JSON Patch expects, and JSON numbers as ints or floats.
+func jsonTree(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[fmt.Sprint(key)] = jsonTree(child)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = jsonTree(child)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, child := range v {
+			a[i] = jsonTree(child)
+		}
+		return a
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// sameJSON returns whether a and b are the same when encoded as JSON, which
+// ignores the differences between YAML and JSON numbers.
+func sameJSON(a interface{}, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// parsePointer parses a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the given token as an index into an array of length n.
+// "-", past the end, is only allowed if appending.
+func arrayIndex(token string, n int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	max := n - 1
+	if appending {
+		max = n
+	}
+	if err != nil || i < 0 || i > max || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func getAt(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, found := node[token]
+			if !found {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%q isn't in a map or an array", token)
+		}
+	}
+	return doc, nil
+}
+
+// updateAt replaces the container of the last token of path in doc with what
+// update returns for it, returning the updated doc.
+func updateAt(doc interface{}, path []string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, found := node[path[0]]
+		if !found {
+			return nil, fmt.Errorf("no member %q", path[0])
+		}
+		updated, err := updateAt(child, path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = updated
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateAt(node[i], path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("%q isn't in a map or an array", path[0])
+}
+
+func addAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateAt(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%q isn't in a map or an array", token)
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	var removed interface{}
+	doc, err := updateAt(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			child, found := node[token]
+			if !found {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			removed = child
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%q isn't in a map or an array", token)
+	})
+	return doc, removed, err
+}
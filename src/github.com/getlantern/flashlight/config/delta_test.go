@@ -0,0 +1,104 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+const deltaBaseConfig = `client:
+  chainedservers:
+    fallback-1:
+      addr: 1.1.1.1:443
+      weight: 1000000
+proxiedsites:
+  cloud:
+  - a.com
+  - c.com
+staleconfigthreshold: 86400000000000
+`
+
+func TestApplyCloudConfigDelta(t *testing.T) {
+	patched, err := applyCloudConfigDelta([]byte(deltaBaseConfig), []byte(`[
+		{"op": "test", "path": "/client/chainedservers/fallback-1/addr", "value": "1.1.1.1:443"},
+		{"op": "replace", "path": "/client/chainedservers/fallback-1/addr", "value": "1.1.1.2:443"},
+		{"op": "add", "path": "/client/chainedservers/fallback-2", "value": {"addr": "2.2.2.2:443", "weight": 1000001}},
+		{"op": "add", "path": "/proxiedsites/cloud/1", "value": "b.com"},
+		{"op": "add", "path": "/proxiedsites/cloud/-", "value": "d.com"},
+		{"op": "copy", "from": "/client/chainedservers/fallback-2", "path": "/client/chainedservers/fallback-3"},
+		{"op": "move", "from": "/client/chainedservers/fallback-1", "path": "/client/chainedservers/fallback~14"},
+		{"op": "remove", "path": "/client/chainedservers/fallback-3"},
+		{"op": "replace", "path": "/staleconfigthreshold", "value": 172800000000000}
+	]`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cfg := &Config{}
+	if !assert.NoError(t, yaml.Unmarshal(patched, cfg)) {
+		return
+	}
+	if assert.Len(t, cfg.Client.ChainedServers, 2) {
+		assert.Equal(t, "1.1.1.2:443", cfg.Client.ChainedServers["fallback/4"].Addr)
+		assert.Equal(t, 1000000, cfg.Client.ChainedServers["fallback/4"].Weight)
+		assert.Equal(t, 1000001, cfg.Client.ChainedServers["fallback-2"].Weight, "Numbers should keep their precision")
+	}
+	assert.Equal(t, []string{"a.com", "b.com", "c.com", "d.com"}, cfg.ProxiedSites.Cloud)
+	assert.Equal(t, int64(172800000000000), int64(cfg.StaleConfigThreshold))
+
+	for _, bad := range []string{
+		`not json`,
+		`[{"op": "test", "path": "/client/chainedservers/fallback-1/addr", "value": "9.9.9.9:443"}]`,
+		`[{"op": "remove", "path": "/client/chainedservers/fallback-9"}]`,
+		`[{"op": "replace", "path": "/proxiedsites/cloud/2", "value": "e.com"}]`,
+		`[{"op": "add", "path": "/proxiedsites/cloud/01", "value": "e.com"}]`,
+		`[{"op": "add", "path": "client", "value": {}}]`,
+		`[{"op": "add", "path": "/client/chainedservers/fallback-2"}]`,
+		`[{"op": "frobnicate", "path": "/client"}]`,
+	} {
+		_, err := applyCloudConfigDelta([]byte(deltaBaseConfig), []byte(bad))
+		assert.Error(t, err, "Delta should have failed: %v", bad)
+	}
+}
+
+func TestFetchCloudConfigDelta(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(deltaBaseConfig)
+	defer srv.Close()
+
+	b, err := fetchCloudConfig(context.Background(), srv.ConfigURL())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, deltaBaseConfig, string(b))
+
+	srv.SetConfigWithDelta(
+		"client:\n  chainedservers:\n    fallback-1:\n      addr: 3.3.3.3:443\n",
+		`[{"op": "replace", "path": "/client/chainedservers/fallback-1/addr", "value": "3.3.3.3:443"}]`)
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, srv.Deltas())
+	cfg := &Config{}
+	if assert.NoError(t, yaml.Unmarshal(b, cfg)) {
+		assert.Equal(t, "3.3.3.3:443", cfg.Client.ChainedServers["fallback-1"].Addr)
+		assert.Equal(t, []string{"a.com", "c.com"}, cfg.ProxiedSites.Cloud, "Delta should have been applied to the last config")
+	}
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Nil(t, b, "Unchanged config should still not be returned")
+
+	// A delta that doesn't apply to what we have
+	requests := srv.Requests()
+	full := "client:\n  chainedservers:\n    fallback-4:\n      addr: 4.4.4.4:443\n"
+	srv.SetConfigWithDelta(full, `[{"op": "remove", "path": "/client/chainedservers/fallback-9"}]`)
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Equal(t, full, string(b), "Should have fallen back to fetching the whole config")
+	assert.Equal(t, 2, srv.Deltas())
+	assert.Equal(t, requests+2, srv.Requests())
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDiffExamples is how many items of a list we show when summarizing it.
+	maxDiffExamples = 3
+)
+
+var (
+	// logConfigDiff logs how an update changed the config.
+	logConfigDiff = func(diff *ConfigDiff) {
+		if !diff.IsEmpty() {
+			log.Debugf("Config updated: %v", diff)
+		}
+	}
+
+	changeHandlers   []func(*ConfigDiff)
+	changeHandlersMx sync.Mutex
+)
+
+// ConfigDiff describes how an update changed the config, for example so that
+// the UI can tell the user that servers were rotated. It never includes
+// secrets.
+type ConfigDiff struct {
+	// AddedServers and RemovedServers: the names of the chained servers that
+	// were added and removed
+	AddedServers   []string
+	RemovedServers []string
+
+	// ProxiedSitesAdded and ProxiedSitesRemoved: how many sites were added to
+	// and removed from the cloud list of proxied sites
+	ProxiedSitesAdded   int
+	ProxiedSitesRemoved int
+
+	// IgnoredProxiedSites and TruncatedProxiedSites: the cloud proxied sites
+	// in an update that we ignored because they aren't domains, and how many
+	// we dropped to stay within MaxProxiedSites
+	IgnoredProxiedSites   []string
+	TruncatedProxiedSites int
+
+	// AddedCAs and RemovedCAs: the hex encoded SHA-256 fingerprints of the
+	// trusted CAs that were added and removed
+	AddedCAs   []string
+	RemovedCAs []string
+
+	// Fields: the other fields that changed, as sorted entries like
+	// "AutoReport: true -> false". Nested fields are given by their dotted
+	// path, for example Client.ChainedServers.fallback-1.Addr, and long lists
+	// are summarized.
+	Fields []string
+}
+
+// OnConfigChanged registers a function that's called with the changes made by
+// every update to the config, whether from the cloud or through Update.
+// Handlers are called synchronously and must not call Update.
+func OnConfigChanged(onChanged func(*ConfigDiff)) {
+	changeHandlersMx.Lock()
+	changeHandlers = append(changeHandlers, onChanged)
+	changeHandlersMx.Unlock()
+}
+
+// configChanged logs the given diff of the given Config from the given source
+// and, if anything changed, records it in the history and passes it to the
+// handlers registered with OnConfigChanged and, if profiling or AutoReport
+// changed, with OnProfilingChange or OnAutoReportChange.
+func configChanged(source string, cfg *Config, diff *ConfigDiff) {
+	logConfigDiff(diff)
+	if diff.IsEmpty() {
+		return
+	}
+	entry := &HistoryEntry{
+		Time:          time.Now(),
+		Source:        source,
+		Version:       cfg.Version,
+		SchemaVersion: cfg.SchemaVersion,
+		Diff:          diff.String(),
+	}
+	if source == historySourceCloud {
+		entry.Provenance = cfg.CloudProvenance
+		if from := cfg.fetchedFrom; from != nil {
+			entry.URL = withoutCredentials(from.url)
+			entry.ETag = from.etag
+			entry.Snapshot = snapshotID(from.payload)
+			entry.payload = from.payload
+		}
+	}
+	recordHistory(entry)
+	changeHandlersMx.Lock()
+	handlers := make([]func(*ConfigDiff), len(changeHandlers))
+	copy(handlers, changeHandlers)
+	changeHandlersMx.Unlock()
+	for _, handler := range handlers {
+		handler(diff)
+	}
+	profilingChanged(cfg, diff)
+	autoReportChanged(diff)
+}
+
+// IsEmpty returns whether nothing changed.
+func (d *ConfigDiff) IsEmpty() bool {
+	return len(d.AddedServers) == 0 && len(d.RemovedServers) == 0 &&
+		d.ProxiedSitesAdded == 0 && d.ProxiedSitesRemoved == 0 &&
+		len(d.IgnoredProxiedSites) == 0 && d.TruncatedProxiedSites == 0 &&
+		len(d.AddedCAs) == 0 && len(d.RemovedCAs) == 0 &&
+		len(d.Fields) == 0
+}
+
+// String returns the diff as a single line suitable for logging.
+func (d *ConfigDiff) String() string {
+	var parts []string
+	if len(d.AddedServers) > 0 || len(d.RemovedServers) > 0 {
+		parts = append(parts, fmt.Sprintf("servers +%v -%v", summarize(d.AddedServers), summarize(d.RemovedServers)))
+	}
+	if d.ProxiedSitesAdded > 0 || d.ProxiedSitesRemoved > 0 {
+		parts = append(parts, fmt.Sprintf("proxiedsites +%d -%d", d.ProxiedSitesAdded, d.ProxiedSitesRemoved))
+	}
+	if len(d.IgnoredProxiedSites) > 0 || d.TruncatedProxiedSites > 0 {
+		parts = append(parts, fmt.Sprintf("proxiedsites ignored %v truncated %d", summarize(d.IgnoredProxiedSites), d.TruncatedProxiedSites))
+	}
+	if len(d.AddedCAs) > 0 || len(d.RemovedCAs) > 0 {
+		parts = append(parts, fmt.Sprintf("cas +%v -%v", summarize(d.AddedCAs), summarize(d.RemovedCAs)))
+	}
+	if len(d.Fields) > 0 {
+		parts = append(parts, fmt.Sprintf("fields [%v]", strings.Join(d.Fields, ", ")))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// summarize returns the number of the given items along with the first few of
+// them, like "5 (a, b, c, ...)".
+func summarize(items []string) string {
+	if len(items) == 0 {
+		return "0"
+	}
+	if len(items) <= maxDiffExamples {
+		return fmt.Sprintf("%d (%v)", len(items), strings.Join(items, ", "))
+	}
+	return fmt.Sprintf("%d (%v, ...)", len(items), strings.Join(items[:maxDiffExamples], ", "))
+}
+
+// newConfigDiff returns how after differs from before. Callers should pass
+// redacted copies so that secrets don't end up in the diff.
+func newConfigDiff(before *Config, after *Config) (*ConfigDiff, error) {
+	beforeFields, err := flattenConfig(diffable(before))
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flattenConfig(diffable(after))
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ConfigDiff{}
+	diff.AddedServers, diff.RemovedServers = diffSets(serverNamesOf(before), serverNamesOf(after))
+	addedSites, removedSites := diffSets(proxiedSitesOf(before), proxiedSitesOf(after))
+	diff.ProxiedSitesAdded, diff.ProxiedSitesRemoved = len(addedSites), len(removedSites)
+	diff.AddedCAs, diff.RemovedCAs = diffSets(caFingerprintsOf(before), caFingerprintsOf(after))
+
+	// Servers that came or went and the lists summarized above don't need to
+	// be repeated field by field
+	summarized := []string{"ProxiedSites.Cloud", "TrustedCAs"}
+	for _, name := range append(diff.AddedServers, diff.RemovedServers...) {
+		summarized = append(summarized, "Client.ChainedServers."+name)
+	}
+	diff.Fields = diffFields(beforeFields, afterFields, func(field string) bool {
+		for _, path := range summarized {
+			if field == path || strings.HasPrefix(field, path+".") {
+				return false
+			}
+		}
+		return true
+	})
+	return diff, nil
+}
+
+// withoutCloudSites returns a shallow copy of the given Config without its
+// cloud proxied sites, for copying or encoding the rest of it. There can be
+// tens of thousands of sites, which makes them most of the work of deep
+// copying or diffing a Config.
+func withoutCloudSites(cfg *Config) *Config {
+	if cfg.ProxiedSites == nil {
+		return cfg
+	}
+	copied := *cfg
+	sites := *cfg.ProxiedSites
+	sites.Cloud = nil
+	copied.ProxiedSites = &sites
+	return &copied
+}
+
+// diffable returns a shallow copy of the given Config without what
+// newConfigDiff doesn't diff field by field: the cloud proxied sites, which it
+// summarizes, and the checksum and ETag of the last merge, which change with
+// every merge.
+func diffable(cfg *Config) *Config {
+	copied := *withoutCloudSites(cfg)
+	copied.LastMergeChecksum = ""
+	copied.CloudETags = nil
+	return &copied
+}
+
+// diffConfigs returns all of the fields that differ between before and after,
+// formatted as in ConfigDiff.Fields. Callers should pass redacted copies so
+// that secrets don't end up in the diff.
+func diffConfigs(before *Config, after *Config) ([]string, error) {
+	beforeFields, err := flattenConfig(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flattenConfig(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffFields(beforeFields, afterFields, func(string) bool { return true }), nil
+}
+
+// diffFields returns sorted entries for the flattened fields that differ
+// between before and after and that include accepts.
+func diffFields(beforeFields map[string]string, afterFields map[string]string, include func(field string) bool) []string {
+	var diff []string
+	for field, beforeValue := range beforeFields {
+		afterValue, found := afterFields[field]
+		if !found {
+			afterValue = "<none>"
+		}
+		if beforeValue != afterValue && include(field) {
+			diff = append(diff, fmt.Sprintf("%v: %v -> %v", field, summarizeValue(beforeValue), summarizeValue(afterValue)))
+		}
+	}
+	for field, afterValue := range afterFields {
+		if _, found := beforeFields[field]; !found && include(field) {
+			diff = append(diff, fmt.Sprintf("%v: <none> -> %v", field, summarizeValue(afterValue)))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// summarizeValue shortens JSON encoded lists with more than a few items, like
+// masquerade sets, to their length and first few items if those are simple.
+func summarizeValue(value string) string {
+	if !strings.HasPrefix(value, "[") {
+		return value
+	}
+	var items []interface{}
+	if err := json.Unmarshal([]byte(value), &items); err != nil || len(items) <= maxDiffExamples {
+		return value
+	}
+	examples := make([]string, 0, maxDiffExamples)
+	for _, item := range items[:maxDiffExamples] {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Sprintf("[%d items]", len(items))
+		}
+		b, _ := json.Marshal(item)
+		examples = append(examples, string(b))
+	}
+	return fmt.Sprintf("[%d items: %v, ...]", len(items), strings.Join(examples, ","))
+}
+
+// diffSets returns the sorted keys that are only in after and only in before.
+func diffSets(before map[string]bool, after map[string]bool) (added []string, removed []string) {
+	for key := range after {
+		if !before[key] {
+			added = append(added, key)
+		}
+	}
+	for key := range before {
+		if !after[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func serverNamesOf(cfg *Config) map[string]bool {
+	names := make(map[string]bool)
+	if cfg.Client != nil {
+		for name := range cfg.Client.ChainedServers {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func proxiedSitesOf(cfg *Config) map[string]bool {
+	if cfg.ProxiedSites == nil {
+		return map[string]bool{}
+	}
+	sites := make(map[string]bool, len(cfg.ProxiedSites.Cloud))
+	for _, site := range cfg.ProxiedSites.Cloud {
+		sites[site] = true
+	}
+	return sites
+}
+
+func caFingerprintsOf(cfg *Config) map[string]bool {
+	fingerprints := make(map[string]bool)
+	for _, ca := range cfg.TrustedCAs {
+		fingerprint := fingerprintOf(ca.Cert)
+		fingerprints[hex.EncodeToString(fingerprint[:])] = true
+	}
+	return fingerprints
+}
+
+// flattenConfig returns the JSON encoded values of the leaf fields of the
+// given Config, keyed by their dotted path. Lists are treated as leaves.
+func flattenConfig(cfg *Config) (map[string]string, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal config: %v", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal config: %v", err)
+	}
+	fields := make(map[string]string)
+	flatten("", tree, fields)
+	return fields, nil
+}
+
+func flatten(path string, value interface{}, fields map[string]string) {
+	// Empty maps have no leaves, so that gaining the first entry doesn't show
+	// up as a change to the map itself
+	if m, ok := value.(map[string]interface{}); ok {
+		for key, child := range m {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			flatten(childPath, child, fields)
+		}
+		return
+	}
+	b, _ := json.Marshal(value)
+	fields[path] = string(b)
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/proxiedsites"
+)
+
+// captureDiffs records the diffs logged by updates. The returned function
+// restores normal logging.
+func captureDiffs() (*[]*ConfigDiff, func()) {
+	orig := logConfigDiff
+	var diffs []*ConfigDiff
+	logConfigDiff = func(diff *ConfigDiff) {
+		diffs = append(diffs, diff)
+	}
+	return &diffs, func() {
+		logConfigDiff = orig
+	}
+}
+
+func TestUpdateRejectsInvalidConfig(t *testing.T) {
+	defer initTestConfig(t, "addr: localhost:8787\n")()
+	diffs, restore := captureDiffs()
+	defer restore()
+
+	err := Update(func(cfg *Config) error {
+		cfg.Addr = ""
+		return nil
+	})
+	if assert.IsType(t, &ValidationError{}, err) {
+		issues := err.(*ValidationError).Issues
+		if assert.Len(t, issues, 1) {
+			assert.Equal(t, "Addr", issues[0].Field)
+		}
+	}
+	assert.Equal(t, "localhost:8787", current().Addr, "Config should have been left as it was")
+	assert.Empty(t, *diffs, "Rejected update should not have been logged")
+}
+
+func TestUpdateLogsDiff(t *testing.T) {
+	defer initTestConfig(t, "addr: localhost:8787\nautoreport: true\nclient:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n      authtoken: secret\n")()
+	diffs, restore := captureDiffs()
+	defer restore()
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		autoReport := false
+		cfg.AutoReport = &autoReport
+		return nil
+	}))
+	if assert.Len(t, *diffs, 1) {
+		assert.Equal(t, []string{"AutoReport: true -> false"}, (*diffs)[0].Fields)
+	}
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.Client.ChainedServers["fallback-1"].AuthToken = "newsecret"
+		cfg.Client.ChainedServers["fallback-1"].Addr = "2.2.2.2:443"
+		return nil
+	}))
+	if assert.Len(t, *diffs, 2) {
+		assert.Equal(t, []string{`Client.ChainedServers.fallback-1.Addr: "1.1.1.1:443" -> "2.2.2.2:443"`}, (*diffs)[1].Fields, "Secrets should have been redacted from diff")
+	}
+}
+
+func TestUpdateFromDiffs(t *testing.T) {
+	servers := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n      authtoken: secret\n    fallback-2:\n      addr: 2.2.2.2:443\n"
+	sites := "proxiedsites:\n  cloud:\n  - a.com\n  - b.com\n"
+	ca1, ca2 := defaultTrustedCAs[0].Cert, defaultTrustedCAs[1].Cert
+	cas := fmt.Sprintf("trustedcas:\n- commonname: ca-1\n  cert: %q\n", ca1)
+	uiAddr := "uiaddr: 127.0.0.1:16823\n"
+	base := uiAddr + servers + sites + cas
+
+	tests := []struct {
+		name   string
+		update string
+		golden string
+	}{
+		{
+			name:   "unchanged",
+			update: uiAddr + servers + "proxiedsites:\n  cloud:\n  - b.com\n  - a.com\n" + cas,
+			golden: "no changes",
+		},
+		{
+			name:   "servers rotated",
+			update: uiAddr + "client:\n  chainedservers:\n    fallback-2:\n      addr: 2.2.2.3:443\n    fallback-3:\n      addr: 3.3.3.3:443\n      authtoken: secret\n    fallback-4:\n      addr: 4.4.4.4:443\n" + sites + cas,
+			golden: `servers +2 (fallback-3, fallback-4) -1 (fallback-1); fields [Client.ChainedServers.fallback-2.Addr: "2.2.2.2:443" -> "2.2.2.3:443"]`,
+		},
+		{
+			name:   "many servers added",
+			update: uiAddr + servers + "    fallback-3:\n      addr: 3.3.3.3:443\n    fallback-4:\n      addr: 4.4.4.4:443\n    fallback-5:\n      addr: 5.5.5.5:443\n    fallback-6:\n      addr: 6.6.6.6:443\n" + sites + cas,
+			golden: "servers +4 (fallback-3, fallback-4, fallback-5, ...) -0",
+		},
+		{
+			name:   "proxied sites added",
+			update: uiAddr + servers + "proxiedsites:\n  cloud:\n  - a.com\n  - b.com\n  - c.com\n  - d.com\n" + cas,
+			golden: "proxiedsites +2 -0",
+		},
+		{
+			name:   "CA replaced",
+			update: uiAddr + servers + sites + fmt.Sprintf("trustedcas:\n- commonname: ca-2\n  cert: %q\n- commonname: ca-1\n  removed: true\n", ca2),
+			golden: fmt.Sprintf("cas +1 (%x) -1 (%x)", fingerprintOf(ca2), fingerprintOf(ca1)),
+		},
+		{
+			name:   "masquerades and scalars",
+			update: uiAddr + "cloudconfigca: ca-pem\n" + servers + "  masqueradesets:\n    test:\n    - domain: a.com\n    - domain: b.com\n    - domain: c.com\n    - domain: d.com\n" + sites + cas,
+			golden: `fields [Client.MasqueradeSets.test: <none> -> [4 items], CloudConfigCA: "" -> "ca-pem"]`,
+		},
+	}
+
+	for _, test := range tests {
+		cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+		if !assert.NoError(t, cfg.updateFrom([]byte(base)), test.name) {
+			continue
+		}
+		diffs, restore := captureDiffs()
+		var reported []*ConfigDiff
+		OnConfigChanged(func(diff *ConfigDiff) {
+			reported = append(reported, diff)
+		})
+		err := cfg.updateFrom([]byte(test.update))
+		restore()
+		changeHandlers = nil
+		if !assert.NoError(t, err, test.name) || !assert.Len(t, *diffs, 1, test.name) {
+			continue
+		}
+		diff := (*diffs)[0]
+		assert.Equal(t, test.golden, diff.String(), test.name)
+		assert.NotContains(t, diff.String(), "secret", "%v: secrets should have been redacted", test.name)
+		if diff.IsEmpty() {
+			assert.Empty(t, reported, "%v: subscribers should only hear about changes", test.name)
+		} else {
+			assert.Equal(t, []*ConfigDiff{diff}, reported, "%v: subscribers should get the logged diff", test.name)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dnsFetcherName is what the DNS fetcher is registered as.
+	dnsFetcherName = "dns"
+
+	// dnsConfigVersion starts the TXT record at DNSConfigDomain that
+	// describes the published config, like
+	// "lantern-config1 chunks=12 sha256=<hex> sig=<base64>". The config
+	// itself, usually gzipped, is split into chunks published base64 encoded
+	// in TXT records at 0.<DNSConfigDomain>, 1.<DNSConfigDomain> and so on.
+	dnsConfigVersion = "lantern-config1"
+
+	// maxDNSConfigChunks caps how many chunks we fetch, so that a bad index
+	// doesn't have us querying forever.
+	maxDNSConfigChunks = 4096
+
+	// dnsConfigParallelism is how many chunks we query at once.
+	dnsConfigParallelism = 8
+
+	dnsTypeTXT = 16
+)
+
+var (
+	// dnsFetchHeadStart is how long we give fetching over HTTP before we start
+	// fetching over DNS, which takes many queries and is only meant for when
+	// HTTP is blocked.
+	dnsFetchHeadStart = 15 * time.Second
+)
+
+// dnsFetcher is a Fetcher that fetches the cloud config published in DNS TXT
+// records under DNSConfigDomain, querying them over DoH so that they can't
+// easily be blocked or tampered with on the way. The same config is published
+// for all cloud config URLs.
+type dnsFetcher struct {
+	resolver *dohResolver
+}
+
+// dnsConfigIndex describes the config published under a domain.
+type dnsConfigIndex struct {
+	chunks    int
+	checksum  []byte
+	signature string
+}
+
+// dnsConfigDomain returns the domain under which cloud config is published in
+// DNS, or "" if we don't fetch it from DNS.
+func dnsConfigDomain() string {
+	cfg := current()
+	if cfg == nil {
+		return ""
+	}
+	return strings.TrimSuffix(cfg.DNSConfigDomain, ".")
+}
+
+// Fetch implements the method from Fetcher.
+func (f *dnsFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	domain := dnsConfigDomain()
+	if domain == "" {
+		return nil, "", fmt.Errorf("No DNS config domain")
+	}
+	resolvers := dohResolvers()
+	if len(resolvers) == 0 {
+		return nil, "", fmt.Errorf("DoH is disabled")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	case <-time.After(dnsFetchHeadStart):
+	}
+
+	records, err := f.resolver.txt(ctx, domain, resolvers)
+	if err != nil {
+		return nil, "", err
+	}
+	index, err := parseDNSConfigIndex(records)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to read DNS config index at %v: %v", domain, err)
+	}
+	chunks := make([][]byte, index.chunks)
+	errs := make(chan error, index.chunks)
+	sem := make(chan bool, dnsConfigParallelism)
+	for i := range chunks {
+		go func(i int) {
+			sem <- true
+			defer func() { <-sem }()
+			name := fmt.Sprintf("%d.%v", i, domain)
+			records, err := f.resolver.txt(ctx, name, resolvers)
+			if err == nil {
+				chunks[i], err = base64.StdEncoding.DecodeString(strings.Join(records, ""))
+			}
+			if err != nil {
+				err = fmt.Errorf("Unable to fetch DNS config chunk %v: %v", name, err)
+			}
+			errs <- err
+		}(i)
+	}
+	var firstErr error
+	for range chunks {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, "", firstErr
+	}
+	config := bytes.Join(chunks, nil)
+	if checksum := sha256.Sum256(config); !bytes.Equal(checksum[:], index.checksum) {
+		// Probably caught between the publishing of two configs
+		return nil, "", fmt.Errorf("Config reassembled from DNS at %v doesn't match its checksum", domain)
+	}
+	log.Debugf("Fetched cloud config from %d TXT records at %v", index.chunks, domain)
+	return config, index.signature, nil
+}
+
+// parseDNSConfigIndex parses the index from the TXT records at the DNS config
+// domain, ignoring records that aren't ours, like SPF ones.
+func parseDNSConfigIndex(records []string) (*dnsConfigIndex, error) {
+	for _, record := range records {
+		fields := strings.Fields(record)
+		if len(fields) == 0 || fields[0] != dnsConfigVersion {
+			continue
+		}
+		index := &dnsConfigIndex{}
+		for _, field := range fields[1:] {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("malformed field %q", field)
+			}
+			var err error
+			switch parts[0] {
+			case "chunks":
+				index.chunks, err = strconv.Atoi(parts[1])
+				if err == nil && (index.chunks < 1 || index.chunks > maxDNSConfigChunks) {
+					err = fmt.Errorf("%d chunks", index.chunks)
+				}
+			case "sha256":
+				index.checksum, err = hex.DecodeString(parts[1])
+				if err == nil && len(index.checksum) != sha256.Size {
+					err = fmt.Errorf("wrong size")
+				}
+			case "sig":
+				index.signature = parts[1]
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v: %v", parts[0], err)
+			}
+		}
+		if index.chunks == 0 || index.checksum == nil {
+			return nil, fmt.Errorf("missing chunks or sha256")
+		}
+		return index, nil
+	}
+	return nil, fmt.Errorf("no %v record", dnsConfigVersion)
+}
+
+// txt returns the TXT records for the given name, racing the given resolvers.
+// Each record's strings are joined.
+func (r *dohResolver) txt(ctx context.Context, name string, resolvers []string) ([]string, error) {
+	type result struct {
+		records []string
+		err     error
+	}
+	results := make(chan *result, len(resolvers))
+	for _, resolver := range resolvers {
+		go func(resolver string) {
+			parsed, host, err := r.lookup(ctx, resolver, name, "TXT")
+			if err != nil {
+				results <- &result{err: err}
+				return
+			}
+			var records []string
+			for _, answer := range parsed.Answer {
+				if answer.Type == dnsTypeTXT {
+					records = append(records, joinTXTStrings(answer.Data))
+				}
+			}
+			if len(records) == 0 {
+				err = fmt.Errorf("DoH resolver %v returned no TXT records for %v", host, name)
+			}
+			results <- &result{records, err}
+		}(resolver)
+	}
+	var lastErr error
+	for range resolvers {
+		res := <-results
+		if res.err == nil {
+			return res.records, nil
+		}
+		lastErr = res.err
+	}
+	return nil, lastErr
+}
+
+// joinTXTStrings joins the character strings of a TXT record as DoH JSON
+// resolvers give them, like "\"abc\" \"def\"", which some give unquoted when
+// there's only one.
+func joinTXTStrings(data string) string {
+	data = strings.TrimSpace(data)
+	if !strings.HasPrefix(data, `"`) {
+		return data
+	}
+	var joined strings.Builder
+	quoted, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			joined.WriteRune(c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+			joined.WriteRune(c)
+		}
+	}
+	return joined.String()
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// publishDNSConfig returns the TXT records that publish the given config under
+// the given domain in chunks of the given size, keyed by name.
+func publishDNSConfig(domain string, config []byte, chunkSize int) map[string][]string {
+	encoded := base64.StdEncoding.EncodeToString(config)
+	records := make(map[string][]string)
+	chunks := 0
+	for ; len(encoded) > 0; chunks++ {
+		n := chunkSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		// Split each chunk into two character strings, like long records are
+		chunk := encoded[:n]
+		records[fmt.Sprintf("%d.%v", chunks, domain)] = []string{fmt.Sprintf("%q %q", chunk[:n/2], chunk[n/2:])}
+		encoded = encoded[n:]
+	}
+	checksum := sha256.Sum256(config)
+	records[domain] = []string{
+		`"v=spf1 -all"`,
+		fmt.Sprintf(`"%v chunks=%d sha256=%x"`, dnsConfigVersion, chunks, checksum),
+	}
+	return records
+}
+
+// newFakeTXTServer creates a DoH server that answers TXT queries with the
+// given records.
+func newFakeTXTServer(records map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("name")
+		var answers []map[string]interface{}
+		for _, data := range records[name] {
+			answers = append(answers, map[string]interface{}{"name": name, "type": dnsTypeTXT, "TTL": 60, "data": data})
+		}
+		status := 0
+		if len(answers) == 0 {
+			status = 3
+		}
+		resp.Header().Set("Content-Type", "application/dns-json")
+		json.NewEncoder(resp).Encode(map[string]interface{}{"Status": status, "Answer": answers})
+	}))
+}
+
+func TestFetchConfigFromDNS(t *testing.T) {
+	origHeadStart := dnsFetchHeadStart
+	dnsFetchHeadStart = 0
+	defer func() {
+		dnsFetchHeadStart = origHeadStart
+	}()
+	yml := serversConfig("fallback-1", "1.1.1.1:443")
+	records := publishDNSConfig("cfg.example.com", gzipped(t, yml), 20)
+	dohServer := newFakeTXTServer(records)
+	defer dohServer.Close()
+	defer initTestConfig(t, fmt.Sprintf("dnsconfigdomain: cfg.example.com.\ndohresolvers:\n- %v/resolve\n", dohServer.URL))()
+
+	fetcher := &dnsFetcher{newDoHResolver()}
+	b, err := fetchWith(context.Background(), fetcher, "http://config.example.com/cloud.yaml.gz")
+	if assert.NoError(t, err) {
+		assert.Equal(t, yml, string(b))
+	}
+
+	// Caught between publishing two configs
+	records["1.cfg.example.com"] = []string{`"AAAA"`}
+	_, _, err = fetcher.Fetch(context.Background(), "http://config.example.com/cloud.yaml.gz")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "checksum")
+	}
+	delete(records, "1.cfg.example.com")
+	_, _, err = fetcher.Fetch(context.Background(), "http://config.example.com/cloud.yaml.gz")
+	assert.Error(t, err, "Missing chunk should fail the fetch")
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.DNSConfigDomain = ""
+		return nil
+	}))
+	_, _, err = fetcher.Fetch(context.Background(), "http://config.example.com/cloud.yaml.gz")
+	assert.Error(t, err, "Shouldn't fetch from DNS without a domain")
+}
+
+func TestParseDNSConfigIndex(t *testing.T) {
+	checksum := strings.Repeat("ab", sha256.Size)
+	index, err := parseDNSConfigIndex([]string{"v=spf1 -all", dnsConfigVersion + " chunks=3 sha256=" + checksum + " sig=c2ln"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, index.chunks)
+		assert.Equal(t, "c2ln", index.signature)
+	}
+	for _, bad := range []string{
+		"v=spf1 -all",
+		dnsConfigVersion + " chunks=3",
+		dnsConfigVersion + " chunks=0 sha256=" + checksum,
+		dnsConfigVersion + " chunks=3 sha256=abcd",
+		dnsConfigVersion + " chunks=3 sha256=" + checksum + " junk",
+	} {
+		_, err := parseDNSConfigIndex([]string{bad})
+		assert.Error(t, err, "Index should have been rejected: %v", bad)
+	}
+}
+
+func TestJoinTXTStrings(t *testing.T) {
+	assert.Equal(t, "abc", joinTXTStrings("abc"))
+	assert.Equal(t, "abcdef", joinTXTStrings(`"abc" "def"`))
+	assert.Equal(t, `a"b\c`, joinTXTStrings(`"a\"b\\c"`))
+}
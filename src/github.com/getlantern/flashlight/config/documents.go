@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/getlantern/yaml"
+)
+
+// Configs, whether on disk or from the cloud, may use anchors, aliases and
+// merge keys (<<) to share definitions like those of chained servers, and may
+// be split into several documents separated by ---. The documents are overlaid
+// in order, so later documents win: maps are merged key by key, so that for
+// example a later document can add chained servers, while lists and other
+// values replace what earlier documents said. We always save the result as a
+// single plain document.
+
+// flattenDocuments overlays the documents in the given YAML as described
+// above and returns the result as a single document. A single document is
+// returned as is.
+func flattenDocuments(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("---")) && !bytes.Contains(data, []byte("...")) {
+		// Without document markers there's only one document, which is the
+		// case for large cloud configs that aren't worth splitting into lines
+		return data, nil
+	}
+	docs := splitDocuments(data)
+	if len(docs) <= 1 {
+		return data, nil
+	}
+	merged := make(map[interface{}]interface{})
+	for i, doc := range docs {
+		var tree map[interface{}]interface{}
+		if err := yaml.Unmarshal(doc, &tree); err != nil {
+			return nil, fmt.Errorf("Unable to parse document %d of config: %v", i+1, err)
+		}
+		overlay(merged, tree)
+	}
+	flattened, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal flattened config: %v", err)
+	}
+	return flattened, nil
+}
+
+// splitDocuments splits the given YAML into its documents, leaving out empty
+// ones.
+func splitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	var current []byte
+	finish := func() {
+		if len(bytes.TrimSpace(stripComments(current))) > 0 {
+			docs = append(docs, current)
+		}
+		current = nil
+	}
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		switch {
+		case bytes.Equal(trimmed, []byte("---")) || bytes.HasPrefix(trimmed, []byte("--- ")) || bytes.HasPrefix(trimmed, []byte("---\t")):
+			finish()
+			// Content may start on the same line as the marker
+			if rest := bytes.TrimLeft(line[3:], " \t"); len(bytes.TrimSpace(rest)) > 0 {
+				current = append(current, rest...)
+			}
+		case bytes.Equal(trimmed, []byte("...")):
+			finish()
+		case bytes.HasPrefix(line, []byte("%")):
+			// Directives like %YAML don't matter to us
+		default:
+			current = append(current, line...)
+		}
+	}
+	finish()
+	return docs
+}
+
+// stripComments returns the given YAML without lines that are only comments.
+func stripComments(doc []byte) []byte {
+	var stripped []byte
+	for _, line := range bytes.SplitAfter(doc, []byte("\n")) {
+		if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			stripped = append(stripped, line...)
+		}
+	}
+	return stripped
+}
+
+// overlay merges over into base, with over winning.
+func overlay(base map[interface{}]interface{}, over map[interface{}]interface{}) {
+	for key, value := range over {
+		overMap, overIsMap := value.(map[interface{}]interface{})
+		baseMap, baseIsMap := base[key].(map[interface{}]interface{})
+		if overIsMap && baseIsMap {
+			overlay(baseMap, overMap)
+			continue
+		}
+		base[key] = value
+	}
+}
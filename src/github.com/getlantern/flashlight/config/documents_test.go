@@ -0,0 +1,145 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/proxiedsites"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// threeDocuments shares server settings through an anchor and merge keys and
+// overlays the first document with two more.
+const threeDocuments = `%YAML 1.1
+---
+# Shared settings
+client:
+  chainedservers:
+    fallback-1: &fallback
+      addr: 1.1.1.1:443
+      authtoken: shared-token
+      pipelined: true
+      weight: 100
+    fallback-2:
+      <<: *fallback
+      addr: 2.2.2.2:443
+proxiedsites:
+  cloud:
+  - a.com
+  - b.com
+---
+# Adds a server and replaces the proxied sites
+client:
+  chainedservers:
+    fallback-3:
+      addr: 3.3.3.3:443
+      authtoken: other-token
+proxiedsites:
+  cloud:
+  - c.com
+...
+--- # Later documents win
+client:
+  chainedservers:
+    fallback-2:
+      weight: 500
+`
+
+func TestFlattenDocuments(t *testing.T) {
+	flattened, err := flattenDocuments([]byte(threeDocuments))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, splitDocuments(flattened), 1, "Should have flattened to a single document")
+	assert.NotContains(t, string(flattened), "<<")
+	assert.NotContains(t, string(flattened), "*fallback")
+
+	cfg := &Config{}
+	if !assert.NoError(t, yaml.Unmarshal(flattened, cfg)) {
+		return
+	}
+	servers := cfg.Client.ChainedServers
+	if assert.Len(t, servers, 3) {
+		assert.Equal(t, &client.ChainedServerInfo{Addr: "1.1.1.1:443", AuthToken: "shared-token", Pipelined: true, Weight: 100}, servers["fallback-1"])
+		assert.Equal(t, &client.ChainedServerInfo{Addr: "2.2.2.2:443", AuthToken: "shared-token", Pipelined: true, Weight: 500}, servers["fallback-2"], "Merge key and later document should both apply")
+		assert.Equal(t, &client.ChainedServerInfo{Addr: "3.3.3.3:443", AuthToken: "other-token"}, servers["fallback-3"])
+	}
+	assert.Equal(t, []string{"c.com"}, cfg.ProxiedSites.Cloud, "Later document should have replaced the list")
+
+	single := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n"
+	flattened, err = flattenDocuments([]byte("---\n" + single))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "---\n"+single, string(flattened), "Single document should be left alone")
+	}
+
+	_, err = flattenDocuments([]byte(single + "---\nclient: [\n"))
+	assert.Error(t, err, "Malformed document should be an error")
+}
+
+func TestSplitDocuments(t *testing.T) {
+	docs := splitDocuments([]byte("---\n# Nothing here\n---\na: 1\n--- b: 2\n...\n---\ncert: |\n  -----BEGIN CERTIFICATE-----\n  abc\n"))
+	var strs []string
+	for _, doc := range docs {
+		strs = append(strs, string(doc))
+	}
+	assert.Equal(t, []string{"a: 1\n", "b: 2\n", "cert: |\n  -----BEGIN CERTIFICATE-----\n  abc\n"}, strs)
+}
+
+func TestUpdateFromMultipleDocuments(t *testing.T) {
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	if !assert.NoError(t, cfg.updateFrom([]byte(threeDocuments))) {
+		return
+	}
+	servers := cfg.Client.ChainedServers
+	if assert.Len(t, servers, 3) {
+		assert.Equal(t, "shared-token", string(servers["fallback-2"].AuthToken))
+		assert.Equal(t, 500, servers["fallback-2"].Weight)
+		assert.Equal(t, "3.3.3.3:443", servers["fallback-3"].Addr)
+	}
+	assert.Equal(t, []string{"c.com"}, cfg.ProxiedSites.Cloud)
+
+	assert.Error(t, cfg.updateFrom([]byte(threeDocuments+"---\nclient: [\n")), "Malformed document should reject the update")
+	assert.Len(t, cfg.Client.ChainedServers, 3, "Rejected update should leave servers alone")
+}
+
+func TestMultipleDocumentConfigFile(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	if err := ioutil.WriteFile(path, []byte(threeDocuments), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, cfg.Client.ChainedServers, 3) {
+		assert.Equal(t, 500, cfg.Client.ChainedServers["fallback-2"].Weight)
+		assert.Equal(t, "shared-token", string(cfg.Client.ChainedServers["fallback-2"].AuthToken))
+	}
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UIAddr = "localhost:16823"
+		return nil
+	}))
+	Stop()
+
+	saved, err := ioutil.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, splitDocuments(saved), 1, "Should have saved a single document")
+	assert.False(t, strings.Contains(string(saved), "<<") || strings.Contains(string(saved), "&fallback"), "Should have saved plain YAML")
+	reloaded := &Config{}
+	if assert.NoError(t, yaml.Unmarshal(saved, reloaded)) {
+		assert.Equal(t, cfg.Client.ChainedServers["fallback-2"].AuthToken, reloaded.Client.ChainedServers["fallback-2"].AuthToken)
+		assert.Len(t, reloaded.Client.ChainedServers, 3)
+		assert.Equal(t, "localhost:16823", reloaded.UIAddr)
+	}
+}
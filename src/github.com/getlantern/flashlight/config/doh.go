@@ -0,0 +1,186 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// dohTimeout is how long to wait for DoH resolvers to answer.
+	dohTimeout = 10 * time.Second
+
+	// minDoHTTL is the minimum time for which we cache DoH answers.
+	minDoHTTL = 1 * time.Minute
+
+	dnsTypeA = 1
+)
+
+var (
+	// defaultDoHResolvers are the DNS-over-HTTPS resolvers we race when none
+	// are configured. They're addressed by IP so that using them doesn't
+	// itself depend on DNS.
+	defaultDoHResolvers = []string{
+		"https://1.1.1.1/dns-query",
+		"https://8.8.8.8/resolve",
+	}
+
+	doh = newDoHResolver()
+)
+
+// dohResolver resolves hostnames using the JSON API of DNS-over-HTTPS
+// resolvers, caching the results for their TTL.
+type dohResolver struct {
+	client *http.Client
+	cache  map[string]*dohAnswer
+	mx     sync.Mutex
+}
+
+type dohAnswer struct {
+	ip      string
+	expires time.Time
+}
+
+// dohResponse is the relevant part of a DoH JSON response.
+type dohResponse struct {
+	Status int
+	Answer []struct {
+		Type int `json:"type"`
+		TTL  int
+		Data string `json:"data"`
+	}
+}
+
+func newDoHResolver() *dohResolver {
+	return &dohResolver{
+		client: &http.Client{Timeout: dohTimeout},
+		cache:  make(map[string]*dohAnswer),
+	}
+}
+
+// dohResolvers returns the DoH resolvers to use for resolving the hosts of
+// cloud config URLs, or nil if DoH is disabled.
+func dohResolvers() []string {
+	cfg := current()
+	if cfg == nil {
+		return defaultDoHResolvers
+	}
+	if cfg.DisableDoH {
+		return nil
+	}
+	if len(cfg.DoHResolvers) > 0 {
+		return cfg.DoHResolvers
+	}
+	return defaultDoHResolvers
+}
+
+// dial dials the given address, resolving its host using the configured DoH
+// resolvers and falling back to the system resolver if that fails.
+func (r *dohResolver) dial(network, addr string) (net.Conn, error) {
+	resolvers := dohResolvers()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || len(resolvers) == 0 || net.ParseIP(host) != nil {
+		return net.Dial(network, addr)
+	}
+	ip, err := r.resolve(host, resolvers)
+	if err != nil {
+		log.Debugf("Unable to resolve %v with DoH, using system resolver: %v", host, err)
+		return net.Dial(network, addr)
+	}
+	log.Tracef("Resolved %v to %v with DoH", host, ip)
+	return net.Dial(network, net.JoinHostPort(ip, port))
+}
+
+// resolve resolves the given host to an IPv4 address by racing the given
+// resolvers, using a cached answer if we have one.
+func (r *dohResolver) resolve(host string, resolvers []string) (string, error) {
+	r.mx.Lock()
+	cached := r.cache[host]
+	r.mx.Unlock()
+	if cached != nil && time.Now().Before(cached.expires) {
+		return cached.ip, nil
+	}
+
+	type result struct {
+		answer *dohAnswer
+		err    error
+	}
+	results := make(chan *result, len(resolvers))
+	for _, resolver := range resolvers {
+		go func(resolver string) {
+			answer, err := r.query(resolver, host)
+			results <- &result{answer, err}
+		}(resolver)
+	}
+	var lastErr error
+	for i := 0; i < len(resolvers); i++ {
+		res := <-results
+		if res.err != nil {
+			lastErr = res.err
+			continue
+		}
+		r.mx.Lock()
+		r.cache[host] = res.answer
+		r.mx.Unlock()
+		return res.answer.ip, nil
+	}
+	return "", lastErr
+}
+
+// query asks the given resolver for the A record of the given host.
+func (r *dohResolver) query(resolver string, host string) (*dohAnswer, error) {
+	parsed, resolverHost, err := r.lookup(context.Background(), resolver, host, "A")
+	if err != nil {
+		return nil, err
+	}
+	for _, answer := range parsed.Answer {
+		if answer.Type != dnsTypeA || net.ParseIP(answer.Data) == nil {
+			continue
+		}
+		ttl := time.Duration(answer.TTL) * time.Second
+		if ttl < minDoHTTL {
+			ttl = minDoHTTL
+		}
+		return &dohAnswer{ip: answer.Data, expires: time.Now().Add(ttl)}, nil
+	}
+	return nil, fmt.Errorf("DoH resolver %v returned no addresses for %v", resolverHost, host)
+}
+
+// lookup asks the given resolver for the records of the given type for name,
+// returning its response and its host for error messages.
+func (r *dohResolver) lookup(ctx context.Context, resolver string, name string, recordType string) (*dohResponse, string, error) {
+	u, err := url.Parse(resolver)
+	if err != nil {
+		return nil, resolver, fmt.Errorf("Invalid DoH resolver %v: %v", resolver, err)
+	}
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("type", recordType)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, u.Host, fmt.Errorf("Unable to construct DoH request: %v", err)
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, u.Host, fmt.Errorf("Unable to query DoH resolver %v: %v", u.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, u.Host, fmt.Errorf("Unexpected response status from DoH resolver %v: %d", u.Host, resp.StatusCode)
+	}
+	var parsed dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, u.Host, fmt.Errorf("Unable to parse response from DoH resolver %v: %v", u.Host, err)
+	}
+	if parsed.Status != 0 {
+		return nil, u.Host, fmt.Errorf("DoH resolver %v returned status %d for %v", u.Host, parsed.Status, name)
+	}
+	return &parsed, u.Host, nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// newFakeDoHServer creates a DoH server that answers every query with the
+// given IP and records the names queried.
+func newFakeDoHServer(ip string, queried *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("name")
+		*queried = append(*queried, name)
+		resp.Header().Set("Content-Type", "application/dns-json")
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"Status": 0,
+			"Answer": []map[string]interface{}{
+				{"name": name, "type": 5, "TTL": 300, "data": "alias.example.com."},
+				{"name": "alias.example.com.", "type": dnsTypeA, "TTL": 300, "data": ip},
+			},
+		})
+	}))
+}
+
+func TestFetchDirectWithDoH(t *testing.T) {
+	defer useTestFetcher()()
+	cf = &failingFetcher{}
+	origServers := bootstrapServers
+	defer func() {
+		bootstrapServers = origServers
+	}()
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{}
+	}
+
+	body := "proxiedsites:\n  cloud:\n  - a.com\n"
+	var hosts []string
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		hosts = append(hosts, req.Host)
+		resp.Write(gzipped(t, body))
+	}))
+	defer backend.Close()
+	backendAddr, _ := url.Parse(backend.URL)
+	_, port, _ := net.SplitHostPort(backendAddr.Host)
+
+	var queried []string
+	dohServer := newFakeDoHServer("127.0.0.1", &queried)
+	defer dohServer.Close()
+
+	defer initTestConfig(t, fmt.Sprintf("dohresolvers:\n- http://127.0.0.1:1/broken\n- %v/resolve\n", dohServer.URL))()
+
+	// This host only resolves through our fake DoH server
+	configHost := net.JoinHostPort("config.invalid", port)
+	configUrl := "http://" + configHost + "/cloud.yaml.gz"
+	b, err := fetchCloudConfig(context.Background(), configUrl)
+	if assert.NoError(t, err) {
+		assert.Equal(t, body, string(b))
+	}
+	lastCloudConfigChecksum = map[string][32]byte{}
+	_, err = fetchCloudConfig(context.Background(), configUrl)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{configHost, configHost}, hosts, "Host header should have been preserved")
+	assert.Equal(t, []string{"config.invalid"}, queried, "DoH answer should have been cached")
+
+	// Fall back to the system resolver when DoH fails
+	dohServer.Close()
+	doh = newDoHResolver()
+	lastCloudConfigChecksum = map[string][32]byte{}
+	_, err = fetchCloudConfig(context.Background(), "http://"+net.JoinHostPort("localhost", port)+"/cloud.yaml.gz")
+	assert.NoError(t, err, "Should have fallen back to system resolver")
+
+	// Skip DoH when disabled
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.DisableDoH = true
+		return nil
+	}))
+	assert.Nil(t, dohResolvers())
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+// latestSchemaVersion returns the schema version that configs are migrated to.
+func latestSchemaVersion() int {
+	latest := 0
+	for _, mig := range migrations {
+		if mig.to > latest {
+			latest = mig.to
+		}
+	}
+	return latest
+}
+
+// copyNewerConfig copies the config file at src, which was written by a newer
+// version of Lantern than this one, to dst so that we can use it after a
+// downgrade. Fields that this version doesn't know about are stripped, since
+// we would otherwise carry them along without understanding them, and the
+// schema version is lowered to ours so that the newer version's migrations
+// run again if it's used by a newer version later. The original is left as it
+// is for when the user upgrades again.
+func copyNewerConfig(src string, dst string) error {
+	raw, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("Unable to read newer config: %v", err)
+	}
+	encrypted := isEncrypted(raw)
+	data, err := readConfigFile(src)
+	if err != nil {
+		return fmt.Errorf("Unable to read newer config: %v", err)
+	}
+	tree := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("Unable to parse newer config: %v", err)
+	}
+	if stripped := stripUnknownFields(tree); len(stripped) > 0 {
+		log.Debugf("Stripped fields unknown to this version from newer config at %v: %v", src, strings.Join(stripped, ", "))
+	}
+	if schemaVersionOf(tree) > latestSchemaVersion() {
+		tree[schemaVersionKey] = latestSchemaVersion()
+	}
+	copied, err := yaml.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal newer config: %v", err)
+	}
+	return newEncryptingStore(yamlconf.NewFileStore(dst), &encrypted).Save(copied)
+}
+
+// stripUnknownFields removes the fields in the given config YAML tree that
+// don't correspond to any field of Config, returning their sorted dotted
+// paths.
+func stripUnknownFields(tree map[string]interface{}) []string {
+	var stripped []string
+	generic := make(map[interface{}]interface{}, len(tree))
+	for key, value := range tree {
+		generic[key] = value
+	}
+	stripUnknown("", generic, reflect.TypeOf(Config{}), &stripped)
+	for key := range tree {
+		if _, found := generic[key]; !found {
+			delete(tree, key)
+		}
+	}
+	sort.Strings(stripped)
+	return stripped
+}
+
+func stripUnknown(path string, value interface{}, t reflect.Type, stripped *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		fields := yamlFieldsOf(t)
+		if len(fields) == 0 {
+			// Opaque to us, like a type with its own unmarshaling
+			return
+		}
+		for key, child := range m {
+			name := fmt.Sprint(key)
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+			field, known := fields[name]
+			if !known {
+				*stripped = append(*stripped, childPath)
+				delete(m, key)
+				continue
+			}
+			stripUnknown(childPath, child, field, stripped)
+		}
+	case reflect.Map:
+		if m, ok := value.(map[interface{}]interface{}); ok {
+			for key, child := range m {
+				stripUnknown(fmt.Sprintf("%v.%v", path, key), child, t.Elem(), stripped)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				stripUnknown(fmt.Sprintf("%v.%d", path, i), item, t.Elem(), stripped)
+			}
+		}
+	}
+}
+
+// yamlFieldsOf returns the types of the fields of the given struct type keyed
+// by their names in YAML, following the rules of the yaml package.
+func yamlFieldsOf(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		inline := false
+		for _, flag := range parts[1:] {
+			if flag == "inline" {
+				inline = true
+			}
+		}
+		if inline {
+			inner := field.Type
+			for inner.Kind() == reflect.Ptr {
+				inner = inner.Elem()
+			}
+			for innerName, innerType := range yamlFieldsOf(inner) {
+				fields[innerName] = innerType
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
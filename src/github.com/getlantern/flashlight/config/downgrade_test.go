@@ -0,0 +1,77 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigAcrossDowngrades(t *testing.T) {
+	dir := t.TempDir()
+	path := func(version string) string {
+		return filepath.Join(dir, configFileName(version))
+	}
+	read := func(version string) map[string]interface{} {
+		b, err := ioutil.ReadFile(path(version))
+		if err != nil {
+			t.Fatalf("Unable to read config: %v", err)
+		}
+		tree := make(map[string]interface{})
+		if err := yaml.Unmarshal(b, &tree); err != nil {
+			t.Fatalf("Unable to parse config: %v", err)
+		}
+		return tree
+	}
+
+	newer := `schemaversion: 99
+provenance: custom
+newfeature:
+  enabled: true
+client:
+  newclientsetting: 5
+  chainedservers:
+    custom:
+      addr: 2.2.2.2:443
+      newserversetting: x
+`
+	if err := ioutil.WriteFile(path("2.2.0"), []byte(newer), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+
+	// Rolled back to 2.1.0, with only the newer config around
+	assert.True(t, useGoodOldConfig(dir, path("2.1.0"), "2.1.0"))
+	downgraded := read("2.1.0")
+	assert.Nil(t, downgraded["newfeature"], "Unknown fields should have been stripped")
+	assert.Equal(t, latestSchemaVersion(), downgraded[schemaVersionKey], "Schema version should have been lowered to ours")
+	client := downgraded["client"].(map[interface{}]interface{})
+	assert.Nil(t, client["newclientsetting"], "Unknown nested fields should have been stripped")
+	server := client["chainedservers"].(map[interface{}]interface{})["custom"].(map[interface{}]interface{})
+	assert.Equal(t, "2.2.2.2:443", server["addr"], "Known fields should be kept")
+	assert.Nil(t, server["newserversetting"], "Unknown fields of servers should have been stripped")
+	b, err := ioutil.ReadFile(path("2.2.0"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, newer, string(b), "Newer config should have been left intact")
+	}
+
+	// Upgraded again, so the newer config is used as it was
+	assert.True(t, useGoodOldConfig(dir, path("2.2.0"), "2.2.0"))
+	assert.NotNil(t, read("2.2.0")["newfeature"])
+
+	// Rolled back to another version with an older config around, which is
+	// preferred over the newer one
+	older := "provenance: custom\nclient:\n  chainedservers:\n    custom:\n      addr: 1.1.1.1:443\n"
+	if err := ioutil.WriteFile(path("2.0.0"), []byte(older), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+	assert.True(t, useGoodOldConfig(dir, path("2.0.5"), "2.0.5"))
+	server = read("2.0.5")["client"].(map[interface{}]interface{})["chainedservers"].(map[interface{}]interface{})["custom"].(map[interface{}]interface{})
+	assert.Equal(t, "1.1.1.1:443", server["addr"], "Should have preferred the older config")
+	assert.NotNil(t, read("2.2.0")["newfeature"], "Newer config should still be intact")
+
+	// Upgrading past all of them moves the newest config into place
+	assert.True(t, useGoodOldConfig(dir, path("2.3.0"), "2.3.0"))
+	assert.NotNil(t, read("2.3.0")["newfeature"], "Should have used the newest config")
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"sort"
+)
+
+var noDialableServersIssue = Issue{Field: "Client.ChainedServers", Message: "no dialable chained servers"}
+
+// applyCloudUpdate merges the given cloud config into this Config like
+// updateFrom. With DryRunCloudUpdates, the update is first merged into a copy
+// of this Config, which has to pass validation and the sanity checks below
+// without new issues before it replaces this Config. Otherwise, this Config is
+// left as it was and a *ValidationError is returned.
+// Without dry runs, an update that leaves none of our chained servers dialable
+// when some were is still refused the same way, but only once it's merged, so
+// this Config has to be thrown away then, like yamlconf does with the copy it
+// mutates.
+func (cfg *Config) applyCloudUpdate(updateBytes []byte) error {
+	if !cfg.DryRunCloudUpdates || cfg.alreadyMerged(updateBytes) {
+		dialable := cfg.dialableChainedServers()
+		if err := cfg.updateFrom(updateBytes); err != nil {
+			return err
+		}
+		if dialable > 0 && cfg.dialableChainedServers() == 0 {
+			// Like dry runs would, refuse to leave us nothing to proxy through
+			err := &ValidationError{[]Issue{noDialableServersIssue}}
+			log.Errorf("Rejecting cloud config: %v", err)
+			return err
+		}
+		return nil
+	}
+	candidate, err := cfg.candidateFrom(updateBytes)
+	if err != nil {
+		return err
+	}
+	// Problems we already have are no reason to refuse an update
+	before := append(cfg.Validate(), cfg.sanityIssues()...)
+	after := append(candidate.Validate(), candidate.sanityIssues()...)
+	if issues := newIssues(before, after); len(issues) > 0 {
+		err := &ValidationError{issues}
+		log.Errorf("Rejecting cloud config after dry run: %v", err)
+		return err
+	}
+	return cfg.commit(candidate)
+}
+
+// sanityIssues checks that this Config leaves Lantern something to work with,
+// which individually valid settings may not when taken together.
+func (cfg *Config) sanityIssues() []Issue {
+	var issues []Issue
+	if cfg.Client != nil && len(cfg.Client.ChainedServers) == 0 && len(cfg.Client.FrontedServers) == 0 {
+		issues = append(issues, Issue{Field: "Client", Message: "no chained or fronted servers"})
+	}
+	if cfg.Client != nil && len(cfg.Client.ChainedServers) > 0 && cfg.dialableChainedServers() == 0 {
+		issues = append(issues, noDialableServersIssue)
+	}
+	if len(cfg.TrustedCAs) == 0 {
+		issues = append(issues, Issue{Field: "TrustedCAs", Message: "no trusted CAs"})
+	}
+	if len(cfg.effectiveProxiedSites()) == 0 {
+		issues = append(issues, Issue{Field: "ProxiedSites", Message: "no proxied sites"})
+	}
+	return issues
+}
+
+// effectiveProxiedSites returns the sorted list of sites that are proxied,
+// which is the cloud list plus the user's additions minus the user's
+// deletions.
+func (cfg *Config) effectiveProxiedSites() []string {
+	sites := make([]string, 0)
+	if cfg.ProxiedSites == nil {
+		return sites
+	}
+	active := make(map[string]bool)
+	for _, site := range cfg.ProxiedSites.Cloud {
+		active[site] = true
+	}
+	if delta := cfg.ProxiedSites.Delta; delta != nil {
+		for _, site := range delta.Additions {
+			active[site] = true
+		}
+		for _, site := range delta.Deletions {
+			delete(active, site)
+		}
+	}
+	for site := range active {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+	return sites
+}
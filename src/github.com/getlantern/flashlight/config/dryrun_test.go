@@ -0,0 +1,129 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/proxiedsites"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+// cloudUpdate returns cloud config YAML with the given chained servers, the
+// default trusted CAs and one proxied site.
+func cloudUpdate(t *testing.T, servers map[string]*client.ChainedServerInfo) string {
+	if servers == nil {
+		servers = map[string]*client.ChainedServerInfo{}
+	}
+	update := map[string]interface{}{
+		"client":       map[string]interface{}{"chainedservers": servers},
+		"trustedcas":   defaultTrustedCAs,
+		"proxiedsites": map[string]interface{}{"cloud": []string{"a.com"}},
+	}
+	data, err := yaml.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDryRunRejectsUpdateWithoutServers(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+	srv := configtest.NewCloudConfigServer(cloudUpdate(t, map[string]*client.ChainedServerInfo{
+		"fallback-cloud": {Addr: "2.2.2.2:443", AuthToken: "cloud-token"},
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	initial := "dryruncloudupdates: true\nclient:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n"
+	if err := ioutil.WriteFile(path, []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Init("2.1.0", WithConfigDir(dir), WithCloudConfigURLs(srv.ConfigURL(), ""), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer Stop()
+	// Consume updates like Run would
+	mgr := m
+	go func() {
+		for {
+			mgr.Next()
+		}
+	}()
+	poll := func() error {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return err
+		}
+		return m.Update(mutate)
+	}
+
+	// A good update passes the dry run
+	assert.NoError(t, poll())
+	before := current()
+	if !assert.NotNil(t, before.Client.ChainedServers["fallback-cloud"], "Good update should have been applied") {
+		return
+	}
+	assert.NoError(t, Flush())
+	onDisk, err := ioutil.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// One that leaves us without servers doesn't
+	srv.SetConfig(cloudUpdate(t, nil))
+	err = poll()
+	if assert.Error(t, err) {
+		_, invalid := err.(*ValidationError)
+		assert.True(t, invalid, "Should have been rejected by validation, not %v", err)
+	}
+	assert.True(t, before == current(), "In-memory config should be untouched")
+	assert.NotNil(t, current().Client.ChainedServers["fallback-cloud"], "Servers should be untouched")
+	assert.NoError(t, Flush())
+	afterRejection, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(onDisk), string(afterRejection), "Config file should be untouched")
+	}
+	assert.NotEmpty(t, DebugState().QuarantinedETag, "Rejected config should have been quarantined")
+	assert.Contains(t, categoriesOf(*collected), ValidateError)
+}
+
+func TestApplyCloudUpdateWithoutDryRun(t *testing.T) {
+	cfg := &Config{
+		Client: &client.ClientConfig{ChainedServers: map[string]*client.ChainedServerInfo{
+			"fallback-1": {Addr: "1.1.1.1:443"},
+		}},
+		TrustedCAs:   defaultTrustedCAs,
+		ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}, Cloud: []string{"a.com"}},
+	}
+	err := cfg.applyCloudUpdate([]byte(cloudUpdate(t, nil)))
+	assert.IsType(t, &ValidationError{}, err, "Update leaving no dialable servers should have been refused")
+
+	// Without servers to begin with, there's nothing to lose
+	cfg.Client.ChainedServers = nil
+	if assert.NoError(t, cfg.applyCloudUpdate([]byte(cloudUpdate(t, nil)))) {
+		assert.Empty(t, cfg.Client.ChainedServers, "Update should have been applied as is")
+	}
+
+	cfg.DryRunCloudUpdates = true
+	assert.NoError(t, cfg.applyCloudUpdate([]byte(cloudUpdate(t, nil))), "Dry run should not refuse problems we already have")
+}
+
+func TestEffectiveProxiedSites(t *testing.T) {
+	cfg := &Config{ProxiedSites: &proxiedsites.Config{
+		Delta: &proxiedsites.Delta{Additions: []string{"b.com"}, Deletions: []string{"a.com"}},
+		Cloud: []string{"a.com"},
+	}}
+	assert.Equal(t, []string{"b.com"}, cfg.effectiveProxiedSites())
+	cfg.ProxiedSites.Delta.Additions = nil
+	assert.Empty(t, cfg.effectiveProxiedSites())
+	assert.Len(t, cfg.sanityIssues(), 2, "Should lack trusted CAs and proxied sites")
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+// DumpEffective writes the current effective config, with defaults and flags
+// applied and secrets masked, to w. format is either "yaml" or "json". The
+// configuration system must have been initialized with Init.
+func DumpEffective(w io.Writer, format string) error {
+	cfg := current()
+	if cfg == nil {
+		return fmt.Errorf("Config not initialized")
+	}
+	return writeRedacted(w, cfg, format)
+}
+
+// writeRedacted writes the given Config, with secrets masked, to w in the
+// given format, either "yaml" or "json".
+func writeRedacted(w io.Writer, cfg *Config, format string) error {
+	redactedCfg, err := cfg.redactedCopy()
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	switch format {
+	case "yaml":
+		b, err = yaml.Marshal(redactedCfg)
+	case "json":
+		b, err = json.MarshalIndent(redactedCfg, "", "  ")
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("Unknown format %q, expected yaml or json", format)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to marshal config: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// traceEffective logs the given Config in full, with secrets masked, if
+// tracing is on, saying what it is with what. Rendering the config is costly,
+// so it's skipped entirely otherwise.
+func (cfg *Config) traceEffective(what string) {
+	if !log.IsTraceEnabled() {
+		return
+	}
+	var b bytes.Buffer
+	if err := writeRedacted(&b, cfg, "yaml"); err != nil {
+		log.Errorf("Unable to log %v: %v", what, err)
+		return
+	}
+	log.Tracef("%v:\n%v", what, b.String())
+}
+
+// DumpConfig prints the effective config for the given version of Lantern to
+// w, with secrets masked, if the -dump-config flag was given. dumped is false
+// if no dump was requested. ok indicates whether the config loaded cleanly.
+// Rather than initializing the config with Init, DumpConfig reads the config
+// file, or that of the profile in use, through a store that keeps changes in
+// memory, so it doesn't take the config lock, change the config dir, create a
+// first run config or touch the network. If there's no config file yet, it
+// says so.
+func DumpConfig(w io.Writer, version string) (dumped bool, ok bool) {
+	if !*dumpConfig {
+		return false, false
+	}
+	path := filepath.Join(configDirPath(), configFileName(version))
+	if name := selectedProfile(); name != DefaultProfile {
+		path = filepath.Join(configDirPath(), profilesDirName, name+".yaml")
+	}
+	data, err := readConfigFile(path)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(w, "There is no config at %v yet, Lantern creates it when it first runs\n", path)
+		return true, true
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Unable to load config: %v\n", err)
+		return true, false
+	}
+	runningVersion = version
+	loadEmbeddedCloudConfig()
+	store := yamlconf.NewMemoryStore(data)
+	if err := prepareStore(store); err != nil {
+		fmt.Fprintf(w, "Unable to load config: %v\n", err)
+		return true, false
+	}
+	mgr := newManager(store)
+	cfg, err := mgr.Init()
+	if err != nil {
+		fmt.Fprintf(w, "Unable to load config: %v\n", err)
+		return true, false
+	}
+	defer mgr.Stop()
+	if err := writeRedacted(w, cfg.(*Config), *dumpFormat); err != nil {
+		fmt.Fprintln(w, err)
+		return true, false
+	}
+	return true, true
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+func TestDumpEffective(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	var buf bytes.Buffer
+	if assert.NoError(t, DumpEffective(&buf, "yaml")) {
+		out := buf.String()
+		assert.Contains(t, out, "addr: 127.0.0.1:8787", "Defaults should be applied")
+		assert.Contains(t, out, "1.2.3.4:443")
+		assert.False(t, strings.Contains(out, "supersecret"), "Auth token should be masked")
+	}
+
+	buf.Reset()
+	if assert.NoError(t, DumpEffective(&buf, "json")) {
+		cfg := &Config{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), cfg))
+		assert.Equal(t, redacted, string(cfg.Client.ChainedServers["fallback-1"].AuthToken))
+	}
+
+	assert.Error(t, DumpEffective(&buf, "xml"))
+}
+
+func TestDumpConfigLeavesConfigDirAlone(t *testing.T) {
+	defer useTempConfigDir(t)()
+	origDumpConfig := *dumpConfig
+	*dumpConfig = true
+	defer func() {
+		*dumpConfig = origDumpConfig
+	}()
+	dir := *configdir
+	path := filepath.Join(dir, configFileName("9.9.9"))
+
+	var buf bytes.Buffer
+	dumped, ok := DumpConfig(&buf, "9.9.9")
+	assert.True(t, dumped)
+	assert.True(t, ok)
+	assert.Contains(t, buf.String(), "There is no config at "+path+" yet")
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, entries, "Nothing should have been written to the config dir")
+
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(handlerTestConfig), 0644)) {
+		return
+	}
+	buf.Reset()
+	dumped, ok = DumpConfig(&buf, "9.9.9")
+	assert.True(t, dumped)
+	assert.True(t, ok)
+	out := buf.String()
+	assert.Contains(t, out, "1.2.3.4:443")
+	assert.Contains(t, out, "addr: 127.0.0.1:8787", "Defaults should be applied")
+	assert.False(t, strings.Contains(out, "supersecret"), "Auth token should be masked")
+	entries, _ = ioutil.ReadDir(dir)
+	assert.Len(t, entries, 1, "Nothing should have been added to the config dir")
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, handlerTestConfig, string(data), "Config file should be untouched")
+}
+
+func TestSecretsNotFormatted(t *testing.T) {
+	server := &client.ChainedServerInfo{Addr: "1.2.3.4:443", AuthToken: "supersecret", Cert: "CERTSECRET"}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+		out := fmt.Sprintf(verb, server)
+		assert.False(t, strings.Contains(out, "supersecret"), "Auth token should be masked with %v: %v", verb, out)
+		assert.False(t, strings.Contains(out, "CERTSECRET"), "Cert should be masked with %v: %v", verb, out)
+	}
+	assert.Equal(t, "", client.Secret("").String(), "Empty secrets should look empty")
+
+	data, err := yaml.Marshal(server)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "supersecret", "YAML should keep the actual auth token")
+	}
+	data, err = json.Marshal(server)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "supersecret", "JSON should keep the actual auth token")
+	}
+}
+
+func TestTraceEffective(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+	var out bytes.Buffer
+	golog.SetOutputs(&out, &out)
+	defer golog.ResetOutputs()
+	origLog := log
+	defer func() {
+		log = origLog
+	}()
+
+	current().traceEffective("Test config")
+	assert.Empty(t, out.String(), "Nothing should be logged without tracing")
+
+	os.Setenv("TRACE", "true")
+	log = golog.LoggerFor("flashlight.config")
+	os.Unsetenv("TRACE")
+	current().traceEffective("Test config")
+	logged := out.String()
+	assert.Contains(t, logged, "Test config:")
+	assert.Contains(t, logged, "1.2.3.4:443", "Config should have been logged")
+	assert.False(t, strings.Contains(logged, "supersecret"), "Auth token should be masked")
+}
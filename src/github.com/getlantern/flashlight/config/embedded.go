@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// Provenances of the cloud settings in a config
+	cloudProvenanceEmbedded   = "embedded"
+	cloudProvenanceCached     = "cached"
+	cloudProvenanceFetched    = "fetched"
+	cloudProvenanceRolledBack = "rolledback"
+)
+
+var (
+	// EmbeddedCloudConfig is a gzipped snapshot of the cloud config that the
+	// main binary can embed (for example with go-bindata) to fall back to when
+	// we can't fetch cloud config on the first run.
+	EmbeddedCloudConfig []byte
+
+	// EmbeddedCloudConfigChecksum is the hex encoded SHA-256 checksum of
+	// EmbeddedCloudConfig, which must be set along with it.
+	EmbeddedCloudConfigChecksum string
+
+	// The YAML of the embedded cloud config, nil if there isn't any or it
+	// failed verification.
+	embeddedCloudConfig []byte
+)
+
+// loadEmbeddedCloudConfig verifies and decompresses EmbeddedCloudConfig, if
+// there is one, making it available for use on the first run. Corrupt
+// embedded cloud configs are reported and ignored.
+func loadEmbeddedCloudConfig() {
+	embeddedCloudConfig = nil
+	if len(EmbeddedCloudConfig) == 0 {
+		return
+	}
+	decoded, err := decodeEmbeddedCloudConfig(EmbeddedCloudConfig, EmbeddedCloudConfigChecksum)
+	if err != nil {
+		err = fmt.Errorf("Ignoring embedded cloud config: %v", err)
+		log.Error(err)
+		reportError(ParseError, err, false)
+		return
+	}
+	log.Debugf("Loaded embedded cloud config")
+	embeddedCloudConfig = decoded
+}
+
+func decodeEmbeddedCloudConfig(data []byte, checksum string) ([]byte, error) {
+	expected, err := hex.DecodeString(checksum)
+	if err != nil || len(expected) != sha256.Size {
+		return nil, fmt.Errorf("invalid checksum %q", checksum)
+	}
+	actual := sha256.Sum256(data)
+	if !bytes.Equal(expected, actual[:]) {
+		return nil, fmt.Errorf("checksum mismatch, expected %v but was %v", checksum, hex.EncodeToString(actual[:]))
+	}
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open gzip reader: %v", err)
+	}
+	decoded, err := ioutil.ReadAll(gzReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read gzipped config: %v", err)
+	}
+	return decoded, nil
+}
+
+// shouldUseEmbeddedCloudConfig returns whether the given Config should fall
+// back to the embedded cloud config because fetching cloud config failed,
+// which is only the case if it's never had any cloud settings.
+func (cfg *Config) shouldUseEmbeddedCloudConfig() bool {
+	return embeddedCloudConfig != nil && cfg.LastCloudUpdate == "" && cfg.CloudProvenance == ""
+}
+
+// applyEmbeddedCloudConfig merges the embedded cloud config into this Config.
+// Its CloudProvenance marks it as embedded until cloud config is fetched.
+func (cfg *Config) applyEmbeddedCloudConfig() {
+	log.Debugf("Merging embedded cloud configuration")
+	cfg.CloudProvenance = cloudProvenanceEmbedded
+	if err := cfg.updateFrom(embeddedCloudConfig); err != nil {
+		cfg.CloudProvenance = ""
+		reportError(ParseError, fmt.Errorf("Rejected embedded cloud config: %v", err), false)
+	}
+}
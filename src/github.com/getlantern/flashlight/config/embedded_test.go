@@ -0,0 +1,85 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+func useEmbeddedCloudConfig(t *testing.T, yml string, checksum string) func() {
+	origData, origChecksum := EmbeddedCloudConfig, EmbeddedCloudConfigChecksum
+	EmbeddedCloudConfig = gzipped(t, yml)
+	EmbeddedCloudConfigChecksum = checksum
+	if checksum == "" {
+		sum := sha256.Sum256(EmbeddedCloudConfig)
+		EmbeddedCloudConfigChecksum = hex.EncodeToString(sum[:])
+	}
+	loadEmbeddedCloudConfig()
+	return func() {
+		EmbeddedCloudConfig, EmbeddedCloudConfigChecksum = origData, origChecksum
+		loadEmbeddedCloudConfig()
+	}
+}
+
+func TestFirstRunUsesEmbeddedCloudConfig(t *testing.T) {
+	defer useEmbeddedCloudConfig(t, "client:\n  chainedservers:\n    embedded-1:\n      addr: 1.1.1.1:443\n", "")()
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")()
+	defer useTestFetcher()()
+
+	// Disable all network paths
+	cf = &failingFetcher{}
+	origServers := bootstrapServers
+	defer func() {
+		bootstrapServers = origServers
+	}()
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{}
+	}
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	poll()
+	cfg := current()
+	assert.Equal(t, cloudProvenanceEmbedded, cfg.CloudProvenance)
+	assert.NotNil(t, cfg.Client.ChainedServers["embedded-1"], "Embedded servers should be in config")
+	assert.NotEmpty(t, cfg.LastCloudError, "Failed fetch should still be recorded")
+
+	// The next successful poll replaces the embedded config
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write(gzipped(t, "client:\n  chainedservers:\n    cloud-1:\n      addr: 2.2.2.2:443\n"))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+	poll()
+	cfg = current()
+	assert.Equal(t, cloudProvenanceFetched, cfg.CloudProvenance)
+	assert.Nil(t, cfg.Client.ChainedServers["embedded-1"], "Embedded servers should have been replaced")
+	assert.NotNil(t, cfg.Client.ChainedServers["cloud-1"])
+
+	// Once we've had cloud config, failures don't bring back the embedded one
+	cf = &failingFetcher{}
+	poll()
+	cfg = current()
+	assert.Equal(t, cloudProvenanceFetched, cfg.CloudProvenance)
+	assert.Nil(t, cfg.Client.ChainedServers["embedded-1"])
+}
+
+func TestCorruptEmbeddedCloudConfigIgnored(t *testing.T) {
+	reported, stop := collectErrors()
+	defer stop()
+	defer useEmbeddedCloudConfig(t, "client:\n  chainedservers:\n    embedded-1:\n      addr: 1.1.1.1:443\n", hex.EncodeToString(make([]byte, sha256.Size)))()
+
+	assert.Nil(t, embeddedCloudConfig, "Embedded config with bad checksum should be ignored")
+	assert.Contains(t, categoriesOf(*reported), ParseError)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// The encodings we accept for cloud config, most compact first. Since we
+	// ask for them ourselves, http.Transport leaves decoding them to us.
+	acceptedEncodings = "zstd, br, gzip"
+
+	// The header with which the cloud config server may send the hex-encoded
+	// SHA-256 of the config once decoded (of the delta, for deltas), so that
+	// we notice configs that got truncated or mangled on the way, for example
+	// by flaky proxies
+	contentSHA256Header = "X-Lantern-Content-Sha256"
+)
+
+var (
+	// maxDecodedSize is the most we decode a cloud config response to, so
+	// that a small response that decodes to something huge, by accident or as
+	// a decompression bomb, can't run us out of memory. Published cloud
+	// configs are a few MB.
+	maxDecodedSize int64 = 64 * 1024 * 1024
+)
+
+// decodeContent returns the given response body with the given
+// Content-Encoding removed. Like the header, the encoding may list several
+// encodings in the order they were applied.
+func decodeContent(encoding string, body []byte) ([]byte, error) {
+	encodings := strings.Split(encoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch name := strings.ToLower(strings.TrimSpace(encodings[i])); name {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			var reader *gzip.Reader
+			if reader, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+				body, err = readDecoded(reader)
+			}
+		case "br":
+			body, err = readDecoded(brotli.NewReader(bytes.NewReader(body)))
+		case "zstd":
+			body, err = decodeZstd(body)
+		default:
+			return nil, &decodeError{fmt.Errorf("Unsupported content encoding %v", name)}
+		}
+		if err != nil {
+			return nil, &decodeError{fmt.Errorf("Unable to decode %v content: %v", encodings[i], err)}
+		}
+	}
+	return body, nil
+}
+
+// readDecoded reads what the given decoder decodes, up to maxDecodedSize.
+func readDecoded(decoder io.Reader) ([]byte, error) {
+	decoded, err := ioutil.ReadAll(io.LimitReader(decoder, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > maxDecodedSize {
+		return nil, errDecodedTooLarge()
+	}
+	return decoded, nil
+}
+
+func errDecodedTooLarge() error {
+	return fmt.Errorf("Decoded content is larger than %d bytes", maxDecodedSize)
+}
+
+func decodeZstd(body []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxDecodedSize)))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	decoded, err := decoder.DecodeAll(body, nil)
+	if err == zstd.ErrDecoderSizeExceeded {
+		return nil, errDecodedTooLarge()
+	}
+	return decoded, err
+}
+
+// checkContentSHA256 returns an error if the given decoded config doesn't
+// match the given contentSHA256Header, if there is one.
+func checkContentSHA256(decoded []byte, header string) error {
+	if header == "" {
+		return nil
+	}
+	expected, err := hex.DecodeString(strings.TrimSpace(header))
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("Invalid %v: %q", contentSHA256Header, header)
+	}
+	actual := sha256.Sum256(decoded)
+	if !bytes.Equal(actual[:], expected) {
+		return fmt.Errorf("Cloud config of %d bytes doesn't match its %v, it may have been truncated", len(decoded), contentSHA256Header)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchContentEncodings(t *testing.T) {
+	defer useTestFetcher()()
+
+	body := "addr: 127.0.0.1:8787\nproxiedsites:\n  cloud:\n  - example.com\n"
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
+	encoded := map[string][]byte{
+		"zstd": zstdEncoded(t, gzipped(t, body)),
+		"br":   brotliEncoded(t, gzipped(t, body)),
+		"gzip": gzipped(t, body),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, acceptedEncodings, req.Header.Get("Accept-Encoding"))
+		encoding := strings.TrimPrefix(req.URL.Path, "/")
+		switch encoding {
+		case "truncated":
+			resp.Header().Set(contentSHA256Header, checksum)
+			resp.Write([]byte(body[:len(body)-5]))
+			return
+		case "unknown":
+			resp.Header().Set("Content-Encoding", "lzma")
+			resp.Write(gzipped(t, body))
+			return
+		}
+		resp.Header().Set("Content-Encoding", encoding)
+		resp.Header().Set(contentSHA256Header, checksum)
+		resp.Write(encoded[encoding])
+	}))
+	defer srv.Close()
+
+	for encoding := range encoded {
+		b, err := fetchCloudConfig(context.Background(), srv.URL+"/"+encoding)
+		if assert.NoError(t, err, encoding) {
+			assert.Equal(t, body, string(b), encoding)
+		}
+	}
+	_, err := fetchCloudConfig(context.Background(), srv.URL+"/truncated")
+	if assert.Error(t, err, "Config not matching its content SHA-256 should be refused") {
+		assert.Contains(t, err.Error(), "truncated")
+	}
+	_, err = fetchCloudConfig(context.Background(), srv.URL+"/unknown")
+	assert.IsType(t, &decodeError{}, err, "Unknown content encodings should be refused")
+}
+
+func TestDecodedSizeLimited(t *testing.T) {
+	origMax := maxDecodedSize
+	defer func() {
+		maxDecodedSize = origMax
+	}()
+	maxDecodedSize = 1024
+
+	small := "proxiedsites:\n  cloud:\n  - example.com\n"
+	large := "proxiedsites:\n  cloud:\n" + strings.Repeat("  - example.com\n", 1000)
+	for encoding, encode := range map[string]func(*testing.T, []byte) []byte{
+		"zstd": zstdEncoded,
+		"br":   brotliEncoded,
+		"gzip": func(t *testing.T, b []byte) []byte { return gzipped(t, string(b)) },
+	} {
+		decoded, err := decodeContent(encoding, encode(t, []byte(small)))
+		if assert.NoError(t, err, encoding) {
+			assert.Equal(t, small, string(decoded), encoding)
+		}
+		_, err = decodeContent(encoding, encode(t, []byte(large)))
+		if assert.IsType(t, &decodeError{}, err, encoding) {
+			assert.Contains(t, err.Error(), "larger than 1024 bytes", encoding)
+		}
+	}
+	_, err := decodeConfig(gzipped(t, large))
+	if assert.IsType(t, &decodeError{}, err) {
+		assert.Contains(t, err.Error(), "larger than 1024 bytes")
+	}
+}
+
+func zstdEncoded(t *testing.T, b []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("Unable to create zstd encoder: %v", err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(b, nil)
+}
+
+func brotliEncoded(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatalf("Unable to brotli encode: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to brotli encode: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// encryptedHeader marks a config that has been sealed with the config key.
+	encryptedHeader = "LANTERN-ENCRYPTED-CONFIG-V1\n"
+)
+
+// encryptingStore wraps a ConfigStore, transparently opening configs that were
+// sealed with the config key when loading them and sealing configs when saving
+// them if encryption is enabled. The config is sealed with AES-GCM, so that
+// tampering with it is detected.
+type encryptingStore struct {
+	ConfigStore
+
+	// encrypt: whether to encrypt when saving, or nil to keep the config
+	// encrypted or not as it was when last loaded
+	encrypt *bool
+
+	// key: loads the config key, creating it if create is true and there
+	// isn't one yet
+	key func(create bool) ([]byte, error)
+
+	// keys: loads the keys with which the config may have been encrypted
+	keys func() ([][]byte, error)
+
+	encrypted bool
+	mx        sync.Mutex
+}
+
+func newEncryptingStore(store ConfigStore, encrypt *bool) *encryptingStore {
+	return &encryptingStore{
+		ConfigStore: store,
+		encrypt:     encrypt,
+		key:         loadConfigKey,
+		keys:        loadConfigKeys,
+	}
+}
+
+// Load implements the method from ConfigStore.
+func (s *encryptingStore) Load() ([]byte, error) {
+	data, err := s.ConfigStore.Load()
+	if err != nil {
+		return nil, err
+	}
+	encrypted := isEncrypted(data)
+	s.mx.Lock()
+	s.encrypted = encrypted
+	s.mx.Unlock()
+	if encrypted {
+		keys, err := s.keys()
+		if err != nil {
+			return nil, &decryptError{fmt.Errorf("Config is encrypted but the key to decrypt it is unavailable: %v", err)}
+		}
+		if data, err = openWithAny(keys, data); err != nil {
+			return nil, &decryptError{err}
+		}
+	}
+	// Configs edited by hand may be split into several documents
+	return flattenDocuments(data)
+}
+
+// Save implements the method from ConfigStore.
+func (s *encryptingStore) Save(data []byte) error {
+	if !s.shouldEncrypt() {
+		return s.ConfigStore.Save(data)
+	}
+	// Only create a key if the config isn't encrypted yet. Otherwise, were the
+	// keychain briefly unavailable, we'd encrypt the config with a new key
+	// and be unable to decrypt it with the keychain's once it's back.
+	s.mx.Lock()
+	create := !s.encrypted
+	s.mx.Unlock()
+	key, err := s.key(create)
+	if err != nil {
+		return fmt.Errorf("Unable to get key to encrypt config: %v", err)
+	}
+	sealed, err := seal(key, data)
+	if err != nil {
+		return err
+	}
+	if err := s.ConfigStore.Save(sealed); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	s.encrypted = true
+	s.mx.Unlock()
+	return nil
+}
+
+// Close closes the wrapped store if it can be closed.
+func (s *encryptingStore) Close() error {
+	if closer, ok := s.ConfigStore.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *encryptingStore) shouldEncrypt() bool {
+	if s.encrypt != nil {
+		return *s.encrypt
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.encrypted
+}
+
+// convert rewrites the stored config so that it's encrypted or not as
+// configured, returning true if it had to be changed.
+func (s *encryptingStore) convert() (bool, error) {
+	data, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	if len(data) == 0 || s.encrypted == s.shouldEncrypt() {
+		return false, nil
+	}
+	if err := s.Save(data); err != nil {
+		return false, err
+	}
+	if s.shouldEncrypt() {
+		if err := s.sealBackup(); err != nil {
+			return false, err
+		}
+	}
+	log.Debugf("Config encryption changed to %v", s.shouldEncrypt())
+	return true, nil
+}
+
+// sealBackup replaces the backup that the file store made of the plaintext
+// config when we encrypted it with the encrypted config, so that the
+// plaintext isn't left behind. If that fails, the backup is removed.
+func (s *encryptingStore) sealBackup() error {
+	file, ok := s.ConfigStore.(*yamlconf.FileStore)
+	if !ok {
+		return nil
+	}
+	backupPath := file.Path + yamlconf.BackupSuffix
+	sealed, err := ioutil.ReadFile(file.Path)
+	if err == nil {
+		err = yamlconf.WriteFileAtomically(backupPath, sealed)
+	}
+	if err == nil {
+		return nil
+	}
+	log.Errorf("Unable to encrypt config backup, removing it: %v", err)
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove plaintext config backup at %v: %v", backupPath, err)
+	}
+	return nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedHeader))
+}
+
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("Unable to generate nonce: %v", err)
+	}
+	sealed := append([]byte(encryptedHeader), nonce...)
+	return gcm.Seal(sealed, nonce, plaintext, []byte(encryptedHeader)), nil
+}
+
+// openWithAny opens the sealed config with whichever of the keys it was
+// sealed with.
+func openWithAny(keys [][]byte, sealed []byte) ([]byte, error) {
+	err := errNoConfigKey
+	for _, key := range keys {
+		var plaintext []byte
+		if plaintext, err = open(key, sealed); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, err
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[len(encryptedHeader):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Encrypted config is truncated")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], []byte(encryptedHeader))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt config, either the key is wrong or the config has been tampered with: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// readConfigFile reads the config file at path, decrypting it if necessary.
+func readConfigFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !isEncrypted(data) {
+		return data, err
+	}
+	keys, err := loadConfigKeys()
+	if err != nil {
+		return nil, &decryptError{fmt.Errorf("Config at %v is encrypted but the key to decrypt it is unavailable: %v", path, err)}
+	}
+	plaintext, err := openWithAny(keys, data)
+	if err != nil {
+		return nil, &decryptError{err}
+	}
+	return plaintext, nil
+}
+
+// decryptError indicates that a config is encrypted but couldn't be
+// decrypted, because the key is unavailable or wrong or the config was
+// tampered with. Rather than fall back to another config, which would replace
+// the user's for good once saved, we treat it as fatal.
+type decryptError struct {
+	err error
+}
+
+func (e *decryptError) Error() string {
+	return e.err.Error()
+}
+
+func isDecryptError(err error) bool {
+	_, ok := err.(*decryptError)
+	return ok
+}
+
+// encryptionFlag returns the setting of the -encryptconfig flag, or nil if it
+// wasn't specified.
+func encryptionFlag() *bool {
+	var encrypt *bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "encryptconfig" {
+			encrypt = encryptConfig
+		}
+	})
+	return encrypt
+}
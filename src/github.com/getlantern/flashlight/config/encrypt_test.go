@@ -0,0 +1,297 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	plaintextConfig = "addr: localhost:8787\nclient:\n  chainedservers:\n    fallback-1:\n      addr: 1.2.3.4:443\n      authtoken: supersecret\n"
+)
+
+// useTestConfigKey makes the config key the given key, or unavailable if key
+// is nil. The returned function restores the original key source.
+func useTestConfigKey(key []byte) func() {
+	orig, origKeys := loadConfigKey, loadConfigKeys
+	loadConfigKey = func(create bool) ([]byte, error) {
+		if key == nil {
+			return nil, errNoConfigKey
+		}
+		return key, nil
+	}
+	loadConfigKeys = func() ([][]byte, error) {
+		if key == nil {
+			return nil, errNoConfigKey
+		}
+		return [][]byte{key}, nil
+	}
+	return func() {
+		loadConfigKey, loadConfigKeys = orig, origKeys
+	}
+}
+
+func testConfigKey(t *testing.T) []byte {
+	key, err := newConfigKey()
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	return key
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+
+	encrypt := true
+	mem := yamlconf.NewMemoryStore(nil)
+	store := newEncryptingStore(mem, &encrypt)
+	if !assert.NoError(t, store.Save([]byte(plaintextConfig))) {
+		return
+	}
+	raw, _ := mem.Load()
+	assert.True(t, isEncrypted(raw), "Saved config should be encrypted")
+	assert.NotContains(t, string(raw), "supersecret")
+
+	loaded, err := store.Load()
+	if assert.NoError(t, err) {
+		assert.Equal(t, plaintextConfig, string(loaded))
+	}
+}
+
+func TestEncryptionMigration(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+
+	mem := yamlconf.NewMemoryStore([]byte(plaintextConfig))
+	encrypt := true
+	converted, err := newEncryptingStore(mem, &encrypt).convert()
+	if assert.NoError(t, err) {
+		assert.True(t, converted)
+	}
+	raw, _ := mem.Load()
+	assert.True(t, isEncrypted(raw), "Plaintext config should have been encrypted")
+
+	// Without the flag, the config should stay encrypted
+	store := newEncryptingStore(mem, nil)
+	converted, err = store.convert()
+	if assert.NoError(t, err) {
+		assert.False(t, converted)
+	}
+	assert.NoError(t, store.Save([]byte(plaintextConfig)))
+	raw, _ = mem.Load()
+	assert.True(t, isEncrypted(raw), "Config should have stayed encrypted")
+
+	encrypt = false
+	converted, err = newEncryptingStore(mem, &encrypt).convert()
+	if assert.NoError(t, err) {
+		assert.True(t, converted)
+	}
+	raw, _ = mem.Load()
+	assert.Equal(t, plaintextConfig, string(raw), "Encrypted config should have been decrypted")
+}
+
+func TestEncryptionSealsBackup(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+	path := filepath.Join(t.TempDir(), "lantern.yaml")
+	if err := ioutil.WriteFile(path, []byte(plaintextConfig), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+
+	encrypt := true
+	converted, err := newEncryptingStore(yamlconf.NewFileStore(path), &encrypt).convert()
+	if !assert.NoError(t, err) || !assert.True(t, converted) {
+		return
+	}
+	backup, err := ioutil.ReadFile(path + yamlconf.BackupSuffix)
+	if assert.NoError(t, err) {
+		assert.True(t, isEncrypted(backup), "Backup should have been encrypted along with the config")
+		assert.NotContains(t, string(backup), "supersecret")
+	}
+}
+
+func TestPlaintextBackupNotRestoredOverEncryptedConfig(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+	path := filepath.Join(t.TempDir(), "lantern.yaml")
+	damaged := []byte(encryptedHeader + "garbled")
+	if err := ioutil.WriteFile(path, damaged, 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+	if err := ioutil.WriteFile(path+yamlconf.BackupSuffix, []byte(plaintextConfig), 0644); err != nil {
+		t.Fatalf("Unable to write backup: %v", err)
+	}
+
+	restoreConfigBackup(path)
+	onDisk, _ := ioutil.ReadFile(path)
+	assert.Equal(t, damaged, onDisk, "Plaintext backup should not have replaced encrypted config")
+}
+
+func TestTamperedConfig(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+
+	encrypt := true
+	mem := yamlconf.NewMemoryStore(nil)
+	store := newEncryptingStore(mem, &encrypt)
+	if !assert.NoError(t, store.Save([]byte(plaintextConfig))) {
+		return
+	}
+	raw, _ := mem.Load()
+	raw[len(raw)-1] ^= 0xff
+	mem.Save(raw)
+
+	_, err := store.Load()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "tampered")
+	}
+}
+
+func TestWrongOrMissingKey(t *testing.T) {
+	restore := useTestConfigKey(testConfigKey(t))
+	encrypt := true
+	mem := yamlconf.NewMemoryStore(nil)
+	if !assert.NoError(t, newEncryptingStore(mem, &encrypt).Save([]byte(plaintextConfig))) {
+		return
+	}
+	restore()
+
+	defer useTestConfigKey(testConfigKey(t))()
+	_, err := newEncryptingStore(mem, nil).Load()
+	assert.Error(t, err, "Loading with the wrong key should fail")
+
+	defer useTestConfigKey(nil)()
+	_, err = newEncryptingStore(mem, nil).Load()
+	if assert.Error(t, err, "Loading without a key should fail") {
+		assert.Contains(t, err.Error(), "key to decrypt it is unavailable")
+	}
+}
+
+func TestKeyOnlyCreatedForUnencryptedConfig(t *testing.T) {
+	defer useTestConfigKey(testConfigKey(t))()
+
+	var creates []bool
+	recordCreates := func(store *encryptingStore) *encryptingStore {
+		key := store.key
+		store.key = func(create bool) ([]byte, error) {
+			creates = append(creates, create)
+			return key(create)
+		}
+		return store
+	}
+	encrypt := true
+	mem := yamlconf.NewMemoryStore([]byte(plaintextConfig))
+	store := recordCreates(newEncryptingStore(mem, &encrypt))
+	_, err := store.convert()
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save([]byte(plaintextConfig)))
+
+	store = recordCreates(newEncryptingStore(mem, nil))
+	_, err = store.Load()
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save([]byte(plaintextConfig)))
+	assert.Equal(t, []bool{true, false, false}, creates, "Key should only have been created when first encrypting")
+}
+
+func TestLoadTriesEachKey(t *testing.T) {
+	key := testConfigKey(t)
+	sealed, err := seal(key, []byte(plaintextConfig))
+	if err != nil {
+		t.Fatalf("Unable to seal config: %v", err)
+	}
+
+	store := newEncryptingStore(yamlconf.NewMemoryStore(sealed), nil)
+	store.keys = func() ([][]byte, error) {
+		return [][]byte{testConfigKey(t), key}, nil
+	}
+	loaded, err := store.Load()
+	if assert.NoError(t, err, "Should have decrypted with the second key") {
+		assert.Equal(t, plaintextConfig, string(loaded))
+	}
+}
+
+func TestEncryptedConfigWithoutKeyNotReplaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	origConfigdir := *configdir
+	*configdir = dir
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	sealed, err := seal(testConfigKey(t), []byte(plaintextConfig))
+	if err != nil {
+		t.Fatalf("Unable to seal config: %v", err)
+	}
+	if err := ioutil.WriteFile(path, sealed, 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+
+	defer useTestConfigKey(nil)()
+	_, err = newFileStore("2.1.0")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "key to decrypt it is unavailable")
+	}
+	onDisk, _ := ioutil.ReadFile(path)
+	assert.Equal(t, sealed, onDisk, "Encrypted config should have been left alone")
+}
+
+func TestInitDoesNotFallBackFromUndecryptableConfig(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	sealed, err := seal(testConfigKey(t), []byte(plaintextConfig))
+	if err != nil {
+		t.Fatalf("Unable to seal config: %v", err)
+	}
+	if err := ioutil.WriteFile(path, sealed, 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+
+	for _, key := range [][]byte{nil, testConfigKey(t)} {
+		restore := useTestConfigKey(key)
+		_, err = Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+		restore()
+		if assert.Error(t, err, "Init should fail rather than fall back to the packaged config") {
+			assert.True(t, isDecryptError(err), "Unexpected error: %v", err)
+		}
+		onDisk, _ := ioutil.ReadFile(path)
+		assert.Equal(t, sealed, onDisk, "Encrypted config should have been left alone")
+	}
+}
+
+func TestFileConfigKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	origConfigdir := *configdir
+	*configdir = dir
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	_, err = fileConfigKey(false, unprotected, unprotected)
+	assert.Equal(t, errNoConfigKey, err, "Key shouldn't be created unless asked")
+
+	key, err := fileConfigKey(true, unprotected, unprotected)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, key, configKeySize)
+	fi, err := os.Stat(filepath.Join(dir, configKeyFile))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "Key file should only be readable by the user")
+	}
+
+	reloaded, err := fileConfigKey(false, unprotected, unprotected)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key, reloaded)
+	}
+}
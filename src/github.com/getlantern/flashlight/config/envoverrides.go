@@ -0,0 +1,135 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getlantern/deepcopy"
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables that override
+	// Config fields, like LANTERN_UIADDR for UIAddr.
+	envPrefix = "LANTERN_"
+
+	// cloudConfigEnv overrides the cloud config URL for this session, like
+	// the -cloudconfig flag.
+	cloudConfigEnv = envPrefix + "CLOUDCONFIG"
+)
+
+var (
+	// Fields that keep track of what we've done rather than configure us,
+	// which can't be overridden
+	notOverridableFields = map[string]bool{
+		"Version":           true,
+		"SchemaVersion":     true,
+		"CloudProvenance":   true,
+		"LastCloudUpdate":   true,
+		"LastCloudAttempt":  true,
+		"LastCloudError":    true,
+		"ClockSkew":         true,
+		"CloudETags":        true,
+		"LastMergeChecksum": true,
+	}
+
+	lookupEnv = os.LookupEnv
+)
+
+// applyEnvOverrides overrides top level fields of this Config with the
+// environment variables named after them, like LANTERN_ADDR for Addr, for
+// deployments where editing the config file is awkward. See parseEnvOverride
+// for how values are given.
+// Command-line flags win over the environment, so fields set by a flag of the
+// same name are left alone. Like flags, overrides are saved in the config.
+func (cfg *Config) applyEnvOverrides() error {
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if url, found := lookupEnv(cloudConfigEnv); found && !setFlags["cloudconfig"] {
+		log.Debugf("Overriding cloud config URL for this session with %v: %v", cloudConfigEnv, url)
+		*cloudconfig = url
+	}
+
+	overrides := make(map[string]interface{})
+	t := reflect.TypeOf(*cfg)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.ToLower(field.Name)
+		name := envPrefix + strings.ToUpper(field.Name)
+		value, found := lookupEnv(name)
+		if !found || notOverridableFields[field.Name] {
+			continue
+		}
+		if setFlags[key] {
+			log.Debugf("Not overriding %v with %v, which the command line sets", field.Name, name)
+			continue
+		}
+		parsed, err := parseEnvOverride(field.Type, value)
+		if err != nil {
+			return fmt.Errorf("Invalid %v: %v", name, err)
+		}
+		overrides[key] = parsed
+		log.Debugf("Overriding %v with %v", field.Name, name)
+	}
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	// Overlay a copy so that a bad value doesn't leave us half overridden
+	overlaid := &Config{}
+	if err := deepcopy.Copy(overlaid, cfg); err != nil {
+		return fmt.Errorf("Unable to copy config to apply environment overrides: %v", err)
+	}
+	for key, value := range overrides {
+		data, err := yaml.Marshal(map[string]interface{}{key: value})
+		if err == nil {
+			err = yaml.Unmarshal(data, overlaid)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %v%v: %v", envPrefix, strings.ToUpper(key), err)
+		}
+	}
+	*cfg = *overlaid
+	return nil
+}
+
+// parseEnvOverride parses the value of an environment variable overriding a
+// field of type t. Strings are taken as they are, lists of strings can be
+// separated by commas and durations are like 1h30m. Anything else, like maps
+// or structs, is YAML like in the config file.
+func parseEnvOverride(t reflect.Type, value string) (interface{}, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		if d, err := time.ParseDuration(value); err == nil {
+			return d.String(), nil
+		}
+		return strconv.ParseInt(value, 10, 64)
+	case t.Kind() == reflect.String:
+		return value, nil
+	case t.Kind() == reflect.Bool:
+		return strconv.ParseBool(value)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	var parsed interface{}
+	err := yaml.Unmarshal([]byte(value), &parsed)
+	return parsed, err
+}
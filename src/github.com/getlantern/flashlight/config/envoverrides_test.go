@@ -0,0 +1,74 @@
+package config
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useEnv makes the given environment variables the only ones set until the
+// returned function is called.
+func useEnv(env map[string]string) func() {
+	orig := lookupEnv
+	lookupEnv = func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+	return func() {
+		lookupEnv = orig
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	origCloudConfig := *cloudconfig
+	defer func() {
+		*cloudconfig = origCloudConfig
+	}()
+	// Flags win over the environment
+	assert.NoError(t, flag.Set("cloudconfigca", ""))
+
+	defer useEnv(map[string]string{
+		"LANTERN_UIADDR":            "0.0.0.0:16823",
+		"LANTERN_ADDR":              "127.0.0.1:9999",
+		"LANTERN_CLOUDCONFIG":       "http://staging.example.com/cloud.yaml.gz",
+		"LANTERN_CLOUDPOLLINTERVAL": "2m",
+		"LANTERN_AUTOREPORT":        "false",
+		"LANTERN_DOHRESOLVERS":      "https://a.example.com/resolve, https://b.example.com/resolve",
+		"LANTERN_CLOUDCONFIGS":      `["http://c.example.com/cloud.yaml.gz"]`,
+		"LANTERN_CLOUDCONFIGCA":     "env-ca",
+		"LANTERN_LASTCLOUDERROR":    "forged",
+		"LANTERN_USERID":            "42",
+	})()
+	autoReport := true
+	cfg := &Config{UIAddr: "127.0.0.1:16823", AutoReport: &autoReport, LastCloudError: "real"}
+	if !assert.NoError(t, cfg.applyFlags()) || !assert.NoError(t, cfg.applyEnvOverrides()) {
+		return
+	}
+	assert.Equal(t, "0.0.0.0:16823", cfg.UIAddr)
+	assert.Equal(t, "127.0.0.1:9999", cfg.Addr)
+	assert.Equal(t, 2*time.Minute, cfg.CloudPollInterval)
+	assert.Equal(t, int64(42), cfg.UserID)
+	if assert.NotNil(t, cfg.AutoReport) {
+		assert.False(t, *cfg.AutoReport)
+	}
+	assert.Equal(t, []string{"https://a.example.com/resolve", "https://b.example.com/resolve"}, cfg.DoHResolvers)
+	assert.Equal(t, []string{"http://c.example.com/cloud.yaml.gz"}, cfg.CloudConfigs)
+	assert.Empty(t, cfg.CloudConfigCA, "Flag should have won over the environment")
+	assert.Equal(t, "real", cfg.LastCloudError, "Bookkeeping shouldn't be overridden")
+	assert.Equal(t, "http://staging.example.com/cloud.yaml.gz", cloudConfigURL(), "Cloud config URL should be overridden for the session")
+}
+
+func TestInvalidEnvOverride(t *testing.T) {
+	defer useEnv(map[string]string{
+		"LANTERN_ADDR":              "127.0.0.1:9999",
+		"LANTERN_CLOUDPOLLINTERVAL": "often",
+	})()
+	cfg := &Config{Addr: "127.0.0.1:8787"}
+	err := cfg.applyEnvOverrides()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "LANTERN_CLOUDPOLLINTERVAL")
+	}
+	assert.Equal(t, "127.0.0.1:8787", cfg.Addr, "Config shouldn't have been half overridden")
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// errorRateLimit is the minimum time between reports of identical errors.
+	errorRateLimit = 5 * time.Minute
+
+	// maxPendingErrors is how many errors we hold on to for reporting to
+	// handlers registered after they happened.
+	maxPendingErrors = 10
+
+	// maxRecentErrors is how many of the most recent errors we keep for
+	// Export.
+	maxRecentErrors = 20
+)
+
+// ErrorCategory describes which part of the configuration system a
+// ConfigError came from.
+type ErrorCategory string
+
+const (
+	// FetchError: we couldn't fetch cloud config
+	FetchError ErrorCategory = "fetch"
+	// ParseError: some config couldn't be parsed, like a corrupt config file
+	// or a bad cloud config
+	ParseError ErrorCategory = "parse"
+	// PersistError: we couldn't load or save the config
+	PersistError ErrorCategory = "persist"
+	// ValidateError: the config has settings that will keep Lantern from
+	// running properly
+	ValidateError ErrorCategory = "validate"
+	// HealthError: the servers from cloud config didn't work, so we rolled
+	// back to the last cloud config that did
+	HealthError ErrorCategory = "health"
+	// VersionError: cloud config requires a newer version of Lantern, see
+	// VersionRequiredError
+	VersionError ErrorCategory = "version"
+)
+
+// ConfigError is a problem in the configuration system that may be of
+// interest to the user.
+type ConfigError struct {
+	Category ErrorCategory
+	Err      error
+	// Fatal: whether the configuration system can't continue because of this
+	// error
+	Fatal bool
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Category, e.Err)
+}
+
+var (
+	errs = newErrorReporter()
+)
+
+// OnError registers a function that's called with problems in the
+// configuration system, for example so that the UI can show them to the user.
+// Errors that happened before any function was registered are passed to the
+// first one registered. Identical errors are reported at most once every five
+// minutes. Handlers are called synchronously and must not call Update.
+func OnError(onError func(ConfigError)) {
+	errs.onError(onError)
+}
+
+// reportError reports the given error to handlers registered with OnError.
+func reportError(category ErrorCategory, err error, fatal bool) {
+	errs.report(ConfigError{category, err, fatal}, time.Now())
+}
+
+// errorReporter passes ConfigErrors to handlers, rate limiting identical
+// errors.
+type errorReporter struct {
+	handlers     []func(ConfigError)
+	pending      []ConfigError
+	recent       []recentError
+	lastReported map[string]time.Time
+	mx           sync.Mutex
+}
+
+func newErrorReporter() *errorReporter {
+	return &errorReporter{lastReported: make(map[string]time.Time)}
+}
+
+func (r *errorReporter) onError(onError func(ConfigError)) {
+	r.mx.Lock()
+	r.handlers = append(r.handlers, onError)
+	pending := r.pending
+	r.pending = nil
+	r.mx.Unlock()
+
+	for _, e := range pending {
+		onError(e)
+	}
+}
+
+func (r *errorReporter) report(e ConfigError, now time.Time) {
+	key := e.Error()
+	r.mx.Lock()
+	if last, found := r.lastReported[key]; found && now.Sub(last) < errorRateLimit {
+		r.mx.Unlock()
+		log.Tracef("Not reporting recently reported error: %v", key)
+		return
+	}
+	r.lastReported[key] = now
+	if len(r.recent) == maxRecentErrors {
+		r.recent = r.recent[1:]
+	}
+	r.recent = append(r.recent, recentError{now, e})
+	if len(r.handlers) == 0 {
+		if len(r.pending) == maxPendingErrors {
+			r.pending = r.pending[1:]
+		}
+		r.pending = append(r.pending, e)
+		r.mx.Unlock()
+		return
+	}
+	handlers := make([]func(ConfigError), len(r.handlers))
+	copy(handlers, r.handlers)
+	r.mx.Unlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// recentError is an error reported at a given time.
+type recentError struct {
+	time time.Time
+	err  ConfigError
+}
+
+// recentErrors returns the most recently reported errors, oldest first.
+func (r *errorReporter) recentErrors() []recentError {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]recentError(nil), r.recent...)
+}
+
+// reportingStore is a ConfigStore that reports failures to save.
+type reportingStore struct {
+	ConfigStore
+}
+
+func (s *reportingStore) Save(data []byte) error {
+	err := s.ConfigStore.Save(data)
+	if err != nil {
+		reportError(PersistError, fmt.Errorf("Unable to save config: %v", err), false)
+	}
+	return err
+}
+
+// Close closes the wrapped store if it needs closing.
+func (s *reportingStore) Close() error {
+	if closer, ok := s.ConfigStore.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
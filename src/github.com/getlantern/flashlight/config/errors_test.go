@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// collectErrors registers a collector for ConfigErrors with a fresh
+// errorReporter. The returned function restores the original reporter.
+func collectErrors() (*[]ConfigError, func()) {
+	orig := errs
+	errs = newErrorReporter()
+	var collected []ConfigError
+	OnError(func(e ConfigError) {
+		collected = append(collected, e)
+	})
+	return &collected, func() {
+		errs = orig
+	}
+}
+
+func categoriesOf(collected []ConfigError) []ErrorCategory {
+	var categories []ErrorCategory
+	for _, e := range collected {
+		categories = append(categories, e.Category)
+	}
+	return categories
+}
+
+func TestErrorRateLimit(t *testing.T) {
+	r := newErrorReporter()
+	now := time.Now()
+	r.report(ConfigError{FetchError, fmt.Errorf("early"), false}, now)
+
+	var collected []ConfigError
+	r.onError(func(e ConfigError) {
+		collected = append(collected, e)
+	})
+	assert.Len(t, collected, 1, "Error reported before registering should have been passed along")
+
+	flapping := ConfigError{FetchError, fmt.Errorf("Unexpected response status: 500"), false}
+	r.report(flapping, now)
+	r.report(flapping, now.Add(time.Second))
+	r.report(ConfigError{PersistError, flapping.Err, false}, now.Add(time.Second))
+	r.report(flapping, now.Add(errorRateLimit))
+	assert.Equal(t, []ErrorCategory{FetchError, FetchError, PersistError, FetchError}, categoriesOf(collected), "Identical errors should have been rate limited")
+}
+
+func TestFetchAndParseErrorsReported(t *testing.T) {
+	collected, restore := collectErrors()
+	defer restore()
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")()
+	defer useTestFetcher()()
+
+	origServers := bootstrapServers
+	defer func() {
+		bootstrapServers = origServers
+	}()
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{}
+	}
+
+	body := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if body == "" {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.Write(gzipped(t, body))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+
+	poll := func() error {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return err
+		}
+		return m.Update(mutate)
+	}
+
+	assert.NoError(t, poll())
+	if assert.Equal(t, []ErrorCategory{FetchError}, categoriesOf(*collected)) {
+		assert.Contains(t, (*collected)[0].Err.Error(), "500")
+		assert.False(t, (*collected)[0].Fatal)
+	}
+
+	body = "proxiedsites: [\n"
+	assert.Error(t, poll(), "Unparseable cloud config should have been rejected")
+	assert.Equal(t, []ErrorCategory{FetchError, ParseError}, categoriesOf(*collected))
+}
+
+// failingStore is a MemoryStore that fails to save once failing is set.
+type failingStore struct {
+	*yamlconf.MemoryStore
+	failing bool
+}
+
+func (s *failingStore) Save(data []byte) error {
+	if s.failing {
+		return fmt.Errorf("Disk full")
+	}
+	return s.MemoryStore.Save(data)
+}
+
+func TestPersistErrorReported(t *testing.T) {
+	collected, restore := collectErrors()
+	defer restore()
+
+	store := &failingStore{MemoryStore: yamlconf.NewMemoryStore([]byte("addr: localhost:8787\n"))}
+	_, err := Init("2.1.0", WithStore(store))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer m.Stop()
+
+	store.failing = true
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UIAddr = "localhost:9999"
+		return nil
+	}))
+	assert.Error(t, Flush())
+	if assert.Equal(t, []ErrorCategory{PersistError}, categoriesOf(*collected)) {
+		assert.Contains(t, (*collected)[0].Err.Error(), "Disk full")
+	}
+}
+
+func TestValidateErrorReported(t *testing.T) {
+	collected, restore := collectErrors()
+	defer restore()
+
+	store := yamlconf.NewMemoryStore([]byte("addr: localhost\n"))
+	_, err := Init("2.1.0", WithStore(store))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer m.Stop()
+
+	if assert.Equal(t, []ErrorCategory{ValidateError}, categoriesOf(*collected)) {
+		assert.Contains(t, (*collected)[0].Err.Error(), "Addr")
+	}
+}
+
+func TestCorruptConfigReported(t *testing.T) {
+	if _, err := packagedConfig(); err != nil {
+		t.Skipf("No packaged config available: %v", err)
+	}
+	collected, restore := collectErrors()
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "lantern-config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	origConfigdir := *configdir
+	*configdir = dir
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	path := filepath.Join(dir, configFileName("2.1.0"))
+	if err := ioutil.WriteFile(path, []byte("client: [\n"), 0644); err != nil {
+		t.Fatalf("Unable to write config: %v", err)
+	}
+	_, err = newFileStore("2.1.0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, isCorruptConfig(path), "Corrupt config should have been replaced")
+	if assert.Equal(t, []ErrorCategory{ParseError}, categoriesOf(*collected)) {
+		assert.Contains(t, (*collected)[0].Err.Error(), "corrupt")
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/getlantern/yaml"
+)
+
+// configExport is what Export writes.
+type configExport struct {
+	Exported string // When the export was made, in RFC 3339 format
+	Version  string // The version of Lantern that made it
+	Profile  string // The config profile in use
+	ReadOnly bool   `yaml:",omitempty"` // Whether another Lantern owns the config
+	Errors   []exportedError
+	Config   *Config
+}
+
+// exportedError is an error in an export.
+type exportedError struct {
+	Time     string
+	Category ErrorCategory
+	Error    string
+	Fatal    bool `yaml:",omitempty"`
+}
+
+// Export writes the current config as YAML to w for attaching to bug reports,
+// along with the most recent errors reported to OnError. Beyond what
+// DumpEffective masks, it leaves out who the user is, the certificates of
+// servers and CAs and the credentials in URLs, so that it's safe to share.
+// The configuration system must have been initialized with Init.
+func Export(w io.Writer) error {
+	cfg := current()
+	if cfg == nil {
+		return fmt.Errorf("Config not initialized")
+	}
+	sanitized, err := cfg.exportedCopy()
+	if err != nil {
+		return err
+	}
+	out := &configExport{
+		Exported: formatCloudTime(time.Now()),
+		Version:  runningVersion,
+		Profile:  CurrentProfile(),
+		ReadOnly: readOnly,
+		Config:   sanitized,
+	}
+	for _, recent := range errs.recentErrors() {
+		out.Errors = append(out.Errors, exportedError{
+			Time:     formatCloudTime(recent.time),
+			Category: recent.err.Category,
+			Error:    redactURLCredentials(recent.err.Err.Error()),
+			Fatal:    recent.err.Fatal,
+		})
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal config export: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// exportedCopy returns a copy of this Config that's safe to share, see Export.
+func (cfg *Config) exportedCopy() (*Config, error) {
+	copied, err := cfg.redactedCopy()
+	if err != nil {
+		return nil, err
+	}
+	copied.UserID = 0
+	if copied.CloudConfigCA != "" {
+		copied.CloudConfigCA = redacted
+	}
+	for i, url := range copied.CloudConfigs {
+		copied.CloudConfigs[i] = withoutCredentials(url)
+	}
+	copied.ConfigProxy = redactURLCredentials(copied.ConfigProxy)
+	if copied.MovedCloudConfigs != nil {
+		moved := make(map[string]string, len(copied.MovedCloudConfigs))
+		for from, to := range copied.MovedCloudConfigs {
+			moved[withoutCredentials(from)] = withoutCredentials(to)
+		}
+		copied.MovedCloudConfigs = moved
+	}
+	if copied.CloudETags != nil {
+		etags := make(map[string]string, len(copied.CloudETags))
+		for url, etag := range copied.CloudETags {
+			etags[withoutCredentials(url)] = etag
+		}
+		copied.CloudETags = etags
+	}
+	if copied.Client != nil {
+		for _, server := range copied.Client.ChainedServers {
+			if server.Cert != "" {
+				server.Cert = redacted
+			}
+		}
+	}
+	for _, ca := range copied.TrustedCAs {
+		if ca.Cert != "" {
+			ca.Cert = redacted
+		}
+	}
+	return copied, nil
+}
+
+// ExportConfig initializes the config for the given version and exports it
+// with Export to the file named by the -export-config flag, or to w if that's
+// -. exported is false if no export was requested. ok indicates whether the
+// export was written. If another Lantern is running, its config is exported
+// without disturbing it. ExportConfig never starts polling for cloud config.
+func ExportConfig(w io.Writer, version string) (exported bool, ok bool) {
+	if *exportConfig == "" {
+		return false, false
+	}
+	if _, err := Init(version, WithReadOnlyIfRunning()); err != nil {
+		fmt.Fprintf(w, "Unable to load config: %v\n", err)
+		return true, false
+	}
+	if *exportConfig == "-" {
+		if err := Export(w); err != nil {
+			fmt.Fprintln(w, err)
+			return true, false
+		}
+		return true, true
+	}
+	file, err := os.Create(*exportConfig)
+	if err != nil {
+		fmt.Fprintf(w, "Unable to create config export: %v\n", err)
+		return true, false
+	}
+	err = Export(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Unable to export config: %v\n", err)
+		return true, false
+	}
+	fmt.Fprintf(w, "Exported config to %v\n", *exportConfig)
+	return true, true
+}
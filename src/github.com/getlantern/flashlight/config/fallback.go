@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/getlantern/tarfs"
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+// newFallbackStore creates a store that keeps the config in memory, starting
+// from fallbackConfig, for when the config in the config dir can't be used
+// because of cause, like when the config dir can't be read. That way we can
+// still run, though changes are lost when Lantern exits.
+func newFallbackStore(cause error) (ConfigStore, error) {
+	data, err := fallbackConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%v, and no config to fall back to: %v", cause, err)
+	}
+	log.Errorf("!!!! UNABLE TO USE CONFIG, FALLING BACK TO PACKAGED CONFIG AND CONFIG CHANGES WILL BE LOST WHEN LANTERN EXITS: %v", cause)
+	reportError(PersistError, fmt.Errorf("Unable to use config, keeping packaged config in memory: %v", cause), false)
+	configFile = nil
+	profilesSupported = false
+	store := yamlconf.NewMemoryStore(data)
+	if err := prepareStore(store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// fallbackConfig returns the packaged config, or if that can't be used, the
+// one built into the binary, which is known to be good since it's built and
+// tested with it.
+func fallbackConfig() ([]byte, error) {
+	data, err := initialConfig()
+	if err == nil {
+		err = checkParses(data)
+	}
+	if err == nil {
+		return data, nil
+	}
+	log.Errorf("Unable to use packaged config, using the one built into Lantern: %v", err)
+	data, err = builtinConfig()
+	if err == nil {
+		err = checkParses(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to use config built into Lantern: %v", err)
+	}
+	return data, nil
+}
+
+// builtinConfig returns the lantern.yaml built into the binary, ignoring any
+// beside it, marked as described in markPackagedConfig.
+func builtinConfig() ([]byte, error) {
+	fs, err := tarfs.New(Resources, "")
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.Get(lanternYamlName)
+	if err != nil {
+		return nil, err
+	}
+	return markPackagedConfig(data)
+}
+
+// checkParses returns an error if the given config YAML can't be parsed.
+func checkParses(data []byte) error {
+	flattened, err := flattenDocuments(data)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(flattened, &Config{})
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitFallsBackWhenConfigDirUnusable(t *testing.T) {
+	if _, err := builtinConfig(); err != nil {
+		t.Skipf("No config built in: %v", err)
+	}
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	collected, restore := collectErrors()
+	defer restore()
+	// A file in the way of the config dir makes it as unusable as one we
+	// can't read, even for root
+	dir := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(dir, nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err, "Should have fallen back to the packaged config") {
+		return
+	}
+	defer Stop()
+	assert.NotNil(t, cfg.Client, "Should have used the packaged config")
+	assert.NotEmpty(t, cfg.Client.MasqueradeSets, "Packaged config should have masquerades")
+	assert.Contains(t, categoriesOf(*collected), PersistError, "Should have warned that config won't be saved")
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UIAddr = "127.0.0.1:1234"
+		return nil
+	}), "Should still be able to change the config for the session")
+}
+
+func TestFallbackConfigSkipsBrokenPackagedConfig(t *testing.T) {
+	builtin, err := builtinConfig()
+	if err != nil {
+		t.Skipf("No config built in: %v", err)
+	}
+	// Use a broken lantern.yaml beside the binary
+	dir, _, err := bootstrapPath(lanternYamlName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, lanternYamlName)
+	if _, err := os.Stat(path); err == nil {
+		t.Skipf("Not replacing existing %v", path)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Skipf("Unable to create %v: %v", dir, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("client: [\n"), 0644); err != nil {
+		t.Skipf("Unable to write %v: %v", path, err)
+	}
+	defer os.Remove(path)
+
+	fallback, err := fallbackConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(builtin), string(fallback), "Should have fallen back to the config built in")
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+// FeatureEnabled returns whether the client behavior with the given name is
+// turned on, which cloud config does with Features so that new behaviors can
+// be enabled gradually without shipping new binaries. A feature that's listed
+// in FeatureRollouts is only turned on for that share of clients, picked by
+// their instance ID like for a Rollout, so clients stay in the share as it's
+// widened. Features that aren't listed are off. Subscribe to FeaturesSection
+// to find out when they're turned on or off.
+func FeatureEnabled(name string) bool {
+	cfg := current()
+	return cfg != nil && cfg.featureEnabled(name)
+}
+
+// featureEnabled returns whether the feature with the given name is turned on
+// in this Config for this Lantern.
+func (cfg *Config) featureEnabled(name string) bool {
+	if !cfg.Features[name] {
+		return false
+	}
+	percent, found := cfg.FeatureRollouts[name]
+	if !found {
+		return true
+	}
+	return rolloutBucket(featureRolloutKey(name), rolloutInstanceID()) < percent
+}
+
+// featureRolloutKey is the key by which clients are bucketed for the rollout
+// of the feature with the given name, which differs from the keys of
+// Rollouts so that a rollout and a feature of the same name pick different
+// clients.
+func featureRolloutKey(name string) string {
+	return "feature:" + name
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureEnabled(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig+"features:\n  shown: true\n  hidden: false\n  gradual: true\nfeaturerollouts:\n  gradual: 50\n  hidden: 100\n")()
+
+	assert.True(t, FeatureEnabled("shown"))
+	assert.False(t, FeatureEnabled("hidden"), "Rollout shouldn't turn on a feature that's off")
+	assert.False(t, FeatureEnabled("unknown"), "Unknown features should be off")
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		restore := useInstanceID(fmt.Sprintf("instance-%d", i))
+		if FeatureEnabled("gradual") {
+			enabled++
+		}
+		restore()
+	}
+	assert.InDelta(t, 500, enabled, 100, "Feature should be on for about half of clients, not %d of 1000", enabled)
+
+	defer useInstanceID("instance-b")()
+	before := FeatureEnabled("gradual")
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.FeatureRollouts["gradual"] = 100
+		return nil
+	}))
+	assert.True(t, FeatureEnabled("gradual"), "Widening the rollout to everyone should turn it on")
+	if before {
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.FeatureRollouts["gradual"] = 50
+			return nil
+		}))
+		assert.True(t, FeatureEnabled("gradual"), "Clients should stay in the rollout")
+	}
+
+	assert.IsType(t, &ValidationError{}, Update(func(cfg *Config) error {
+		cfg.FeatureRollouts["gradual"] = 101
+		return nil
+	}))
+}
+
+func TestCloudUpdateReplacesFeatures(t *testing.T) {
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	if !assert.NoError(t, cfg.updateFrom([]byte("features:\n  a: true\n  b: true\nfeaturerollouts:\n  b: 10\n"))) {
+		return
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, cfg.Features)
+	if assert.NoError(t, cfg.updateFrom([]byte("features:\n  a: true\n"))) {
+		assert.Equal(t, map[string]bool{"a": true}, cfg.Features, "Features left out of update should be dropped")
+		assert.Empty(t, cfg.FeatureRollouts)
+	}
+
+	before := &Config{Features: map[string]bool{"a": true}}
+	after := &Config{Features: map[string]bool{"a": false}}
+	sections, err := changedSections(before, after)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[Section]bool{FeaturesSection: true}, sections)
+	}
+}
@@ -0,0 +1,598 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/yaml"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/util"
+)
+
+const (
+	etag            = "X-Lantern-Etag"
+	ifNoneMatch     = "X-Lantern-If-None-Match"
+	lastModified    = "Last-Modified"
+	ifModifiedSince = "If-Modified-Since"
+	gzSuffix        = ".gz"
+	authTokenHeader = "X-LANTERN-AUTH-TOKEN"
+
+	// viaLocalProxy is the auth token to use when fetching through the local
+	// proxy, which authenticates with upstream servers itself.
+	viaLocalProxy = ""
+
+	// How many redirects to follow when fetching cloud config
+	maxRedirects = 5
+
+	bootstrapAttemptTimeout = 30 * time.Second
+)
+
+var (
+	// How long we keep trying bootstrap servers in all, swapped out by tests
+	bootstrapFallbackTimeout = 2 * time.Minute
+
+	// This is over HTTP because proxies do not forward X-Forwarded-For with HTTPS
+	// and because we only support falling back to direct domain fronting through
+	// the local proxy for HTTP.
+	frontedCloudConfigUrl = "http://d2wi0vwulmtn99.cloudfront.net/cloud.yaml.gz"
+
+	lastCloudConfigETag = map[string]string{}
+	// The Last-Modified (or Date) header of the last successful fetch of each
+	// cloud config URL, used as a fallback for edges that strip our ETags.
+	lastCloudConfigModified = map[string]string{}
+	// The checksum of the last cloud config fetched from each URL.
+	lastCloudConfigChecksum = map[string][sha256.Size]byte{}
+	// Gzipped cloud config URLs for which we've had to fall back to fetching
+	// the uncompressed config instead, mapped to the uncompressed URL.
+	uncompressedCloudConfigUrl = map[string]string{}
+	// Cloud config URLs that we found had moved permanently on their last
+	// fetch, mapped to where they moved, until pollForConfig saves the move.
+	movedCloudConfigUrl = map[string]string{}
+	// Request the config via either chained servers or direct fronted servers.
+	cf util.HTTPFetcher = util.NewChainedAndFrontedWith(newFrontedRetrier())
+	// The servers to fall back to when fetching through the local proxy fails.
+	bootstrapServers = packagedChainedServers
+	// The address of the bootstrap server through which we last fetched config.
+	lastGoodBootstrapServer string
+	// Finds the system proxy to use for a request.
+	proxyFromEnvironment = http.ProxyFromEnvironment
+	// Buffers for reading cloud config responses, which can be several MB, so
+	// that each fetch doesn't grow new ones from scratch.
+	responseBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+)
+
+// fetchCloudConfig fetches the cloud config at the given URL through the
+// local proxy (racing chained and fronted servers), returning nil if it hasn't
+// changed since the last fetch. If that fails, this falls back to fetching
+// through the configured SOCKS proxy, if any, or directly through the
+// packaged bootstrap servers otherwise.
+func fetchCloudConfig(ctx context.Context, url string) ([]byte, error) {
+	bytes, err := fetchCloudConfigWith(ctx, cf, url, frontedCloudConfigUrl, viaLocalProxy)
+	if err == nil || isDeferred(err) {
+		return bytes, err
+	}
+	log.Debugf("Unable to fetch cloud config through local proxy, trying bootstrap servers: %v", err)
+	bytes, bootstrapErr := fetchCloudConfigViaBootstrap(ctx, url)
+	if bootstrapErr != nil {
+		log.Debugf("Unable to fetch cloud config through bootstrap servers: %v", bootstrapErr)
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// fetchCloudConfigViaBootstrapFirst is like fetchCloudConfig, but tries the
+// bootstrap servers before the local proxy. We use this when our config has
+// gone stale, since the local proxy is then likely to be broken.
+func fetchCloudConfigViaBootstrapFirst(ctx context.Context, url string) ([]byte, error) {
+	bytes, err := fetchCloudConfigViaBootstrap(ctx, url)
+	if err == nil || isDeferred(err) {
+		return bytes, err
+	}
+	log.Debugf("Unable to fetch cloud config through bootstrap servers, trying local proxy: %v", err)
+	return fetchCloudConfigWith(ctx, cf, url, frontedCloudConfigUrl, viaLocalProxy)
+}
+
+// fetchCloudConfigViaBootstrap tries fetching the cloud config at the given
+// URL through each of the bootstrap servers in turn, starting with the one
+// that last worked, and returns the first successful result. If a SOCKS proxy
+// is configured, this fetches through that instead. If we're using the system
+// proxy or DoH, this first tries fetching directly.
+func fetchCloudConfigViaBootstrap(ctx context.Context, url string) ([]byte, error) {
+	proxyURL, err := configProxy()
+	if err != nil {
+		// Validation reports this, just use the bootstrap servers
+		log.Errorf("Not using config proxy: %v", err)
+	} else if proxyURL != nil {
+		return fetchCloudConfigViaSOCKS(ctx, url, proxyURL)
+	}
+
+	if useSystemProxy() || len(dohResolvers()) > 0 {
+		bytes, err := fetchCloudConfigDirect(ctx, url)
+		if err == nil || isDeferred(err) {
+			return bytes, err
+		}
+		log.Debugf("Unable to fetch cloud config directly: %v", err)
+	}
+
+	clients := loadBootstrapHttpClients(bootstrapServers())
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("No bootstrap servers available")
+	}
+	// Each attempt gets at most what's left of the budget, so a slow server
+	// can't make us overrun it
+	budget, cancel := context.WithTimeout(ctx, bootstrapFallbackTimeout)
+	defer cancel()
+	var lastErr error
+	for _, bc := range clients {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Stopped trying bootstrap servers: %v", ctx.Err())
+		}
+		if budget.Err() != nil {
+			return nil, fmt.Errorf("Timed out trying bootstrap servers, last error: %v", lastErr)
+		}
+		// We're bypassing the local proxy, so authenticate with the bootstrap
+		// server ourselves
+		bytes, err := fetchCloudConfigWith(budget, bc.client, url, "", bc.authToken)
+		if err == nil {
+			log.Debugf("Fetched cloud config through bootstrap server %v", bc.addr)
+			lastGoodBootstrapServer = bc.addr
+			return bytes, nil
+		}
+		if isDeferred(err) {
+			return nil, err
+		}
+		log.Debugf("Unable to fetch cloud config through bootstrap server %v: %v", bc.addr, err)
+		lastErr = err
+	}
+	if ctx.Err() == nil && budget.Err() != nil {
+		return nil, fmt.Errorf("Timed out trying bootstrap servers, last error: %v", lastErr)
+	}
+	return nil, lastErr
+}
+
+// fetchCloudConfigDirect fetches the cloud config at the given URL without
+// going through any of our servers. If we're using the system proxy, the
+// fetch goes through that. Otherwise, we resolve the config host using DoH,
+// since plain DNS for it is poisoned in some countries.
+func fetchCloudConfigDirect(ctx context.Context, url string) ([]byte, error) {
+	systemProxy := useSystemProxy()
+	dial := doh.dial
+	if systemProxy {
+		// The system proxy resolves the host
+		dial = nil
+	}
+	direct := &http.Client{
+		Transport: newTransport(dial, systemProxy),
+		Timeout:   bootstrapAttemptTimeout,
+	}
+	bytes, err := fetchCloudConfigWith(ctx, direct, url, "", "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Fetched cloud config directly")
+	return bytes, nil
+}
+
+// bootstrapClient is an http.Client that dials through a bootstrap server.
+type bootstrapClient struct {
+	addr      string
+	authToken string
+	client    *http.Client
+}
+
+// loadBootstrapHttpClients creates http.Clients that dial through each of the
+// given chained servers, with the server that last worked first.
+func loadBootstrapHttpClients(servers map[string]*client.ChainedServerInfo) []*bootstrapClient {
+	keys := make([]string, 0, len(servers))
+	for key := range servers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	clients := make([]*bootstrapClient, 0, len(servers))
+	for _, key := range keys {
+		server := servers[key]
+		dial, err := chainedDial(server)
+		if err != nil {
+			log.Errorf("Unable to create dialer for bootstrap server %v: %v", server.Addr, err)
+			continue
+		}
+		bc := &bootstrapClient{
+			addr:      server.Addr,
+			authToken: string(server.AuthToken),
+			client: &http.Client{
+				// The chained dialer tunnels through the bootstrap server
+				// itself, so the system proxy never applies here.
+				Transport: newTransport(tunneled(dial), false),
+				Timeout:   bootstrapAttemptTimeout,
+			},
+		}
+		if server.Addr == lastGoodBootstrapServer {
+			clients = append([]*bootstrapClient{bc}, clients...)
+		} else {
+			clients = append(clients, bc)
+		}
+	}
+	return clients
+}
+
+// newTransport creates an http.Transport for fetching cloud config that dials
+// with the given function, or net.Dial if that's nil. If useSystemProxy is
+// true, requests go through the proxy specified by the HTTP_PROXY and
+// HTTPS_PROXY environment variables, which only makes sense when dialing
+// directly.
+func newTransport(dial func(network, addr string) (net.Conn, error), useSystemProxy bool) *http.Transport {
+	transport := &http.Transport{
+		Dial:              dial,
+		DisableKeepAlives: true,
+	}
+	if useSystemProxy {
+		transport.Proxy = proxyFromEnvironment
+	}
+	return transport
+}
+
+// useSystemProxy returns whether to fetch cloud config directly through the
+// system proxy when the local proxy doesn't work. Either the
+// -usesystemproxy flag or the UseSystemProxy setting enables this.
+func useSystemProxy() bool {
+	if *useSystemProxyFlag {
+		return true
+	}
+	cfg := current()
+	return cfg != nil && cfg.UseSystemProxy
+}
+
+// tunneled wraps the given chained dial function so that connections are
+// tunneled through the server using CONNECT.
+func tunneled(dial func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		return dial("connect", addr)
+	}
+}
+
+// chainedDial returns a function that dials through the given chained
+// server, presenting its auth token.
+var chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+	d, err := server.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	return d.Dial, nil
+}
+
+// fetchCloudConfigWith fetches the cloud config at the given URL using the
+// given fetcher. If frontedUrl is specified, the fetcher may also try fetching
+// it via domain fronting. If the gzipped config can't be decoded, this falls
+// back to fetching the uncompressed config and remembers to fetch that
+// directly next time. If authToken is specified, it's sent to authenticate
+// with the upstream server, which callers should do only when the fetcher
+// bypasses the local proxy.
+func fetchCloudConfigWith(ctx context.Context, fetcher util.HTTPFetcher, url string, frontedUrl string, authToken string) ([]byte, error) {
+	if plainUrl, found := uncompressedCloudConfigUrl[url]; found {
+		return doFetchCloudConfig(ctx, fetcher, plainUrl, uncompressedUrl(frontedUrl), authToken)
+	}
+	bytes, err := doFetchCloudConfig(ctx, fetcher, url, frontedUrl, authToken)
+	if err == nil || !strings.HasSuffix(url, gzSuffix) {
+		return bytes, err
+	}
+	if _, ok := err.(*decodeError); !ok {
+		return nil, err
+	}
+
+	plainUrl := uncompressedUrl(url)
+	log.Debugf("%v, retrying with uncompressed config at %v", err, plainUrl)
+	bytes, err = doFetchCloudConfig(ctx, fetcher, plainUrl, uncompressedUrl(frontedUrl), authToken)
+	if err != nil {
+		return nil, err
+	}
+	uncompressedCloudConfigUrl[url] = plainUrl
+	return bytes, nil
+}
+
+// newCloudConfigRequest creates a request for the cloud config at url, or at
+// target if we've been redirected there, with the headers we send on every
+// hop. Conditional headers come from the last fetch of url.
+func newCloudConfigRequest(ctx context.Context, url string, target string, frontedUrl string, authToken string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to construct request for cloud config at %s: %s", target, err)
+	}
+	if lastCloudConfigETag[url] != "" {
+		// Don't bother fetching if unchanged
+		req.Header.Set(ifNoneMatch, lastCloudConfigETag[url])
+		if lastCloudConfigPayload[url] != nil {
+			// And if changed, only fetch what changed
+			req.Header.Set(acceptDeltaHeader, deltaFormat)
+		}
+	}
+	if lastCloudConfigModified[url] != "" {
+		// Some edges strip our ETag headers, so also send If-Modified-Since. When
+		// both are present, servers give precedence to the ETag.
+		req.Header.Set(ifModifiedSince, lastCloudConfigModified[url])
+	}
+
+	if strings.HasSuffix(target, gzSuffix) {
+		req.Header.Set("Accept", "application/x-gzip")
+	}
+	req.Header.Set("Accept-Encoding", acceptedEncodings)
+	// Prevents intermediate nodes (domain-fronters) from caching the content
+	req.Header.Set("Cache-Control", "no-cache")
+	if frontedUrl != "" {
+		// Set the fronted URL to lookup the config in parallel using chained and domain fronted servers.
+		req.Header.Set("Lantern-Fronted-URL", frontedUrl)
+	}
+	if authToken != "" {
+		req.Header.Set(authTokenHeader, authToken)
+	}
+	setUserHeaders(req)
+
+	// make sure to close the connection after reading the Body
+	// this prevents the occasional EOFs errors we're seeing with
+	// successive requests
+	req.Close = true
+	return req, nil
+}
+
+// withoutFollowingRedirects returns a copy of the given fetcher that returns
+// redirects instead of following them, if it's an http.Client. Other fetchers
+// follow redirects as they see fit.
+func withoutFollowingRedirects(fetcher util.HTTPFetcher) util.HTTPFetcher {
+	client, ok := fetcher.(*http.Client)
+	if !ok {
+		return fetcher
+	}
+	copied := *client
+	copied.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &copied
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func uncompressedUrl(url string) string {
+	return strings.TrimSuffix(url, gzSuffix)
+}
+
+func doFetchCloudConfig(ctx context.Context, fetcher util.HTTPFetcher, url string, frontedUrl string, authToken string) ([]byte, error) {
+	if unchangedPerHead(ctx, fetcher, url, frontedUrl, authToken) {
+		return nil, nil
+	}
+	fetcher = withoutFollowingRedirects(fetcher)
+	// We follow redirects ourselves so that our headers go along with each
+	// hop, which http.Client doesn't do for all of them
+	target := url
+	permanent := true
+	var resp *http.Response
+	for hops := 0; ; hops++ {
+		req, err := newCloudConfigRequest(ctx, url, target, frontedUrl, authToken)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = fetcher.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to fetch cloud config at %s: %s", target, err)
+		}
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			break
+		}
+		resp.Body.Close()
+		if hops == maxRedirects {
+			return nil, fmt.Errorf("Stopped after %d redirects fetching cloud config at %s", maxRedirects, url)
+		}
+		next, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redirect from %s to %q: %v", target, location, err)
+		}
+		if req.URL.Scheme == "https" && next.Scheme != "https" {
+			return nil, fmt.Errorf("Refusing redirect from %s to insecure %s", target, next)
+		}
+		log.Debugf("Cloud config at %s redirected with %d to %s", target, resp.StatusCode, next)
+		permanent = permanent && (resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect)
+		target = next.String()
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Debugf("Error closing response body: %v", err)
+		}
+	}()
+	if target != url && permanent && resp.StatusCode < 400 {
+		log.Debugf("Cloud config at %s moved permanently to %s", url, target)
+		movedCloudConfigUrl[url] = target
+	}
+
+	recordStatusCode(resp.StatusCode)
+	recordClockSkew(url, resp.Header.Get("Date"), wallClock())
+	if resp.StatusCode == 304 {
+		log.Debugf("Config unchanged in cloud")
+		return nil, nil
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Unexpected response status: %d", resp.StatusCode)
+	}
+
+	if err := limitResponse(resp, downloadLimit()); err != nil {
+		return nil, err
+	}
+	wire := newWireRecorder()
+	recordWire(resp, wire)
+	bytes, err := readConfigResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	// Checked before remembering anything about the response, so that a
+	// forged one doesn't keep us from fetching the real one
+	if err := verifyCloudConfig(bytes, resp.Header.Get(signatureHeader)); err != nil {
+		return nil, err
+	}
+	if base := resp.Header.Get(deltaBaseHeader); base != "" {
+		patched, err := applyCloudConfigDeltaFor(url, base, bytes)
+		if err != nil {
+			if lastCloudConfigPayload[url] == nil {
+				// We didn't ask for a delta
+				return nil, err
+			}
+			log.Errorf("%v, fetching the whole config instead", err)
+			forgetCloudConfig(url)
+			return doFetchCloudConfig(ctx, fetcher, url, frontedUrl, authToken)
+		}
+		log.Debugf("Applied cloud config delta of %d bytes against %v", len(bytes), base)
+		bytes = patched
+	}
+
+	lastCloudConfigWire[url] = wire.summary()
+	lastCloudConfigETag[url] = resp.Header.Get(etag)
+	modified := resp.Header.Get(lastModified)
+	if modified == "" {
+		modified = resp.Header.Get("Date")
+	}
+	lastCloudConfigModified[url] = modified
+
+	lastCloudConfigPayload[url] = bytes
+
+	checksum := sha256.Sum256(bytes)
+	if previous, found := lastCloudConfigChecksum[url]; found && previous == checksum {
+		log.Debugf("Fetched cloud config identical to last one")
+		return nil, nil
+	}
+	lastCloudConfigChecksum[url] = checksum
+	log.Debugf("Fetched cloud config")
+	return bytes, nil
+}
+
+// decodeError indicates that a cloud config response couldn't be decoded.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("Unable to decode cloud config: %v", e.err)
+}
+
+// readConfigResponse reads the config from the body of the given response,
+// removing its Content-Encoding and checking it against its content SHA-256,
+// if any. The config is normally gzipped, but if it turns out to be plain YAML
+// (for example because a transparent proxy decompressed it), it's used as is.
+func readConfigResponse(resp *http.Response) ([]byte, error) {
+	body := responseBuffers.Get().(*bytes.Buffer)
+	defer responseBuffers.Put(body)
+	body.Reset()
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("Unable to read cloud config: %s", err)
+	}
+	raw, err := decodeContent(resp.Header.Get("Content-Encoding"), body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentSHA256(decoded, resp.Header.Get(contentSHA256Header)); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// decodeConfig returns a copy of the given cloud config, gunzipped if it's
+// gzipped.
+func decodeConfig(raw []byte) ([]byte, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		if looksLikeYAML(raw) {
+			log.Debugf("Cloud config wasn't gzipped (%v), using it as plain YAML", err)
+			return append([]byte(nil), raw...), nil
+		}
+		return nil, &decodeError{fmt.Errorf("Unable to open gzip reader: %s", err)}
+	}
+	decoded := responseBuffers.Get().(*bytes.Buffer)
+	defer responseBuffers.Put(decoded)
+	decoded.Reset()
+	if _, err := decoded.ReadFrom(io.LimitReader(gzReader, maxDecodedSize+1)); err != nil {
+		return nil, &decodeError{fmt.Errorf("Unable to read gzipped config: %s", err)}
+	}
+	if int64(decoded.Len()) > maxDecodedSize {
+		return nil, &decodeError{errDecodedTooLarge()}
+	}
+	// The buffers go back in the pool, so what's returned has to be a copy
+	return append([]byte(nil), decoded.Bytes()...), nil
+}
+
+// looksLikeYAML returns whether the given bytes appear to be a plain YAML
+// config.
+func looksLikeYAML(b []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("Version:")) {
+		return true
+	}
+	tree := make(map[string]interface{})
+	return yaml.Unmarshal(b, &tree) == nil && len(tree) > 0
+}
+
+// movedCloudConfigURL returns where the cloud config at the given URL has
+// moved to, following moves we've saved, or the URL itself if it hasn't
+// moved.
+func (cfg *Config) movedCloudConfigURL(url string) string {
+	for i := 0; i < maxRedirects; i++ {
+		moved, found := cfg.MovedCloudConfigs[url]
+		if !found {
+			break
+		}
+		url = moved
+	}
+	return url
+}
+
+// recordCloudConfigMove saves that the cloud config at from has moved
+// permanently to to, replacing from in CloudConfigs.
+func (cfg *Config) recordCloudConfigMove(from string, to string) {
+	if cfg.MovedCloudConfigs == nil {
+		cfg.MovedCloudConfigs = make(map[string]string)
+	}
+	for orig, moved := range cfg.MovedCloudConfigs {
+		if moved == from {
+			cfg.MovedCloudConfigs[orig] = to
+		}
+	}
+	cfg.MovedCloudConfigs[from] = to
+	for i, cloudConfig := range cfg.CloudConfigs {
+		if cloudConfig == from {
+			cfg.CloudConfigs[i] = to
+		}
+	}
+}
+
+// learnCloudConfigMove carries over what we know about the last fetch of the
+// cloud config at from to to, where it has moved permanently, so that the
+// next fetch from there can be conditional.
+func learnCloudConfigMove(from string, to string) {
+	lastCloudConfigIdentity[to] = lastCloudConfigIdentity[from]
+	lastCloudConfigETag[to] = lastCloudConfigETag[from]
+	if payload, found := lastCloudConfigPayload[from]; found {
+		lastCloudConfigPayload[to] = payload
+	}
+	lastCloudConfigModified[to] = lastCloudConfigModified[from]
+	if checksum, found := lastCloudConfigChecksum[from]; found {
+		lastCloudConfigChecksum[to] = checksum
+	}
+	if wire, found := lastCloudConfigWire[from]; found {
+		lastCloudConfigWire[to] = wire
+	}
+}
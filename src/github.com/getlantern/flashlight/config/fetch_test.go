@@ -0,0 +1,506 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/config/configtest"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("Unable to gzip: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// noBootstrapServers keeps fetches from falling back to the packaged bootstrap
+// servers.
+func noBootstrapServers() map[string]*client.ChainedServerInfo {
+	return map[string]*client.ChainedServerInfo{}
+}
+
+// restoreOptions returns a function that restores the settings that Init
+// options change.
+func restoreOptions() func() {
+	origDir, origChained, origFronted := *configdir, chainedCloudConfigUrl, frontedCloudConfigUrl
+	origCloud, origFile := defaultCloudPollInterval, defaultFilePollInterval
+	origServers, origFetcher, origCountry := bootstrapServers, cf, geoCountry
+	return func() {
+		*configdir, chainedCloudConfigUrl, frontedCloudConfigUrl = origDir, origChained, origFronted
+		defaultCloudPollInterval, defaultFilePollInterval = origCloud, origFile
+		bootstrapServers, cf, geoCountry = origServers, origFetcher, origCountry
+	}
+}
+
+// useTestFetcher makes cloud config fetches go directly to test servers. The
+// returned function restores the original fetcher and clears fetch state.
+func useTestFetcher() func() {
+	orig, origDoHResolvers := cf, defaultDoHResolvers
+	cf = &http.Client{}
+	// Don't try fetching directly through public DoH resolvers
+	defaultDoHResolvers = nil
+	return func() {
+		cf, defaultDoHResolvers = orig, origDoHResolvers
+		doh = newDoHResolver()
+		lastCloudConfigETag = map[string]string{}
+		lastCloudConfigModified = map[string]string{}
+		lastCloudConfigChecksum = map[string][32]byte{}
+		lastCloudConfigPayload = map[string][]byte{}
+		uncompressedCloudConfigUrl = map[string]string{}
+		movedCloudConfigUrl = map[string]string{}
+		lastCloudConfigWire = map[string]wireSummary{}
+		lastCloudConfigIdentity = map[string]string{}
+		headUnsupportedUrl = map[string]bool{}
+		takeStaleCloudCache()
+		clearQuarantine()
+		circuits = newCircuitBreaker()
+		failedPolls = 0
+		forgetClockSkews()
+	}
+}
+
+func TestFetchHonorsLastModified(t *testing.T) {
+	defer useTestFetcher()()
+
+	modified := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	body := "proxiedsites:\n  cloud:\n  - a.com\n"
+	fullDownloads := 0
+	// This server ignores our ETag headers and only honors If-Modified-Since
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullDownloads++
+		resp.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		resp.Write(gzipped(t, body))
+	}))
+	defer srv.Close()
+
+	b, err := fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+
+	b, err = fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Nil(t, b, "Unchanged config should not be returned")
+	assert.Equal(t, 1, fullDownloads)
+
+	modified = modified.Add(time.Hour)
+	body = "proxiedsites:\n  cloud:\n  - b.com\n"
+	b, err = fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+	assert.Equal(t, 2, fullDownloads)
+}
+
+func TestFetchSkipsIdenticalBody(t *testing.T) {
+	defer useTestFetcher()()
+
+	// This server honors no validators at all
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write(gzipped(t, "addr: 127.0.0.1:8787\n"))
+	}))
+	defer srv.Close()
+
+	b, err := fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, b)
+	b, err = fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Nil(t, b, "Identical body should be treated as unchanged")
+}
+
+func TestFetchProxyDecompressedBody(t *testing.T) {
+	defer useTestFetcher()()
+
+	body := "addr: 127.0.0.1:8787\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		// Simulate a transparent proxy that decompressed the payload
+		resp.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	b, err := fetchCloudConfig(context.Background(), srv.URL+"/cloud.yaml.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+	assert.Empty(t, uncompressedCloudConfigUrl, "Should not have needed to fall back to uncompressed URL")
+}
+
+func TestFetchCorruptGzip(t *testing.T) {
+	defer useTestFetcher()()
+
+	requested := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requested[req.URL.Path]++
+		if req.URL.Path == "/cloud.yaml.gz" {
+			// Valid gzip header with truncated content
+			resp.Write(gzipped(t, "addr: 127.0.0.1:8787\n")[:15])
+			return
+		}
+		resp.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := fetchCloudConfig(context.Background(), srv.URL+"/cloud.yaml.gz")
+	assert.Error(t, err)
+	assert.Equal(t, 1, requested["/cloud.yaml"], "Should have retried the uncompressed URL once")
+	assert.Empty(t, uncompressedCloudConfigUrl)
+
+	_, err = fetchCloudConfig(context.Background(), srv.URL+"/other")
+	assert.Error(t, err, "Corrupt gzip without .gz suffix should fail")
+}
+
+func TestFetchUncompressedRetry(t *testing.T) {
+	defer useTestFetcher()()
+
+	body := "addr: 127.0.0.1:8787\n"
+	requested := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requested[req.URL.Path]++
+		if req.URL.Path == "/cloud.yaml.gz" {
+			// Garbage that is neither gzip nor YAML
+			resp.Write([]byte{0x01, 0x02, 0x03, 0x04})
+			return
+		}
+		resp.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/cloud.yaml.gz"
+	b, err := fetchCloudConfig(context.Background(), url)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+	assert.Equal(t, srv.URL+"/cloud.yaml", uncompressedCloudConfigUrl[url])
+
+	_, err = fetchCloudConfig(context.Background(), url)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requested["/cloud.yaml.gz"], "Should skip the failing gzipped URL on subsequent polls")
+	assert.Equal(t, 2, requested["/cloud.yaml"])
+}
+
+// redirectingFetcher sends all requests to the given test server.
+type redirectingFetcher struct {
+	srv *httptest.Server
+}
+
+func (f *redirectingFetcher) Do(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(f.srv.URL)
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	return http.DefaultClient.Do(req)
+}
+
+func TestPollRecordsCloudUpdates(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	lastUpdate, lastAttempt, lastErr := CloudUpdateStatus()
+	assert.True(t, lastUpdate.IsZero(), "Should not have updated yet")
+	assert.True(t, lastAttempt.IsZero(), "Should not have attempted yet")
+
+	before := time.Now().Add(-1 * time.Second)
+	poll()
+	lastUpdate, lastAttempt, lastErr = CloudUpdateStatus()
+	assert.True(t, lastUpdate.After(before), "Successful poll should advance last update")
+	assert.Equal(t, lastUpdate, lastAttempt)
+	assert.Empty(t, lastErr)
+
+	// RFC 3339 times only have second resolution
+	time.Sleep(1100 * time.Millisecond)
+	srv.FailNext(http.StatusInternalServerError)
+	poll()
+	failedUpdate, failedAttempt, lastErr := CloudUpdateStatus()
+	assert.Equal(t, lastUpdate, failedUpdate, "Failed poll should not advance last update")
+	assert.True(t, failedAttempt.After(lastAttempt), "Failed poll should advance last attempt")
+	assert.Contains(t, lastErr, "500")
+
+	poll()
+	lastUpdate, _, lastErr = CloudUpdateStatus()
+	assert.True(t, lastUpdate.After(failedUpdate), "Successful poll should advance last update")
+	assert.Empty(t, lastErr, "Successful poll should clear last error")
+	assert.Equal(t, 1, srv.NotModified(), "Unchanged config should not have been downloaded again")
+}
+
+func TestETagsKeptAcrossSessions(t *testing.T) {
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	restoreFetcher := useTestFetcher()
+	stop := initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")
+	poll()
+	assert.Len(t, current().CloudETags, 1, "ETag of applied config should be kept in config")
+	saved, err := yaml.Marshal(current())
+	stop()
+	restoreFetcher()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The next session starts without knowing anything about the last fetch
+	defer useTestFetcher()()
+	defer initTestConfig(t, string(saved))()
+	poll()
+	assert.Equal(t, 1, srv.NotModified(), "Unchanged config should not have been downloaded again after restart")
+}
+
+func TestFetchHonorsETag(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+
+	b, err := fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Equal(t, "proxiedsites:\n  cloud:\n  - a.com\n", string(b))
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Nil(t, b, "Unchanged config should not be returned")
+	assert.Equal(t, 1, srv.NotModified())
+
+	srv.SetConfig("proxiedsites:\n  cloud:\n  - b.com\n")
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Equal(t, "proxiedsites:\n  cloud:\n  - b.com\n", string(b))
+}
+
+func TestPollingWithFixture(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n")
+	defer srv.Close()
+
+	_, err := Init("2.1.0",
+		WithConfigDir(t.TempDir()),
+		WithCloudConfigURLs(srv.ConfigURL(), ""),
+		WithPollIntervals(20*time.Millisecond, 20*time.Millisecond),
+		WithBootstrapServers(noBootstrapServers),
+		WithHTTPFetcher(&http.Client{}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer Stop()
+	updates := make(chan *Config, 100)
+	mgr := m
+	go func() {
+		for {
+			updates <- mgr.Next().(*Config)
+		}
+	}()
+	waitFor := func(server string) bool {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case cfg := <-updates:
+				if cfg.Client.ChainedServers[server] != nil {
+					return true
+				}
+			case <-timeout:
+				return false
+			}
+		}
+	}
+
+	StartPolling()
+	assert.True(t, waitFor("cloud-1"), "Should have fetched cloud config")
+	srv.FailNext(http.StatusBadGateway, http.StatusServiceUnavailable)
+	srv.SetConfig("client:\n  chainedservers:\n    cloud-2:\n      addr: 2.2.2.2:443\n")
+	assert.True(t, waitFor("cloud-2"), "Should have fetched updated cloud config after failures")
+	assert.Nil(t, current().Client.ChainedServers["cloud-1"])
+}
+
+func TestPollFailsOverToNextCloudConfig(t *testing.T) {
+	defer useTestFetcher()()
+	primary := configtest.NewCloudConfigServer(serversConfig("primary-1", "1.1.1.1:443"))
+	defer primary.Close()
+	secondary := configtest.NewCloudConfigServer(serversConfig("secondary-1", "2.2.2.2:443"))
+	defer secondary.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       primary.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+primary.ConfigURL()+"\n- "+secondary.ConfigURL()+"\n")()
+
+	poll := func() string {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+		for name := range current().Client.ChainedServers {
+			return name
+		}
+		return ""
+	}
+
+	assert.Equal(t, "primary-1", poll())
+	assert.Equal(t, 0, secondary.Requests(), "Should only fail over when needed")
+
+	primary.FailNext(http.StatusForbidden)
+	assert.Equal(t, "secondary-1", poll(), "Should have failed over to the next URL")
+	assert.Equal(t, secondary.ConfigURL(), DebugState().CloudConfigURL)
+
+	assert.Equal(t, "primary-1", poll(), "Should have gone back to the first URL once it worked again")
+	assert.Equal(t, 0, primary.NotModified(), "Config from another URL was applied in between, so it should have been fetched in full")
+	assert.Equal(t, "primary-1", poll())
+	assert.Equal(t, 1, primary.NotModified(), "Should have used the ETag of the first URL")
+
+	// Blocked for long enough, the first URL isn't even tried for a while
+	for i := 0; i < circuitFailureThreshold; i++ {
+		primary.FailNext(http.StatusForbidden)
+		poll()
+	}
+	requests := primary.Requests()
+	assert.Equal(t, "secondary-1", poll())
+	assert.Equal(t, requests, primary.Requests(), "Should have skipped the URL with an open circuit")
+
+	// Nothing's applied if all of them fail
+	secondary.FailNext(http.StatusForbidden)
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) && assert.NoError(t, m.Update(mutate)) {
+		assert.NotEmpty(t, current().LastCloudError)
+		assert.NotNil(t, current().Client.ChainedServers["secondary-1"])
+	}
+}
+
+func TestFetchThroughLocalProxyOmitsAuthToken(t *testing.T) {
+	defer useTestFetcher()()
+
+	var tokensMx sync.Mutex
+	var authTokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		tokensMx.Lock()
+		authTokens = append(authTokens, req.Header.Get(authTokenHeader))
+		tokensMx.Unlock()
+		resp.Write(gzipped(t, "proxiedsites:\n  cloud:\n  - a.com\n"))
+	}))
+	defer srv.Close()
+
+	_, err := fetchCloudConfig(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	tokensMx.Lock()
+	defer tokensMx.Unlock()
+	assert.Equal(t, []string{""}, authTokens, "Should not have sent auth token through local proxy")
+}
+
+func TestFetchFollowsRedirects(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	var hopHeaders []http.Header
+	hop := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		hopHeaders = append(hopHeaders, req.Header)
+		http.Redirect(resp, req, srv.ConfigURL(), http.StatusPermanentRedirect)
+	}))
+	defer hop.Close()
+	old := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		http.Redirect(resp, req, hop.URL+"/hop/cloud.yaml.gz", http.StatusMovedPermanently)
+	}))
+	defer old.Close()
+	oldURL := old.URL + "/cloud.yaml.gz"
+	(&options{
+		chainedURL:       oldURL,
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+oldURL+"\n")()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	poll()
+	cfg := current()
+	assert.Contains(t, cfg.ProxiedSites.Cloud, "a.com", "Should have followed redirects to the config")
+	assert.Equal(t, map[string]string{oldURL: srv.ConfigURL()}, cfg.MovedCloudConfigs, "Permanent move should have been saved")
+	assert.Equal(t, []string{srv.ConfigURL()}, cfg.CloudConfigs, "Moved URL should have replaced the old one")
+	assert.Equal(t, 1, srv.Requests())
+
+	// The next poll skips the redirects and is conditional on the ETag from
+	// the final URL
+	poll()
+	assert.Equal(t, 1, len(hopHeaders), "Should have skipped the redirects")
+	assert.Equal(t, 1, srv.NotModified(), "ETag should have been sent to the new URL")
+
+	// Headers go along with every hop
+	hopHeaders = nil
+	lastCloudConfigETag[oldURL] = "etag-1"
+	_, err := fetchCloudConfigWith(context.Background(), &http.Client{}, oldURL, "", "token-1")
+	assert.NoError(t, err)
+	if assert.Len(t, hopHeaders, 1) {
+		assert.Equal(t, "etag-1", hopHeaders[0].Get(ifNoneMatch))
+		assert.Equal(t, "token-1", hopHeaders[0].Get(authTokenHeader))
+		assert.Equal(t, "no-cache", hopHeaders[0].Get("Cache-Control"))
+	}
+}
+
+func TestFetchRedirectLimits(t *testing.T) {
+	defer useTestFetcher()()
+	hops := 0
+	var loop *httptest.Server
+	loop = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		hops++
+		http.Redirect(resp, req, loop.URL+"/again", http.StatusFound)
+	}))
+	defer loop.Close()
+	_, err := fetchCloudConfigWith(context.Background(), &http.Client{}, loop.URL+"/cloud.yaml.gz", "", "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "redirects")
+	}
+	assert.Equal(t, maxRedirects+1, hops, "Should have stopped following redirects")
+	assert.Empty(t, movedCloudConfigUrl, "Temporary redirects should not be learned")
+
+	downgrading := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		http.Redirect(resp, req, "http://example.com/cloud.yaml.gz", http.StatusMovedPermanently)
+	}))
+	defer downgrading.Close()
+	_, err = fetchCloudConfigWith(context.Background(), downgrading.Client(), downgrading.URL+"/cloud.yaml.gz", "", "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "insecure")
+	}
+	assert.Empty(t, movedCloudConfigUrl, "Downgrades should not be learned")
+}
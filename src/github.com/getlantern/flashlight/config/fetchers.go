@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Fetcher fetches cloud config over some transport other than HTTP through
+// our servers and the bootstrap servers, like DNS TXT records, S3, an IPFS
+// gateway or BitTorrent, which may get through where those don't.
+type Fetcher interface {
+	// Fetch fetches the cloud config published at the given cloud config URL,
+	// returning the config, gzipped or as plain YAML, and its signature if
+	// the transport carries one (like the X-Lantern-Signature header, base64
+	// encoded). Fetch should give up once ctx is done, which it is as soon as
+	// another fetcher has won.
+	Fetch(ctx context.Context, url string) (config []byte, signature string, err error)
+}
+
+// FetcherFunc adapts a function to a Fetcher.
+type FetcherFunc func(ctx context.Context, url string) ([]byte, string, error)
+
+// Fetch implements the method from Fetcher.
+func (f FetcherFunc) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	return f(ctx, url)
+}
+
+var (
+	fetchers   = make(map[string]Fetcher)
+	fetchersMx sync.Mutex
+)
+
+// RegisterFetcher registers a Fetcher under the given name, replacing any
+// registered under that name before, or unregisters it if fetcher is nil.
+// Each time we fetch cloud config, the registered fetchers race fetching it
+// over HTTP, and the first to succeed wins.
+func RegisterFetcher(name string, fetcher Fetcher) {
+	fetchersMx.Lock()
+	defer fetchersMx.Unlock()
+	if fetcher == nil {
+		delete(fetchers, name)
+	} else {
+		fetchers[name] = fetcher
+	}
+}
+
+// registeredFetchers returns the names of the registered fetchers, sorted,
+// and the fetchers by name.
+func registeredFetchers() ([]string, map[string]Fetcher) {
+	fetchersMx.Lock()
+	defer fetchersMx.Unlock()
+	names := make([]string, 0, len(fetchers))
+	registered := make(map[string]Fetcher, len(fetchers))
+	for name, fetcher := range fetchers {
+		names = append(names, name)
+		registered[name] = fetcher
+	}
+	sort.Strings(names)
+	return names, registered
+}
+
+// fetchResult is the outcome of one of the fetches raced by raceFetchers,
+// where fetcher is empty for the fetch over HTTP.
+type fetchResult struct {
+	fetcher string
+	bytes   []byte
+	err     error
+}
+
+// raceFetchers fetches the cloud config at the given URL with fetch, which
+// fetches it over HTTP, racing the registered fetchers. Once one succeeds, the
+// others are canceled. What fetch got is preferred if it also succeeded, since
+// it's the one that remembers what it fetched, like the ETag. Otherwise, the
+// winner's config is returned, or nil if it's the same as what we last
+// fetched from the URL. If everything fails, fetch's error is returned.
+// Canceling ctx cancels all of them.
+func raceFetchers(ctx context.Context, url string, fetch func(ctx context.Context, url string) ([]byte, error)) ([]byte, error) {
+	names, registered := registeredFetchers()
+	if len(names) == 0 {
+		return fetch(ctx, url)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *fetchResult, len(names)+1)
+	go func() {
+		bytes, err := fetch(ctx, url)
+		results <- &fetchResult{bytes: bytes, err: err}
+	}()
+	for _, name := range names {
+		go func(name string, fetcher Fetcher) {
+			bytes, err := fetchWith(ctx, fetcher, url)
+			results <- &fetchResult{fetcher: name, bytes: bytes, err: err}
+		}(name, registered[name])
+	}
+
+	// Everything has to finish before we return, so that nothing's still
+	// fetching while we apply what was fetched
+	var ours, winner *fetchResult
+	for i := 0; i <= len(names); i++ {
+		result := <-results
+		if result.fetcher == "" {
+			ours = result
+			if isDeferred(result.err) {
+				// Don't download over metered connections by other means either
+				cancel()
+			}
+		} else if result.err != nil {
+			log.Debugf("Unable to fetch cloud config with %v fetcher: %v", result.fetcher, result.err)
+		}
+		if result.err == nil && winner == nil {
+			winner = result
+			cancel()
+		}
+	}
+	if ours.err == nil || isDeferred(ours.err) || winner == nil {
+		return ours.bytes, ours.err
+	}
+	log.Debugf("Fetched cloud config with %v fetcher", winner.fetcher)
+	return fetchedWithFetcher(url, winner.bytes), nil
+}
+
+// fetchWith fetches the cloud config at the given URL with the given Fetcher,
+// decoding and verifying it.
+func fetchWith(ctx context.Context, fetcher Fetcher, url string) ([]byte, error) {
+	raw, signature, err := fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := decodeConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCloudConfig(bytes, signature); err != nil {
+		return nil, fmt.Errorf("Fetched cloud config isn't genuine: %v", err)
+	}
+	return bytes, nil
+}
+
+// fetchedWithFetcher remembers the given config as the last one fetched from
+// the given URL, returning it, or nil if it's the same as the last one. We
+// don't know its ETag, so the next fetch over HTTP downloads the whole config
+// rather than a delta against what we remember.
+func fetchedWithFetcher(url string, bytes []byte) []byte {
+	checksum := sha256.Sum256(bytes)
+	previous, found := lastCloudConfigChecksum[url]
+	delete(lastCloudConfigETag, url)
+	delete(lastCloudConfigModified, url)
+	delete(lastCloudConfigWire, url)
+	lastCloudConfigChecksum[url] = checksum
+	lastCloudConfigPayload[url] = bytes
+	if found && previous == checksum {
+		log.Debugf("Fetched cloud config identical to last one")
+		return nil
+	}
+	return bytes
+}
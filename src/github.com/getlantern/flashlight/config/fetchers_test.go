@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useFetcher registers the given fetcher until the returned function is
+// called.
+func useFetcher(name string, fetcher Fetcher) func() {
+	RegisterFetcher(name, fetcher)
+	return func() {
+		RegisterFetcher(name, nil)
+	}
+}
+
+func TestRaceFetchers(t *testing.T) {
+	defer useTestFetcher()()
+	url := "http://config.example.com/cloud.yaml.gz"
+	yml := serversConfig("fallback-1", "1.1.1.1:443")
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(yml))
+	w.Close()
+	httpFails := func(ctx context.Context, url string) ([]byte, error) {
+		return nil, fmt.Errorf("blocked")
+	}
+
+	b, err := raceFetchers(context.Background(), url, httpFails)
+	assert.EqualError(t, err, "blocked", "Without other fetchers, we only have HTTP")
+	assert.Nil(t, b)
+
+	defer useFetcher("broken", FetcherFunc(func(ctx context.Context, url string) ([]byte, string, error) {
+		return []byte("\x00\x01 not a config"), "", nil
+	}))()
+	defer useFetcher("ipfs", FetcherFunc(func(ctx context.Context, url string) ([]byte, string, error) {
+		return gzipped.Bytes(), "", nil
+	}))()
+	b, err = raceFetchers(context.Background(), url, httpFails)
+	if assert.NoError(t, err, "Should have fallen back to the other fetchers") {
+		assert.Equal(t, yml, string(b))
+	}
+	b, err = raceFetchers(context.Background(), url, httpFails)
+	assert.NoError(t, err)
+	assert.Nil(t, b, "Unchanged config should not be returned")
+
+	// Fetchers that are still going are canceled once one succeeds
+	canceled := make(chan bool, 1)
+	defer useFetcher("slow", FetcherFunc(func(ctx context.Context, url string) ([]byte, string, error) {
+		select {
+		case <-ctx.Done():
+			canceled <- true
+			return nil, "", ctx.Err()
+		case <-time.After(10 * time.Second):
+			canceled <- false
+			return []byte(yml), "", nil
+		}
+	}))()
+	RegisterFetcher("ipfs", nil)
+	RegisterFetcher("broken", nil)
+	fromHTTP := serversConfig("fallback-2", "2.2.2.2:443")
+	b, err = raceFetchers(context.Background(), url, func(ctx context.Context, url string) ([]byte, error) {
+		return []byte(fromHTTP), nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, fromHTTP, string(b))
+	}
+	assert.True(t, <-canceled, "Slow fetcher should have been canceled")
+}
+
+func TestRaceFetchersRespectsDeferral(t *testing.T) {
+	defer useTestFetcher()()
+	defer useFetcher("dns", FetcherFunc(func(ctx context.Context, url string) ([]byte, string, error) {
+		<-ctx.Done()
+		return nil, "", ctx.Err()
+	}))()
+	deferred := &deferredError{}
+	b, err := raceFetchers(context.Background(), "http://config.example.com/cloud.yaml.gz", func(ctx context.Context, url string) ([]byte, error) {
+		return nil, deferred
+	})
+	assert.Nil(t, b)
+	assert.True(t, isDeferred(err), "Deferred download shouldn't be done by other means")
+}
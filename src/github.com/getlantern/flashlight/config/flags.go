@@ -11,26 +11,80 @@ import (
 )
 
 var (
-	configdir     = flag.String("configdir", "", "directory in which to store configuration, including flashlight.yaml (defaults to current directory)")
-	cloudconfig   = flag.String("cloudconfig", "", "optional http(s) URL to a cloud-based source for configuration updates")
-	cloudconfigca = flag.String("cloudconfigca", "", "optional PEM encoded certificate used to verify TLS connections to fetch cloudconfig")
-	addr          = flag.String("addr", "", "ip:port on which to listen for requests. When running as a client proxy, we'll listen with http, when running as a server proxy we'll listen with https (required)")
-	unencrypted   = flag.Bool("unencrypted", false, "set to true to run server in unencrypted mode (no TLS)")
-	role          = flag.String("role", "", "either 'client' or 'server' (required)")
-	frontFQDNs    = flag.String("frontfqdns", "", "YAML string representing a map from the name of each front provider to a FQDN that will reach this particular server via that provider (e.g. '{cloudflare: fl-001.getiantem.org, cloudfront: blablabla.cloudfront.net}')")
-	statsPeriod   = flag.Int("statsperiod", 0, "time in seconds to wait between reporting stats. If not specified, stats are not reported. If specified, statshub, instanceid and statshubAddr must also be specified.")
-	statshubAddr  = flag.String("statshub", "pure-journey-3547.herokuapp.com", "address of statshub server")
-	instanceid    = flag.String("instanceid", "", "instanceId under which to report stats to statshub. If not specified, no stats are reported.")
-	registerat    = flag.String("registerat", "", "base URL for peer DNS registry at which to register (e.g. https://peerscanner.getiantem.org)")
-	country       = flag.String("country", "xx", "2 digit country code under which to report stats. Defaults to xx.")
-	cpuprofile    = flag.String("cpuprofile", "", "write cpu profile to given file")
-	memprofile    = flag.String("memprofile", "", "write heap profile to given file")
-	portmap       = flag.Int("portmap", 0, "try to map this port on the firewall to the port on which flashlight is listening, using UPnP or NAT-PMP. If mapping this port fails, flashlight will exit with status code 50")
-	uiaddr        = flag.String("uiaddr", "", "if specified, indicates host:port the UI HTTP server should be started on")
-	proxyAll      = flag.Bool("proxyall", false, "set to true to proxy all traffic through Lantern network")
-	stickyConfig  = flag.Bool("stickyconfig", false, "set to true to only use the local config file")
+	configdir          = flag.String("configdir", "", "directory in which to store configuration, including flashlight.yaml (defaults to current directory)")
+	cloudconfig        = flag.String("cloudconfig", "", "if specified, the http(s) URL from which to fetch cloud config for this session instead of the default, for example a staging server")
+	cloudconfigca      = flag.String("cloudconfigca", "", "optional PEM encoded certificate used to verify TLS connections to fetch cloudconfig")
+	addr               = flag.String("addr", "", "ip:port on which to listen for requests. When running as a client proxy, we'll listen with http, when running as a server proxy we'll listen with https (required)")
+	unencrypted        = flag.Bool("unencrypted", false, "set to true to run server in unencrypted mode (no TLS)")
+	role               = flag.String("role", "", "either 'client' or 'server' (required)")
+	frontFQDNs         = flag.String("frontfqdns", "", "YAML string representing a map from the name of each front provider to a FQDN that will reach this particular server via that provider (e.g. '{cloudflare: fl-001.getiantem.org, cloudfront: blablabla.cloudfront.net}')")
+	statsPeriod        = flag.Int("statsperiod", 0, "time in seconds to wait between reporting stats. If not specified, stats are not reported. If specified, statshub, instanceid and statshubAddr must also be specified.")
+	statshubAddr       = flag.String("statshub", "pure-journey-3547.herokuapp.com", "address of statshub server")
+	instanceid         = flag.String("instanceid", "", "instanceId under which to report stats to statshub. If not specified, no stats are reported.")
+	registerat         = flag.String("registerat", "", "base URL for peer DNS registry at which to register (e.g. https://peerscanner.getiantem.org)")
+	country            = flag.String("country", "xx", "2 digit country code under which to report stats. Defaults to xx.")
+	cpuprofile         = flag.String("cpuprofile", "", "write cpu profile to given file")
+	memprofile         = flag.String("memprofile", "", "write heap profile to given file")
+	portmap            = flag.Int("portmap", 0, "try to map this port on the firewall to the port on which flashlight is listening, using UPnP or NAT-PMP. If mapping this port fails, flashlight will exit with status code 50")
+	uiaddr             = flag.String("uiaddr", "", "if specified, indicates host:port the UI HTTP server should be started on")
+	proxyAll           = flag.Bool("proxyall", false, "set to true to proxy all traffic through Lantern network")
+	stickyConfig       = flag.Bool("stickyconfig", false, "set to true to only use the local config file")
+	checkConfig        = flag.String("check-config", "", "if specified, validate the config file at this path, merge it as a cloud update would be, print the effective config (with secrets masked, see -dump-format) and any issues and exit")
+	dumpConfig         = flag.Bool("dump-config", false, "set to true to print the effective config (with secrets masked) and exit")
+	dumpFormat         = flag.String("dump-format", "yaml", "format in which to print the config with -dump-config or -check-config, either yaml or json")
+	exportConfig       = flag.String("export-config", "", "if specified, write the config with secrets and identifying details removed, along with recent config errors, to this file for attaching to bug reports and exit. - writes to stdout")
+	cloudPollInterval  = flag.Duration("cloudpollinterval", 0, "if specified, how often to poll for cloud config for this session, overriding the config. Limited to between 15s and 6h")
+	filePollInterval   = flag.Duration("filepollinterval", 0, "if specified, how often to check the config file for changes on platforms where it can't be watched for this session, overriding the config. Limited to between 1s and 1m")
+	configProxyFlag    = flag.String("config-proxy", "", "if specified, a SOCKS proxy through which to fetch cloud config when the local proxy doesn't work instead of the bootstrap servers, as socks5://[user:password@]host:port. Overrides the config")
+	useSystemProxyFlag = flag.Bool("usesystemproxy", false, "set to true to fetch cloud config directly through the proxy in the HTTP_PROXY and HTTPS_PROXY environment variables when the local proxy doesn't work")
+	encryptConfig      = flag.Bool("encryptconfig", false, "set to true to encrypt the config file at rest or false to decrypt it. If not specified, the config file is kept as it is")
+	portable           = flag.Bool("portable", false, "set to true to keep config, settings and logs in a directory beside the Lantern binary instead of in the user's profile, for example when running off a USB stick. Also turned on by a file called portable beside the binary")
+	bootstrapURL       = flag.String("bootstrap-url", "", "if specified, the http(s) URL of a config to start with on the first run instead of the packaged one, for custom distributions. Falls back to the packaged config if it can't be fetched")
+	bootstrapCA        = flag.String("bootstrap-ca", "", "optional PEM encoded certificate used to verify TLS connections to fetch the config at -bootstrap-url")
+	bootstrapToken     = flag.String("bootstrap-token", "", "optional token with which to authorize fetching the config at -bootstrap-url")
+	noConfigCleanup    = flag.Bool("no-config-cleanup", false, "set to true to leave the config files of older versions of Lantern and old backups of config files in the config directory instead of removing them")
+	territory          = flag.String("territory", "", "if specified, the 2-letter code of the territory to prefer the servers of, like CN. Saved in the config")
+	configAdminAddr    = flag.String("config-admin-addr", "", "if specified, the loopback host:port, like localhost:16824, on which to serve the gRPC config admin API for tooling and tests. Callers authenticate with the token in the config-admin-token file in the config directory")
 )
 
+func init() {
+	flag.DurationVar(cloudPollInterval, "cloudconfig-poll", 0, "same as -cloudpollinterval")
+	flag.DurationVar(filePollInterval, "fileconfig-poll", 0, "same as -filepollinterval")
+}
+
+// cloudConfigURL returns the URL from which to fetch cloud config, which the
+// -cloudconfig flag overrides for this session.
+func cloudConfigURL() string {
+	if *cloudconfig != "" {
+		return *cloudconfig
+	}
+	return chainedCloudConfigUrl
+}
+
+// cloudConfigURLs returns the URLs from which to fetch cloud config, in the
+// order to try them: those in CloudConfigs, in their configured order. The
+// -cloudconfig flag overrides them all for this session.
+func (cfg *Config) cloudConfigURLs() []string {
+	if *cloudconfig != "" || len(cfg.CloudConfigs) == 0 {
+		return []string{cloudConfigURL()}
+	}
+	return cfg.CloudConfigs
+}
+
+// logFlagOverrides logs the settings that flags override for this session,
+// since they're easy to forget about and aren't saved in the config.
+func (cfg *Config) logFlagOverrides() {
+	if *cloudconfig != "" {
+		log.Debugf("Overriding cloud config URL for this session: %v", *cloudconfig)
+	}
+	if *cloudPollInterval > 0 {
+		log.Debugf("Overriding cloud config poll interval for this session: %v", cfg.cloudPollInterval())
+	}
+	if *filePollInterval > 0 {
+		log.Debugf("Overriding config file poll interval for this session: %v", cfg.filePollInterval())
+	}
+}
+
 // applyFlags updates this Config from any command-line flags that were passed
 // in. ApplyFlags assumes that flag.Parse() has already been called.
 func (updated *Config) applyFlags() error {
@@ -52,8 +106,6 @@ func (updated *Config) applyFlags() error {
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
 		// General
-		case "cloudconfig":
-			updated.CloudConfig = *cloudconfig
 		case "cloudconfigca":
 			updated.CloudConfigCA = *cloudconfigca
 		case "addr":
@@ -75,6 +127,8 @@ func (updated *Config) applyFlags() error {
 		// Client
 		case "proxyall":
 			settings.SetProxyAll(*proxyAll)
+		case "territory":
+			updated.Client.Territory = *territory
 
 		// Server
 		case "portmap":
@@ -97,6 +151,9 @@ func (updated *Config) applyFlags() error {
 	updated.CpuProfile = *cpuprofile
 	updated.MemProfile = *memprofile
 	updated.Server.Unencrypted = *unencrypted
+	// Flags that only apply for this session, like -cloudconfig, aren't copied
+	// into the config, which is saved
+	updated.logFlagOverrides()
 
 	return nil
 }
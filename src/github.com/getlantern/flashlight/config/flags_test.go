@@ -0,0 +1,77 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestCloudConfigFlag(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("client:\n  chainedservers:\n    staging-1:\n      addr: 1.1.1.1:443\n")
+	defer srv.Close()
+	(&options{bootstrapServers: noBootstrapServers}).apply()
+
+	assert.Equal(t, chainedCloudConfigUrl, cloudConfigURL(), "Should use compiled default without flag")
+
+	origCloudConfig := *cloudconfig
+	defer func() {
+		*cloudconfig = origCloudConfig
+	}()
+	*cloudconfig = srv.ConfigURL()
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")()
+	assert.Equal(t, srv.ConfigURL(), cloudConfigURL(), "Flag should override compiled default")
+
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+	cfg := current()
+	assert.Equal(t, 1, srv.Requests(), "Should have fetched from the URL in the flag")
+	assert.NotNil(t, cfg.Client.ChainedServers["staging-1"])
+	assert.Equal(t, []string{"http://config.example.com/cloud.yaml.gz"}, cfg.CloudConfigs, "Flag should not have been saved in config")
+	_, _, _, err = loadCloudCache()
+	assert.True(t, os.IsNotExist(err), "Config from the flag's URL should not have been cached")
+}
+
+func TestPollFlagsPrecedence(t *testing.T) {
+	origCloud, origFile := *cloudPollInterval, *filePollInterval
+	defer func() {
+		*cloudPollInterval, *filePollInterval = origCloud, origFile
+	}()
+	*cloudPollInterval, *filePollInterval = 0, 0
+
+	configured := &Config{CloudPollInterval: time.Hour, FilePollInterval: 30 * time.Second}
+	unconfigured := &Config{}
+	assert.Equal(t, defaultCloudPollInterval, unconfigured.cloudPollInterval(), "Should use compiled default without flag or config")
+	assert.Equal(t, defaultFilePollInterval, unconfigured.filePollInterval(), "Should use compiled default without flag or config")
+
+	assert.NoError(t, flag.Set("cloudconfig-poll", "10s"))
+	assert.NoError(t, flag.Set("fileconfig-poll", "2s"))
+	for _, cfg := range []*Config{configured, unconfigured} {
+		assert.Equal(t, minCloudPollInterval, cfg.cloudPollInterval(), "Flag should override config and default, clamped like the config")
+		assert.Equal(t, 2*time.Second, cfg.filePollInterval(), "Flag should override config and default")
+	}
+}
+
+func TestCloudConfigURLsKeepConfiguredOrder(t *testing.T) {
+	origCloudConfig := *cloudconfig
+	defer func() {
+		*cloudconfig = origCloudConfig
+	}()
+	*cloudconfig = ""
+
+	urls := []string{"http://second.example.com/cloud.yaml.gz", chainedCloudConfigUrl, "http://third.example.com/cloud.yaml.gz"}
+	cfg := &Config{CloudConfigs: urls}
+	assert.Equal(t, urls, cfg.cloudConfigURLs(), "Should try CloudConfigs in their configured order")
+	assert.Equal(t, []string{chainedCloudConfigUrl}, (&Config{}).cloudConfigURLs(), "Should fall back to compiled default")
+
+	*cloudconfig = "http://flag.example.com/cloud.yaml.gz"
+	assert.Equal(t, []string{*cloudconfig}, cfg.cloudConfigURLs(), "Flag should override CloudConfigs")
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// flapWindow is the period over which we count changes to the chained
+	// servers.
+	flapWindow = time.Hour
+
+	// defaultMaxServerSetChanges is how many times cloud config can change
+	// the chained servers within flapWindow when the config doesn't say.
+	defaultMaxServerSetChanges = 6
+)
+
+var (
+	serverSetChanges = &flapTracker{}
+)
+
+// flappingError is returned when cloud config would change the chained
+// servers again after changing them too often lately. Every change makes
+// clients drop their connections, so we hold on to the servers we have until
+// enough of the changes are old enough.
+type flappingError struct {
+	changes int
+	until   time.Time
+}
+
+func (e *flappingError) Error() string {
+	return fmt.Sprintf("Chained servers changed %d times in the last %v, holding them until %v", e.changes, flapWindow, formatCloudTime(e.until))
+}
+
+// flapTracker keeps the times at which cloud config changed the chained
+// servers during the last flapWindow.
+type flapTracker struct {
+	changes []time.Time
+	mx      sync.Mutex
+}
+
+// check records that cloud config changed the chained servers from before to
+// after at the given time, unless they changed max times already in the last
+// flapWindow, in which case it returns a *flappingError instead. Updates that
+// leave the servers as they were don't count.
+func (t *flapTracker) check(before []string, after []string, at time.Time, max int) error {
+	if equalStrings(before, after) {
+		return nil
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	recent := t.changes[:0]
+	for _, changed := range t.changes {
+		if at.Sub(changed) < flapWindow {
+			recent = append(recent, changed)
+		}
+	}
+	t.changes = recent
+	if len(t.changes) >= max {
+		return &flappingError{len(t.changes), t.changes[len(t.changes)-max].Add(flapWindow)}
+	}
+	t.changes = append(t.changes, at)
+	return nil
+}
+
+// maxServerSetChanges returns MaxServerSetChanges, or its default if it's not
+// set.
+func (cfg *Config) maxServerSetChanges() int {
+	if cfg.MaxServerSetChanges <= 0 {
+		return defaultMaxServerSetChanges
+	}
+	return cfg.MaxServerSetChanges
+}
+
+// chainedServerSet returns the names and addresses of the chained servers in
+// this Config, sorted, so that changes to them can be told apart from other
+// changes to the servers, like their weights.
+func (cfg *Config) chainedServerSet() []string {
+	if cfg.Client == nil {
+		return nil
+	}
+	servers := make([]string, 0, len(cfg.Client.ChainedServers))
+	for name, server := range cfg.Client.ChainedServers {
+		servers = append(servers, name+"="+server.Addr)
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// equalStrings returns whether a and b hold the same strings in the same
+// order.
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestFlapTracker(t *testing.T) {
+	tracker := &flapTracker{}
+	a, b := []string{"fallback-1=1.1.1.1:443"}, []string{"fallback-2=2.2.2.2:443"}
+	start := time.Now()
+
+	assert.NoError(t, tracker.check(a, b, start, 2))
+	assert.NoError(t, tracker.check(b, b, start.Add(time.Minute), 2), "Unchanged servers shouldn't count")
+	assert.NoError(t, tracker.check(b, a, start.Add(10*time.Minute), 2))
+	err := tracker.check(a, b, start.Add(20*time.Minute), 2)
+	if assert.IsType(t, &flappingError{}, err) {
+		assert.Equal(t, start.Add(flapWindow), err.(*flappingError).until, "Should hold until the oldest change leaves the window")
+	}
+	assert.NoError(t, tracker.check(a, b, start.Add(flapWindow), 2), "Changes should be allowed again once old ones leave the window")
+}
+
+func TestFlappingServersHeld(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+	servers := func(i int) string {
+		return cloudUpdate(t, map[string]*client.ChainedServerInfo{
+			fmt.Sprintf("fallback-%d", i): {Addr: fmt.Sprintf("%d.%d.%d.%d:443", i, i, i, i), AuthToken: "token"},
+		})
+	}
+	srv := configtest.NewCloudConfigServer(servers(1))
+	defer srv.Close()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\nmaxserversetchanges: 2\n")()
+	poll := func() error {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return err
+		}
+		return m.Update(mutate)
+	}
+
+	assert.NoError(t, poll())
+	srv.SetConfig(servers(2))
+	assert.NoError(t, poll())
+	assert.NotNil(t, current().Client.ChainedServers["fallback-2"])
+
+	// A third change within the hour is held
+	srv.SetConfig(servers(3))
+	assert.IsType(t, &flappingError{}, poll())
+	assert.NotNil(t, current().Client.ChainedServers["fallback-2"], "Servers should have been held")
+	assert.NotEmpty(t, DebugState().QuarantinedETag, "Held config should have been quarantined")
+	assert.Contains(t, categoriesOf(*collected), HealthError, "Holding servers should have been reported")
+	requests := srv.Requests()
+	assert.NoError(t, poll())
+	assert.Nil(t, current().Client.ChainedServers["fallback-3"], "Servers should still be held")
+
+	// Once the changes are an hour old, the held config gets another chance
+	serverSetChanges.mx.Lock()
+	for i := range serverSetChanges.changes {
+		serverSetChanges.changes[i] = serverSetChanges.changes[i].Add(-flapWindow)
+	}
+	serverSetChanges.mx.Unlock()
+	quarantineMx.Lock()
+	quarantined.until = time.Now().Add(-time.Second)
+	quarantineMx.Unlock()
+	assert.NoError(t, poll())
+	assert.True(t, srv.Requests() > requests)
+	assert.NotNil(t, current().Client.ChainedServers["fallback-3"], "Held config should have been applied")
+	assert.Empty(t, DebugState().QuarantinedETag)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/getlantern/fronted"
+
+	"github.com/getlantern/flashlight/util"
+)
+
+const (
+	// frontedAttempts is how many direct fronters we try in turn when
+	// fetching cloud config via domain fronting.
+	frontedAttempts = 4
+
+	// frontedAttemptTimeout is how long each direct fronter gets.
+	frontedAttemptTimeout = 20 * time.Second
+)
+
+// FrontedAttempt describes how one of the direct fronters fared when we last
+// fetched cloud config via domain fronting.
+type FrontedAttempt struct {
+	Attempt  int           // Which attempt this was, starting from 1
+	Duration time.Duration // How long it took
+	Error    string        // Why it failed, empty if it succeeded
+}
+
+// frontedRetrier fetches via domain fronting, trying several independently
+// created direct fronters in turn. Each dials masquerades from the ones
+// fronted hasn't handed out yet, so a blocked masquerade only costs us one
+// attempt rather than the whole fronted fetch.
+type frontedRetrier struct {
+	newFronter     func() util.HTTPFetcher
+	attempts       int
+	attemptTimeout time.Duration
+	timeout        time.Duration // Bounds all attempts together
+}
+
+func newFrontedRetrier() *frontedRetrier {
+	return &frontedRetrier{
+		newFronter: func() util.HTTPFetcher {
+			return fronted.NewDirect()
+		},
+		attempts:       frontedAttempts,
+		attemptTimeout: frontedAttemptTimeout,
+		timeout:        bootstrapFallbackTimeout,
+	}
+}
+
+// Do implements util.HTTPFetcher. It stops trying once the request's context
+// is done, like when the chained request it's racing has succeeded.
+func (r *frontedRetrier) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var attempts []FrontedAttempt
+	defer func() {
+		updatePollState(func(state *PollState) {
+			state.FrontedAttempts = attempts
+		})
+	}()
+	var lastErr error
+	for i := 1; i <= r.attempts; i++ {
+		if err := req.Context().Err(); err != nil {
+			log.Debugf("Stopping fronted fetch after %d attempts: %v", len(attempts), err)
+			return nil, err
+		}
+		remaining := r.timeout - time.Since(start)
+		if remaining <= 0 {
+			lastErr = fmt.Errorf("Timed out after %v, last error: %v", r.timeout, lastErr)
+			break
+		}
+		timeout := r.attemptTimeout
+		if remaining < timeout {
+			timeout = remaining
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		attemptStart := time.Now()
+		resp, err := r.newFronter().Do(req.WithContext(ctx))
+		if err == nil && resp.StatusCode >= 400 {
+			resp.Body.Close()
+			err = fmt.Errorf("Bad response code: %v", resp.StatusCode)
+		}
+		if err != nil && ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			err = fmt.Errorf("Timed out after %v", timeout)
+		}
+		attempt := FrontedAttempt{Attempt: i, Duration: time.Since(attemptStart)}
+		if err != nil {
+			cancel()
+			attempt.Error = err.Error()
+			attempts = append(attempts, attempt)
+			log.Debugf("Fronted attempt %d failed: %v", i, err)
+			lastErr = err
+			continue
+		}
+		attempts = append(attempts, attempt)
+		log.Debugf("Fronted attempt %d succeeded", i)
+		// The body is read after we return, so the attempt lasts until it's
+		// closed
+		resp.Body = &cancelOnClose{resp.Body, cancel}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("Unable to fetch via domain fronting after %d attempts: %v", len(attempts), lastErr)
+}
+
+// cancelOnClose cancels the context of the request whose response body it
+// wraps once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/util"
+)
+
+// scriptedFronter stands in for a direct fronter, doing what its script says
+// for the attempt that created it.
+type scriptedFronter struct {
+	do func(req *http.Request) (*http.Response, error)
+}
+
+func (f *scriptedFronter) Do(req *http.Request) (*http.Response, error) {
+	return f.do(req)
+}
+
+func blockedFronter(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("masquerade blocked")
+}
+
+func hangingFronter(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func workingFronter(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString("fronted"))}, nil
+}
+
+// scriptedRetrier returns a frontedRetrier whose attempts follow the given
+// script, repeating the last step, along with a function that returns how
+// many fronters it created.
+func scriptedRetrier(attempts int, attemptTimeout time.Duration, timeout time.Duration, script ...func(*http.Request) (*http.Response, error)) (*frontedRetrier, func() int) {
+	var created int
+	var mx sync.Mutex
+	r := &frontedRetrier{
+		newFronter: func() util.HTTPFetcher {
+			mx.Lock()
+			defer mx.Unlock()
+			step := script[len(script)-1]
+			if created < len(script) {
+				step = script[created]
+			}
+			created++
+			return &scriptedFronter{step}
+		},
+		attempts:       attempts,
+		attemptTimeout: attemptTimeout,
+		timeout:        timeout,
+	}
+	return r, func() int {
+		mx.Lock()
+		defer mx.Unlock()
+		return created
+	}
+}
+
+func TestFrontedRetries(t *testing.T) {
+	r, created := scriptedRetrier(4, 100*time.Millisecond, time.Minute, blockedFronter, hangingFronter, workingFronter)
+	req, _ := http.NewRequest("GET", "http://fronted.example.com/cloud.yaml.gz", nil)
+	resp, err := r.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "fronted", string(body))
+	assert.Equal(t, 3, created(), "Should have stopped at the fronter that worked")
+
+	attempts := DebugState().FrontedAttempts
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, "masquerade blocked", attempts[0].Error)
+		assert.Contains(t, attempts[1].Error, "Timed out")
+		assert.True(t, attempts[1].Duration >= 100*time.Millisecond, "Hanging attempt should have lasted its timeout")
+		assert.Empty(t, attempts[2].Error)
+		assert.Equal(t, 3, attempts[2].Attempt)
+	}
+
+	r, created = scriptedRetrier(3, 10*time.Millisecond, time.Minute, blockedFronter)
+	_, err = r.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, 3, created(), "Should have given up after the configured attempts")
+}
+
+func TestFrontedRetriesTimeBounded(t *testing.T) {
+	r, created := scriptedRetrier(10, 100*time.Millisecond, 150*time.Millisecond, hangingFronter)
+	req, _ := http.NewRequest("GET", "http://fronted.example.com/cloud.yaml.gz", nil)
+	start := time.Now()
+	_, err := r.Do(req)
+	elapsed := time.Since(start)
+	assert.Error(t, err)
+	assert.Equal(t, 2, created(), "Second attempt should have been cut short by the overall timeout")
+	assert.True(t, elapsed < time.Second, "Took %v", elapsed)
+	attempts := DebugState().FrontedAttempts
+	if assert.Len(t, attempts, 2) {
+		assert.True(t, attempts[1].Duration < 100*time.Millisecond, "Last attempt should only get what's left of the overall timeout")
+	}
+}
+
+func TestFrontedRetriesCanceled(t *testing.T) {
+	r, created := scriptedRetrier(10, time.Minute, time.Minute, blockedFronter, hangingFronter)
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "http://fronted.example.com/cloud.yaml.gz", nil)
+	go func() {
+		// Like the chained request winning the race
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err := r.Do(req.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < time.Second, "Should have stopped right away")
+	assert.Equal(t, 2, created(), "Should not have retried after being canceled")
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/getlantern/proxiedsites"
+)
+
+const (
+	configPath = "/config"
+	exportPath = "/config/export"
+
+	// sessionTokenHeader carries the UI's session token. Requests that can't
+	// set headers, like downloads of the export, can pass it in the token
+	// query parameter instead.
+	sessionTokenHeader = "X-Lantern-Session-Token"
+)
+
+var (
+	// patchableFields are the top-level Config fields that callers of the
+	// config handler are allowed to change.
+	patchableFields = map[string]bool{
+		"AutoReport":   true,
+		"AutoLaunch":   true,
+		"ProxiedSites": true,
+	}
+)
+
+// configPatch is the body of a PATCH request to the config handler.
+type configPatch struct {
+	AutoReport *bool
+	AutoLaunch *bool
+
+	// ProxiedSites: user additions and deletions to merge into the existing
+	// proxied sites delta.
+	ProxiedSites *proxiedsites.Delta
+}
+
+// RegisterHandlers registers the config handler on the given mux. The handler
+// serves a redacted JSON snapshot of the current config in response to GET
+// /config and applies changes to a whitelisted set of fields in response to
+// PATCH /config. Changes are routed through Update. GET /config/export
+// downloads the config as written by Export, for attaching to bug reports.
+// Requests are rejected unless they come from a loopback address, are
+// addressed to a loopback host, so that pages that rebind their own domain to
+// 127.0.0.1 can't use the handler, and carry the given session token.
+func RegisterHandlers(mux *http.ServeMux, sessionToken string) {
+	mux.HandleFunc(configPath, localOnly(sessionToken, handleConfig))
+	mux.HandleFunc(exportPath, localOnly(sessionToken, handleExport))
+}
+
+// localOnly returns a handler that passes requests to handle only if they
+// come from a loopback address, name a loopback host and carry the given
+// session token.
+func localOnly(sessionToken string, handle http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		if !isLoopback(req.RemoteAddr) {
+			log.Debugf("Rejecting config request from %v", req.RemoteAddr)
+			http.Error(resp, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !isLoopbackHost(req.Host) {
+			log.Debugf("Rejecting config request for host %v", req.Host)
+			http.Error(resp, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !hasSessionToken(req, sessionToken) {
+			log.Debugf("Rejecting config request without session token from %v", req.RemoteAddr)
+			http.Error(resp, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handle(resp, req)
+	}
+}
+
+func handleConfig(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		getConfig(resp)
+	case "PATCH":
+		patchConfig(resp, req)
+	default:
+		resp.Header().Set("Allow", "GET, PATCH")
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleExport(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		resp.Header().Set("Allow", "GET")
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if current() == nil {
+		http.Error(resp, "Config not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	var buf bytes.Buffer
+	if err := Export(&buf); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/x-yaml")
+	resp.Header().Set("Content-Disposition", `attachment; filename="lantern-config.yaml"`)
+	if _, err := resp.Write(buf.Bytes()); err != nil {
+		log.Errorf("Unable to write config export: %v", err)
+	}
+}
+
+func getConfig(resp http.ResponseWriter) {
+	cfg := current()
+	if cfg == nil {
+		http.Error(resp, "Config not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	writeRedactedJSON(resp, cfg)
+}
+
+func patchConfig(resp http.ResponseWriter, req *http.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Unable to read patch: %v", err), http.StatusBadRequest)
+		return
+	}
+	updated, err := applyPatch(data)
+	switch err.(type) {
+	case nil:
+		writeRedactedJSON(resp, updated)
+	case *forbiddenFieldError, *LockedFieldsError:
+		http.Error(resp, fmt.Sprintf("Unable to update config: %v", err), http.StatusForbidden)
+	default:
+		http.Error(resp, fmt.Sprintf("Unable to update config: %v", err), http.StatusBadRequest)
+	}
+}
+
+// forbiddenFieldError is returned by applyPatch for patches to fields that
+// aren't in patchableFields.
+type forbiddenFieldError struct {
+	field string
+}
+
+func (e *forbiddenFieldError) Error() string {
+	return fmt.Sprintf("Field %v may not be modified", e.field)
+}
+
+// badPatchError is returned by applyPatch for patches that can't be decoded.
+type badPatchError struct {
+	err error
+}
+
+func (e *badPatchError) Error() string {
+	return fmt.Sprintf("Unable to decode patch: %v", e.err)
+}
+
+// applyPatch applies the given JSON patch, a configPatch, to the config
+// through Update, returning the updated config. Patches that can't be decoded
+// are rejected with a *badPatchError and ones that touch fields callers aren't
+// allowed to change with a *forbiddenFieldError, before anything is changed.
+func applyPatch(data []byte) (*Config, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, &badPatchError{err}
+	}
+	for name := range fields {
+		if !patchableFields[name] {
+			log.Debugf("Rejecting attempt to modify %v through config handler", name)
+			return nil, &forbiddenFieldError{name}
+		}
+	}
+	patch := &configPatch{}
+	if err := json.Unmarshal(data, patch); err != nil {
+		return nil, &badPatchError{err}
+	}
+
+	var updated *Config
+	err := Update(func(cfg *Config) error {
+		patch.applyTo(cfg)
+		updated = cfg
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// applyTo applies this patch to the given Config.
+func (patch *configPatch) applyTo(cfg *Config) {
+	if patch.AutoReport != nil {
+		autoReport := *patch.AutoReport
+		cfg.AutoReport = &autoReport
+	}
+	if patch.AutoLaunch != nil {
+		autoLaunch := *patch.AutoLaunch
+		cfg.AutoLaunch = &autoLaunch
+	}
+	if patch.ProxiedSites != nil {
+		if cfg.ProxiedSites == nil {
+			cfg.ProxiedSites = &proxiedsites.Config{}
+		}
+		if cfg.ProxiedSites.Delta == nil {
+			cfg.ProxiedSites.Delta = &proxiedsites.Delta{}
+		}
+		cfg.ProxiedSites.Delta.Merge(patch.ProxiedSites)
+	}
+}
+
+func writeRedactedJSON(resp http.ResponseWriter, cfg *Config) {
+	redactedCfg, err := cfg.redactedCopy()
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(redactedCfg); err != nil {
+		log.Errorf("Unable to write config: %v", err)
+	}
+}
+
+// isLoopback returns whether the given remote address is a loopback address.
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackHost returns whether the given host, as in the Host header and
+// with or without a port, is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	return strings.EqualFold(host, "localhost") || isLoopback(host)
+}
+
+// hasSessionToken returns whether the given request carries the session
+// token, which must not be empty.
+func hasSessionToken(req *http.Request, sessionToken string) bool {
+	if sessionToken == "" {
+		return false
+	}
+	token := req.Header.Get(sessionTokenHeader)
+	if token == "" {
+		token = req.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(sessionToken)) == 1
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	handlerTestConfig = `
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+      authtoken: supersecret
+`
+
+	testSessionToken = "test-session-token"
+)
+
+func doConfigRequest(method string, remoteAddr string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "http://127.0.0.1:16823"+configPath, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set(sessionTokenHeader, testSessionToken)
+	resp := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, testSessionToken)
+	mux.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestGetConfigRedacted(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	resp := doConfigRequest("GET", "127.0.0.1:5000", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.False(t, strings.Contains(resp.Body.String(), "supersecret"), "Auth token should be redacted")
+
+	cfg := &Config{}
+	if assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), cfg)) {
+		assert.Equal(t, "1.2.3.4:443", cfg.Client.ChainedServers["fallback-1"].Addr)
+	}
+}
+
+func TestPatchAutoReport(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	resp := doConfigRequest("PATCH", "127.0.0.1:5000", `{"AutoReport": false}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	if assert.NotNil(t, current().AutoReport) {
+		assert.False(t, *current().AutoReport)
+	}
+	assert.Equal(t, "supersecret", string(current().Client.ChainedServers["fallback-1"].AuthToken), "Stored auth token should be untouched")
+}
+
+func TestPatchTrustedCAsRejected(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	before := len(current().TrustedCAs)
+	resp := doConfigRequest("PATCH", "127.0.0.1:5000", `{"TrustedCAs": [{"CommonName": "evil", "Cert": "bad"}]}`)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, before, len(current().TrustedCAs), "TrustedCAs should be unchanged")
+}
+
+func TestNonLoopbackRejected(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	resp := doConfigRequest("GET", "10.0.0.5:5000", "")
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = doConfigRequest("PATCH", "10.0.0.5:5000", `{"AutoReport": false}`)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Nil(t, current().AutoReport)
+}
+
+func TestRequestsFromOtherPagesRejected(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, testSessionToken)
+	request := func(host string, token string) int {
+		req, _ := http.NewRequest("PATCH", "http://"+host+configPath, strings.NewReader(`{"AutoReport": false}`))
+		req.RemoteAddr = "127.0.0.1:5000"
+		if token != "" {
+			req.Header.Set(sessionTokenHeader, token)
+		}
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, request("attacker.example.com:16823", testSessionToken), "Rebound hosts should be rejected")
+	assert.Equal(t, http.StatusForbidden, request("127.0.0.1:16823", ""), "Requests without the session token should be rejected")
+	assert.Equal(t, http.StatusForbidden, request("127.0.0.1:16823", "wrong"), "Requests with the wrong session token should be rejected")
+	assert.Nil(t, current().AutoReport)
+	assert.Equal(t, http.StatusOK, request("localhost:16823", testSessionToken))
+	assert.Equal(t, http.StatusOK, request("[::1]:16823", testSessionToken))
+
+	emptyMux := http.NewServeMux()
+	RegisterHandlers(emptyMux, "")
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:16823"+configPath, nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	resp := httptest.NewRecorder()
+	emptyMux.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Without a session token nothing should be allowed")
+}
+
+func TestConcurrentPatches(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig)()
+
+	count := 20
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"ProxiedSites": {"Additions": ["site%d.com"]}}`, i)
+			resp := doConfigRequest("PATCH", "127.0.0.1:5000", body)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, current().ProxiedSites.Delta.Additions, count, "All additions should have been applied")
+}
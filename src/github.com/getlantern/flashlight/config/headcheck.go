@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getlantern/flashlight/util"
+)
+
+const (
+	// digest is the header (RFC 3230) in which servers may send a checksum of
+	// the cloud config on the wire.
+	digest = "Digest"
+)
+
+var (
+	// What the last cloud config fetched from each URL looked like on the
+	// wire, to compare with what HEAD requests say.
+	lastCloudConfigWire = map[string]wireSummary{}
+	// Cloud config URLs for which HEAD requests don't tell us whether the
+	// config changed, so that we don't keep sending them.
+	headUnsupportedUrl = map[string]bool{}
+)
+
+// wireSummary is the length and checksum of a response body as sent over the
+// wire, before any decompression.
+type wireSummary struct {
+	length   int64
+	checksum [sha256.Size]byte
+}
+
+// wireRecorder summarizes what's read through it.
+type wireRecorder struct {
+	hash   hash.Hash
+	length int64
+}
+
+func newWireRecorder() *wireRecorder {
+	return &wireRecorder{hash: sha256.New()}
+}
+
+func (r *wireRecorder) Write(p []byte) (int, error) {
+	r.length += int64(len(p))
+	return r.hash.Write(p)
+}
+
+func (r *wireRecorder) summary() wireSummary {
+	s := wireSummary{length: r.length}
+	copy(s.checksum[:], r.hash.Sum(nil))
+	return s
+}
+
+// recordWire makes the given recorder see the body of the given response as
+// it's read.
+func recordWire(resp *http.Response, recorder *wireRecorder) {
+	resp.Body = &bodyWithHead{io.TeeReader(resp.Body, recorder), resp.Body}
+}
+
+// headBeforeFetch returns whether to check with a HEAD request that the cloud
+// config changed before downloading it.
+func headBeforeFetch() bool {
+	cfg := current()
+	return cfg != nil && cfg.HeadBeforeFetch
+}
+
+// unchangedPerHead returns whether a HEAD request for the cloud config at the
+// given URL shows that it's the same as what we last fetched from there, in
+// which case there's no need to download it. Some captive portals and
+// transparent caches answer our conditional requests with the full config
+// even when it hasn't changed, which this avoids. The ETag has to match and,
+// if the server sends them, so do the Content-Length and Digest, so that a
+// config that changed without its ETag changing is still downloaded. If the
+// server doesn't support HEAD or doesn't send an ETag or Digest, we remember
+// not to bother with HEAD for that URL again.
+func unchangedPerHead(ctx context.Context, fetcher util.HTTPFetcher, url string, frontedUrl string, authToken string) bool {
+	if !headBeforeFetch() || headUnsupportedUrl[url] {
+		return false
+	}
+	last, found := lastCloudConfigWire[url]
+	if !found {
+		// Nothing to compare with
+		return false
+	}
+	req, err := newCloudConfigRequest(ctx, url, url, frontedUrl, authToken)
+	if err != nil {
+		return false
+	}
+	req.Method = "HEAD"
+	resp, err := withoutFollowingRedirects(fetcher).Do(req)
+	if err != nil {
+		log.Debugf("Unable to check cloud config at %v with HEAD: %v", url, err)
+		return false
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		log.Debugf("Config unchanged in cloud per HEAD")
+		return true
+	case http.StatusOK:
+		// Compare validators below
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		log.Debugf("Cloud config server at %v doesn't support HEAD, not checking with it again", url)
+		headUnsupportedUrl[url] = true
+		return false
+	default:
+		return false
+	}
+
+	tag := resp.Header.Get(etag)
+	checksum, hasChecksum := sha256Digest(resp.Header.Get(digest))
+	if tag == "" && !hasChecksum {
+		log.Debugf("HEAD for cloud config at %v gave no validators, not checking with it again", url)
+		headUnsupportedUrl[url] = true
+		return false
+	}
+	if tag != "" && tag != lastCloudConfigETag[url] {
+		return false
+	}
+	if hasChecksum && checksum != last.checksum {
+		return false
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != last.length {
+		return false
+	}
+	log.Debugf("Config unchanged in cloud per HEAD")
+	return true
+}
+
+// sha256Digest returns the SHA-256 checksum in the given Digest header, if it
+// has one.
+func sha256Digest(header string) ([sha256.Size]byte, bool) {
+	var checksum [sha256.Size]byte
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "sha-256") {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(b) != sha256.Size {
+			return checksum, false
+		}
+		copy(checksum[:], b)
+		return checksum, true
+	}
+	return checksum, false
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fullResponseServer serves cloud config with an ETag but, like the caches of
+// some captive portals, always answers with the full config and never with a
+// 304. It counts requests by method.
+type fullResponseServer struct {
+	*httptest.Server
+	mx           sync.Mutex
+	config       string
+	tag          string
+	supportsHead bool
+	sendDigest   bool
+	requests     map[string]int
+}
+
+func newFullResponseServer(config string, tag string) *fullResponseServer {
+	s := &fullResponseServer{config: config, tag: tag, supportsHead: true, requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		s.requests[req.Method]++
+		if req.Method == "HEAD" && !s.supportsHead {
+			resp.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		resp.Header().Set(etag, s.tag)
+		if s.sendDigest {
+			checksum := sha256.Sum256([]byte(s.config))
+			resp.Header().Set(digest, "SHA-256="+base64.StdEncoding.EncodeToString(checksum[:]))
+		}
+		resp.Header().Set("Content-Length", fmt.Sprint(len(s.config)))
+		resp.WriteHeader(http.StatusOK)
+		if req.Method != "HEAD" {
+			resp.Write([]byte(s.config))
+		}
+	}))
+	return s
+}
+
+func (s *fullResponseServer) set(config string, tag string) {
+	s.mx.Lock()
+	s.config, s.tag = config, tag
+	s.mx.Unlock()
+}
+
+func (s *fullResponseServer) count(method string) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests[method]
+}
+
+func TestHeadBeforeFetchSkipsUnchangedConfig(t *testing.T) {
+	defer useTestFetcher()()
+	defer initTestConfig(t, "headbeforefetch: true\n")()
+	srv := newFullResponseServer("proxiedsites:\n  cloud:\n  - a.com\n", "v1")
+	defer srv.Close()
+	url := srv.URL + "/cloud.yaml"
+	fetch := func() []byte {
+		bytes, err := fetchCloudConfigWith(context.Background(), &http.Client{}, url, "", "")
+		assert.NoError(t, err)
+		return bytes
+	}
+
+	assert.NotNil(t, fetch(), "Should have downloaded the config the first time")
+	assert.Equal(t, 0, srv.count("HEAD"), "Nothing to compare a HEAD with yet")
+
+	assert.Nil(t, fetch(), "Unchanged config should not be returned")
+	assert.Equal(t, 1, srv.count("HEAD"))
+	assert.Equal(t, 1, srv.count("GET"), "Should not have downloaded unchanged config")
+
+	srv.set("proxiedsites:\n  cloud:\n  - b.com\n", "v2")
+	assert.NotNil(t, fetch(), "Should have downloaded changed config")
+	assert.Equal(t, 2, srv.count("HEAD"))
+	assert.Equal(t, 2, srv.count("GET"))
+
+	// The ETag didn't change but the length did
+	srv.set("proxiedsites:\n  cloud:\n  - b.com\n  - c.com\n", "v2")
+	assert.NotNil(t, fetch(), "Should have downloaded config whose length changed")
+	assert.Equal(t, 3, srv.count("GET"))
+
+	// The ETag and length didn't change but the checksum did
+	srv.mx.Lock()
+	srv.sendDigest = true
+	srv.mx.Unlock()
+	assert.Nil(t, fetch(), "Unchanged config should not be returned")
+	assert.Equal(t, 3, srv.count("GET"), "Matching checksum should have skipped downloading")
+	srv.set("proxiedsites:\n  cloud:\n  - b.com\n  - d.com\n", "v2")
+	assert.NotNil(t, fetch(), "Should have downloaded config whose checksum changed")
+	assert.Equal(t, 4, srv.count("GET"))
+}
+
+func TestHeadBeforeFetchDisabled(t *testing.T) {
+	defer useTestFetcher()()
+	defer initTestConfig(t, "headbeforefetch: false\n")()
+	srv := newFullResponseServer("proxiedsites:\n  cloud:\n  - a.com\n", "v1")
+	defer srv.Close()
+	url := srv.URL + "/cloud.yaml"
+
+	for i := 0; i < 2; i++ {
+		_, err := fetchCloudConfigWith(context.Background(), &http.Client{}, url, "", "")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, srv.count("HEAD"))
+	assert.Equal(t, 2, srv.count("GET"))
+}
+
+func TestHeadBeforeFetchUnsupported(t *testing.T) {
+	defer useTestFetcher()()
+	defer initTestConfig(t, "headbeforefetch: true\n")()
+	srv := newFullResponseServer("proxiedsites:\n  cloud:\n  - a.com\n", "v1")
+	srv.supportsHead = false
+	defer srv.Close()
+	url := srv.URL + "/cloud.yaml"
+	fetch := func() {
+		_, err := fetchCloudConfigWith(context.Background(), &http.Client{}, url, "", "")
+		assert.NoError(t, err)
+	}
+
+	fetch()
+	fetch()
+	assert.Equal(t, 1, srv.count("HEAD"))
+	assert.Equal(t, 2, srv.count("GET"), "Should have fallen back to GET")
+	fetch()
+	assert.Equal(t, 1, srv.count("HEAD"), "Should have remembered that HEAD isn't supported")
+	assert.Equal(t, 3, srv.count("GET"))
+}
+
+func TestHeadBeforeFetchWithoutValidators(t *testing.T) {
+	defer useTestFetcher()()
+	defer initTestConfig(t, "headbeforefetch: true\n")()
+	srv := newFullResponseServer("proxiedsites:\n  cloud:\n  - a.com\n", "")
+	defer srv.Close()
+	url := srv.URL + "/cloud.yaml"
+
+	for i := 0; i < 3; i++ {
+		_, err := fetchCloudConfigWith(context.Background(), &http.Client{}, url, "", "")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, srv.count("HEAD"), "Should have stopped sending HEAD without validators")
+	assert.Equal(t, 3, srv.count("GET"))
+}
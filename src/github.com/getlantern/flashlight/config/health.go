@@ -0,0 +1,250 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/getlantern/yamlconf"
+)
+
+// We only learn whether the servers from a cloud config update work once the
+// client tries them, so the client tells us with MarkHealthy and
+// MarkUnhealthy. Cloud config that's confirmed healthy is kept on disk, and if
+// an update is reported unhealthy for UnhealthyRollbackWindow without being
+// confirmed healthy, we roll back to what was last confirmed and quarantine
+// the update, so that it isn't applied again until something newer is
+// published.
+
+const (
+	healthyCloudConfigName = "cloud-healthy.yaml.gz"
+
+	// defaultUnhealthyRollbackWindow is how long a cloud config update can be
+	// reported unhealthy before we roll back from it.
+	defaultUnhealthyRollbackWindow = 15 * time.Minute
+
+	// healthyConfirmations is how many times in a row MarkHealthy has to be
+	// called to confirm that a cloud config is healthy, or that it's healthy
+	// again after being reported unhealthy, so that proxies that come and go
+	// don't have us flapping between configs.
+	healthyConfirmations = 3
+)
+
+var (
+	health   healthState
+	healthMx sync.Mutex
+)
+
+// healthState is whether the last cloud config we applied works.
+type healthState struct {
+	// The cloud config applied last, nil if none was this session
+	url     string
+	etag    string
+	payload []byte
+	fetched time.Time
+
+	confirmed       bool // Whether it was confirmed healthy
+	rolledBack      bool // Whether we rolled back from it
+	healthyStreak   int
+	unhealthySince  time.Time
+	unhealthyReason string
+}
+
+// unhealthyError is why we rolled back from a cloud config.
+type unhealthyError struct {
+	reason string
+	period time.Duration
+}
+
+func (e *unhealthyError) Error() string {
+	return fmt.Sprintf("Reported unhealthy for %v: %v", e.period, e.reason)
+}
+
+// MarkHealthy tells the configuration system that Lantern is able to proxy
+// with the current config. Once it's been called a few times in a row, the
+// current cloud config is kept as the one to roll back to.
+func MarkHealthy() {
+	if m == nil {
+		return
+	}
+	healthMx.Lock()
+	health.healthyStreak++
+	if health.healthyStreak < healthyConfirmations {
+		healthMx.Unlock()
+		return
+	}
+	wasUnhealthy := !health.unhealthySince.IsZero()
+	health.unhealthySince, health.unhealthyReason = time.Time{}, ""
+	confirm := !health.confirmed
+	health.confirmed = true
+	payload, etag, fetched := health.payload, health.etag, health.fetched
+	healthMx.Unlock()
+
+	if wasUnhealthy {
+		log.Debugf("Config is healthy again")
+		updatePollState(func(state *PollState) {
+			state.UnhealthySince = time.Time{}
+			state.UnhealthyReason = ""
+		})
+	}
+	if confirm {
+		confirmHealthy(payload, etag, fetched)
+	}
+}
+
+// MarkUnhealthy tells the configuration system that Lantern isn't able to
+// proxy with the current config, for the given reason. If the current config
+// came from a cloud config update that hasn't been confirmed healthy with
+// MarkHealthy, and it's been reported unhealthy for UnhealthyRollbackWindow,
+// we roll back to the last cloud config that was.
+func MarkUnhealthy(reason string) {
+	if m == nil {
+		return
+	}
+	now := wallClock()
+	window := current().unhealthyRollbackWindow()
+	healthMx.Lock()
+	health.healthyStreak = 0
+	newlyUnhealthy := health.unhealthySince.IsZero()
+	if newlyUnhealthy {
+		health.unhealthySince, health.unhealthyReason = now, reason
+	}
+	since := health.unhealthySince
+	rollBack := health.payload != nil && !health.confirmed && !health.rolledBack &&
+		window >= 0 && now.Sub(since) >= window
+	if rollBack {
+		health.rolledBack = true
+	}
+	url, etag := health.url, health.etag
+	healthMx.Unlock()
+
+	if newlyUnhealthy {
+		log.Debugf("Config reported unhealthy: %v", reason)
+		updatePollState(func(state *PollState) {
+			state.UnhealthySince = since
+			state.UnhealthyReason = reason
+		})
+	}
+	if rollBack {
+		rollBackToHealthy(url, etag, &unhealthyError{reason, now.Sub(since)}, since)
+	}
+}
+
+// cloudConfigApplied records that we applied the given cloud config payload,
+// fetched from the given URL at the given time with the given ETag, which
+// hasn't yet been confirmed healthy.
+func cloudConfigApplied(url string, etag string, payload []byte, fetched time.Time) {
+	healthMx.Lock()
+	wasUnhealthy := !health.unhealthySince.IsZero()
+	health = healthState{url: url, etag: etag, payload: payload, fetched: fetched}
+	healthMx.Unlock()
+	if wasUnhealthy {
+		updatePollState(func(state *PollState) {
+			state.UnhealthySince = time.Time{}
+			state.UnhealthyReason = ""
+		})
+	}
+}
+
+// healthyCloudConfigPath returns the path of the cloud config last confirmed
+// healthy.
+func healthyCloudConfigPath() (string, error) {
+	_, path, err := InConfigDir(healthyCloudConfigName)
+	return path, err
+}
+
+// confirmHealthy keeps the given cloud config payload, fetched at the given
+// time with the given ETag, as the one to roll back to. Without a payload,
+// that's the cached cloud config if it's what the current config was last
+// updated with.
+func confirmHealthy(payload []byte, etag string, fetched time.Time) {
+	if payload == nil {
+		cached, cachedETag, cachedFetched, err := loadCloudCache()
+		if err != nil {
+			log.Debugf("No cloud config to confirm healthy: %v", err)
+			return
+		}
+		flattened, err := flattenDocuments(cached)
+		if err != nil || current().LastMergeChecksum != current().mergeChecksumOf(flattened) {
+			log.Debugf("Cached cloud config isn't the current one, not confirming it healthy")
+			return
+		}
+		payload, etag, fetched = cached, cachedETag, cachedFetched
+	}
+	path, err := healthyCloudConfigPath()
+	if err == nil {
+		err = writeCloudPayload(path, payload, etag, fetched)
+	}
+	if err != nil {
+		log.Errorf("Unable to keep healthy cloud config: %v", err)
+		reportError(PersistError, err, false)
+		return
+	}
+	log.Debugf("Confirmed cloud config %v healthy", etag)
+	revision := current().Revision()
+	updatePollState(func(state *PollState) {
+		state.HealthyETag = etag
+		state.HealthyRevision = revision
+	})
+}
+
+// rollBackToHealthy replaces the cloud settings of the current config with
+// those of the cloud config last confirmed healthy, and quarantines the cloud
+// config with the given ETag fetched from the given URL, which was reported
+// unhealthy since the given time.
+func rollBackToHealthy(url string, etag string, unhealthy *unhealthyError, since time.Time) {
+	path, err := healthyCloudConfigPath()
+	if err != nil {
+		log.Errorf("Unable to find healthy cloud config: %v", err)
+		return
+	}
+	payload, healthyETag, fetched, err := readCloudPayload(path)
+	if os.IsNotExist(err) {
+		log.Debugf("No cloud config was confirmed healthy, not rolling back from %v", etag)
+		return
+	}
+	if err != nil {
+		log.Errorf("Unable to read healthy cloud config: %v", err)
+		reportError(PersistError, err, false)
+		return
+	}
+	log.Debugf("Rolling back from cloud config %v to %v", etag, healthyETag)
+	err = m.Update(func(ycfg yamlconf.Config) error {
+		cfg := ycfg.(*Config)
+		provenance := cfg.CloudProvenance
+		cfg.CloudProvenance = cloudProvenanceRolledBack
+		if err := cfg.updateFrom(payload); err != nil {
+			cfg.CloudProvenance = provenance
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("Unable to roll back to healthy cloud config %v: %v", healthyETag, err)
+		log.Error(err)
+		reportError(HealthError, err, false)
+		return
+	}
+	quarantineCloudConfig(url, etag, unhealthy, since)
+
+	// What we rolled back to is what was confirmed healthy
+	healthMx.Lock()
+	if health.etag == etag {
+		health = healthState{url: url, etag: healthyETag, payload: payload, fetched: fetched, confirmed: true}
+	}
+	healthMx.Unlock()
+	updatePollState(func(state *PollState) {
+		state.UnhealthySince = time.Time{}
+		state.UnhealthyReason = ""
+	})
+}
+
+// unhealthyRollbackWindow returns UnhealthyRollbackWindow, or its default if
+// it's not set.
+func (cfg *Config) unhealthyRollbackWindow() time.Duration {
+	if cfg == nil || cfg.UnhealthyRollbackWindow == 0 {
+		return defaultUnhealthyRollbackWindow
+	}
+	return cfg.UnhealthyRollbackWindow
+}
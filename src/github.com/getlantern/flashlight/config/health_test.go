@@ -0,0 +1,139 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func serversConfig(name string, addr string) string {
+	return "client:\n  chainedservers:\n    " + name + ":\n      addr: " + addr + "\n"
+}
+
+func TestRollBackUnhealthyCloudConfig(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(serversConfig("fallback-1", "1.1.1.1:443"))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	origState := pollState
+	pollState = PollState{}
+	defer func() {
+		pollState = origState
+		health = healthState{}
+	}()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+	downloads := func() int {
+		return srv.Requests() - srv.NotModified()
+	}
+	servers := func() []string {
+		var names []string
+		for name := range current().Client.ChainedServers {
+			names = append(names, name)
+		}
+		return names
+	}
+	markHealthy := func() {
+		for i := 0; i < healthyConfirmations; i++ {
+			MarkHealthy()
+		}
+	}
+
+	poll()
+	markHealthy()
+	healthyETag := DebugState().HealthyETag
+	assert.NotEmpty(t, healthyETag, "Working config should have been confirmed healthy")
+	assert.Equal(t, current().Revision(), DebugState().HealthyRevision)
+
+	// An update whose servers don't work
+	srv.SetConfig(serversConfig("fallback-2", "2.2.2.2:443"))
+	poll()
+	assert.Equal(t, []string{"fallback-2"}, servers())
+	MarkUnhealthy("all proxies failing")
+	since := DebugState().UnhealthySince
+	assert.False(t, since.IsZero())
+
+	// Proxies that come and go don't end the unhealthy spell
+	MarkHealthy()
+	MarkHealthy()
+	MarkUnhealthy("all proxies failing again")
+	assert.Equal(t, since, DebugState().UnhealthySince, "Healthy reports should have to be sustained")
+	assert.Equal(t, "all proxies failing", DebugState().UnhealthyReason)
+	assert.Equal(t, []string{"fallback-2"}, servers(), "Should wait out the window before rolling back")
+
+	restoreClock := useWallClock(defaultUnhealthyRollbackWindow + time.Minute)
+	MarkUnhealthy("all proxies failing still")
+	restoreClock()
+	assert.Equal(t, []string{"fallback-1"}, servers(), "Should have rolled back to healthy config")
+	assert.Equal(t, cloudProvenanceRolledBack, current().CloudProvenance)
+	state := DebugState()
+	assert.NotEmpty(t, state.QuarantinedETag, "Unhealthy config should have been quarantined")
+	assert.NotEqual(t, healthyETag, state.QuarantinedETag)
+	assert.True(t, state.UnhealthySince.IsZero())
+	if assert.NotEmpty(t, *collected) {
+		assert.Equal(t, HealthError, (*collected)[len(*collected)-1].Category)
+	}
+
+	// The unhealthy config isn't applied again
+	before := downloads()
+	poll()
+	assert.Equal(t, before, downloads(), "Unhealthy config should not have been downloaded again")
+	assert.Equal(t, []string{"fallback-1"}, servers())
+	MarkUnhealthy("still failing after rollback")
+	restoreClock = useWallClock(2 * defaultUnhealthyRollbackWindow)
+	MarkUnhealthy("still failing after rollback")
+	restoreClock()
+	assert.Equal(t, []string{"fallback-1"}, servers(), "Should not roll back from a healthy config")
+
+	// A new publish is applied and recovers
+	srv.SetConfig(serversConfig("fallback-3", "3.3.3.3:443"))
+	poll()
+	assert.Equal(t, []string{"fallback-3"}, servers())
+	state = DebugState()
+	assert.Empty(t, state.QuarantinedETag, "New publish should have ended the quarantine")
+	assert.True(t, state.UnhealthySince.IsZero(), "New publish should get a fresh start")
+	markHealthy()
+	state = DebugState()
+	assert.NotEqual(t, healthyETag, state.HealthyETag, "New publish should have been confirmed healthy")
+	assert.Equal(t, state.LastETag, state.HealthyETag)
+}
+
+func TestNoRollBackWithoutHealthyConfig(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(serversConfig("fallback-1", "1.1.1.1:443"))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	defer func() {
+		health = healthState{}
+	}()
+
+	mutate, _, err := pollForConfig(current())
+	if !assert.NoError(t, err) || !assert.NoError(t, m.Update(mutate)) {
+		return
+	}
+	MarkUnhealthy("all proxies failing")
+	defer useWallClock(defaultUnhealthyRollbackWindow + time.Minute)()
+	MarkUnhealthy("all proxies failing")
+	assert.NotNil(t, current().Client.ChainedServers["fallback-1"], "Nothing to roll back to")
+	assert.Empty(t, DebugState().QuarantinedETag)
+}
@@ -0,0 +1,422 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getlantern/yaml"
+)
+
+const (
+	historyName = "config-history.jsonl"
+
+	// historySnapshotsName is the directory in the config dir where we keep
+	// the cloud configs applied by the changes in the history, named by their
+	// checksum, for Diff.
+	historySnapshotsName = "config-history"
+
+	// Sources of changes to the config
+	historySourceCloud     = "cloud"
+	historySourceUpdate    = "update"
+	historySourceMigration = "migration"
+
+	// maxPendingHistory is how many entries we buffer for writing before
+	// dropping the oldest ones.
+	maxPendingHistory = 100
+)
+
+var (
+	// maxHistorySize is how big the history file gets before we rotate it.
+	maxHistorySize int64 = 1024 * 1024
+
+	// maxHistoryAge is how long we keep history for.
+	maxHistoryAge = 30 * 24 * time.Hour
+
+	// maxHistorySnapshots is how many of the cloud configs in the history we
+	// keep for Diff. Cloud configs can be big, so we keep fewer of them than
+	// history entries.
+	maxHistorySnapshots = 50
+
+	history = &historyLog{wake: make(chan struct{}, 1)}
+)
+
+// HistoryEntry is a record of a change to the config.
+type HistoryEntry struct {
+	Time          time.Time
+	Source        string // What changed the config: cloud, update or migration
+	Provenance    string `json:",omitempty"` // For cloud changes, where the cloud settings came from
+	Version       int    `json:",omitempty"`
+	SchemaVersion int    `json:",omitempty"`
+	Diff          string // Summary of the change, with secrets redacted
+	URL           string `json:",omitempty"` // For fetched cloud changes, the cloud config URL
+	ETag          string `json:",omitempty"` // For fetched cloud changes, the ETag of the cloud config
+	Snapshot      string `json:",omitempty"` // For fetched cloud changes, the checksum of the cloud config, see Diff
+
+	// The cloud config to keep as the snapshot
+	payload []byte
+
+	// Where to write the entry and its snapshot, resolved when it's recorded
+	// so that a write in the background goes where the config was at the time
+	file         string
+	snapshotFile string
+}
+
+// cloudSource is where a fetched cloud config came from.
+type cloudSource struct {
+	url     string
+	etag    string
+	payload []byte
+}
+
+// snapshotID identifies a cloud config payload in the history.
+func snapshotID(payload []byte) string {
+	checksum := sha256.Sum256(payload)
+	return hex.EncodeToString(checksum[:])
+}
+
+// Diff returns how the cloud config applied by history entry b differs from
+// the one applied by history entry a, for example to see what changed between
+// two cloud pushes. Both must be fetched cloud changes whose cloud configs we
+// still keep, which are the most recent 50 that are no older than 30 days.
+func Diff(a *HistoryEntry, b *HistoryEntry) (*ConfigDiff, error) {
+	before, err := historySnapshot(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := historySnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	return newConfigDiff(before, after)
+}
+
+// historySnapshot reads the cloud config applied by the given history entry,
+// with secrets redacted.
+func historySnapshot(entry *HistoryEntry) (*Config, error) {
+	if entry == nil || entry.Snapshot == "" {
+		return nil, fmt.Errorf("No cloud config kept for config change")
+	}
+	if id, err := hex.DecodeString(entry.Snapshot); err != nil || len(id) != sha256.Size {
+		return nil, fmt.Errorf("Invalid config history snapshot %q", entry.Snapshot)
+	}
+	path, err := historySnapshotPath(entry.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	payload, _, _, err := readCloudPayload(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Cloud config for config change at %v is no longer kept", entry.Time)
+	}
+	if err != nil {
+		return nil, err
+	}
+	flattened, err := flattenDocuments(payload)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(flattened, cfg); err != nil {
+		return nil, fmt.Errorf("Unable to parse cloud config %v: %v", entry.Snapshot, err)
+	}
+	return cfg.redactedCopy()
+}
+
+func historySnapshotPath(id string) (string, error) {
+	_, dir, err := InConfigDir(historySnapshotsName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".yaml.gz"), nil
+}
+
+// History returns up to limit of the most recent changes to the config that
+// are no older than 30 days, newest first, for example for diagnostics.
+// Entries that can't be parsed are skipped.
+func History(limit int) ([]*HistoryEntry, error) {
+	if err := history.flush(); err != nil {
+		log.Errorf("Unable to write config history: %v", err)
+	}
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-1 * maxHistoryAge)
+	var entries []*HistoryEntry
+	for _, file := range []string{path + ".1", path} {
+		read, err := readHistory(file, cutoff)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+func historyPath() (string, error) {
+	_, path, err := InConfigDir(historyName)
+	return path, err
+}
+
+// readHistory reads the entries in the given history file that are newer than
+// cutoff, oldest first.
+func readHistory(path string, cutoff time.Time) ([]*HistoryEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			log.Debugf("Skipping corrupt config history entry in %v: %v", path, err)
+			continue
+		}
+		if entry.Time.After(cutoff) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// recordHistory records a change to the config in the history. The change is
+// written in the background so that it doesn't hold up updates.
+func recordHistory(entry *HistoryEntry) {
+	if readOnly {
+		// The history belongs to the Lantern that owns the config
+		return
+	}
+	history.record(entry)
+}
+
+// flushHistory writes any changes that haven't been written to the history
+// yet, waiting for any write that's already in progress in the background.
+func flushHistory() {
+	if err := history.flush(); err != nil {
+		log.Errorf("Unable to write config history: %v", err)
+	}
+}
+
+// historyLog buffers history entries and appends them to the history file in
+// the background.
+type historyLog struct {
+	pending   []*HistoryEntry
+	wake      chan struct{}
+	startOnce sync.Once
+	mx        sync.Mutex
+	writeMx   sync.Mutex
+}
+
+func (h *historyLog) record(entry *HistoryEntry) {
+	file, err := historyPath()
+	if err != nil {
+		log.Errorf("Unable to record config history: %v", err)
+		return
+	}
+	entry.file = file
+	if entry.payload != nil {
+		entry.snapshotFile, err = historySnapshotPath(entry.Snapshot)
+		if err != nil {
+			log.Errorf("Unable to record config history: %v", err)
+			return
+		}
+	}
+	h.startOnce.Do(func() {
+		go h.run()
+	})
+	h.mx.Lock()
+	if len(h.pending) == maxPendingHistory {
+		log.Debugf("Too much pending config history, dropping oldest entry")
+		h.pending = h.pending[1:]
+	}
+	h.pending = append(h.pending, entry)
+	h.mx.Unlock()
+	select {
+	case h.wake <- struct{}{}:
+	default:
+		// Already woken
+	}
+}
+
+func (h *historyLog) run() {
+	for range h.wake {
+		if err := h.flush(); err != nil {
+			log.Errorf("Unable to write config history: %v", err)
+		}
+	}
+}
+
+func (h *historyLog) flush() error {
+	h.writeMx.Lock()
+	defer h.writeMx.Unlock()
+	h.mx.Lock()
+	entries := h.pending
+	h.pending = nil
+	h.mx.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Entries recorded against different config dirs go to different files
+	for len(entries) > 0 {
+		n := 1
+		for n < len(entries) && entries[n].file == entries[0].file {
+			n++
+		}
+		if err := writeHistory(entries[0].file, entries[:n]); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// writeHistory appends the given entries to the history file at path.
+func writeHistory(path string, entries []*HistoryEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("Unable to encode config history: %v", err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if err := rotateHistory(path, time.Now()); err != nil {
+		log.Errorf("Unable to rotate config history: %v", err)
+	}
+	if err := appendHistory(path, buf.Bytes()); err != nil {
+		return err
+	}
+	return keepHistorySnapshots(entries, time.Now())
+}
+
+// keepHistorySnapshots saves the cloud configs applied by the given entries
+// and prunes the ones that are too old or beyond maxHistorySnapshots.
+func keepHistorySnapshots(entries []*HistoryEntry, now time.Time) error {
+	var dir string
+	for _, entry := range entries {
+		if entry.payload == nil {
+			continue
+		}
+		path := entry.snapshotFile
+		dir = filepath.Dir(path)
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return fmt.Errorf("Unable to create config history snapshots dir: %v", err)
+		}
+		// Saving it again if we already have it marks it as recently applied
+		if err := writeCloudPayload(path, entry.payload, entry.ETag, entry.Time); err != nil {
+			return err
+		}
+	}
+	if dir == "" {
+		return nil
+	}
+	return pruneHistorySnapshots(dir, now)
+}
+
+// pruneHistorySnapshots removes the snapshots in dir that are older than
+// maxHistoryAge, along with the oldest ones beyond maxHistorySnapshots.
+func pruneHistorySnapshots(dir string, now time.Time) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	cutoff := now.Add(-1 * maxHistoryAge)
+	for i, info := range infos {
+		if i < maxHistorySnapshots && info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateHistory moves the history file at path aside once it's too big or its
+// oldest entry is too old, and removes the history moved aside previously once
+// it's entirely too old.
+func rotateHistory(path string, now time.Time) error {
+	cutoff := now.Add(-1 * maxHistoryAge)
+	rotated := path + ".1"
+	if info, err := os.Stat(rotated); err == nil && info.ModTime().Before(cutoff) {
+		if err := os.Remove(rotated); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < maxHistorySize && !oldestHistoryBefore(path, cutoff) {
+		return nil
+	}
+	log.Debugf("Rotating config history at %v", path)
+	return os.Rename(path, rotated)
+}
+
+// oldestHistoryBefore returns whether the first entry in the history file at
+// path is from before cutoff.
+func oldestHistoryBefore(path string, cutoff time.Time) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	entry := &HistoryEntry{}
+	if err := json.Unmarshal(line, entry); err != nil {
+		return false
+	}
+	return entry.Time.Before(cutoff)
+}
+
+// appendHistory appends the given lines to the history file at path, starting
+// on a new line if the file was left with a partial one.
+func appendHistory(path string, lines []byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to open config history: %v", err)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			lines = append([]byte{'\n'}, lines...)
+		}
+	}
+	if _, err := file.Write(lines); err != nil {
+		return fmt.Errorf("Unable to write config history: %v", err)
+	}
+	return nil
+}
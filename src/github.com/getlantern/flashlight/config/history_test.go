@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryRecordsChanges(t *testing.T) {
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\nautoreport: true\n")()
+	defer useTestFetcher()()
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		autoReport := false
+		cfg.AutoReport = &autoReport
+		return nil
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write(gzipped(t, "client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n      authtoken: secret\n"))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+
+	entries, err := History(2)
+	if !assert.NoError(t, err) || !assert.Len(t, entries, 2) {
+		return
+	}
+	assert.Equal(t, historySourceCloud, entries[0].Source, "Newest entry should come first")
+	assert.Equal(t, cloudProvenanceFetched, entries[0].Provenance)
+	assert.Contains(t, entries[0].Diff, "cloud-1")
+	assert.NotContains(t, entries[0].Diff, "secret")
+	assert.Equal(t, historySourceUpdate, entries[1].Source)
+	assert.Equal(t, "fields [AutoReport: true -> false]", entries[1].Diff)
+}
+
+func TestHistoryRotation(t *testing.T) {
+	defer useTempConfigDir(t)()
+	origSize, origAge := maxHistorySize, maxHistoryAge
+	defer func() {
+		maxHistorySize, maxHistoryAge = origSize, origAge
+	}()
+	maxHistorySize = 300
+
+	path, err := historyPath()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 6; i++ {
+		history.record(&HistoryEntry{Time: time.Now(), Source: historySourceUpdate, Diff: fmt.Sprintf("change %d", i)})
+		assert.NoError(t, history.flush())
+	}
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.True(t, info.Size() < maxHistorySize, "History should have been rotated")
+	}
+	_, err = os.Stat(path + ".1")
+	assert.NoError(t, err, "Rotated history should be kept")
+	entries, err := History(3)
+	if assert.NoError(t, err) && assert.Len(t, entries, 3) {
+		assert.Equal(t, "change 5", entries[0].Diff)
+		assert.Equal(t, "change 3", entries[2].Diff, "History should span rotated files")
+	}
+
+	// Rotated history that's too old is dropped, as are old entries
+	old := time.Now().Add(-2 * maxHistoryAge)
+	assert.NoError(t, os.Chtimes(path+".1", old, old))
+	history.record(&HistoryEntry{Time: old, Source: historySourceUpdate, Diff: "old change"})
+	assert.NoError(t, history.flush())
+	_, err = os.Stat(path + ".1")
+	assert.True(t, os.IsNotExist(err), "Old rotated history should have been removed")
+	entries, err = History(0)
+	if assert.NoError(t, err) {
+		for _, entry := range entries {
+			assert.NotEqual(t, "old change", entry.Diff, "Old entries should be skipped")
+		}
+	}
+}
+
+func TestHistoryWrittenWhereRecorded(t *testing.T) {
+	defer useTempConfigDir(t)()
+	path, err := historyPath()
+	if !assert.NoError(t, err) {
+		return
+	}
+	history.record(&HistoryEntry{Time: time.Now(), Source: historySourceUpdate, Diff: "change"})
+	defer useTempConfigDir(t)()
+
+	flushHistory()
+	entries, err := readHistory(path, time.Time{})
+	if assert.NoError(t, err, "History should be written to the config dir it was recorded in") && assert.Len(t, entries, 1) {
+		assert.Equal(t, "change", entries[0].Diff)
+	}
+	entries, err = History(0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, entries, "History should not follow the config dir")
+	}
+}
+
+func TestCorruptHistoryIgnored(t *testing.T) {
+	defer initTestConfig(t, "autoreport: true\n")()
+	path, err := historyPath()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte("{\"Time\": not json"), 0644)) {
+		return
+	}
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		autoReport := false
+		cfg.AutoReport = &autoReport
+		return nil
+	}), "Corrupt history should not keep config from being updated")
+	assert.False(t, *current().AutoReport)
+	entries, err := History(10)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "fields [AutoReport: true -> false]", entries[0].Diff)
+	}
+}
+
+func TestHistoryDiff(t *testing.T) {
+	defer initTestConfig(t, "")()
+	defer useTestFetcher()()
+
+	var yml string
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set(etag, snapshotID([]byte(yml)))
+		resp.Write(gzipped(t, yml))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+	for _, next := range []string{serversConfig("cloud-1", "1.1.1.1:443"), serversConfig("cloud-2", "2.2.2.2:443")} {
+		yml = next
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) || !assert.NoError(t, m.Update(mutate)) {
+			return
+		}
+	}
+
+	entries, err := History(2)
+	if !assert.NoError(t, err) || !assert.Len(t, entries, 2) {
+		return
+	}
+	newer, older := entries[0], entries[1]
+	assert.Equal(t, current().cloudConfigURLs()[0], newer.URL)
+	assert.Equal(t, newer.Snapshot, newer.ETag)
+	assert.NotEqual(t, older.Snapshot, newer.Snapshot)
+	diff, err := Diff(older, newer)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"cloud-2"}, diff.AddedServers)
+		assert.Equal(t, []string{"cloud-1"}, diff.RemovedServers)
+	}
+
+	_, err = Diff(older, &HistoryEntry{Source: historySourceUpdate})
+	assert.Error(t, err, "Changes without a cloud config can't be diffed")
+	path, _ := historySnapshotPath(older.Snapshot)
+	assert.NoError(t, os.Remove(path))
+	_, err = Diff(older, newer)
+	assert.Error(t, err, "Pruned cloud configs can't be diffed")
+	_, err = Diff(&HistoryEntry{Snapshot: "../config"}, newer)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	jitter = newPollJitter(randomSeed())
+)
+
+// pollJitter randomizes how long we wait between polls for cloud config, so
+// that clients don't poll in lockstep. It has its own source of randomness,
+// seeded per process, since clients that started at the same time with the
+// default seed of math/rand would wait for the same times, hitting the CDN
+// together after something like an auto-update wave restarts them all. For
+// the same reason, the first wait after startup is anywhere up to the full
+// poll interval, while later waits are between half and one and a half times
+// the interval.
+type pollJitter struct {
+	rnd       *rand.Rand
+	scheduled bool
+	mx        sync.Mutex
+}
+
+func newPollJitter(seed int64) *pollJitter {
+	return &pollJitter{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// sleepTime returns how long to wait before polling again given the poll
+// interval.
+func (j *pollJitter) sleepTime(interval time.Duration) time.Duration {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	if interval <= 0 {
+		return 0
+	}
+	if !j.scheduled {
+		j.scheduled = true
+		return time.Duration(j.rnd.Int63n(interval.Nanoseconds()))
+	}
+	return time.Duration((interval.Nanoseconds() / 2) + j.rnd.Int63n(interval.Nanoseconds()))
+}
+
+// randomSeed returns a seed for pollJitter that differs between processes
+// even if they started at the same time.
+func randomSeed() int64 {
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		log.Errorf("Unable to seed poll jitter randomly, using time: %v", err)
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(b[:]))
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useJitterSeed makes poll times random with the given seed, as if we had just
+// started. It returns a function that restores the original jitter.
+func useJitterSeed(seed int64) func() {
+	orig := jitter
+	jitter = newPollJitter(seed)
+	return func() {
+		jitter = orig
+	}
+}
+
+func TestPollScheduleReproducible(t *testing.T) {
+	schedule := func(seed int64) []time.Duration {
+		j := newPollJitter(seed)
+		sleeps := make([]time.Duration, 20)
+		for i := range sleeps {
+			sleeps[i] = j.sleepTime(time.Hour)
+		}
+		return sleeps
+	}
+	assert.Equal(t, schedule(42), schedule(42), "Same seed should give same schedule")
+	assert.NotEqual(t, schedule(42), schedule(43), "Different seeds should give different schedules")
+	assert.NotEqual(t, randomSeed(), randomSeed())
+}
+
+func TestFirstPollSpread(t *testing.T) {
+	const (
+		clients  = 10000
+		interval = time.Hour
+		buckets  = 10
+	)
+	counts := make([]int, buckets)
+	for seed := int64(0); seed < clients; seed++ {
+		sleep := newPollJitter(seed).sleepTime(interval)
+		if !assert.True(t, sleep >= 0 && sleep < interval, "First sleep %v should be within the interval", sleep) {
+			return
+		}
+		counts[int(sleep*buckets/interval)]++
+	}
+	// Each tenth of the interval should get about a tenth of the clients,
+	// which with this many clients is very unlikely to be off by a fifth
+	for i, count := range counts {
+		assert.InDelta(t, clients/buckets, count, clients/buckets/5, "Bucket %d has %d of %d first polls", i, count, clients)
+	}
+}
+
+func TestDebugStateShowsNextPoll(t *testing.T) {
+	defer initTestConfig(t, "cloudpollinterval: 600000000000\n")()
+	defer useTestFetcher()()
+	defer useJitterSeed(7)()
+	origState := pollState
+	pollState = PollState{}
+	defer func() {
+		pollState = origState
+	}()
+	before := time.Now()
+
+	// Even polls that fetch nothing are scheduled
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.CloudConfigs = nil
+		return nil
+	}))
+	_, waitTime, err := pollForConfig(current())
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The default cloud config URL can't be reached, so the poll backs off
+	expected := newPollJitter(7)
+	expected.sleepTime(10 * time.Minute)
+	assert.Equal(t, expected.sleepTime(20*time.Minute), waitTime)
+	state := DebugState()
+	assert.Equal(t, waitTime, state.Backoff)
+	assert.False(t, state.NextPoll.Before(before.Add(waitTime)))
+	assert.False(t, state.NextPoll.After(time.Now().Add(waitTime)))
+}
+
+func TestPollBacksOffOnFailures(t *testing.T) {
+	defer useTestFetcher()()
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if failing {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.Write(gzipped(t, serversConfig("fallback-1", "1.1.1.1:443")))
+	}))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.URL + "/cloud.yaml.gz",
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudpollinterval: 60000000000\ncloudconfigs:\n- "+srv.URL+"/cloud.yaml.gz\n")()
+	defer useJitterSeed(7)()
+
+	backoff := time.Minute
+	for i := 1; i <= 3; i++ {
+		backoff *= 2
+		mutate, waitTime, err := pollForConfig(current())
+		if !assert.NoError(t, err) || !assert.NoError(t, m.Update(mutate)) {
+			return
+		}
+		assert.True(t, waitTime >= backoff/2 && waitTime < backoff*3/2, "Wait after %d failures should be around %v, not %v", i, backoff, waitTime)
+	}
+	_, waitTime, _ := pollForConfig(current())
+	assert.True(t, waitTime >= backoff/2, "Should keep backing off while the circuit is open, not wait %v", waitTime)
+
+	waitTime = current().cloudPollBackoffTime(20)
+	assert.True(t, waitTime >= maxCloudPollBackoff/2 && waitTime < maxCloudPollBackoff*3/2, "Backoff should be capped, not %v", waitTime)
+
+	failing = false
+	circuits = newCircuitBreaker()
+	mutate, waitTime, err := pollForConfig(current())
+	if assert.NoError(t, err) && assert.NoError(t, m.Update(mutate)) {
+		assert.True(t, waitTime < 90*time.Second, "Success should reset backoff, not wait %v", waitTime)
+	}
+	assert.Equal(t, 0, failedPolls)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/getlantern/deepcopy"
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// localOverridesName is the name of the optional file in the config dir
+	// with settings that take precedence over everything else we're told.
+	// We only ever read it.
+	localOverridesName = "lantern-local.yaml"
+)
+
+var (
+	// The local overrides file, watched for changes
+	localOverridesFile *yamlconf.FileStore
+	// Closed to stop watching the local overrides file
+	stopWatchingLocalOverrides chan struct{}
+)
+
+// localOverridesPath returns the path of the local overrides file.
+func localOverridesPath() (string, error) {
+	_, path, err := InConfigDir(localOverridesName)
+	return path, err
+}
+
+// loadLocalOverrides returns the contents of the local overrides file, or nil
+// if there isn't one.
+func loadLocalOverrides() ([]byte, error) {
+	path, err := localOverridesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// applyLocalOverrides overlays the local overrides file, if there is one, onto
+// this Config. Maps in the overrides are merged into ours by key, while other
+// fields replace ours. Since merging cloud config replaces our servers
+// wholesale, this is applied again after every updateFrom. Overrides that
+// can't be read or parsed are reported and ignored.
+func (cfg *Config) applyLocalOverrides() {
+	data, err := loadLocalOverrides()
+	if err != nil {
+		log.Errorf("Unable to read local overrides: %v", err)
+		reportError(PersistError, err, false)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	// Overlay a copy so that a bad file doesn't leave us half overridden
+	overlaid := &Config{}
+	if err := deepcopy.Copy(overlaid, cfg); err != nil {
+		log.Errorf("Unable to copy config to apply local overrides: %v", err)
+		return
+	}
+	if err := yaml.Unmarshal(data, overlaid); err != nil {
+		err = fmt.Errorf("Ignoring local overrides: %v", err)
+		log.Error(err)
+		reportError(ParseError, err, false)
+		return
+	}
+	// Servers from the overrides need defaults like any others
+	if overlaid.Client != nil {
+		overlaid.applyServerInfoDefaults()
+	}
+	logLocalOverrides(cfg, overlaid)
+	*cfg = *overlaid
+}
+
+// logLocalOverrides logs the fields where the local overrides won over what
+// we had, with secrets masked.
+func logLocalOverrides(before *Config, after *Config) {
+	redactedBefore, err := before.redactedCopy()
+	if err != nil {
+		return
+	}
+	redactedAfter, err := after.redactedCopy()
+	if err != nil {
+		return
+	}
+	diff, err := diffConfigs(redactedBefore, redactedAfter)
+	if err != nil {
+		log.Errorf("Unable to diff local overrides: %v", err)
+		return
+	}
+	for _, change := range diff {
+		log.Debugf("Local override: %v", change)
+	}
+}
+
+// watchLocalOverrides watches the local overrides file, applying it again
+// whenever it changes, until unwatchLocalOverrides is called.
+func watchLocalOverrides() {
+	unwatchLocalOverrides()
+	path, err := localOverridesPath()
+	if err != nil {
+		log.Errorf("Unable to watch local overrides: %v", err)
+		return
+	}
+	last, _ := loadLocalOverrides()
+	localOverridesFile = yamlconf.NewFileStore(path)
+	localOverridesFile.PollInterval = current().filePollInterval()
+	stop := make(chan struct{})
+	stopWatchingLocalOverrides = stop
+	changed := localOverridesFile.Watch()
+	go func() {
+		for {
+			select {
+			case <-changed:
+			case <-stop:
+				return
+			}
+			data, err := loadLocalOverrides()
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			log.Debugf("Local overrides changed, applying them")
+			if err := update(func(cfg *Config) error {
+				cfg.applyLocalOverrides()
+				return nil
+			}, false); err != nil {
+				log.Errorf("Unable to apply local overrides: %v", err)
+			}
+		}
+	}()
+}
+
+// unwatchLocalOverrides stops watching the local overrides file.
+func unwatchLocalOverrides() {
+	if localOverridesFile == nil {
+		return
+	}
+	close(stopWatchingLocalOverrides)
+	localOverridesFile.Close()
+	localOverridesFile = nil
+}
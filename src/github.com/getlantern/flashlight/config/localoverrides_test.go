@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalOverridesSurviveCloudUpdates(t *testing.T) {
+	defer initTestConfig(t, "cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")()
+	defer useTestFetcher()()
+
+	path, err := localOverridesPath()
+	if !assert.NoError(t, err) {
+		return
+	}
+	local := "uiaddr: 127.0.0.1:1234\nclient:\n  chainedservers:\n    local-1:\n      addr: 9.9.9.9:443\n"
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(local), 0644)) {
+		return
+	}
+
+	update := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write(gzipped(t, fmt.Sprintf("uiaddr: 127.0.0.1:%d\nclient:\n  chainedservers:\n    cloud-%d:\n      addr: 1.1.1.%d:443\n", 5000+update, update, update)))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+
+	for update = 1; update <= 3; update++ {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, m.Update(mutate))
+		cfg := current()
+		if assert.NotNil(t, cfg.Client.ChainedServers["local-1"], "Local server should survive cloud update %d", update) {
+			assert.Equal(t, "9.9.9.9:443", cfg.Client.ChainedServers["local-1"].Addr)
+			assert.Equal(t, defaultServerWeight, cfg.Client.ChainedServers["local-1"].Weight, "Local server should have defaults applied")
+		}
+		assert.NotNil(t, cfg.Client.ChainedServers[fmt.Sprintf("cloud-%d", update)], "Cloud servers should be merged with local ones")
+		assert.Equal(t, "127.0.0.1:1234", cfg.UIAddr, "Local settings should win over cloud ones")
+	}
+}
+
+func TestBadLocalOverridesIgnored(t *testing.T) {
+	defer useTempConfigDir(t)()
+	reported, stop := collectErrors()
+	defer stop()
+
+	path, err := localOverridesPath()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte("uiaddr: 127.0.0.1:1234\nclient: [\n"), 0644)) {
+		return
+	}
+	cfg := &Config{UIAddr: "127.0.0.1:5000"}
+	cfg.applyLocalOverrides()
+	assert.Equal(t, "127.0.0.1:5000", cfg.UIAddr, "Unparseable overrides should not be applied at all")
+	assert.Contains(t, categoriesOf(*reported), ParseError)
+}
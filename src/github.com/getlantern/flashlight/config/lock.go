@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// lockFileName is the name of the file in the config dir that the Lantern
+	// using the config holds a lock on.
+	lockFileName = "lantern.lock"
+)
+
+var (
+	// ErrAlreadyRunning is returned by Init when another Lantern is already
+	// using the config dir, unless WithReadOnlyIfRunning is given.
+	ErrAlreadyRunning = errors.New("Another Lantern is already using the config")
+
+	// errLocked is returned by lockFile when another file handle holds the
+	// lock.
+	errLocked = errors.New("File is locked")
+
+	// The lock we hold on the config dir, if any
+	heldLock *os.File
+	// Whether we're using a config that another Lantern owns
+	readOnly bool
+)
+
+// WithReadOnlyIfRunning makes Init use the config read-only, without polling
+// for cloud config or saving changes, if another Lantern is already using it,
+// instead of returning ErrAlreadyRunning.
+func WithReadOnlyIfRunning() Option {
+	return func(o *options) {
+		o.readOnlyIfRunning = true
+	}
+}
+
+// ReadOnly returns whether we're using the config read-only because another
+// Lantern is using it, in which case we don't poll for cloud config and
+// changes last only for the session.
+func ReadOnly() bool {
+	return readOnly
+}
+
+// lockConfig locks the config dir so that only we use the config in it. If
+// another Lantern holds the lock, we use the config read-only if
+// readOnlyIfRunning is true or return ErrAlreadyRunning otherwise. Failing to
+// lock for other reasons, like a read-only config dir, isn't fatal.
+func lockConfig(readOnlyIfRunning bool) error {
+	unlockConfigDir()
+	dir, _, err := InConfigDir("")
+	if err != nil {
+		// newFileStore reports this
+		return nil
+	}
+	lock, err := lockConfigDir(dir)
+	switch {
+	case err == nil:
+		heldLock = lock
+	case err == ErrAlreadyRunning && readOnlyIfRunning:
+		log.Debug("Another Lantern is using the config, using it read-only")
+		readOnly = true
+	case err == ErrAlreadyRunning:
+		return err
+	default:
+		log.Errorf("Unable to lock config, continuing without lock: %v", err)
+	}
+	return nil
+}
+
+// lockConfigDir takes an advisory lock on the lock file in the given config
+// dir, recording our PID in it, so that two Lanterns don't write the same
+// config. If the lock is held by a process that's no longer running, like
+// one that crashed on a file system that doesn't release locks when that
+// happens, the lock is broken. It returns ErrAlreadyRunning if a running
+// process holds the lock.
+func lockConfigDir(dir string) (*os.File, error) {
+	path := filepath.Join(dir, lockFileName)
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open lock file: %v", err)
+		}
+		err = lockFile(file)
+		if err == nil {
+			if err := file.Truncate(0); err != nil {
+				log.Errorf("Unable to clear lock file: %v", err)
+			} else if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+				log.Errorf("Unable to record PID in lock file: %v", err)
+			}
+			return file, nil
+		}
+		file.Close()
+		if err != errLocked {
+			return nil, fmt.Errorf("Unable to lock %v: %v", path, err)
+		}
+		pid := lockHolder(path)
+		if pid <= 0 || processAlive(pid) {
+			return nil, ErrAlreadyRunning
+		}
+		log.Debugf("Breaking stale lock on config held by process %d, which isn't running", pid)
+		if err := os.Remove(path); err != nil {
+			// Somebody else is holding it after all
+			return nil, ErrAlreadyRunning
+		}
+	}
+}
+
+// lockHolder returns the PID recorded in the lock file at the given path, or
+// zero if there isn't one.
+func lockHolder(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// unlockConfigDir releases our lock on the config dir, if we hold one.
+func unlockConfigDir() {
+	if heldLock == nil {
+		return
+	}
+	if err := heldLock.Close(); err != nil {
+		log.Errorf("Unable to release lock on config: %v", err)
+	}
+	heldLock = nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+// lockAsOtherLantern locks the given config dir the way another Lantern using
+// it would.
+func lockAsOtherLantern(t *testing.T, dir string) {
+	other, err := lockConfigDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+}
+
+func TestInitRefusedWhenAlreadyRunning(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+	lockAsOtherLantern(t, dir)
+
+	_, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	assert.Equal(t, ErrAlreadyRunning, err)
+	_, err = os.Stat(filepath.Join(dir, configFileName("2.1.0")))
+	assert.True(t, os.IsNotExist(err), "Config file shouldn't have been touched")
+}
+
+func TestInitReadOnlyIfRunning(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	srv := configtest.NewCloudConfigServer("client:\n  chainedservers:\n    cloud-1:\n      addr: 1.1.1.1:443\n")
+	defer srv.Close()
+	dir := t.TempDir()
+	lockAsOtherLantern(t, dir)
+
+	cfg, err := Init("2.1.0",
+		WithConfigDir(dir),
+		WithReadOnlyIfRunning(),
+		WithCloudConfigURLs(srv.ConfigURL(), ""),
+		WithPollIntervals(10*time.Millisecond, 10*time.Millisecond),
+		WithBootstrapServers(noBootstrapServers),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, ReadOnly())
+	assert.NotNil(t, cfg.Client, "Should have used the packaged config")
+
+	StartPolling()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, srv.Requests(), "Shouldn't have polled for cloud config")
+	Stop()
+	assert.False(t, ReadOnly())
+	files, err := ioutil.ReadDir(dir)
+	if assert.NoError(t, err) {
+		for _, file := range files {
+			assert.Equal(t, lockFileName, file.Name(), "Nothing but the lock should be in the config dir")
+		}
+	}
+}
+
+func TestStopReleasesLock(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+
+	_, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, ReadOnly())
+	_, err = lockConfigDir(dir)
+	assert.Equal(t, ErrAlreadyRunning, err, "Config dir should be locked while running")
+	assert.Equal(t, os.Getpid(), lockHolder(filepath.Join(dir, lockFileName)))
+
+	Stop()
+	lock, err := lockConfigDir(dir)
+	if assert.NoError(t, err, "Config dir should be unlocked after stopping") {
+		lock.Close()
+	}
+}
+
+func TestStaleLockIsBroken(t *testing.T) {
+	dir := t.TempDir()
+	stale, err := lockConfigDir(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stale.Close()
+	// The lock is still held, as on file systems that don't release the locks
+	// of crashed processes, but by a process that's gone
+	if err := ioutil.WriteFile(filepath.Join(dir, lockFileName), []byte("2147483646"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lockConfigDir(dir)
+	if assert.NoError(t, err, "Stale lock should have been broken") {
+		defer lock.Close()
+		assert.Equal(t, os.Getpid(), lockHolder(filepath.Join(dir, lockFileName)))
+	}
+}
@@ -0,0 +1,25 @@
+// +build !windows
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on the given file without
+// waiting, returning errLocked if it's already locked.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLocked
+	}
+	return err
+}
+
+// processAlive returns whether the process with the given PID is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means that it's running as somebody else
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+	stillActive             = 259
+	processQueryLimitedInfo = 0x1000
+)
+
+var (
+	procLockFileEx = kernel32.NewProc("LockFileEx")
+)
+
+// lockFile takes an exclusive lock on the first byte of the given file
+// without waiting, returning errLocked if it's already locked.
+func lockFile(file *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return errLocked
+	}
+	return err
+}
+
+// processAlive returns whether the process with the given PID is running.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInfo, false, uint32(pid))
+	if err != nil {
+		// Access is denied to processes of other users, which are running
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// lockedFieldsName is the name of the optional file in the config dir
+	// with which administrators of managed deployments lock top level Config
+	// fields, listed by name, like:
+	//
+	//   - proxiedsites
+	//   - autoreport
+	//   - addr
+	//
+	// Locked fields keep the values they have in the config file and the
+	// local overrides file, which can still change them, while Update, cloud
+	// config, flags and the environment can't. We only ever read it.
+	lockedFieldsName = "lantern-locked.yaml"
+)
+
+// LockedFieldsError is returned by Update when the update would change fields
+// that an administrator locked.
+type LockedFieldsError struct {
+	Fields []string
+}
+
+func (e *LockedFieldsError) Error() string {
+	return fmt.Sprintf("Locked by administrator: %v", strings.Join(e.Fields, ", "))
+}
+
+// lockedFieldsPath returns the path of the locked fields file.
+func lockedFieldsPath() (string, error) {
+	_, path, err := InConfigDir(lockedFieldsName)
+	return path, err
+}
+
+// loadLockedFields returns the names of the Config fields locked by the
+// locked fields file, sorted, or nil if there isn't one. Names that aren't
+// fields we can lock are logged and ignored, as are files that can't be read.
+func loadLockedFields() []string {
+	path, err := lockedFieldsPath()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Errorf("Unable to read locked fields: %v", err)
+		reportError(PersistError, err, false)
+		return nil
+	}
+	var names []string
+	if err := yaml.Unmarshal(data, &names); err != nil {
+		err = fmt.Errorf("Ignoring locked fields: %v", err)
+		log.Error(err)
+		reportError(ParseError, err, false)
+		return nil
+	}
+	cfgType := reflect.TypeOf(Config{})
+	var fields []string
+	for _, name := range names {
+		field, found := cfgType.FieldByNameFunc(func(field string) bool {
+			return strings.EqualFold(field, name)
+		})
+		if !found || field.PkgPath != "" || notOverridableFields[field.Name] {
+			log.Errorf("Ignoring lock on %q, which isn't a setting that can be locked", name)
+			continue
+		}
+		fields = append(fields, field.Name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// lockedValues are the values of the locked fields of a Config, as YAML, by
+// field name.
+type lockedValues map[string][]byte
+
+// snapshotLockedFields returns the values of the fields of this Config that
+// are locked, or nil if none are. Sections that aren't there are left out,
+// since they're filled in with defaults rather than kept out.
+func (cfg *Config) snapshotLockedFields() lockedValues {
+	fields := loadLockedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(cfg).Elem()
+	locked := make(lockedValues, len(fields))
+	for _, name := range fields {
+		field := v.FieldByName(name)
+		if field.Kind() == reflect.Ptr && field.IsNil() && field.Type().Elem().Kind() == reflect.Struct {
+			continue
+		}
+		b, err := yaml.Marshal(field.Interface())
+		if err != nil {
+			log.Errorf("Unable to keep locked field %v: %v", name, err)
+			continue
+		}
+		locked[name] = b
+	}
+	return locked
+}
+
+// changedLockedFields returns the names of the locked fields whose values in
+// this Config differ from the given ones, sorted.
+func (cfg *Config) changedLockedFields(locked lockedValues) []string {
+	v := reflect.ValueOf(cfg).Elem()
+	var changed []string
+	for name, before := range locked {
+		after, err := yaml.Marshal(v.FieldByName(name).Interface())
+		if err != nil || string(after) != string(before) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// restoreLockedFields sets the locked fields of this Config that changed back
+// to the given values, returning the names of the ones it restored.
+func (cfg *Config) restoreLockedFields(locked lockedValues) []string {
+	changed := cfg.changedLockedFields(locked)
+	v := reflect.ValueOf(cfg).Elem()
+	for _, name := range changed {
+		field := v.FieldByName(name)
+		field.Set(reflect.Zero(field.Type()))
+		if err := yaml.Unmarshal(locked[name], field.Addr().Interface()); err != nil {
+			log.Errorf("Unable to restore locked field %v: %v", name, err)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+)
+
+// lockFields writes a locked fields file with the given yaml.
+func lockFields(t *testing.T, yml string) {
+	path, err := lockedFieldsPath()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(yml), 0644)) {
+		t.FailNow()
+	}
+}
+
+func TestLoadLockedFields(t *testing.T) {
+	defer useTempConfigDir(t)()
+	assert.Nil(t, loadLockedFields(), "Nothing should be locked without a locked fields file")
+
+	lockFields(t, "- proxiedsites\n- AutoReport\n- uiaddr\n- nosuchfield\n- lastcloudupdate\n")
+	assert.Equal(t, []string{"AutoReport", "ProxiedSites", "UIAddr"}, loadLockedFields())
+
+	_, restoreErrs := collectErrors()
+	defer restoreErrs()
+	lockFields(t, "proxiedsites: [\n")
+	assert.Nil(t, loadLockedFields(), "Bad locked fields file should be ignored")
+}
+
+func TestUpdateRefusesLockedFields(t *testing.T) {
+	defer initTestConfig(t, handlerTestConfig+"uiaddr: 127.0.0.1:1234\n")()
+	lockFields(t, "- uiaddr\n- autoreport\n")
+
+	err := Update(func(cfg *Config) error {
+		cfg.UIAddr = "0.0.0.0:80"
+		cfg.AutoLaunch = new(bool)
+		return nil
+	})
+	if assert.IsType(t, &LockedFieldsError{}, err) {
+		assert.Equal(t, []string{"UIAddr"}, err.(*LockedFieldsError).Fields)
+	}
+	assert.Equal(t, "127.0.0.1:1234", current().UIAddr)
+	assert.Nil(t, current().AutoLaunch, "Update changing a locked field should be refused entirely")
+
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.AutoLaunch = new(bool)
+		return nil
+	}), "Unlocked fields should still be updatable")
+
+	resp := doConfigRequest("PATCH", "127.0.0.1:5000", `{"AutoReport": false}`)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Nil(t, current().AutoReport)
+
+	// Administrators still set locked fields with the local overrides
+	path, err := localOverridesPath()
+	if assert.NoError(t, err) && assert.NoError(t, ioutil.WriteFile(path, []byte("uiaddr: 127.0.0.1:4321\n"), 0644)) {
+		assert.NoError(t, update(func(cfg *Config) error {
+			cfg.applyLocalOverrides()
+			return nil
+		}, false))
+		assert.Equal(t, "127.0.0.1:4321", current().UIAddr)
+	}
+}
+
+func TestCloudUpdateKeepsLockedFields(t *testing.T) {
+	defer useTempConfigDir(t)()
+	lockFields(t, "- proxiedsites\n")
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}, Cloud: []string{"a.com", "b.com"}}}
+
+	update := "proxiedsites:\n  cloud:\n  - example.com\nclient:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n"
+	if assert.NoError(t, cfg.updateFrom([]byte(update))) {
+		assert.Equal(t, []string{"a.com", "b.com"}, cfg.ProxiedSites.Cloud, "Locked proxied sites should be kept")
+		if assert.NotNil(t, cfg.Client.ChainedServers["fallback-1"], "Unlocked fields should be updated") {
+			assert.Equal(t, "1.1.1.1:443", cfg.Client.ChainedServers["fallback-1"].Addr)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/getlantern/fronted"
+)
+
+const (
+	// masqueradeSampleSize is how many masquerades of a new set we probe.
+	masqueradeSampleSize = 10
+
+	// masqueradeProbeTimeout bounds how long probing a set takes in total.
+	// Probes that haven't finished by then count as failures.
+	masqueradeProbeTimeout = 5 * time.Second
+
+	// maxMasqueradeFailureRate is the fraction of probed masquerades above
+	// which we reject a new set.
+	maxMasqueradeFailureRate = 0.5
+)
+
+// masqueradeProber checks whether masquerades work.
+type masqueradeProber interface {
+	// probe returns an error if the given masquerade doesn't work, giving up
+	// after the given timeout.
+	probe(masquerade *fronted.Masquerade, timeout time.Duration) error
+}
+
+// newMasqueradeProber creates a masqueradeProber that trusts the given CAs.
+var newMasqueradeProber = func(rootCAs *x509.CertPool) masqueradeProber {
+	return &tlsMasqueradeProber{rootCAs}
+}
+
+// tlsMasqueradeProber probes masquerades with a TLS handshake.
+type tlsMasqueradeProber struct {
+	rootCAs *x509.CertPool
+}
+
+func (p *tlsMasqueradeProber) probe(masquerade *fronted.Masquerade, timeout time.Duration) error {
+	host := masquerade.IpAddress
+	if host == "" {
+		host = masquerade.Domain
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", net.JoinHostPort(host, "443"), &tls.Config{
+		ServerName: masquerade.Domain,
+		RootCAs:    p.rootCAs,
+	})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// validateMasquerade checks that the given masquerade is well formed.
+func validateMasquerade(masquerade *fronted.Masquerade) error {
+	if masquerade == nil || masquerade.Domain == "" {
+		return fmt.Errorf("masquerade has no domain")
+	}
+	if masquerade.IpAddress != "" && net.ParseIP(masquerade.IpAddress) == nil {
+		return fmt.Errorf("masquerade %v has invalid ip address %q", masquerade.Domain, masquerade.IpAddress)
+	}
+	return nil
+}
+
+// checkMasqueradeSets checks the masquerade sets that an update put in this
+// Config, replacing each one that's malformed or, if VerifyMasquerades is
+// set, that mostly doesn't work with the corresponding set from oldSets. Sets
+// without a counterpart in oldSets are dropped instead.
+func (updated *Config) checkMasqueradeSets(oldSets map[string][]*fronted.Masquerade) {
+	var prober masqueradeProber
+	if updated.VerifyMasquerades {
+		rootCAs, err := updated.GetTrustedCACerts()
+		if err != nil {
+			log.Errorf("Unable to get trusted CAs for verifying masquerades, using system CAs: %v", err)
+			rootCAs = nil
+		}
+		prober = newMasqueradeProber(rootCAs)
+	}
+
+	for name, masquerades := range updated.Client.MasqueradeSets {
+		oldMasquerades, hadOld := oldSets[name]
+		err := checkMasquerades(masquerades)
+		if err == nil && prober != nil && !reflect.DeepEqual(masquerades, oldMasquerades) {
+			err = probeMasquerades(masquerades, prober)
+		}
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("Rejected masquerade set %v: %v", name, err)
+		log.Error(err)
+		reportError(ParseError, err, false)
+		if hadOld {
+			updated.Client.MasqueradeSets[name] = oldMasquerades
+		} else {
+			delete(updated.Client.MasqueradeSets, name)
+		}
+	}
+}
+
+// checkMasquerades checks that all of the given masquerades are well formed.
+func checkMasquerades(masquerades []*fronted.Masquerade) error {
+	if len(masquerades) == 0 {
+		return fmt.Errorf("set is empty")
+	}
+	for _, masquerade := range masquerades {
+		if err := validateMasquerade(masquerade); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeMasquerades probes a random sample of the given masquerades in
+// parallel, returning an error if too many of them don't work.
+func probeMasquerades(masquerades []*fronted.Masquerade, prober masqueradeProber) error {
+	sampleSize := masqueradeSampleSize
+	if len(masquerades) < sampleSize {
+		sampleSize = len(masquerades)
+	}
+	// Buffered so that probes that time out don't block forever
+	results := make(chan error, sampleSize)
+	for _, i := range rand.Perm(len(masquerades))[:sampleSize] {
+		go func(masquerade *fronted.Masquerade) {
+			results <- prober.probe(masquerade, masqueradeProbeTimeout)
+		}(masquerades[i])
+	}
+
+	failures := 0
+	timeout := time.After(masqueradeProbeTimeout)
+probing:
+	for i := 0; i < sampleSize; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				log.Debugf("Masquerade probe failed: %v", err)
+				failures++
+			}
+		case <-timeout:
+			log.Debugf("Timed out probing masquerades")
+			failures += sampleSize - i
+			break probing
+		}
+	}
+	log.Debugf("%d of %d sampled masquerades failed", failures, sampleSize)
+	if float64(failures)/float64(sampleSize) > maxMasqueradeFailureRate {
+		return fmt.Errorf("%d of %d sampled masquerades failed", failures, sampleSize)
+	}
+	return nil
+}
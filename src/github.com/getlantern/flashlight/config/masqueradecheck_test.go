@@ -0,0 +1,124 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/fronted"
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// fakeProber fails probes of the domains in failing and counts the probes.
+type fakeProber struct {
+	failing map[string]bool
+	probes  int
+	mx      sync.Mutex
+}
+
+func (p *fakeProber) probe(masquerade *fronted.Masquerade, timeout time.Duration) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.probes++
+	if p.failing[masquerade.Domain] {
+		return fmt.Errorf("%v is dead", masquerade.Domain)
+	}
+	return nil
+}
+
+func useFakeProber(prober *fakeProber) func() {
+	origNewMasqueradeProber := newMasqueradeProber
+	newMasqueradeProber = func(rootCAs *x509.CertPool) masqueradeProber {
+		return prober
+	}
+	return func() {
+		newMasqueradeProber = origNewMasqueradeProber
+	}
+}
+
+func masqueradeTestConfig() *Config {
+	return &Config{
+		Client: &client.ClientConfig{
+			MasqueradeSets: map[string][]*fronted.Masquerade{
+				cloudfront: []*fronted.Masquerade{
+					&fronted.Masquerade{Domain: "old.example.com", IpAddress: "1.1.1.1"},
+				},
+			},
+		},
+		ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}},
+	}
+}
+
+func masqueradeUpdate(verify bool, masquerades ...string) []byte {
+	update := fmt.Sprintf("verifymasquerades: %v\nclient:\n  masqueradesets:\n    cloudfront:\n", verify)
+	for i := 0; i < len(masquerades); i += 2 {
+		update += fmt.Sprintf("    - domain: %q\n      ipaddress: %q\n", masquerades[i], masquerades[i+1])
+	}
+	return []byte(update)
+}
+
+func TestMalformedMasqueradesRejected(t *testing.T) {
+	for _, masquerades := range [][]string{
+		{"new.example.com", "1.2.3"},
+		{"", "1.2.3.4"},
+	} {
+		cfg := masqueradeTestConfig()
+		if !assert.NoError(t, cfg.updateFrom(masqueradeUpdate(false, masquerades...))) {
+			continue
+		}
+		if assert.Len(t, cfg.Client.MasqueradeSets[cloudfront], 1) {
+			assert.Equal(t, "old.example.com", cfg.Client.MasqueradeSets[cloudfront][0].Domain, "Malformed set %v should be rejected", masquerades)
+		}
+	}
+
+	cfg := masqueradeTestConfig()
+	if assert.NoError(t, cfg.updateFrom(masqueradeUpdate(false, "new.example.com", "1.2.3.4", "other.example.com", ""))) {
+		assert.Len(t, cfg.Client.MasqueradeSets[cloudfront], 2, "Well formed set should be applied")
+	}
+}
+
+func TestMasqueradesVerified(t *testing.T) {
+	prober := &fakeProber{failing: map[string]bool{
+		"dead1.example.com": true,
+		"dead2.example.com": true,
+	}}
+	defer useFakeProber(prober)()
+
+	cfg := masqueradeTestConfig()
+	if assert.NoError(t, cfg.updateFrom(masqueradeUpdate(true, "dead1.example.com", "1.2.3.4", "dead2.example.com", "1.2.3.5", "new.example.com", "1.2.3.6"))) {
+		if assert.Len(t, cfg.Client.MasqueradeSets[cloudfront], 1) {
+			assert.Equal(t, "old.example.com", cfg.Client.MasqueradeSets[cloudfront][0].Domain, "Mostly dead set should be rejected")
+		}
+	}
+	assert.Equal(t, 3, prober.probes, "All masquerades of a small set should be probed")
+
+	prober.probes = 0
+	masquerades := make([]string, 0)
+	for i := 0; i < 2*masqueradeSampleSize; i++ {
+		masquerades = append(masquerades, fmt.Sprintf("new%d.example.com", i), fmt.Sprintf("1.2.3.%d", i))
+	}
+	cfg = masqueradeTestConfig()
+	if assert.NoError(t, cfg.updateFrom(masqueradeUpdate(true, masquerades...))) {
+		assert.Len(t, cfg.Client.MasqueradeSets[cloudfront], 2*masqueradeSampleSize, "Working set should be applied")
+	}
+	assert.Equal(t, masqueradeSampleSize, prober.probes, "Only a sample of a large set should be probed")
+
+	// Applying the same set again shouldn't probe it
+	prober.probes = 0
+	if assert.NoError(t, cfg.updateFrom(masqueradeUpdate(true, masquerades...))) {
+		assert.Len(t, cfg.Client.MasqueradeSets[cloudfront], 2*masqueradeSampleSize)
+	}
+	assert.Equal(t, 0, prober.probes, "Unchanged set should not be probed")
+
+	// Without VerifyMasquerades, nothing is probed
+	cfg = masqueradeTestConfig()
+	if assert.NoError(t, cfg.updateFrom(masqueradeUpdate(false, "dead1.example.com", "1.2.3.4"))) {
+		assert.Equal(t, "dead1.example.com", cfg.Client.MasqueradeSets[cloudfront][0].Domain)
+	}
+	assert.Equal(t, 0, prober.probes, "Masquerades should only be probed with VerifyMasquerades")
+}
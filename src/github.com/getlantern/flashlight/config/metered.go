@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// meteredPollFactor is how much longer we wait between polls on a metered
+	// connection.
+	meteredPollFactor = 4
+
+	// defaultMeteredDownloadLimit is the largest cloud config, as sent over the
+	// wire, that we download on a metered connection when the config doesn't
+	// say.
+	defaultMeteredDownloadLimit = 256 * 1024
+
+	// defaultMeteredMaxAge is how old our cloud settings can get before we
+	// download cloud config regardless of its size on a metered connection
+	// when the config doesn't say.
+	defaultMeteredMaxAge = 24 * time.Hour
+
+	// meteredCheckInterval is how often we ask the platform whether the
+	// connection is metered.
+	meteredCheckInterval = 30 * time.Second
+
+	// The settings of MeteredConnection
+	meteredAuto   = "auto"
+	meteredAlways = "always"
+	meteredNever  = "never"
+)
+
+var (
+	metered               bool // what the host app says, see SetNetworkConstraints
+	detectedMetered       bool // what the platform says, see watchMeteredConnection
+	deferredDownload      bool
+	meteredMx             sync.Mutex
+	pollAfterDeferral     = pollNow
+	detectMetered         = platformMetered
+	startMeteredWatchOnce sync.Once
+	stopMeteredWatch      = make(chan struct{})
+	stopMeteredWatchOnce  sync.Once
+)
+
+// SetNetworkConstraints tells us whether the connection we're on is metered,
+// like cellular or tethered connections, for the host app's connectivity
+// watcher to call whenever that changes. On a metered connection, we poll for
+// cloud config less often, or not at all with PauseMeteredPolling, and put off
+// downloading large cloud configs until the connection is unmetered, unless
+// our cloud settings are getting too old. This only lasts for the session.
+// Where we can, we also ask the platform, see watchMeteredConnection, and the
+// connection is metered if either says so. MeteredConnection overrides both.
+func SetNetworkConstraints(isMetered bool) {
+	meteredMx.Lock()
+	changed := metered != isMetered
+	metered = isMetered
+	meteredMx.Unlock()
+	if changed {
+		log.Debugf("Connection metered: %v", isMetered)
+	}
+	resumeIfUnmetered()
+}
+
+// watchMeteredConnection asks the platform whether the connection is metered
+// every meteredCheckInterval until Stop, on platforms where we can tell
+// without the host app's help. It's started once, by StartPolling.
+func watchMeteredConnection() {
+	startMeteredWatchOnce.Do(func() {
+		go func() {
+			for {
+				checkMeteredConnection()
+				select {
+				case <-time.After(meteredCheckInterval):
+				case <-stopMeteredWatch:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// checkMeteredConnection records whether the platform says that the
+// connection is metered, if it can tell.
+func checkMeteredConnection() {
+	isMetered, known := detectMetered()
+	if !known {
+		return
+	}
+	meteredMx.Lock()
+	changed := detectedMetered != isMetered
+	detectedMetered = isMetered
+	meteredMx.Unlock()
+	if changed {
+		log.Debugf("Platform says connection metered: %v", isMetered)
+		resumeIfUnmetered()
+	}
+}
+
+// resumeIfUnmetered downloads the cloud config that we put off while the
+// connection was metered, if it no longer is.
+func resumeIfUnmetered() {
+	if isMetered() {
+		return
+	}
+	meteredMx.Lock()
+	pollDeferred := deferredDownload
+	deferredDownload = false
+	meteredMx.Unlock()
+	if pollDeferred {
+		log.Debug("Connection no longer metered, downloading deferred cloud config")
+		go pollAfterDeferral()
+	}
+}
+
+// isMetered returns whether the connection is metered, going by
+// MeteredConnection and, unless that says otherwise, by what the host app
+// and the platform say.
+func isMetered() bool {
+	if cfg := current(); cfg != nil {
+		switch cfg.MeteredConnection {
+		case meteredAlways:
+			return true
+		case meteredNever:
+			return false
+		}
+	}
+	meteredMx.Lock()
+	defer meteredMx.Unlock()
+	return metered || detectedMetered
+}
+
+// deferredError indicates that we put off downloading cloud config because
+// it's too large to download on a metered connection.
+type deferredError struct {
+	size int64
+}
+
+func (e *deferredError) Error() string {
+	return fmt.Sprintf("Deferred downloading cloud config of at least %d bytes until the connection is unmetered", e.size)
+}
+
+// isDeferred returns whether the given error is a deferredError, in which case
+// there's no point in trying to download the cloud config some other way.
+func isDeferred(err error) bool {
+	_, ok := err.(*deferredError)
+	return ok
+}
+
+// deferDownload records that we've put off downloading cloud config until the
+// connection is unmetered.
+func deferDownload() {
+	meteredMx.Lock()
+	deferredDownload = true
+	meteredMx.Unlock()
+}
+
+// pollingPaused returns whether to skip polling for cloud config altogether
+// because we're on a metered connection and PauseMeteredPolling is set, which
+// only holds while our cloud settings are younger than MeteredMaxAge.
+func (cfg *Config) pollingPaused() bool {
+	if !cfg.PauseMeteredPolling || !isMetered() {
+		return false
+	}
+	return !cfg.cloudSettingsTooOld()
+}
+
+// cloudSettingsTooOld returns whether our cloud settings are older than
+// MeteredMaxAge, so that we should download cloud config even on a metered
+// connection.
+func (cfg *Config) cloudSettingsTooOld() bool {
+	maxAge := cfg.MeteredMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultMeteredMaxAge
+	}
+	lastUpdate, _, _ := CloudUpdateStatus()
+	if lastUpdate.IsZero() || cfg.correctedNow().Sub(lastUpdate) > maxAge {
+		log.Debugf("Cloud settings are older than %v, downloading even though connection is metered", maxAge)
+		return true
+	}
+	return false
+}
+
+// meteredPollSleepTime stretches the given time between polls if we're on a
+// metered connection.
+func meteredPollSleepTime(waitTime time.Duration) time.Duration {
+	if isMetered() {
+		return waitTime * meteredPollFactor
+	}
+	return waitTime
+}
+
+// downloadLimit returns the largest cloud config response that we should
+// download now, or zero if there's no limit.
+func downloadLimit() int64 {
+	if !isMetered() {
+		return 0
+	}
+	cfg := current()
+	if cfg == nil || cfg.cloudSettingsTooOld() {
+		return 0
+	}
+	if cfg.MeteredDownloadLimit > 0 {
+		return cfg.MeteredDownloadLimit
+	}
+	return defaultMeteredDownloadLimit
+}
+
+// limitResponse returns a deferredError if the body of the given response is
+// larger than the given limit, reading at most limit bytes of it to find out
+// when it doesn't say how large it is. Otherwise, the body is left to be read
+// in full.
+func limitResponse(resp *http.Response, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if resp.ContentLength > limit {
+		return &deferredError{resp.ContentLength}
+	}
+	if resp.ContentLength >= 0 {
+		return nil
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("Unable to read cloud config: %v", err)
+	}
+	if int64(len(head)) > limit {
+		return &deferredError{int64(len(head))}
+	}
+	resp.Body = &bodyWithHead{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return nil
+}
+
+// bodyWithHead is a response body of which we've already read the head.
+type bodyWithHead struct {
+	io.Reader
+	io.Closer
+}
+
+// pollNow polls for cloud config right away, outside of the regular polling
+// schedule.
+func pollNow() {
+	cfg := current()
+	if cfg == nil {
+		return
+	}
+	mutate, _, err := pollForConfig(cfg)
+	if err != nil {
+		log.Errorf("Unable to poll for cloud config: %v", err)
+		return
+	}
+	if err := m.Update(mutate); err != nil {
+		log.Errorf("Unable to apply cloud config: %v", err)
+	}
+}
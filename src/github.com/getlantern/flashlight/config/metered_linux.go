@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// rtfUp is the RTF_UP flag of a route in /proc/net/route.
+	rtfUp = 0x1
+)
+
+// platformMetered goes by whether the interface of the default route is a
+// cellular modem, which NetworkManager and Android treat as metered too.
+// known is false if there's no default route or its interface can't be told
+// apart.
+func platformMetered() (isMetered bool, known bool) {
+	return meteredInterface("/proc/net/route", "/sys/class/net")
+}
+
+// meteredInterface is platformMetered, reading the routing table and the
+// network interfaces from the given paths.
+func meteredInterface(routes string, sysClassNet string) (isMetered bool, known bool) {
+	iface, ok := defaultRouteInterface(routes)
+	if !ok {
+		return false, false
+	}
+	if strings.HasPrefix(iface, "wwan") || strings.HasPrefix(iface, "rmnet") {
+		return true, true
+	}
+	uevent, err := ioutil.ReadFile(filepath.Join(sysClassNet, iface, "uevent"))
+	if err != nil {
+		return false, false
+	}
+	for _, line := range bytes.Split(uevent, []byte("\n")) {
+		if string(bytes.TrimSpace(line)) == "DEVTYPE=wwan" {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// defaultRouteInterface returns the interface of the default route with the
+// lowest metric in the routing table at the given path, as laid out in
+// /proc/net/route.
+func defaultRouteInterface(routes string) (string, bool) {
+	file, err := os.Open(routes)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	best, bestMetric := "", -1
+	scanner := bufio.NewScanner(file)
+	// Skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfUp == 0 {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if bestMetric < 0 || metric < bestMetric {
+			best, bestMetric = fields[0], metric
+		}
+	}
+	return best, bestMetric >= 0
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeteredInterface(t *testing.T) {
+	dir := t.TempDir()
+	routes := filepath.Join(dir, "route")
+	sysClassNet := filepath.Join(dir, "net")
+	for iface, uevent := range map[string]string{
+		"eth0": "INTERFACE=eth0\nIFINDEX=2\n",
+		"usb0": "DEVTYPE=wwan\nINTERFACE=usb0\nIFINDEX=3\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(sysClassNet, iface), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(sysClassNet, iface, "uevent"), []byte(uevent), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	check := func(table string) (bool, bool) {
+		if err := ioutil.WriteFile(routes, []byte(header+table), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return meteredInterface(routes, sysClassNet)
+	}
+
+	isMetered, known := check("eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+		"usb0\t00000000\t01002A0A\t0003\t0\t0\t700\t00000000\t0\t0\t0\n")
+	assert.True(t, known)
+	assert.False(t, isMetered, "Wired default route with the lowest metric shouldn't be metered")
+
+	isMetered, known = check("eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n" +
+		"usb0\t00000000\t01002A0A\t0003\t0\t0\t700\t00000000\t0\t0\t0\n")
+	assert.True(t, known)
+	assert.True(t, isMetered, "Default route through a cellular modem should be metered")
+
+	_, known = check("eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n")
+	assert.False(t, known, "Can't tell without a default route")
+}
@@ -0,0 +1,9 @@
+// +build !linux,!windows
+
+package config
+
+// platformMetered can't tell whether the connection is metered here, so we go
+// by what the host app tells us with SetNetworkConstraints.
+func platformMetered() (isMetered bool, known bool) {
+	return false, false
+}
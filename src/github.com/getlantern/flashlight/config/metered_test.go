@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestMeteredPolling(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	defer SetNetworkConstraints(false)
+	origPollAfterDeferral := pollAfterDeferral
+	defer func() {
+		pollAfterDeferral = origPollAfterDeferral
+	}()
+	polledAfterDeferral := make(chan bool, 10)
+	pollAfterDeferral = func() {
+		pollNow()
+		polledAfterDeferral <- true
+	}
+
+	// Lots of sites that don't compress well
+	var sites []string
+	for i := 0; i < 200; i++ {
+		sites = append(sites, fmt.Sprintf("  - %x.com\n", time.Now().UnixNano()*int64(i+7919)))
+	}
+	large := "proxiedsites:\n  cloud:\n" + strings.Join(sites, "")
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\nmetereddownloadlimit: 1024\ncloudpollinterval: 1h\n")()
+
+	poll := func() time.Duration {
+		mutate, waitTime, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+		return waitTime
+	}
+
+	// Unmetered, small configs are downloaded and polls are regular
+	waitTime := poll()
+	assert.True(t, waitTime <= 90*time.Minute, "Unmetered poll interval should not be stretched")
+	assert.Contains(t, current().ProxiedSites.Cloud, "a.com")
+
+	// Metered, polls are less frequent and large configs are deferred
+	SetNetworkConstraints(true)
+	srv.SetConfig(large)
+	waitTime = poll()
+	assert.True(t, waitTime >= 2*time.Hour, "Metered poll interval should be stretched, was %v", waitTime)
+	assert.Equal(t, 2, srv.Requests())
+	assert.NotContains(t, current().ProxiedSites.Cloud, strings.TrimSpace(strings.TrimPrefix(sites[0], "  - ")), "Large config should have been deferred")
+	poll()
+	assert.Equal(t, 3, srv.Requests(), "Should keep validating while metered")
+	assert.NotContains(t, current().ProxiedSites.Cloud, strings.TrimSpace(strings.TrimPrefix(sites[0], "  - ")), "Large config should still be deferred")
+
+	// Unmetered again, the deferred config is downloaded right away
+	SetNetworkConstraints(false)
+	select {
+	case <-polledAfterDeferral:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Should have polled once unmetered")
+	}
+	assert.Contains(t, current().ProxiedSites.Cloud, strings.TrimSpace(strings.TrimPrefix(sites[0], "  - ")), "Deferred config should have been applied")
+
+	// Metered with cloud settings older than the safety limit, large configs
+	// are downloaded anyway
+	SetNetworkConstraints(true)
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.LastCloudUpdate = time.Now().Add(-2 * defaultMeteredMaxAge).Format(time.RFC3339)
+		return nil
+	}))
+	srv.SetConfig(large + "  - b.com\n")
+	poll()
+	assert.Contains(t, current().ProxiedSites.Cloud, "b.com", "Large config should be downloaded when settings are too old")
+	select {
+	case <-polledAfterDeferral:
+		t.Fatal("Should not have polled outside of schedule")
+	default:
+	}
+}
+
+func TestMeteredConnectionSetting(t *testing.T) {
+	defer SetNetworkConstraints(false)
+	defer initTestConfig(t, "")()
+
+	SetNetworkConstraints(true)
+	assert.True(t, isMetered(), "Should go by the host app by default")
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.MeteredConnection = meteredNever
+		return nil
+	}))
+	assert.False(t, isMetered(), "Setting should override the host app")
+	SetNetworkConstraints(false)
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.MeteredConnection = meteredAlways
+		return nil
+	}))
+	assert.True(t, isMetered(), "Setting should override the host app")
+	err := Update(func(cfg *Config) error {
+		cfg.MeteredConnection = "sometimes"
+		return nil
+	})
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestPausedMeteredPolling(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	defer SetNetworkConstraints(false)
+	origDetectMetered, origPollAfterDeferral := detectMetered, pollAfterDeferral
+	defer func() {
+		detectMetered, pollAfterDeferral = origDetectMetered, origPollAfterDeferral
+		detectedMetered = false
+	}()
+	platformSaysMetered := true
+	detectMetered = func() (bool, bool) {
+		return platformSaysMetered, true
+	}
+	polledAfterDeferral := make(chan bool, 10)
+	pollAfterDeferral = func() {
+		pollNow()
+		polledAfterDeferral <- true
+	}
+
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\npausemeteredpolling: true\n")()
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.LastCloudUpdate = time.Now().Format(time.RFC3339)
+		return nil
+	}))
+
+	checkMeteredConnection()
+	mutate, _, err := pollForConfig(current())
+	if assert.NoError(t, err) {
+		assert.NoError(t, m.Update(mutate))
+	}
+	assert.Equal(t, 0, srv.Requests(), "Shouldn't poll on a metered connection")
+
+	// Back on an unmetered connection, polling resumes right away
+	platformSaysMetered = false
+	checkMeteredConnection()
+	select {
+	case <-polledAfterDeferral:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Should have polled once unmetered")
+	}
+	assert.Equal(t, 1, srv.Requests())
+	assert.Contains(t, current().ProxiedSites.Cloud, "a.com")
+}
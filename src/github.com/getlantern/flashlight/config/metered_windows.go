@@ -0,0 +1,48 @@
+package config
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// The values of NL_NETWORK_CONNECTIVITY_COST_HINT
+	networkConnectivityCostHintUnknown  = 0
+	networkConnectivityCostHintFixed    = 2
+	networkConnectivityCostHintVariable = 3
+)
+
+var (
+	iphlpapi                       = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetNetworkConnectivityHint = iphlpapi.NewProc("GetNetworkConnectivityHint")
+)
+
+// networkConnectivityHint is an NL_NETWORK_CONNECTIVITY_HINT as filled in by
+// GetNetworkConnectivityHint.
+type networkConnectivityHint struct {
+	connectivityLevel    int32
+	connectivityCost     int32
+	approachingDataLimit byte
+	overDataLimit        byte
+	roaming              byte
+}
+
+// platformMetered asks Windows what the connection costs, as set for the
+// network in Settings. known is false on versions of Windows before 10 2004,
+// which can't tell us without COM.
+func platformMetered() (isMetered bool, known bool) {
+	if err := procGetNetworkConnectivityHint.Find(); err != nil {
+		return false, false
+	}
+	hint := &networkConnectivityHint{}
+	if r, _, _ := procGetNetworkConnectivityHint.Call(uintptr(unsafe.Pointer(hint))); r != 0 {
+		return false, false
+	}
+	switch hint.connectivityCost {
+	case networkConnectivityCostHintUnknown:
+		return false, false
+	case networkConnectivityCostHintFixed, networkConnectivityCostHintVariable:
+		return true, true
+	}
+	return hint.roaming != 0 || hint.overDataLimit != 0, true
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	schemaVersionKey = "schemaversion"
+	provenanceKey    = "provenance"
+)
+
+var (
+	// migrations are the registered schema migrations, ordered by the version
+	// they migrate from.
+	migrations = make([]*migration, 0)
+)
+
+func init() {
+	RegisterMigration(0, 1, migrateCloudConfigToList)
+	RegisterMigration(1, 2, markProvenance)
+}
+
+// migration migrates the raw YAML tree of a config file from one schema
+// version to another.
+type migration struct {
+	from    int
+	to      int
+	migrate func(tree map[string]interface{}) error
+}
+
+// byFrom implements sort.Interface for []*migration based on the from version
+type byFrom []*migration
+
+func (a byFrom) Len() int           { return len(a) }
+func (a byFrom) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFrom) Less(i, j int) bool { return a[i].from < a[j].from }
+
+// RegisterMigration registers a function that migrates the raw YAML tree of a
+// config file from schema version from to schema version to. Init runs the
+// migrations that lead on from the file's schema version, one after the other,
+// before the file is unmarshaled into a Config. They must be idempotent.
+func RegisterMigration(from, to int, fn func(tree map[string]interface{}) error) {
+	if to <= from {
+		// Using panic because this would be a developer error rather that
+		// something that could happen naturally.
+		panic(fmt.Sprintf("Migration must move to a newer schema version, not from %d to %d", from, to))
+	}
+	migrations = append(migrations, &migration{from, to, fn})
+	sort.Stable(byFrom(migrations))
+}
+
+// migrateConfigFile runs the registered migrations against the config file at
+// path, keeping a backup of the file as it was before the migrations.
+func migrateConfigFile(path string) error {
+	return migrateFile(path, migrations)
+}
+
+func migrateFile(path string, migs []*migration) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read config for migration: %v", err)
+	}
+	// Keep encrypted configs encrypted
+	store := newEncryptingStore(yamlconf.NewFileStore(path), nil)
+	original, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("Unable to read config for migration: %v", err)
+	}
+	migrated, from, to, err := migrate(original, migs)
+	if err != nil {
+		return err
+	}
+	if to == from {
+		log.Tracef("Config at %v already at schema version %d", path, from)
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%v.schema%d.bak", path, from)
+	if err := ioutil.WriteFile(backupPath, raw, 0644); err != nil {
+		return fmt.Errorf("Unable to back up config before migration: %v", err)
+	}
+	if err := store.Save(migrated); err != nil {
+		return fmt.Errorf("Unable to write migrated config: %v", err)
+	}
+	log.Debugf("Migrated config at %v from schema version %d to %d, backup at %v", path, from, to, backupPath)
+	recordHistory(&HistoryEntry{
+		Time:          time.Now(),
+		Source:        historySourceMigration,
+		SchemaVersion: to,
+		Diff:          fmt.Sprintf("SchemaVersion: %d -> %d", from, to),
+	})
+	return nil
+}
+
+// migrate runs the given migrations against the given config YAML, returning
+// the migrated YAML along with the schema versions migrated from and to. If no
+// migrations apply, the original YAML is returned.
+func migrate(original []byte, migs []*migration) ([]byte, int, int, error) {
+	tree := make(map[string]interface{})
+	if err := yaml.Unmarshal(original, &tree); err != nil {
+		return nil, 0, 0, fmt.Errorf("Unable to parse config for migration: %v", err)
+	}
+
+	from := schemaVersionOf(tree)
+	to, err := applyMigrations(tree, from, migs)
+	if err != nil {
+		return nil, from, from, err
+	}
+	if to == from {
+		return original, from, to, nil
+	}
+	migrated, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, from, from, fmt.Errorf("Unable to marshal migrated config: %v", err)
+	}
+	return migrated, from, to, nil
+}
+
+// applyMigrations applies, in order, the chain of the given migrations that
+// starts at the given schema version, each starting at the version the last
+// one migrated to, returning the resulting schema version. It stops at a
+// version that no migration starts at, without applying migrations from later
+// versions, since those expect what the missing ones would have done.
+func applyMigrations(tree map[string]interface{}, version int, migs []*migration) (int, error) {
+	for _, mig := range migs {
+		if mig.from < version {
+			continue
+		}
+		if mig.from > version {
+			log.Errorf("No migration from schema version %d, not migrating config to schema version %d", version, mig.to)
+			break
+		}
+		if err := mig.migrate(tree); err != nil {
+			return version, fmt.Errorf("Unable to migrate config from schema version %d to %d: %v", mig.from, mig.to, err)
+		}
+		version = mig.to
+		tree[schemaVersionKey] = version
+	}
+	return version, nil
+}
+
+func schemaVersionOf(tree map[string]interface{}) int {
+	version, _ := tree[schemaVersionKey].(int)
+	return version
+}
+
+// migrateCloudConfigToList moves the single CloudConfig URL into the
+// CloudConfigs list.
+func migrateCloudConfigToList(tree map[string]interface{}) error {
+	url, found := tree["cloudconfig"]
+	if !found {
+		return nil
+	}
+	delete(tree, "cloudconfig")
+	s, ok := url.(string)
+	if !ok {
+		return fmt.Errorf("Expected cloudconfig to be a string, not %T", url)
+	}
+	if s != "" && tree["cloudconfigs"] == nil {
+		tree["cloudconfigs"] = []interface{}{s}
+	}
+	return nil
+}
+
+// markProvenance records where a config that doesn't say so was installed
+// from, guessing from its chained servers.
+func markProvenance(tree map[string]interface{}) error {
+	if _, found := tree[provenanceKey]; found {
+		return nil
+	}
+	nc := 0
+	if client, ok := tree["client"].(map[interface{}]interface{}); ok {
+		if servers, ok := client["chainedservers"].(map[interface{}]interface{}); ok {
+			nc = len(servers)
+		}
+	}
+	if hasCustomChainedServers(nc) {
+		tree[provenanceKey] = provenanceCustom
+	} else {
+		tree[provenanceKey] = provenanceStandard
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTree(t *testing.T, path string) map[string]interface{} {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read %v: %v", path, err)
+	}
+	tree := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &tree); err != nil {
+		t.Fatalf("Unable to parse %v: %v", path, err)
+	}
+	return tree
+}
+
+func TestMigrateCloudConfigToList(t *testing.T) {
+	path := writeTempConfig(t, "cloudconfig: http://example.com/cloud.yaml.gz\naddr: 127.0.0.1:8787\n")
+	defer os.Remove(path)
+	defer os.Remove(path + ".schema0.bak")
+
+	assert.NoError(t, migrateConfigFile(path))
+	tree := readTree(t, path)
+	assert.Equal(t, 2, tree[schemaVersionKey])
+	assert.Nil(t, tree["cloudconfig"])
+	assert.Equal(t, []interface{}{"http://example.com/cloud.yaml.gz"}, tree["cloudconfigs"])
+	assert.Equal(t, "127.0.0.1:8787", tree["addr"])
+
+	backup := readTree(t, path+".schema0.bak")
+	assert.Equal(t, "http://example.com/cloud.yaml.gz", backup["cloudconfig"], "Backup should contain the unmigrated config")
+
+	// Running the migrations again shouldn't change anything
+	before, _ := ioutil.ReadFile(path)
+	assert.NoError(t, migrateConfigFile(path))
+	after, _ := ioutil.ReadFile(path)
+	assert.Equal(t, string(before), string(after))
+
+	cfg := &Config{}
+	assert.NoError(t, yaml.Unmarshal(after, cfg))
+	assert.Equal(t, []string{"http://example.com/cloud.yaml.gz"}, cfg.CloudConfigs)
+}
+
+func TestMigrateChain(t *testing.T) {
+	var applied []int
+	record := func(from int) func(map[string]interface{}) error {
+		return func(tree map[string]interface{}) error {
+			applied = append(applied, from)
+			return nil
+		}
+	}
+	migs := []*migration{
+		&migration{0, 1, record(0)},
+		&migration{1, 3, record(1)},
+		&migration{2, 3, record(2)},
+		&migration{3, 4, record(3)},
+		&migration{5, 6, record(5)},
+	}
+
+	path := writeTempConfig(t, "schemaversion: 1\n")
+	defer os.Remove(path)
+	defer os.Remove(path + ".schema1.bak")
+	assert.NoError(t, migrateFile(path, migs))
+	assert.Equal(t, []int{1, 3}, applied, "Should only apply migrations that lead on from the file's version")
+	assert.Equal(t, 4, readTree(t, path)[schemaVersionKey], "Should stop at the gap after schema version 4")
+
+	applied = nil
+	gap := writeTempConfig(t, "schemaversion: 4\n")
+	defer os.Remove(gap)
+	assert.NoError(t, migrateFile(gap, migs))
+	assert.Empty(t, applied, "Migrations after a gap shouldn't be applied")
+	assert.Equal(t, 4, readTree(t, gap)[schemaVersionKey])
+}
+
+func TestMigrateFailure(t *testing.T) {
+	original := "schemaversion: 1\naddr: 127.0.0.1:8787\n"
+	path := writeTempConfig(t, original)
+	defer os.Remove(path)
+
+	migs := []*migration{
+		&migration{1, 2, func(tree map[string]interface{}) error {
+			tree["addr"] = "changed"
+			return nil
+		}},
+		&migration{2, 3, func(tree map[string]interface{}) error {
+			return errors.New("boom")
+		}},
+	}
+	assert.Error(t, migrateFile(path, migs))
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, original, string(b), "Failed migration should leave file untouched")
+}
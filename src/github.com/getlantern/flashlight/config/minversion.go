@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+)
+
+var (
+	// The version of Lantern that's running, as passed to Init
+	runningVersion string
+)
+
+// VersionRequiredError is returned when a cloud config update requires a
+// newer version of Lantern than the one running, which it may use features
+// of that we don't understand. Such updates are quarantined rather than
+// applied, so the UI can prompt the user to upgrade.
+type VersionRequiredError struct {
+	Required string // The oldest version of Lantern that can apply the update
+	Running  string // The version of Lantern that's running
+}
+
+func (e *VersionRequiredError) Error() string {
+	return fmt.Sprintf("Cloud config requires Lantern %v or newer, running %v", e.Required, e.Running)
+}
+
+// checkMinClientVersion checks that the running version of Lantern can apply
+// a cloud config update that requires the given version, returning a
+// *VersionRequiredError if it can't. Any version can apply updates that don't
+// require one, and so can development builds, whose versions don't parse.
+func checkMinClientVersion(required string) error {
+	if required == "" {
+		return nil
+	}
+	requiredVersion := parseVersion(required)
+	if !requiredVersion.valid {
+		return fmt.Errorf("Invalid minimum client version %q in update", required)
+	}
+	running := parseVersion(runningVersion)
+	if !running.valid {
+		log.Debugf("Not checking that %q is at least %v", runningVersion, required)
+		return nil
+	}
+	if running.compare(requiredVersion) < 0 {
+		return &VersionRequiredError{Required: required, Running: runningVersion}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func useRunningVersion(version string) func() {
+	orig := runningVersion
+	runningVersion = version
+	return func() {
+		runningVersion = orig
+	}
+}
+
+func TestCheckMinClientVersion(t *testing.T) {
+	for _, test := range []struct {
+		running  string
+		required string
+		ok       bool
+	}{
+		{"2.1.0", "", true},
+		{"2.1.0", "2.1.0", true},
+		{"2.1.1", "2.1.0", true},
+		{"2.1.0", "2.2.0", false},
+		{"2.1.0-beta1", "2.1.0", false},
+		{"development", "2.2.0", true},
+	} {
+		func() {
+			defer useRunningVersion(test.running)()
+			err := checkMinClientVersion(test.required)
+			if test.ok {
+				assert.NoError(t, err, "%v should be able to apply updates for %v", test.running, test.required)
+			} else if assert.IsType(t, &VersionRequiredError{}, err, "%v should be too old for %v", test.running, test.required) {
+				assert.Equal(t, test.required, err.(*VersionRequiredError).Required)
+			}
+		}()
+	}
+	assert.Error(t, checkMinClientVersion("two"), "Malformed requirement should be rejected")
+}
+
+func TestUpdateRequiringNewerClient(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(serversConfig("fallback-1", "1.1.1.1:443"))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer useRunningVersion("2.1.0")()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	origState := pollState
+	pollState = PollState{}
+	defer func() {
+		pollState = origState
+	}()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+
+	// Returns whether the poll applied cloud config
+	poll := func() bool {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return false
+		}
+		return m.Update(mutate) == nil
+	}
+	downloads := func() int {
+		return srv.Requests() - srv.NotModified()
+	}
+
+	assert.True(t, poll())
+
+	// Older than required
+	srv.SetConfig("minclientversion: 2.2.0\n" + serversConfig("fallback-2", "2.2.2.2:443"))
+	assert.False(t, poll(), "Update for a newer client should have been skipped")
+	assert.NotNil(t, current().Client.ChainedServers["fallback-1"], "Current config should be kept")
+	assert.Nil(t, current().Client.ChainedServers["fallback-2"])
+	state := DebugState()
+	assert.Equal(t, "2.2.0", state.RequiredVersion)
+	assert.NotEmpty(t, state.QuarantinedETag)
+	if assert.NotEmpty(t, *collected) {
+		last := (*collected)[len(*collected)-1]
+		assert.Equal(t, VersionError, last.Category)
+		assert.True(t, strings.Contains(last.Error(), "2.2.0"), "Error should name the required version")
+	}
+	downloaded := downloads()
+	assert.True(t, poll())
+	assert.Equal(t, downloaded, downloads(), "Update for a newer client should not have been downloaded again")
+
+	// Exactly the required version
+	srv.SetConfig("minclientversion: 2.1.0\n" + serversConfig("fallback-3", "3.3.3.3:443"))
+	assert.True(t, poll())
+	assert.NotNil(t, current().Client.ChainedServers["fallback-3"])
+	assert.Equal(t, "2.1.0", current().MinClientVersion)
+	state = DebugState()
+	assert.Empty(t, state.RequiredVersion)
+	assert.Empty(t, state.QuarantinedETag)
+
+	// No requirement
+	srv.SetConfig(serversConfig("fallback-4", "4.4.4.4:443"))
+	assert.True(t, poll())
+	assert.NotNil(t, current().Client.ChainedServers["fallback-4"])
+	assert.Empty(t, current().MinClientVersion, "Requirement of the last update should not carry over")
+}
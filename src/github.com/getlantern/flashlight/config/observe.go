@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/getlantern/deepcopy"
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+// Observer follows a config file that's owned by a running Lantern, for
+// companion tools like diagnostics. It only ever reads the file: it never
+// writes it, never locks the config dir, never polls for cloud config and
+// never applies defaults to what it reads.
+type Observer struct {
+	path    string
+	file    *yamlconf.FileStore
+	changes chan *Config
+	stop    chan struct{}
+
+	current *Config
+	stored  []byte
+	mx      sync.RWMutex
+
+	closeOnce sync.Once
+}
+
+// Observe starts observing the config file at the given path, which has to
+// exist and parse.
+func Observe(configPath string) (*Observer, error) {
+	o := &Observer{
+		path:    configPath,
+		file:    yamlconf.NewFileStore(configPath),
+		changes: make(chan *Config),
+		stop:    make(chan struct{}),
+	}
+	if _, err := o.reload(); err != nil {
+		return nil, err
+	}
+	changed := o.file.Watch()
+	go o.watch(changed)
+	return o, nil
+}
+
+// Snapshot returns a copy of the config as it was last read from the file,
+// without defaults applied.
+func (o *Observer) Snapshot() *Config {
+	o.mx.RLock()
+	defer o.mx.RUnlock()
+	return snapshotOf(o.current)
+}
+
+// EffectiveSnapshot returns a copy of the config as it was last read from the
+// file with defaults applied, the way Lantern sees it.
+func (o *Observer) EffectiveSnapshot() *Config {
+	effective := o.Snapshot()
+	if effective != nil {
+		effective.ApplyDefaults()
+	}
+	return effective
+}
+
+// Changes returns a channel that receives a new snapshot of the config
+// whenever the file changes. Snapshots aren't dropped, so watching stops
+// until each one is received.
+func (o *Observer) Changes() <-chan *Config {
+	return o.changes
+}
+
+// Close stops observing the config file.
+func (o *Observer) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.stop)
+		o.file.Close()
+	})
+	return nil
+}
+
+func (o *Observer) watch(changed <-chan struct{}) {
+	for {
+		select {
+		case <-changed:
+		case <-o.stop:
+			return
+		}
+		cfg, err := o.reload()
+		if err != nil {
+			// Most likely caught the file in the middle of being rewritten,
+			// we'll be notified again once the write is done
+			log.Debugf("Unable to read observed config: %v", err)
+			continue
+		}
+		if cfg == nil {
+			continue
+		}
+		select {
+		case o.changes <- cfg:
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+// reload reads the config file, returning a snapshot of the config if it
+// changed since it was last read and nil otherwise.
+func (o *Observer) reload() (*Config, error) {
+	data, err := readConfigFile(o.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Config file is empty")
+	}
+	o.mx.RLock()
+	unchanged := bytes.Equal(data, o.stored)
+	o.mx.RUnlock()
+	if unchanged {
+		return nil, nil
+	}
+	flattened, err := flattenDocuments(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to flatten config: %v", err)
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(flattened, cfg); err != nil {
+		return nil, fmt.Errorf("Unable to parse config: %v", err)
+	}
+	o.mx.Lock()
+	o.current = cfg
+	o.stored = data
+	o.mx.Unlock()
+	return snapshotOf(cfg), nil
+}
+
+// snapshotOf returns a copy of the given config for handing out, since
+// callers may change what they get, or nil if it can't be copied.
+func snapshotOf(cfg *Config) *Config {
+	copied := &Config{}
+	if err := deepcopy.Copy(copied, cfg); err != nil {
+		log.Errorf("Unable to copy observed config: %v", err)
+		return nil
+	}
+	return copied
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// awaitObserved waits for the given Observer to report a config with the given
+// UIAddr, returning whether it did.
+func awaitObserved(t *testing.T, o *Observer, uiAddr string) bool {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case cfg := <-o.Changes():
+			if cfg.UIAddr == uiAddr {
+				return true
+			}
+		case <-timeout:
+			t.Errorf("Observer didn't see UIAddr %v", uiAddr)
+			return false
+		}
+	}
+}
+
+func TestObserveManagedConfig(t *testing.T) {
+	defer useTempConfigDir(t)()
+	defer useTestFetcher()()
+	_, err := Init("2.1.0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer Stop()
+	mgr := m
+	go func() {
+		for {
+			mgr.Next()
+		}
+	}()
+	_, path, _ := InConfigDir(configFileName("2.1.0"))
+
+	o, err := Observe(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer o.Close()
+	assert.Equal(t, current().UIAddr, o.Snapshot().UIAddr)
+
+	for i := 1; i <= 5; i++ {
+		uiAddr := fmt.Sprintf("127.0.0.1:%d", 20000+i)
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.UIAddr = uiAddr
+			return nil
+		}))
+		assert.NoError(t, Flush())
+		if !awaitObserved(t, o, uiAddr) {
+			return
+		}
+		assert.Equal(t, uiAddr, o.Snapshot().UIAddr)
+	}
+
+	// Replacing the file with a rename, after catching it half written
+	data, err := ioutil.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, ioutil.WriteFile(path, data[:len(data)/2], 0644))
+	tmp := filepath.Join(filepath.Dir(path), "lantern.yaml.tmp")
+	assert.NoError(t, ioutil.WriteFile(tmp, append(data, []byte("uiaddr: 127.0.0.1:30000\n")...), 0644))
+	assert.NoError(t, os.Rename(tmp, path))
+	awaitObserved(t, o, "127.0.0.1:30000")
+}
+
+func TestObserverNeverWritesOrAppliesDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "observe")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lantern.yaml")
+	data := []byte("cloudconfigs:\n- http://config.example.com/cloud.yaml.gz\n")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0444))
+
+	o, err := Observe(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer o.Close()
+	snapshot := o.Snapshot()
+	assert.Empty(t, snapshot.Addr, "Snapshot should not have defaults")
+	assert.Nil(t, snapshot.ProxiedSites)
+	effective := o.EffectiveSnapshot()
+	assert.Equal(t, "127.0.0.1:8787", effective.Addr, "Effective snapshot should have defaults")
+	assert.NotEmpty(t, effective.ProxiedSites.Cloud)
+	assert.Empty(t, o.Snapshot().Addr, "Effective snapshot should not change what's observed")
+
+	time.Sleep(100 * time.Millisecond)
+	after, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(data), string(after), "Observer should not have written config")
+	}
+	assert.Equal(t, []string{"lantern.yaml"}, filesIn(t, dir), "Observer should not have created files")
+
+	_, err = Observe(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
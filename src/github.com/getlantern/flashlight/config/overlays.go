@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/getlantern/jibber_jabber"
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// overlaysKey is the section of cloud config that holds the overlays for
+	// countries, keyed by ISO 3166 country code, like:
+	//
+	//   overlays:
+	//     IR:
+	//       client:
+	//         masqueradesets:
+	//           cloudfront: [...]
+	//
+	// The overlay for the country we're in is merged on top of the rest of
+	// the cloud config like a later document, see flattenDocuments, so that
+	// one cloud config can carry region specific servers and masquerades.
+	overlaysKey = "overlays"
+)
+
+var (
+	// geoCountry returns the country we're in according to GeoIP, or "" if
+	// that's not known yet, see WithCountry
+	geoCountry func() string
+
+	// localeTerritory returns the territory of the system locale
+	localeTerritory = jibber_jabber.DetectTerritory
+)
+
+// WithCountry makes us apply the cloud config overlays for the country that
+// the given function says we're in, like one looked up by GeoIP, which
+// returns "" until it's known. Without it, or until it's known, we go by the
+// territory of the system locale. Either way, a territory set in the config
+// takes precedence.
+func WithCountry(country func() string) Option {
+	return func(o *options) {
+		o.country = country
+	}
+}
+
+// overlayCountry returns the 2-letter code of the country whose cloud config
+// overlay applies to this Config, or "" if we don't know where we are.
+func (cfg *Config) overlayCountry() string {
+	if cfg.Client != nil && cfg.Client.Territory != "" {
+		return strings.ToUpper(cfg.Client.Territory)
+	}
+	if geoCountry != nil {
+		if country := strings.ToUpper(geoCountry()); isTerritoryCode(country) {
+			return country
+		}
+	}
+	if territory, err := localeTerritory(); err == nil {
+		if territory = strings.ToUpper(territory); isTerritoryCode(territory) {
+			return territory
+		}
+	}
+	return ""
+}
+
+// hasOverlays returns whether the given cloud config YAML may have overlays,
+// so that configs without them aren't parsed an extra time.
+func hasOverlays(data []byte) bool {
+	return hasTopLevelKey(data, overlaysKey)
+}
+
+// hasTopLevelKey returns whether the given YAML may have the given top level
+// key.
+func hasTopLevelKey(data []byte, key string) bool {
+	prefix := []byte(key + ":")
+	return bytes.HasPrefix(data, prefix) || bytes.Contains(data, append([]byte("\n"), prefix...))
+}
+
+// applyCountryOverlay merges the overlay for the given country in the given
+// single document cloud config YAML on top of the rest of it, returning the
+// result without the overlays.
+func applyCountryOverlay(data []byte, country string) ([]byte, error) {
+	if !hasOverlays(data) {
+		return data, nil
+	}
+	var tree map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	overlays, ok := tree[overlaysKey].(map[interface{}]interface{})
+	if !ok && tree[overlaysKey] != nil {
+		return nil, fmt.Errorf("%v should map countries to overlays", overlaysKey)
+	}
+	delete(tree, overlaysKey)
+	for key, over := range overlays {
+		code, _ := key.(string)
+		if country == "" || !strings.EqualFold(code, country) {
+			continue
+		}
+		overMap, ok := over.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Overlay for %v should be a map", code)
+		}
+		log.Debugf("Applying cloud config overlay for %v", country)
+		overlay(tree, overMap)
+	}
+	return yaml.Marshal(tree)
+}
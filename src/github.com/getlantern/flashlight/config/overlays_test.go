@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/getlantern/flashlight/config/configtest"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+const overlaidConfig = "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n" +
+	"overlays:\n  IR:\n    client:\n      chainedservers:\n        fallback-ir:\n          addr: 2.2.2.2:443\n" +
+	"  cn:\n    client:\n      chainedservers:\n        fallback-1:\n          addr: 3.3.3.3:443\n"
+
+// useLocaleTerritory makes the system locale say we're in the given territory.
+// It returns a function that restores the original.
+func useLocaleTerritory(territory string) func() {
+	orig := localeTerritory
+	localeTerritory = func() (string, error) {
+		if territory == "" {
+			return "", errors.New("No territory")
+		}
+		return territory, nil
+	}
+	return func() {
+		localeTerritory = orig
+	}
+}
+
+func TestApplyCountryOverlay(t *testing.T) {
+	servers := func(data []byte) map[string]string {
+		cfg := &Config{}
+		if !assert.NoError(t, yaml.Unmarshal(data, cfg)) {
+			return nil
+		}
+		addrs := make(map[string]string)
+		for name, server := range cfg.Client.ChainedServers {
+			addrs[name] = server.Addr
+		}
+		return addrs
+	}
+
+	plain := []byte(serversConfig("fallback-1", "1.1.1.1:443"))
+	same, err := applyCountryOverlay(plain, "IR")
+	if assert.NoError(t, err) {
+		assert.Equal(t, plain, same, "Config without overlays should be left alone")
+	}
+
+	for country, expected := range map[string]map[string]string{
+		"":   {"fallback-1": "1.1.1.1:443"},
+		"US": {"fallback-1": "1.1.1.1:443"},
+		"IR": {"fallback-1": "1.1.1.1:443", "fallback-ir": "2.2.2.2:443"},
+		"CN": {"fallback-1": "3.3.3.3:443"},
+	} {
+		overlaid, err := applyCountryOverlay([]byte(overlaidConfig), country)
+		if assert.NoError(t, err, country) {
+			assert.Equal(t, expected, servers(overlaid), "Servers for %q", country)
+			assert.False(t, hasOverlays(overlaid), "Overlays should be removed for %q", country)
+		}
+	}
+
+	_, err = applyCountryOverlay([]byte("overlays:\n  IR: true\n"), "IR")
+	assert.Error(t, err, "Overlay that isn't a map should be rejected")
+	_, err = applyCountryOverlay([]byte("overlays:\n- IR\n"), "IR")
+	assert.Error(t, err, "Overlays that aren't a map should be rejected")
+}
+
+func TestCountryOverlayFollowsCountry(t *testing.T) {
+	defer useTestFetcher()()
+	defer useLocaleTerritory("")()
+	srv := configtest.NewCloudConfigServer(overlaidConfig)
+	defer srv.Close()
+	defer restoreOptions()()
+	country := ""
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+		country: func() string {
+			return country
+		},
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+	addr := func(name string) string {
+		if server := current().Client.ChainedServers[name]; server != nil {
+			return server.Addr
+		}
+		return ""
+	}
+
+	poll()
+	assert.Equal(t, "1.1.1.1:443", addr("fallback-1"))
+	assert.Empty(t, addr("fallback-ir"), "No overlay should apply until we know where we are")
+
+	// Finding out where we are applies its overlay even though the cloud
+	// config hasn't changed
+	country = "ir"
+	poll()
+	assert.Equal(t, 1, srv.NotModified())
+	assert.Equal(t, "2.2.2.2:443", addr("fallback-ir"))
+
+	country = "CN"
+	poll()
+	assert.Equal(t, "3.3.3.3:443", addr("fallback-1"))
+	assert.Empty(t, addr("fallback-ir"), "Overlay for where we were should no longer apply")
+
+	// The territory in the config wins over where GeoIP says we are
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.Client.Territory = "IR"
+		return nil
+	}))
+	poll()
+	assert.Equal(t, "1.1.1.1:443", addr("fallback-1"))
+	assert.Equal(t, "2.2.2.2:443", addr("fallback-ir"))
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// sectionsKey is the key in a cloud config update that lists the sections
+	// it carries, for updates that only carry some, like:
+	//
+	//   sections: [proxiedsites]
+	//   proxiedsites:
+	//     cloud:
+	//     - example.com
+	//
+	// The sections it leaves out are left as they were rather than replaced,
+	// even if the update says something about them. Updates without it carry
+	// every section.
+	sectionsKey = "sections"
+
+	// Sections of the config that a partial update can carry, besides those
+	// that a rollout can gate
+	sectionProxiedSites = "proxiedsites"
+	sectionFeatures     = "features"
+)
+
+var (
+	// Where the settings in each section are in an update, as top level keys
+	// or as keys under client
+	sectionKeys = map[string][]string{
+		rolloutChainedServers: {"client", "chainedservers"},
+		rolloutFrontedServers: {"client", "frontedservers"},
+		rolloutMasqueradeSets: {"client", "masqueradesets"},
+		rolloutTrustedCAs:     {"trustedcas"},
+		sectionProxiedSites:   {"proxiedsites"},
+		sectionFeatures:       {"features", "featurerollouts"},
+	}
+)
+
+// updateSections is the set of sections that an update carries, nil if it
+// carries all of them.
+type updateSections map[string]bool
+
+// carries returns whether the update carries the given section.
+func (s updateSections) carries(section string) bool {
+	return s == nil || s[section]
+}
+
+// selectUpdateSections returns the given single document cloud config YAML
+// without the settings in the sections it doesn't carry, if it says which it
+// does, along with those sections.
+func selectUpdateSections(data []byte) ([]byte, updateSections, error) {
+	if !hasTopLevelKey(data, sectionsKey) {
+		return data, nil, nil
+	}
+	var tree map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, nil, err
+	}
+	listed, ok := tree[sectionsKey].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%v should list the sections in the update", sectionsKey)
+	}
+	delete(tree, sectionsKey)
+	sections := make(updateSections, len(listed))
+	for _, item := range listed {
+		name, _ := item.(string)
+		name = strings.ToLower(name)
+		if _, known := sectionKeys[name]; !known {
+			return nil, nil, fmt.Errorf("Unknown section %v in update, expected some of %v", item, sectionNames())
+		}
+		sections[name] = true
+	}
+	client, _ := tree["client"].(map[interface{}]interface{})
+	for section, keys := range sectionKeys {
+		if sections[section] {
+			continue
+		}
+		if keys[0] == "client" {
+			if client != nil {
+				delete(client, keys[1])
+			}
+			continue
+		}
+		for _, key := range keys {
+			delete(tree, key)
+		}
+	}
+	log.Debugf("Update only carries sections %v", strings.Join(sections.names(), ", "))
+	selected, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	return selected, sections, nil
+}
+
+// names returns the names of the sections, sorted.
+func (s updateSections) names() []string {
+	var names []string
+	for _, name := range sectionNames() {
+		if s[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// sectionNames returns the names of the sections an update can carry, sorted.
+func sectionNames() []string {
+	return []string{rolloutChainedServers, sectionFeatures, rolloutFrontedServers, rolloutMasqueradeSets, sectionProxiedSites, rolloutTrustedCAs}
+}
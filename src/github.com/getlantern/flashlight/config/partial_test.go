@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialUpdate(t *testing.T) {
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	full := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n" +
+		"  masqueradesets:\n    cloudfront:\n    - domain: example.com\n" +
+		"proxiedsites:\n  cloud:\n  - a.com\n" +
+		"features:\n  shown: true\n"
+	if !assert.NoError(t, cfg.updateFrom([]byte(full))) {
+		return
+	}
+
+	// Only the proxied sites, even though the update says something about
+	// the servers
+	sitesOnly := "sections: [ProxiedSites]\nproxiedsites:\n  cloud:\n  - b.com\nclient:\n  chainedservers:\n    fallback-2:\n      addr: 2.2.2.2:443\n"
+	if assert.NoError(t, cfg.updateFrom([]byte(sitesOnly))) {
+		assert.Equal(t, []string{"a.com", "b.com"}, cfg.ProxiedSites.Cloud)
+		assert.Len(t, cfg.Client.ChainedServers, 1, "Servers should be left as they were")
+		assert.NotNil(t, cfg.Client.ChainedServers["fallback-1"])
+		assert.Len(t, cfg.Client.MasqueradeSets["cloudfront"], 1, "Masquerades should be left as they were")
+		assert.True(t, cfg.Features["shown"], "Features should be left as they were")
+	}
+
+	serversOnly := "sections:\n- chainedservers\nclient:\n  chainedservers:\n    fallback-3:\n      addr: 3.3.3.3:443\n"
+	if assert.NoError(t, cfg.updateFrom([]byte(serversOnly))) {
+		assert.Len(t, cfg.Client.ChainedServers, 1, "Servers in the update should replace ours")
+		assert.NotNil(t, cfg.Client.ChainedServers["fallback-3"])
+		assert.Equal(t, []string{"a.com", "b.com"}, cfg.ProxiedSites.Cloud, "Proxied sites should be left as they were")
+		assert.Len(t, cfg.Client.MasqueradeSets["cloudfront"], 1, "Masquerades should be left as they were")
+	}
+
+	assert.Error(t, cfg.updateFrom([]byte("sections: [servers]\n")), "Unknown sections should be rejected")
+	assert.Error(t, cfg.updateFrom([]byte("sections: proxiedsites\n")), "Sections should be a list")
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-3"], "Rejected updates should change nothing")
+
+	if assert.NoError(t, cfg.updateFrom([]byte(full))) {
+		assert.Len(t, cfg.Client.ChainedServers, 1, "Full updates should replace everything")
+		assert.NotNil(t, cfg.Client.ChainedServers["fallback-1"])
+		assert.Len(t, cfg.Client.MasqueradeSets["cloudfront"], 1)
+	}
+}
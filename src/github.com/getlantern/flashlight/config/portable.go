@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// portableMarkerName is the name of the file beside the Lantern binary
+	// that turns on portable mode, as -portable does.
+	portableMarkerName = "portable"
+
+	// portableDirName is the name of the directory beside the Lantern binary
+	// in which everything is kept in portable mode.
+	portableDirName = "lantern-data"
+)
+
+var (
+	// executable returns the path to the running binary, replaceable for
+	// testing.
+	executable = os.Executable
+)
+
+// PortableDir returns the directory beside the Lantern binary in which config,
+// settings and logs are kept when running in portable mode, for example off a
+// USB stick, and whether we're running in portable mode. Portable mode is
+// turned on with -portable or by a file called "portable" beside the binary.
+func PortableDir() (string, bool) {
+	exe, err := executable()
+	if err != nil {
+		if *portable {
+			log.Errorf("Unable to find Lantern binary, not running portable: %v", err)
+		}
+		return "", false
+	}
+	exeDir := filepath.Dir(exe)
+	if !*portable {
+		if _, err := os.Stat(filepath.Join(exeDir, portableMarkerName)); err != nil {
+			return "", false
+		}
+	}
+	return filepath.Join(exeDir, portableDirName), true
+}
+
+// newPortableStore creates the store for the config in portable mode. If the
+// portable dir can't be written to, like on read-only media, the config is
+// instead kept in memory for this session, starting from the config that's
+// already there if any.
+func newPortableStore(dir string, version string) (ConfigStore, error) {
+	err := checkWritable(dir)
+	if err == nil {
+		return newFileStore(version)
+	}
+	log.Errorf("!!!! PORTABLE CONFIG DIR %v IS NOT WRITABLE, CONFIG CHANGES WILL BE LOST WHEN LANTERN EXITS: %v", dir, err)
+	reportError(PersistError, fmt.Errorf("Portable config dir %v is not writable, keeping config in memory: %v", dir, err), false)
+	return newMemoryStoreFrom(filepath.Join(dir, configFileName(version)))
+}
+
+// newReadOnlyStore creates a store for the config of the given version of
+// Lantern that keeps changes in memory, starting from the config in the config
+// file, for when another Lantern owns that file.
+func newReadOnlyStore(version string) (ConfigStore, error) {
+	_, configPath, err := InConfigDir(configFileName(version))
+	if err != nil {
+		return nil, err
+	}
+	return newMemoryStoreFrom(configPath)
+}
+
+// newMemoryStoreFrom creates a store that keeps the config in memory, starting
+// from a copy of the config file at the given path if there is one or the
+// packaged config otherwise.
+func newMemoryStoreFrom(configPath string) (ConfigStore, error) {
+	data, err := readConfigFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Unable to read config at %v, using packaged config: %v", configPath, err)
+	}
+	store := yamlconf.NewMemoryStore(data)
+	if err := prepareStore(store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// checkWritable returns an error if files can't be created in dir, creating
+// dir if necessary.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".writable")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
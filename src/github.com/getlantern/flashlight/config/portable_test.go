@@ -0,0 +1,111 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// usePortableBinary makes it look like the Lantern binary is in a temp dir,
+// with nothing telling us to run portable yet, and points HOME at an empty
+// temp dir. It returns the dir with the binary and the home dir.
+func usePortableBinary(t *testing.T) (string, string) {
+	exeDir := t.TempDir()
+	origExecutable := executable
+	executable = func() (string, error) {
+		return filepath.Join(exeDir, "lantern"), nil
+	}
+	origConfigdir, origPortable := *configdir, *portable
+	*configdir, *portable = "", false
+	home := t.TempDir()
+	origHome, origXDG := os.Getenv("HOME"), os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("HOME", home)
+	os.Unsetenv("XDG_CONFIG_HOME")
+	t.Cleanup(func() {
+		executable = origExecutable
+		*configdir, *portable = origConfigdir, origPortable
+		os.Setenv("HOME", origHome)
+		os.Setenv("XDG_CONFIG_HOME", origXDG)
+	})
+	return exeDir, home
+}
+
+func TestPortableDetection(t *testing.T) {
+	exeDir, _ := usePortableBinary(t)
+	expected := filepath.Join(exeDir, portableDirName)
+
+	_, ok := PortableDir()
+	assert.False(t, ok, "Should not run portable without flag or marker")
+
+	*portable = true
+	dir, ok := PortableDir()
+	assert.True(t, ok, "Flag should turn on portable mode")
+	assert.Equal(t, expected, dir)
+
+	*portable = false
+	if err := ioutil.WriteFile(filepath.Join(exeDir, portableMarkerName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir, ok = PortableDir()
+	assert.True(t, ok, "Marker should turn on portable mode")
+	assert.Equal(t, expected, dir)
+
+	configDir, _, err := InConfigDir("lantern-2.1.0.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, configDir, "Config dir should be beside the binary")
+	}
+	flagged := t.TempDir()
+	*configdir = flagged
+	configDir, _, err = InConfigDir("lantern-2.1.0.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, flagged, configDir, "-configdir should win over portable mode")
+	}
+}
+
+func TestPortableInitLeavesNoTraces(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	exeDir, home := usePortableBinary(t)
+	*portable = true
+
+	_, err := Init("2.1.0", WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	Stop()
+	_, err = os.Stat(filepath.Join(exeDir, portableDirName, configFileName("2.1.0")))
+	assert.NoError(t, err, "Config should have been saved beside the binary")
+	inHome, err := ioutil.ReadDir(home)
+	if assert.NoError(t, err) {
+		assert.Empty(t, inHome, "Nothing should have been written to the user's profile")
+	}
+}
+
+func TestPortableReadOnly(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	collected, restore := collectErrors()
+	defer restore()
+	exeDir, home := usePortableBinary(t)
+	*portable = true
+	// A file in the way of the portable dir is as unwritable as read-only
+	// media, even for root
+	if err := ioutil.WriteFile(filepath.Join(exeDir, portableDirName), nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Init("2.1.0", WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err, "Should have fallen back to keeping config in memory") {
+		return
+	}
+	defer Stop()
+	assert.NotNil(t, cfg.Client, "Should have used the packaged config")
+	assert.Contains(t, categoriesOf(*collected), PersistError, "Should have warned that config won't be saved")
+	inHome, err := ioutil.ReadDir(home)
+	if assert.NoError(t, err) {
+		assert.Empty(t, inHome, "Nothing should have been written to the user's profile")
+	}
+}
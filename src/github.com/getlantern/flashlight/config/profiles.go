@@ -0,0 +1,268 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getlantern/yaml"
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// DefaultProfile is the config profile kept in the usual config file.
+	DefaultProfile = "default"
+
+	// profilesDirName is the directory in the config dir where we keep the
+	// config files of the profiles other than DefaultProfile.
+	profilesDirName = "profiles"
+
+	// profileSelectionName is the file in the config dir that names the
+	// profile in use, so that it's used again in the next session. Without it,
+	// DefaultProfile is used.
+	profileSelectionName = "config-profile"
+)
+
+var (
+	// ErrProfilesUnsupported is returned by UseProfile when the config isn't
+	// kept in a config file that we own, like when it's kept in a store given
+	// with WithStore or when another Lantern is running.
+	ErrProfilesUnsupported = errors.New("Config profiles need a config file of our own")
+
+	profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+	// Whether the config is kept in a config file of ours, so that profiles
+	// can be used
+	profilesSupported bool
+	// The profile in use
+	currentProfile = DefaultProfile
+	// Held while switching profiles
+	profileMx sync.Mutex
+)
+
+// CurrentProfile returns the name of the config profile in use.
+func CurrentProfile() string {
+	profileMx.Lock()
+	defer profileMx.Unlock()
+	return currentProfile
+}
+
+// Profiles returns the names of the config profiles, sorted. DefaultProfile
+// is always one of them.
+func Profiles() ([]string, error) {
+	_, dir, err := InConfigDir(profilesDirName)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{DefaultProfile}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to list config profiles: %v", err)
+	}
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), ".yaml")
+		if info.Mode().IsRegular() && name != info.Name() && name != DefaultProfile && profileNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// UseProfile switches to the config profile with the given name, returning
+// once its config has been applied. Profiles let users keep several variants
+// of the config, like one for work and one for travel. A profile that doesn't
+// exist yet starts out as a copy of the current config. Names are up to 32
+// lowercase letters, digits, dashes and underscores. The profile stays in use
+// in later sessions until another one is chosen.
+func UseProfile(name string) error {
+	if m == nil {
+		return fmt.Errorf("Configuration system not initialized")
+	}
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid config profile name %q", name)
+	}
+	profileMx.Lock()
+	defer profileMx.Unlock()
+	if !profilesSupported {
+		return ErrProfilesUnsupported
+	}
+	if name == currentProfile {
+		return nil
+	}
+	path, err := profileConfigPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Debugf("Creating config profile %v from profile %v", name, currentProfile)
+		if err := copyCurrentConfig(path); err != nil {
+			return fmt.Errorf("Unable to create config profile %v: %v", name, err)
+		}
+	}
+	store, file, err := openProfile(path)
+	if err != nil {
+		return err
+	}
+
+	// What we know about the cloud configs we last fetched is about the
+	// config we're leaving, and the one we're switching to remembers its own
+	pollMx.Lock()
+	interruptFetch()
+	for url := range lastCloudConfigChecksum {
+		forgetCloudConfig(url)
+	}
+	for url := range lastCloudConfigETag {
+		forgetCloudConfig(url)
+	}
+	takeStaleCloudCache()
+	err = m.SwitchStore(&reportingStore{store})
+	pollMx.Unlock()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Unable to switch to config profile %v: %v", name, err)
+	}
+	log.Debugf("Switched to config profile %v", name)
+	configFile = file
+	currentProfile = name
+	applyFilePollInterval(current())
+	if err := saveProfileSelection(name); err != nil {
+		log.Error(err)
+		reportError(PersistError, err, false)
+	}
+	return nil
+}
+
+// DeleteProfile deletes the config profile with the given name, which can't
+// be DefaultProfile or the one in use.
+func DeleteProfile(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid config profile name %q", name)
+	}
+	profileMx.Lock()
+	defer profileMx.Unlock()
+	if name == DefaultProfile {
+		return fmt.Errorf("The default config profile can't be deleted")
+	}
+	if name == currentProfile {
+		return fmt.Errorf("Unable to delete config profile %v, which is in use", name)
+	}
+	path, err := profileConfigPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("Unable to delete config profile %v: %v", name, err)
+	}
+	return nil
+}
+
+// profileConfigPath returns the path of the config file of the profile with
+// the given name.
+func profileConfigPath(name string) (string, error) {
+	if name == DefaultProfile {
+		_, path, err := InConfigDir(configFileName(runningVersion))
+		return path, err
+	}
+	_, dir, err := InConfigDir(profilesDirName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("Unable to create config profiles dir: %v", err)
+	}
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+// copyCurrentConfig saves the current config to the config file at path,
+// encrypting it if the config is kept encrypted.
+func copyCurrentConfig(path string) error {
+	data, err := yaml.Marshal(current())
+	if err != nil {
+		return err
+	}
+	return newEncryptingStore(yamlconf.NewFileStore(path), encryptionFlag()).Save(data)
+}
+
+// openProfile migrates the config file at path to the current schema if
+// necessary and returns a store for it along with the underlying file store.
+func openProfile(path string) (*encryptingStore, *yamlconf.FileStore, error) {
+	if err := migrateConfigFile(path); err != nil {
+		// Keep going with the unmigrated config, which may still be usable
+		log.Errorf("Unable to migrate config: %v", err)
+	}
+	file := yamlconf.NewFileStore(path)
+	store := newEncryptingStore(file, encryptionFlag())
+	if _, err := store.convert(); err != nil {
+		return nil, nil, fmt.Errorf("Unable to change encryption of config: %v", err)
+	}
+	return store, file, nil
+}
+
+// openSelectedProfile returns a store for the config profile that was in use
+// in the last session, given the store for DefaultProfile, which is returned
+// if that's the one or if the other one can't be opened.
+func openSelectedProfile(defaultStore ConfigStore) ConfigStore {
+	currentProfile = DefaultProfile
+	name := selectedProfile()
+	if name == DefaultProfile {
+		return defaultStore
+	}
+	path, err := profileConfigPath(name)
+	if err == nil {
+		_, err = os.Stat(path)
+	}
+	var store *encryptingStore
+	var file *yamlconf.FileStore
+	if err == nil {
+		store, file, err = openProfile(path)
+	}
+	if err != nil {
+		log.Errorf("Unable to use config profile %v, using default profile: %v", name, err)
+		return defaultStore
+	}
+	log.Debugf("Using config profile %v", name)
+	configFile = file
+	currentProfile = name
+	return store
+}
+
+// selectedProfile returns the name of the profile that was in use in the last
+// session.
+func selectedProfile() string {
+	data, err := ioutil.ReadFile(filepath.Join(configDirPath(), profileSelectionName))
+	if err != nil {
+		return DefaultProfile
+	}
+	name := strings.TrimSpace(string(data))
+	if !profileNamePattern.MatchString(name) {
+		return DefaultProfile
+	}
+	return name
+}
+
+// saveProfileSelection saves that the profile with the given name is in use.
+func saveProfileSelection(name string) error {
+	_, path, err := InConfigDir(profileSelectionName)
+	if err != nil {
+		return err
+	}
+	if name == DefaultProfile {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = ioutil.WriteFile(path, []byte(name+"\n"), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to save which config profile is in use: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+)
+
+// consumeUpdates takes the updates of the current manager like Run would.
+func consumeUpdates() {
+	mgr := m
+	go func() {
+		for {
+			mgr.Next()
+		}
+	}()
+}
+
+func TestProfiles(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	dir := t.TempDir()
+	setAutoReport := func(autoReport bool) {
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.AutoReport = &autoReport
+			return nil
+		}))
+	}
+
+	_, err := Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	consumeUpdates()
+	assert.Equal(t, DefaultProfile, CurrentProfile())
+	setAutoReport(false)
+
+	if !assert.NoError(t, UseProfile("travel")) {
+		return
+	}
+	assert.Equal(t, "travel", CurrentProfile())
+	assert.False(t, *current().AutoReport, "New profile should start as a copy of the current config")
+	setAutoReport(true)
+	assert.NoError(t, UseProfile(DefaultProfile))
+	assert.False(t, *current().AutoReport, "Default profile should have been left alone")
+	assert.NoError(t, UseProfile("travel"))
+	assert.True(t, *current().AutoReport, "Profile should keep its own config")
+	profiles, err := Profiles()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{DefaultProfile, "travel"}, profiles)
+	}
+	assert.Error(t, UseProfile("../travel"), "Profile names shouldn't be paths")
+	assert.Error(t, DeleteProfile("travel"), "Profile in use shouldn't be deleted")
+	assert.Error(t, DeleteProfile(DefaultProfile))
+	Stop()
+
+	// The profile stays in use in the next session
+	_, err = Init("2.1.0", WithConfigDir(dir), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	consumeUpdates()
+	assert.Equal(t, "travel", CurrentProfile())
+	assert.True(t, *current().AutoReport)
+	assert.NoError(t, UseProfile(DefaultProfile))
+	assert.NoError(t, DeleteProfile("travel"))
+	profiles, err = Profiles()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{DefaultProfile}, profiles)
+	}
+	Stop()
+}
+
+func TestProfilesNeedConfigFile(t *testing.T) {
+	defer useTestFetcher()()
+	defer restoreOptions()()
+	defer useTempConfigDir(t)()
+	_, err := Init("2.1.0", WithStore(yamlconf.NewMemoryStore(nil)), WithBootstrapServers(noBootstrapServers))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer Stop()
+	consumeUpdates()
+	assert.Equal(t, ErrProfilesUnsupported, UseProfile("travel"))
+}
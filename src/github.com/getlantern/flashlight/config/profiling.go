@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	profilingHandlers   []func(cpuPath string, memPath string)
+	profilingHandlersMx sync.Mutex
+)
+
+// OnProfilingChange registers a function that's called whenever an update to
+// the config, whether from the cloud or through Update, changes CpuProfile or
+// MemProfile, so that profiling can be started and stopped without a restart.
+// It's called with the paths to which CPU and memory profiles should now be
+// saved, where an empty path means not to profile. Before returning, the
+// function must stop any profiling it started earlier whose path is no longer
+// given, flushing and closing its file. Paths are only ever inside the config
+// dir. Handlers are called synchronously and must not call Update.
+func OnProfilingChange(onChange func(cpuPath string, memPath string)) {
+	profilingHandlersMx.Lock()
+	profilingHandlers = append(profilingHandlers, onChange)
+	profilingHandlersMx.Unlock()
+}
+
+// profilingChanged passes the profile paths in the given Config to the
+// handlers registered with OnProfilingChange if the given diff changed them.
+func profilingChanged(cfg *Config, diff *ConfigDiff) {
+	changed := false
+	for _, field := range diff.Fields {
+		if strings.HasPrefix(field, "CpuProfile:") || strings.HasPrefix(field, "MemProfile:") {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	cpuPath := profilePath("CpuProfile", cfg.CpuProfile)
+	memPath := profilePath("MemProfile", cfg.MemProfile)
+	log.Debugf("Profiling changed, cpu: %q mem: %q", cpuPath, memPath)
+	profilingHandlersMx.Lock()
+	handlers := make([]func(string, string), len(profilingHandlers))
+	copy(handlers, profilingHandlers)
+	profilingHandlersMx.Unlock()
+	for _, handler := range handlers {
+		handler(cpuPath, memPath)
+	}
+}
+
+// profilePath resolves the given profile path relative to the config dir,
+// returning an empty path, so that nothing is profiled, if it's outside of
+// the config dir.
+func profilePath(field string, path string) string {
+	if path == "" {
+		return ""
+	}
+	dir, _, err := InConfigDir("")
+	if err != nil {
+		reportError(PersistError, fmt.Errorf("Unable to find config dir for %v: %v", field, err), false)
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		reportError(ValidateError, fmt.Errorf("Not profiling to %v at %v, which is outside of the config dir %v", field, path, dir), false)
+		return ""
+	}
+	return path
+}
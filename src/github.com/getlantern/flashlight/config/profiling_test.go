@@ -0,0 +1,45 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfilingChanges(t *testing.T) {
+	defer initTestConfig(t, "addr: localhost:8787\n")()
+	collected, restore := collectErrors()
+	defer restore()
+	var calls [][2]string
+	OnProfilingChange(func(cpuPath string, memPath string) {
+		calls = append(calls, [2]string{cpuPath, memPath})
+	})
+	defer func() {
+		profilingHandlers = nil
+	}()
+	dir, _, _ := InConfigDir("")
+	update := func(cpu string, mem string) {
+		assert.NoError(t, Update(func(cfg *Config) error {
+			cfg.CpuProfile, cfg.MemProfile = cpu, mem
+			return nil
+		}))
+	}
+
+	update("cpu.prof", "")
+	update("cpu.prof", "")
+	update("cpu.prof", filepath.Join(dir, "mem.prof"))
+	update("", "")
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.UIAddr = "localhost:16823"
+		return nil
+	}))
+	update("../cpu.prof", "/etc/mem.prof")
+	assert.Equal(t, [][2]string{
+		{filepath.Join(dir, "cpu.prof"), ""},
+		{filepath.Join(dir, "cpu.prof"), filepath.Join(dir, "mem.prof")},
+		{"", ""},
+		{"", ""},
+	}, calls, "Should have been called with paths in the config dir only when profiling changed")
+	assert.Equal(t, []ErrorCategory{ValidateError, ValidateError}, categoriesOf(*collected), "Paths outside of the config dir should have been reported")
+}
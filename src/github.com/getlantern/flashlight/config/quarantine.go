@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// When cloud config is rejected, for example because it doesn't parse or
+// because we rolled back from it after it was reported unhealthy, we
+// quarantine it: we keep its ETag so that following polls don't download it
+// again, and keep reporting why it was rejected so that operators can see that
+// clients are refusing what's published. The quarantine ends when a new cloud
+// config is applied, for one poll when the user asks us to Refresh or, for
+// cloud config we're only holding off on for a while, when that's over.
+
+// quarantineRecord describes the cloud config we rejected last.
+type quarantineRecord struct {
+	url      string
+	etag     string
+	reason   string
+	category ErrorCategory
+	since    time.Time
+	until    time.Time // when the quarantine lapses, or zero if it doesn't
+}
+
+var (
+	quarantined  *quarantineRecord
+	quarantineMx sync.Mutex
+)
+
+// Refresh polls for cloud config right away, downloading it again even if we
+// rejected what's currently published, for example because the user suspects
+// it was mangled on the way. A poll already in progress is interrupted rather
+// than waited for.
+func Refresh() {
+	if m == nil {
+		return
+	}
+	quarantineMx.Lock()
+	record := quarantined
+	quarantineMx.Unlock()
+	pollMx.Lock()
+	interruptFetch()
+	if record != nil {
+		log.Debugf("Refreshing cloud config %v despite quarantine", record.etag)
+		forgetCloudConfig(record.url)
+	}
+	pollMx.Unlock()
+	pollNow()
+}
+
+// forgetCloudConfig forgets what we know about the last cloud config fetched
+// from the given URL, so that it's downloaded and applied again even if it's
+// unchanged. pollMx must be held.
+func forgetCloudConfig(url string) {
+	delete(lastCloudConfigETag, url)
+	delete(lastCloudConfigModified, url)
+	delete(lastCloudConfigChecksum, url)
+	delete(lastCloudConfigPayload, url)
+	delete(lastCloudConfigWire, url)
+	delete(lastCloudConfigIdentity, url)
+}
+
+// quarantineCloudConfig quarantines the cloud config with the given ETag
+// fetched from the given URL, which was rejected with the given error.
+func quarantineCloudConfig(url string, etag string, rejected error, at time.Time) {
+	record := &quarantineRecord{url: url, etag: etag, reason: rejected.Error(), category: categoryOf(rejected), since: at}
+	if flapping, ok := rejected.(*flappingError); ok {
+		record.until = flapping.until
+	}
+	quarantineMx.Lock()
+	if quarantined != nil && quarantined.url == url && quarantined.etag == etag {
+		// Refreshed and rejected again
+		record.since = quarantined.since
+	}
+	quarantined = record
+	quarantineMx.Unlock()
+	log.Errorf("Quarantined cloud config %v: %v", etag, rejected)
+	reportQuarantine(record)
+	updatePollState(func(state *PollState) {
+		state.QuarantinedETag = record.etag
+		state.QuarantineReason = redactURLCredentials(record.reason)
+		state.QuarantinedSince = record.since
+		state.RequiredVersion = ""
+		if required, ok := rejected.(*VersionRequiredError); ok {
+			state.RequiredVersion = required.Required
+		}
+	})
+}
+
+// endLapsedQuarantine forgets the cloud config we quarantined if its
+// quarantine lapsed by the given time, so that the next poll downloads it and
+// gives it another chance. pollMx must be held.
+func endLapsedQuarantine(now time.Time) {
+	quarantineMx.Lock()
+	record := quarantined
+	quarantineMx.Unlock()
+	if record == nil || record.until.IsZero() || now.Before(record.until) {
+		return
+	}
+	log.Debugf("Quarantine of cloud config %v lapsed, downloading it again", record.etag)
+	forgetCloudConfig(record.url)
+}
+
+// stillQuarantined reports the quarantine again if the cloud config fetched
+// from the given URL is unchanged since we quarantined it.
+func stillQuarantined(url string) {
+	quarantineMx.Lock()
+	record := quarantined
+	quarantineMx.Unlock()
+	if record != nil && record.url == url {
+		log.Debugf("Cloud config %v is still quarantined", record.etag)
+		reportQuarantine(record)
+	}
+}
+
+// clearQuarantine ends the quarantine, if any, now that we've applied cloud
+// config.
+func clearQuarantine() {
+	quarantineMx.Lock()
+	record := quarantined
+	quarantined = nil
+	quarantineMx.Unlock()
+	if record == nil {
+		return
+	}
+	log.Debugf("Ended quarantine of cloud config %v", record.etag)
+	updatePollState(func(state *PollState) {
+		state.QuarantinedETag = ""
+		state.QuarantineReason = ""
+		state.QuarantinedSince = time.Time{}
+		state.RequiredVersion = ""
+	})
+}
+
+func reportQuarantine(record *quarantineRecord) {
+	reportError(record.category, fmt.Errorf("Refusing cloud config %v: %v", record.etag, record.reason), false)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestQuarantineRejectedCloudConfig(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	origState := pollState
+	pollState = PollState{}
+	defer func() {
+		pollState = origState
+	}()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+
+	// Returns whether the poll applied cloud config
+	poll := func() bool {
+		mutate, _, err := pollForConfig(current())
+		if !assert.NoError(t, err) {
+			return false
+		}
+		return m.Update(mutate) == nil
+	}
+	downloads := func() int {
+		return srv.Requests() - srv.NotModified()
+	}
+
+	assert.True(t, poll())
+	assert.Equal(t, 1, downloads())
+	assert.Empty(t, DebugState().QuarantinedETag)
+
+	// A bad publish is downloaded once and then skipped
+	srv.SetConfig("proxiedsites:\n  cloud: [\n")
+	assert.False(t, poll(), "Bad config should have been rejected")
+	assert.Equal(t, 2, downloads())
+	state := DebugState()
+	badETag := state.QuarantinedETag
+	assert.NotEmpty(t, badETag)
+	assert.NotEmpty(t, state.QuarantineReason)
+	since := state.QuarantinedSince
+	assert.False(t, since.IsZero())
+	if assert.NotEmpty(t, *collected) {
+		last := (*collected)[len(*collected)-1]
+		assert.Equal(t, ParseError, last.Category)
+		assert.True(t, strings.Contains(last.Error(), badETag), "Error should name the quarantined config")
+	}
+	assert.True(t, poll(), "Poll of quarantined config should do nothing")
+	assert.Equal(t, 2, downloads(), "Quarantined config should not have been downloaded again")
+	assert.Equal(t, badETag, DebugState().QuarantinedETag)
+
+	// Another bad publish replaces the quarantine
+	srv.SetConfig("proxiedsites:\n  cloud: {\n")
+	assert.False(t, poll())
+	assert.Equal(t, 3, downloads())
+	secondETag := DebugState().QuarantinedETag
+	assert.NotEqual(t, badETag, secondETag)
+
+	// Refreshing bypasses the quarantine once
+	Refresh()
+	assert.Equal(t, 4, downloads(), "Refresh should have downloaded quarantined config")
+	assert.Equal(t, secondETag, DebugState().QuarantinedETag, "Config should still be quarantined")
+	assert.True(t, poll())
+	assert.Equal(t, 4, downloads(), "Quarantine should have resumed after refreshing")
+
+	// A good publish is applied and ends the quarantine
+	srv.SetConfig("proxiedsites:\n  cloud:\n  - b.com\n")
+	assert.True(t, poll())
+	assert.Equal(t, 5, downloads())
+	assert.Contains(t, current().ProxiedSites.Cloud, "b.com")
+	state = DebugState()
+	assert.Empty(t, state.QuarantinedETag)
+	assert.Empty(t, state.QuarantineReason)
+	assert.True(t, state.QuarantinedSince.IsZero())
+}
+
+func TestRefreshInterruptsPollInProgress(t *testing.T) {
+	defer useTestFetcher()()
+	var requests int32
+	hanging := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(hanging)
+			<-req.Context().Done()
+			return
+		}
+		resp.Write(gzipped(t, "proxiedsites:\n  cloud:\n  - a.com\n"))
+	}))
+	defer srv.Close()
+	configURL := srv.URL + "/cloud.yaml.gz"
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       configURL,
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+configURL+"\n")()
+
+	polled := make(chan error, 1)
+	go func() {
+		mutate, _, err := pollForConfig(current())
+		if err == nil {
+			err = m.Update(mutate)
+		}
+		polled <- err
+	}()
+	select {
+	case <-hanging:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Poll never fetched")
+	}
+
+	refreshed := make(chan struct{})
+	go func() {
+		Refresh()
+		close(refreshed)
+	}()
+	select {
+	case <-refreshed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Refresh should not have waited for the poll in progress")
+	}
+	select {
+	case err := <-polled:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Interrupted poll should have returned")
+	}
+	assert.Equal(t, 0, failedPolls, "Interrupted poll should not count as failed")
+	assert.Empty(t, current().LastCloudError)
+	assert.Contains(t, current().ProxiedSites.Cloud, "a.com", "Refresh should have applied the cloud config")
+}
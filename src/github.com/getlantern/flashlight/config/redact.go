@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/getlantern/deepcopy"
+)
+
+const (
+	redacted = "<redacted>"
+)
+
+// redactedCopy returns a deep copy of this Config with secrets (like the auth
+// tokens of chained servers) masked so that it can be safely displayed or
+// logged. The copy shares the cloud proxied sites with this Config, so callers
+// must not change them.
+func (cfg *Config) redactedCopy() (*Config, error) {
+	copied := &Config{}
+	if err := deepcopy.Copy(copied, withoutCloudSites(cfg)); err != nil {
+		return nil, fmt.Errorf("Unable to copy config: %v", err)
+	}
+	// There's nothing to redact in the cloud proxied sites, and there can be
+	// tens of thousands of them, so they're shared rather than copied
+	if copied.ProxiedSites != nil {
+		copied.ProxiedSites.Cloud = cfg.ProxiedSites.Cloud
+	}
+	if copied.UserToken != "" {
+		copied.UserToken = redacted
+	}
+	if copied.Client != nil {
+		for _, server := range copied.Client.ChainedServers {
+			if server.AuthToken != "" {
+				server.AuthToken = redacted
+			}
+		}
+	}
+	return copied, nil
+}
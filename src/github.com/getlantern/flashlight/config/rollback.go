@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/getlantern/keyman"
+	"github.com/getlantern/yamlconf"
+)
+
+const (
+	// appliedCloudConfigName is the name of the files in the config dir that
+	// keep the cloud configs we applied most recently, 1 being the current
+	// one, 2 the one before it and so on.
+	appliedCloudConfigName = "cloud-applied.%d.yaml.gz"
+
+	// defaultKeepCloudConfigs is how many of the cloud configs we applied most
+	// recently we keep when the config doesn't say.
+	defaultKeepCloudConfigs = 3
+)
+
+var (
+	// ErrNothingToRollBackTo is returned by Rollback when we haven't kept an
+	// earlier cloud config.
+	ErrNothingToRollBackTo = errors.New("No earlier cloud config to roll back to")
+)
+
+// rolledBackError is why a cloud config that was rolled back with Rollback is
+// quarantined.
+type rolledBackError struct {
+	to string
+}
+
+func (e *rolledBackError) Error() string {
+	return fmt.Sprintf("Rolled back to cloud config %v", e.to)
+}
+
+// appliedCloudConfigPath returns the path of the nth most recently applied
+// cloud config, starting from 1.
+func appliedCloudConfigPath(n int) (string, error) {
+	_, path, err := InConfigDir(fmt.Sprintf(appliedCloudConfigName, n))
+	return path, err
+}
+
+// keepCloudConfigs returns KeepCloudConfigs, or its default if it's not set.
+func (cfg *Config) keepCloudConfigs() int {
+	if cfg == nil || cfg.KeepCloudConfigs <= 0 {
+		return defaultKeepCloudConfigs
+	}
+	return cfg.KeepCloudConfigs
+}
+
+// rememberAppliedCloudConfig keeps the given cloud config payload, which we
+// just applied and which was fetched at the given time with the given ETag,
+// as the current one for Rollback, along with up to keep-1 earlier ones.
+func rememberAppliedCloudConfig(payload []byte, etag string, fetched time.Time, keep int) {
+	err := rotateAppliedCloudConfigs(keep)
+	if err == nil {
+		var path string
+		path, err = appliedCloudConfigPath(1)
+		if err == nil {
+			err = writeCloudPayload(path, payload, etag, fetched)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Unable to keep cloud config for rolling back: %v", err)
+		log.Error(err)
+		reportError(PersistError, err, false)
+	}
+}
+
+// rotateAppliedCloudConfigs makes room for a new current cloud config, moving
+// the ones we keep back a place and dropping the oldest one.
+func rotateAppliedCloudConfigs(keep int) error {
+	for n := keep - 1; n >= 1; n-- {
+		from, err := appliedCloudConfigPath(n)
+		if err != nil {
+			return err
+		}
+		to, err := appliedCloudConfigPath(n + 1)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropCurrentCloudConfig moves the cloud configs we keep forward a place,
+// dropping the current one, up to the given number kept.
+func dropCurrentCloudConfig(keep int) error {
+	for n := 1; n < keep; n++ {
+		from, err := appliedCloudConfigPath(n + 1)
+		if err != nil {
+			return err
+		}
+		to, err := appliedCloudConfigPath(n)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			if os.IsNotExist(err) {
+				// The rest were never kept
+				return nil
+			}
+			return err
+		}
+	}
+	last, err := appliedCloudConfigPath(keep)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(last); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Rollback replaces the cloud settings of the current config with those of
+// the cloud config we applied before the current one, for example when the
+// user finds that the current one doesn't work. The current cloud config is
+// quarantined, so it's not applied again until a new one is published.
+// Rollback returns ErrNothingToRollBackTo if we haven't kept an earlier one.
+func Rollback() error {
+	if m == nil {
+		return fmt.Errorf("Configuration system not initialized")
+	}
+	cfg := current()
+	keep := cfg.keepCloudConfigs()
+	currentPath, err := appliedCloudConfigPath(1)
+	if err != nil {
+		return err
+	}
+	path, err := appliedCloudConfigPath(2)
+	if err != nil {
+		return err
+	}
+	payload, etag, fetched, err := readCloudPayload(path)
+	if os.IsNotExist(err) {
+		return ErrNothingToRollBackTo
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read earlier cloud config: %v", err)
+	}
+	_, currentETag, _, err := readCloudPayload(currentPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Debugf("Unable to read current cloud config: %v", err)
+	}
+	log.Debugf("Rolling back to cloud config %v", etag)
+	err = m.Update(func(ycfg yamlconf.Config) error {
+		cfg := ycfg.(*Config)
+		provenance := cfg.CloudProvenance
+		cfg.CloudProvenance = cloudProvenanceRolledBack
+		if err := cfg.updateFrom(payload); err != nil {
+			cfg.CloudProvenance = provenance
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to roll back to cloud config %v: %v", etag, err)
+	}
+	if err := dropCurrentCloudConfig(keep); err != nil {
+		log.Errorf("Unable to drop rolled back cloud config: %v", err)
+	}
+
+	healthMx.Lock()
+	url := health.url
+	health = healthState{url: url, etag: etag, payload: payload, fetched: fetched}
+	healthMx.Unlock()
+	if url == "" {
+		url = cfg.cloudConfigURLs()[0]
+	}
+	if currentETag != "" {
+		quarantineCloudConfig(url, currentETag, &rolledBackError{etag}, wallClock())
+	}
+	return nil
+}
+
+// dialableChainedServers returns how many of our chained servers we could
+// dial, as far as we can tell without dialing them.
+func (cfg *Config) dialableChainedServers() int {
+	if cfg.Client == nil {
+		return 0
+	}
+	dialable := 0
+	for _, server := range cfg.Client.ChainedServers {
+		if validateAddr(server.Addr) != nil {
+			continue
+		}
+		if server.Cert != "" {
+			if _, err := keyman.LoadCertificateFromPEMBytes([]byte(server.Cert)); err != nil {
+				continue
+			}
+		}
+		dialable++
+	}
+	return dialable
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func TestRollback(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(serversConfig("fallback-1", "1.1.1.1:443"))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\nkeepcloudconfigs: 2\n")()
+	defer func() {
+		health = healthState{}
+	}()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+	servers := func() []string {
+		var names []string
+		for name := range current().Client.ChainedServers {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	poll()
+	assert.Equal(t, ErrNothingToRollBackTo, Rollback(), "Only one cloud config applied so far")
+
+	srv.SetConfig(serversConfig("fallback-2", "2.2.2.2:443"))
+	poll()
+	srv.SetConfig(serversConfig("fallback-3", "3.3.3.3:443"))
+	poll()
+	assert.Equal(t, []string{"fallback-3"}, servers())
+
+	if !assert.NoError(t, Rollback()) {
+		return
+	}
+	assert.Equal(t, []string{"fallback-2"}, servers(), "Should have rolled back to the previous cloud config")
+	assert.Equal(t, cloudProvenanceRolledBack, current().CloudProvenance)
+	assert.NotEmpty(t, DebugState().QuarantinedETag, "Rolled back config should have been quarantined")
+	if assert.NotEmpty(t, *collected) {
+		assert.Equal(t, HealthError, (*collected)[len(*collected)-1].Category)
+	}
+
+	// The rolled back config isn't applied again
+	poll()
+	assert.Equal(t, []string{"fallback-2"}, servers())
+
+	// Only two were kept, so the first one is gone
+	assert.Equal(t, ErrNothingToRollBackTo, Rollback())
+	assert.Equal(t, []string{"fallback-2"}, servers())
+}
+
+func TestRejectUpdateWithoutDialableServers(t *testing.T) {
+	defer useTestFetcher()()
+	srv := configtest.NewCloudConfigServer(serversConfig("fallback-1", "1.1.1.1:443"))
+	defer srv.Close()
+	defer restoreOptions()()
+	(&options{
+		chainedURL:       srv.ConfigURL(),
+		bootstrapServers: noBootstrapServers,
+	}).apply()
+	defer initTestConfig(t, "cloudconfigs:\n- "+srv.ConfigURL()+"\n")()
+	defer func() {
+		health = healthState{}
+	}()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+
+	mutate, _, err := pollForConfig(current())
+	if !assert.NoError(t, err) || !assert.NoError(t, m.Update(mutate)) {
+		return
+	}
+
+	srv.SetConfig("client:\n  chainedservers:\n    fallback-1:\n      addr: 1.1.1.1:443\n      cert: not a cert\n")
+	mutate, _, err = pollForConfig(current())
+	if assert.NoError(t, err) {
+		err = m.Update(mutate)
+	}
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Equal(t, "1.1.1.1:443", current().Client.ChainedServers["fallback-1"].Addr)
+	assert.Empty(t, string(current().Client.ChainedServers["fallback-1"].Cert), "Config should have been left as it was")
+	assert.NotEmpty(t, DebugState().QuarantinedETag)
+	assert.Contains(t, categoriesOf(*collected), ValidateError)
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+
+	"github.com/getlantern/fronted"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/settings"
+)
+
+const (
+	// Sections of the config that a rollout can gate
+	rolloutChainedServers = "chainedservers"
+	rolloutFrontedServers = "frontedservers"
+	rolloutMasqueradeSets = "masqueradesets"
+	rolloutTrustedCAs     = "trustedcas"
+)
+
+var (
+	// The sections a rollout gates when it doesn't say
+	defaultRolloutSections = []string{rolloutChainedServers, rolloutFrontedServers, rolloutMasqueradeSets}
+
+	// The ID of this Lantern, by which clients are bucketed for rollouts
+	rolloutInstanceID = settings.GetInstanceID
+)
+
+// Rollout limits some sections of a cloud config update to a share of
+// clients, so that risky changes like new fallback pools or masquerade lists
+// can be tried on some clients first. Clients outside the share keep what
+// they have for those sections while applying the rest of the update. Each
+// update is evaluated anew, so the rollout is widened by publishing the same
+// update with a higher Percent.
+type Rollout struct {
+	// Percent: the share of clients, from 0 to 100, that apply the gated
+	// sections
+	Percent int
+
+	// Key: identifies the rollout, so that different rollouts pick different
+	// clients. Clients stay in the share of a rollout with a given key as it's
+	// widened.
+	Key string
+
+	// Sections: the gated sections, any of chainedservers, frontedservers,
+	// masqueradesets and trustedcas. All but trustedcas if not given.
+	Sections []string
+}
+
+// includes returns whether this Lantern is in the share of clients that apply
+// the gated sections of the rollout.
+func (r *Rollout) includes() bool {
+	return rolloutBucket(r.Key, rolloutInstanceID()) < r.Percent
+}
+
+// gates returns whether the rollout gates the given section.
+func (r *Rollout) gates(section string) bool {
+	sections := r.Sections
+	if len(sections) == 0 {
+		sections = defaultRolloutSections
+	}
+	for _, gated := range sections {
+		if strings.EqualFold(gated, section) {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutBucket deterministically assigns the Lantern with the given instance
+// ID to one of 100 buckets for the rollout with the given key.
+func rolloutBucket(key string, instanceID string) int {
+	sum := sha256.Sum256([]byte(key + "|" + instanceID))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// applyRollout reverts the sections gated by the rollout in this Config, if
+// any, to what they were before an update if this Lantern isn't in the share
+// of clients that apply them. A client without chained or fronted servers
+// takes the gated servers anyway, since it can't keep what it has. The
+// rollout itself isn't kept.
+func (updated *Config) applyRollout(oldChainedServers map[string]*client.ChainedServerInfo, oldFrontedServers []*client.FrontedServerInfo, oldMasqueradeSets map[string][]*fronted.Masquerade, oldTrustedCAs []*CA) {
+	rollout := updated.Rollout
+	updated.Rollout = nil
+	if rollout == nil {
+		return
+	}
+	if rollout.includes() {
+		log.Debugf("In rollout %q of %d%% of clients, applying gated sections", rollout.Key, rollout.Percent)
+		return
+	}
+	log.Debugf("Not in rollout %q of %d%% of clients, keeping gated sections", rollout.Key, rollout.Percent)
+	hasServers := len(oldChainedServers) > 0 || len(oldFrontedServers) > 0
+	if hasServers && rollout.gates(rolloutChainedServers) {
+		updated.Client.ChainedServers = oldChainedServers
+	}
+	if hasServers && rollout.gates(rolloutFrontedServers) {
+		updated.Client.FrontedServers = oldFrontedServers
+	}
+	if rollout.gates(rolloutMasqueradeSets) {
+		updated.Client.MasqueradeSets = oldMasqueradeSets
+	}
+	if rollout.gates(rolloutTrustedCAs) {
+		updated.TrustedCAs = oldTrustedCAs
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/settings"
+)
+
+const (
+	// In bucket 11 of rollout new-fallbacks
+	instanceInRollout = "instance-b"
+	// In bucket 96 of rollout new-fallbacks
+	instanceOutOfRollout = "instance-d"
+)
+
+// rolloutUpdate returns a cloud config update with new servers and proxied
+// sites, rolled out with the given rollout settings.
+func rolloutUpdate(rollout string) []byte {
+	return []byte(`rollout:
+  key: new-fallbacks
+` + rollout + `
+client:
+  chainedservers:
+    fallback-new:
+      addr: 2.2.2.2:443
+      authtoken: new-token
+proxiedsites:
+  cloud:
+  - new.com
+`)
+}
+
+func useInstanceID(id string) func() {
+	rolloutInstanceID = func() string {
+		return id
+	}
+	return func() {
+		rolloutInstanceID = settings.GetInstanceID
+	}
+}
+
+func configWithServers() *Config {
+	return &Config{
+		Client: &client.ClientConfig{
+			ChainedServers: map[string]*client.ChainedServerInfo{
+				"fallback-old": {Addr: "1.1.1.1:443", AuthToken: "old-token"},
+			},
+		},
+		ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}, Cloud: []string{"old.com"}},
+	}
+}
+
+func TestRolloutBucket(t *testing.T) {
+	assert.Equal(t, 11, rolloutBucket("new-fallbacks", instanceInRollout))
+	assert.Equal(t, 96, rolloutBucket("new-fallbacks", instanceOutOfRollout))
+	assert.Equal(t, rolloutBucket("new-fallbacks", instanceInRollout), rolloutBucket("new-fallbacks", instanceInRollout), "Bucket should be stable")
+	assert.NotEqual(t, rolloutBucket("new-fallbacks", instanceOutOfRollout), rolloutBucket("other", instanceOutOfRollout), "Bucket should depend on key")
+}
+
+func TestRolloutInside(t *testing.T) {
+	defer useInstanceID(instanceInRollout)()
+	cfg := configWithServers()
+	if !assert.NoError(t, cfg.updateFrom(rolloutUpdate("  percent: 50"))) {
+		return
+	}
+	assert.Len(t, cfg.Client.ChainedServers, 1)
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-new"], "Should have applied gated servers")
+	assert.Contains(t, cfg.ProxiedSites.Cloud, "new.com")
+	assert.Nil(t, cfg.Rollout, "Should not keep the rollout")
+}
+
+func TestRolloutOutside(t *testing.T) {
+	defer useInstanceID(instanceOutOfRollout)()
+	cfg := configWithServers()
+	if !assert.NoError(t, cfg.updateFrom(rolloutUpdate("  percent: 50"))) {
+		return
+	}
+	assert.Len(t, cfg.Client.ChainedServers, 1)
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-old"], "Should have kept current servers")
+	assert.Contains(t, cfg.ProxiedSites.Cloud, "new.com", "Should have applied ungated sections")
+	assert.Nil(t, cfg.Rollout, "Should not keep the rollout")
+
+	// Widening the rollout takes effect on the next update
+	if !assert.NoError(t, cfg.updateFrom(rolloutUpdate("  percent: 100"))) {
+		return
+	}
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-new"], "Should have applied gated servers once in the rollout")
+}
+
+func TestRolloutWithoutServers(t *testing.T) {
+	defer useInstanceID(instanceOutOfRollout)()
+	cfg := configWithServers()
+	cfg.Client.ChainedServers = nil
+	if !assert.NoError(t, cfg.updateFrom(rolloutUpdate("  percent: 0"))) {
+		return
+	}
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-new"], "Client without servers should take gated servers anyway")
+}
+
+func TestRolloutSections(t *testing.T) {
+	defer useInstanceID(instanceOutOfRollout)()
+	cfg := configWithServers()
+	if !assert.NoError(t, cfg.updateFrom(rolloutUpdate("  percent: 50\n  sections: [masqueradesets]"))) {
+		return
+	}
+	assert.NotNil(t, cfg.Client.ChainedServers["fallback-new"], "Should have applied servers that aren't gated")
+}
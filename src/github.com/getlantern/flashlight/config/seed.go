@@ -0,0 +1,120 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/getlantern/keyman"
+	"github.com/getlantern/yaml"
+)
+
+const (
+	// seedTimeout is how long to wait for the config at -bootstrap-url before
+	// starting with the packaged config instead.
+	seedTimeout = 30 * time.Second
+)
+
+// firstRunConfig returns the config to start with when there's none yet. With
+// -bootstrap-url, that's the operator's config at that URL merged into the
+// packaged config, marked as seeded by the operator. Custom distributions use
+// it to ship a stub installer instead of baking their config into it. If that
+// config can't be fetched, or without -bootstrap-url, it's the packaged
+// config.
+func firstRunConfig() ([]byte, error) {
+	if *bootstrapURL == "" {
+		return initialConfig()
+	}
+	seeded, err := operatorSeededConfig(*bootstrapURL, *bootstrapCA, *bootstrapToken)
+	if err == nil {
+		log.Debugf("Seeded config from %v", withoutCredentials(*bootstrapURL))
+		return seeded, nil
+	}
+	log.Errorf("Unable to seed config from %v, using packaged config: %v", withoutCredentials(*bootstrapURL), err)
+	reportError(FetchError, fmt.Errorf("Unable to seed config from %v: %v", withoutCredentials(*bootstrapURL), err), false)
+	return initialConfig()
+}
+
+// makeFirstRunConfig saves the config from firstRunConfig to the file
+// specified by configPath.
+func makeFirstRunConfig(configPath string) error {
+	bytes, err := firstRunConfig()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(configPath, bytes, 0644); err != nil {
+		log.Errorf("Could not write first run config %v", err)
+		return err
+	}
+	return nil
+}
+
+// operatorSeededConfig fetches the config at the given URL, trusting only the
+// given PEM-encoded CA if there is one and sending the given token if there is
+// one, and merges it into the packaged config like updateFrom, except that it
+// can set any field, not only those cloud config manages. The result keeps its
+// chained servers, since they're the operator's.
+func operatorSeededConfig(url string, ca string, token string) ([]byte, error) {
+	fetched, err := fetchOperatorConfig(url, ca, token)
+	if err != nil {
+		return nil, err
+	}
+	packaged, err := initialConfig()
+	if err != nil {
+		return nil, err
+	}
+	if packaged, err = flattenDocuments(packaged); err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(packaged, cfg); err != nil {
+		return nil, fmt.Errorf("Unable to parse packaged config: %v", err)
+	}
+	cfg.ApplyDefaults()
+	// Nothing's running yet to be told about the changes, so this merges like
+	// updateFrom without committing the result
+	seeded, err := cfg.mergedWith(fetched, false)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to merge operator config: %v", err)
+	}
+	if issues := newIssues(cfg.Validate(), seeded.Validate()); len(issues) > 0 {
+		return nil, &ValidationError{issues}
+	}
+	seeded.Provenance = provenanceOperatorSeeded
+	seeded.PreserveCustomServers = true
+	return yaml.Marshal(seeded)
+}
+
+// fetchOperatorConfig fetches the config at the given URL for
+// operatorSeededConfig.
+func fetchOperatorConfig(url string, ca string, token string) ([]byte, error) {
+	transport := &http.Transport{Proxy: proxyFromEnvironment}
+	if ca != "" {
+		cert, err := keyman.LoadCertificateFromPEMBytes([]byte(ca))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse bootstrap CA: %v", err)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: cert.PoolContainingCert()}
+	}
+	client := &http.Client{Transport: transport, Timeout: seedTimeout}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to construct request for operator config: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch operator config: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected response status: %d", resp.StatusCode)
+	}
+	return readConfigResponse(resp)
+}
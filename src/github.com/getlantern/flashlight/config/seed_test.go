@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+const operatorConfig = "uiaddr: 127.0.0.1:16999\nclient:\n  chainedservers:\n    operator-1:\n      addr: 10.9.9.9:443\n      authtoken: operator-secret\n"
+
+// operatorConfigServer serves operatorConfig over TLS to requests with the
+// given token, counting requests.
+func operatorConfigServer(t *testing.T, token string, requests *int32) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			resp.WriteHeader(http.StatusForbidden)
+			return
+		}
+		resp.Write(gzipped(t, operatorConfig))
+	}))
+}
+
+// serverCA returns the PEM-encoded certificate of the given TLS test server,
+// which is its own CA.
+func serverCA(srv *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+// useBootstrapFlags sets -bootstrap-url, -bootstrap-ca and -bootstrap-token.
+// The returned function restores them.
+func useBootstrapFlags(url string, ca string, token string) func() {
+	origURL, origCA, origToken := *bootstrapURL, *bootstrapCA, *bootstrapToken
+	*bootstrapURL, *bootstrapCA, *bootstrapToken = url, ca, token
+	return func() {
+		*bootstrapURL, *bootstrapCA, *bootstrapToken = origURL, origCA, origToken
+	}
+}
+
+// firstRun creates the config file for a first run and returns what it
+// contains.
+func firstRun(t *testing.T) *Config {
+	if _, err := newFileStore("2.1.0"); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, path, _ := InConfigDir(configFileName("2.1.0"))
+	data, err := ioutil.ReadFile(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg := &Config{}
+	if !assert.NoError(t, yaml.Unmarshal(data, cfg)) {
+		t.FailNow()
+	}
+	return cfg
+}
+
+func TestFirstRunSeededByOperator(t *testing.T) {
+	var requests int32
+	srv := operatorConfigServer(t, "operator-token", &requests)
+	defer srv.Close()
+	defer useTempConfigDir(t)()
+	defer useBootstrapFlags(srv.URL+"/org-config.yaml.gz", serverCA(srv), "operator-token")()
+
+	cfg := firstRun(t)
+	assert.Equal(t, provenanceOperatorSeeded, cfg.Provenance)
+	assert.True(t, cfg.PreserveCustomServers, "Operator's servers should be kept through cloud updates")
+	assert.Equal(t, "127.0.0.1:16999", cfg.UIAddr)
+	if assert.Len(t, cfg.Client.ChainedServers, 1) {
+		assert.Equal(t, "10.9.9.9:443", cfg.Client.ChainedServers["operator-1"].Addr)
+	}
+	assert.NotEmpty(t, cfg.ProxiedSites.Cloud, "Packaged settings the operator didn't change should be kept")
+	_, path, _ := InConfigDir(configFileName("2.1.0"))
+	assert.True(t, isCustomConfig(path, configFileName("2.1.0")), "Seeded config should be carried over like a custom one")
+
+	// Only the first run is seeded
+	firstRun(t)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestFirstRunSeedFallsBackToPackaged(t *testing.T) {
+	var requests int32
+	srv := operatorConfigServer(t, "operator-token", &requests)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		name  string
+		ca    string
+		token string
+	}{
+		{"untrusted server", string(generateCA(t, "Other CA").PEMEncoded()), "operator-token"},
+		{"system CAs only", "", "operator-token"},
+		{"wrong token", serverCA(srv), "wrong-token"},
+	} {
+		func() {
+			defer useTempConfigDir(t)()
+			defer useBootstrapFlags(srv.URL, test.ca, test.token)()
+			collected, restore := collectErrors()
+			defer restore()
+
+			cfg := firstRun(t)
+			assert.NotEqual(t, provenanceOperatorSeeded, cfg.Provenance, test.name)
+			assert.Nil(t, cfg.Client.ChainedServers["operator-1"], "%v: should have used packaged config", test.name)
+			assert.Equal(t, []ErrorCategory{FetchError}, categoriesOf(*collected), test.name)
+		}()
+	}
+}
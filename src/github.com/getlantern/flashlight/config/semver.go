@@ -0,0 +1,137 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed semantic version of the form
+// major[.minor[.patch]][-prerelease][+build]. Build metadata is ignored for
+// the purposes of comparison.
+type semVersion struct {
+	major      int
+	minor      int
+	patch      int
+	prerelease []string
+	valid      bool
+}
+
+// parseVersion parses the given version string. Malformed versions are
+// returned with valid set to false.
+func parseVersion(version string) semVersion {
+	v := semVersion{}
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.Index(version, "-"); i >= 0 {
+		if i == len(version)-1 {
+			return v
+		}
+		v.prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return v
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v
+		}
+		nums[i] = n
+	}
+	v.major, v.minor, v.patch = nums[0], nums[1], nums[2]
+	v.valid = true
+	return v
+}
+
+// compare returns -1, 0 or 1 depending on whether v is older than, the same
+// as or newer than other. Malformed versions are older than all valid
+// versions.
+func (v semVersion) compare(other semVersion) int {
+	if !v.valid || !other.valid {
+		return compareInts(boolToInt(v.valid), boolToInt(other.valid))
+	}
+	if c := compareInts(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.patch, other.patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// sameMajor returns whether v and other are both valid and share the same
+// major version, meaning that configs from one can be reused by the other.
+func (v semVersion) sameMajor(other semVersion) bool {
+	return v.valid && other.valid && v.major == other.major
+}
+
+// compareVersions compares two version strings (see semVersion.compare).
+func compareVersions(a, b string) int {
+	return parseVersion(a).compare(parseVersion(b))
+}
+
+// sortVersionsNewestFirst sorts the given version strings from newest to
+// oldest, with malformed versions last.
+func sortVersionsNewestFirst(versions []string) {
+	sort.Stable(newestFirst(versions))
+}
+
+// newestFirst implements sort.Interface for version strings, ordering them
+// from newest to oldest.
+type newestFirst []string
+
+func (a newestFirst) Len() int           { return len(a) }
+func (a newestFirst) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a newestFirst) Less(i, j int) bool { return compareVersions(a[i], a[j]) > 0 }
+
+func comparePrerelease(a, b []string) int {
+	// A version without prerelease identifiers is newer than one with them
+	if len(a) == 0 || len(b) == 0 {
+		return compareInts(boolToInt(len(a) == 0), boolToInt(len(b) == 0))
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		an, aErr := strconv.Atoi(a[i])
+		bn, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInts(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			// Numeric identifiers have lower precedence than alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
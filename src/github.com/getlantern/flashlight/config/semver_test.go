@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.0.0", "2.0.0", 0},
+		{"2.0.1", "2.0.0", 1},
+		{"2.1", "2.0.9", 1},
+		{"10.1", "9.9", 1},
+		{"2.0.10", "2.0.9", 1},
+		{"222.00.1", "222.0.1", 0},
+		{"2.2.0-beta1", "2.2.0", -1},
+		{"2.2.0-beta1+manoto", "2.2.0-beta1", 0},
+		{"2.2.0+manoto", "2.2.0+other", 0},
+		{"2.2.0-beta2", "2.2.0-beta10", 1},
+		{"2.2.0-beta.2", "2.2.0-beta.10", -1},
+		{"2.2.0-alpha", "2.2.0-alpha.1", -1},
+		{"2.2.0-1", "2.2.0-alpha", -1},
+		{"2.2.0-rc.1", "2.2.0-beta.11", 1},
+		{"garbage", "0.0.1", -1},
+		{"2.0.0", "2.x", 1},
+		{"garbage", "nonsense", 0},
+		{"1.2.3.4", "0.0.1", -1},
+		{"2.0.0-", "0.0.1", -1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, compareVersions(test.a, test.b), "Comparing %v to %v", test.a, test.b)
+		assert.Equal(t, -test.expected, compareVersions(test.b, test.a), "Comparing %v to %v", test.b, test.a)
+	}
+}
+
+func TestSameMajor(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"2.0.0", "2.5.1-beta1", true},
+		{"2.0.0", "3.0.0", false},
+		{"10.1", "1.10", false},
+		{"2.0.0", "garbage", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseVersion(test.a).sameMajor(parseVersion(test.b)), "Comparing %v to %v", test.a, test.b)
+	}
+}
+
+func TestSortVersionsNewestFirst(t *testing.T) {
+	versions := []string{"bad", "2.0.9", "2.1.0-beta1", "10.0.0", "2.1.0", "2.0.10"}
+	sortVersionsNewestFirst(versions)
+	assert.Equal(t, []string{"10.0.0", "2.1.0", "2.1.0-beta1", "2.0.10", "2.0.9", "bad"}, versions)
+}
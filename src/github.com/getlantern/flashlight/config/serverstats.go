@@ -0,0 +1,186 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// reweightInterval is how often we adjust the weights of fronted servers
+	// based on their observed performance.
+	reweightInterval = 5 * time.Minute
+
+	// serverStatsAlpha is the weight of each new observation in the moving
+	// averages of success rate and latency.
+	serverStatsAlpha = 0.2
+
+	// maxWeightAdjustment bounds how far observed performance can move a
+	// server's weight away from the one assigned by the cloud, so that the
+	// cloud still steers.
+	maxWeightAdjustment = 0.5
+)
+
+var (
+	serverStats = newServerStatsTracker()
+)
+
+// ServerStats is an observation of how a fronted server performed, for
+// example on a single dial.
+type ServerStats struct {
+	// Success: whether the server worked
+	Success bool
+
+	// Latency: how long the server took, only meaningful if it worked
+	Latency time.Duration
+}
+
+// ReportServerStats reports observed performance of the fronted server with
+// the given host, which is used to adjust the server's weight relative to the
+// one assigned by the cloud.
+func ReportServerStats(host string, stats ServerStats) {
+	serverStats.report(host, stats)
+}
+
+// serverPerformance is the moving average performance of a server.
+type serverPerformance struct {
+	successRate float64
+	// latency is zero until we've seen a success
+	latency float64
+}
+
+// serverStatsTracker accumulates the performance of fronted servers.
+type serverStatsTracker struct {
+	servers map[string]*serverPerformance
+	mx      sync.Mutex
+}
+
+func newServerStatsTracker() *serverStatsTracker {
+	return &serverStatsTracker{servers: make(map[string]*serverPerformance)}
+}
+
+func (t *serverStatsTracker) report(host string, stats ServerStats) {
+	success := 0.0
+	if stats.Success {
+		success = 1.0
+	}
+	latency := float64(stats.Latency)
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	perf := t.servers[host]
+	if perf == nil {
+		perf = &serverPerformance{successRate: success}
+		if stats.Success {
+			perf.latency = latency
+		}
+		t.servers[host] = perf
+		return
+	}
+	perf.successRate = ewma(perf.successRate, success)
+	if stats.Success {
+		if perf.latency == 0 {
+			perf.latency = latency
+		} else {
+			perf.latency = ewma(perf.latency, latency)
+		}
+	}
+}
+
+func ewma(average float64, observation float64) float64 {
+	return serverStatsAlpha*observation + (1-serverStatsAlpha)*average
+}
+
+// reweight adjusts the weights of the fronted servers in the given Config
+// based on their observed performance and forgets about servers that are no
+// longer in it. Servers that succeed reliably with average latency keep their
+// cloud weight. Servers that fail lose up to maxWeightAdjustment of it, and
+// servers that are faster than average gain up to maxWeightAdjustment.
+func (t *serverStatsTracker) reweight(cfg *Config) {
+	if cfg.Client == nil {
+		return
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	configured := make(map[string]bool)
+	for _, server := range cfg.Client.FrontedServers {
+		configured[server.Host] = true
+	}
+	for host := range t.servers {
+		if !configured[host] {
+			log.Tracef("Forgetting stats for %v, which is no longer configured", host)
+			delete(t.servers, host)
+		}
+	}
+
+	// Latency is judged relative to the average of the servers we know about
+	totalLatency := 0.0
+	withLatency := 0
+	for _, perf := range t.servers {
+		if perf.latency > 0 {
+			totalLatency += perf.latency
+			withLatency++
+		}
+	}
+	averageLatency := 0.0
+	if withLatency > 0 {
+		averageLatency = totalLatency / float64(withLatency)
+	}
+
+	for _, server := range cfg.Client.FrontedServers {
+		if server.CloudWeight == 0 {
+			// Defaults haven't been applied, nothing to adjust relative to
+			continue
+		}
+		perf := t.servers[server.Host]
+		if perf == nil {
+			server.Weight = server.CloudWeight
+			continue
+		}
+		// Reliable servers with average latency score 0, failing ones -1
+		score := perf.successRate - 1
+		if perf.latency > 0 && averageLatency > 0 {
+			score += averageLatency/perf.latency - 1
+		}
+		if score > 1 {
+			score = 1
+		} else if score < -1 {
+			score = -1
+		}
+		weight := int(float64(server.CloudWeight) * (1 + maxWeightAdjustment*score))
+		if weight < 1 {
+			weight = 1
+		}
+		if weight != server.Weight {
+			log.Debugf("Adjusting weight of %v from %d to %d (cloud weight %d)", server.Host, server.Weight, weight, server.CloudWeight)
+			server.Weight = weight
+		}
+	}
+	cfg.Client.SortServers()
+}
+
+// reweightServers adjusts the weights of fronted servers based on their
+// observed performance, persisting the adjusted weights.
+func reweightServers() error {
+	return Update(func(cfg *Config) error {
+		serverStats.reweight(cfg)
+		return nil
+	})
+}
+
+// reweightServersPeriodically calls reweightServers every reweightInterval
+// until stop is closed.
+func reweightServersPeriodically(stop <-chan struct{}) {
+	ticker := time.NewTicker(reweightInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := reweightServers(); err != nil {
+				log.Errorf("Unable to adjust server weights: %v", err)
+			}
+		}
+	}
+}
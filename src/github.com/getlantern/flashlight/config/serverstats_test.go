@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func frontedWeights() map[string]int {
+	weights := make(map[string]int)
+	for _, server := range current().Client.FrontedServers {
+		weights[server.Host] = server.Weight
+	}
+	return weights
+}
+
+func TestServerWeightsAdapt(t *testing.T) {
+	origServerStats := serverStats
+	serverStats = newServerStatsTracker()
+	defer func() {
+		serverStats = origServerStats
+	}()
+	defer initTestConfig(t, `
+client:
+  frontedservers:
+  - host: a.example.com
+    weight: 1000
+  - host: b.example.com
+    weight: 1000
+`)()
+
+	for i := 0; i < 20; i++ {
+		ReportServerStats("a.example.com", ServerStats{Success: false})
+		ReportServerStats("b.example.com", ServerStats{Success: true, Latency: 100 * time.Millisecond})
+	}
+	if !assert.NoError(t, reweightServers()) {
+		return
+	}
+	weights := frontedWeights()
+	assert.Equal(t, 500, weights["a.example.com"], "Failing server should lose half its weight")
+	assert.Equal(t, 1000, weights["b.example.com"], "Reliable server with average latency should keep its weight")
+
+	// Reweighting again shouldn't compound the adjustment
+	if !assert.NoError(t, reweightServers()) {
+		return
+	}
+	assert.Equal(t, 500, frontedWeights()["a.example.com"], "Adjustment should be relative to cloud weight")
+
+	for i := 0; i < 30; i++ {
+		ReportServerStats("a.example.com", ServerStats{Success: true, Latency: 100 * time.Millisecond})
+	}
+	if !assert.NoError(t, reweightServers()) {
+		return
+	}
+	assert.True(t, frontedWeights()["a.example.com"] > 950, "Server should recover after succeeding")
+
+	for i := 0; i < 30; i++ {
+		ReportServerStats("b.example.com", ServerStats{Success: true, Latency: time.Millisecond})
+	}
+	if !assert.NoError(t, reweightServers()) {
+		return
+	}
+	assert.Equal(t, 1500, frontedWeights()["b.example.com"], "Fast server should gain at most half its weight")
+}
+
+func TestServerStatsForgotten(t *testing.T) {
+	origServerStats := serverStats
+	serverStats = newServerStatsTracker()
+	defer func() {
+		serverStats = origServerStats
+	}()
+	defer initTestConfig(t, `
+client:
+  frontedservers:
+  - host: a.example.com
+  - host: b.example.com
+`)()
+
+	ReportServerStats("a.example.com", ServerStats{Success: true, Latency: time.Second})
+	ReportServerStats("b.example.com", ServerStats{Success: false})
+	err := Update(func(cfg *Config) error {
+		cfg.Client.FrontedServers = cfg.Client.FrontedServers[:1]
+		return nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, reweightServers()) {
+		return
+	}
+	serverStats.mx.Lock()
+	defer serverStats.mx.Unlock()
+	assert.NotNil(t, serverStats.servers["a.example.com"])
+	assert.Nil(t, serverStats.servers["b.example.com"], "Stats for removed server should be forgotten")
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	// The header with which cloud config servers pass the base64 encoded
+	// detached signature of the (uncompressed) cloud config
+	signatureHeader = "X-Lantern-Signature"
+)
+
+var (
+	// CloudConfigSigningKeys are the PEM encoded public keys, Ed25519 or RSA,
+	// that the main binary can bake in to only accept cloud config signed with
+	// one of them. That keeps a compromised CDN or a man in the middle from
+	// handing out servers of its choosing. If there are none, cloud config
+	// isn't checked for signatures.
+	CloudConfigSigningKeys []string
+
+	// The parsed CloudConfigSigningKeys
+	signingKeys []crypto.PublicKey
+)
+
+// signatureError indicates that fetched cloud config wasn't signed with any
+// of the CloudConfigSigningKeys.
+type signatureError struct {
+	reason string
+}
+
+func (e *signatureError) Error() string {
+	return fmt.Sprintf("Rejecting cloud config: %v", e.reason)
+}
+
+// loadSigningKeys parses CloudConfigSigningKeys. Keys that don't parse are
+// reported and ignored, but if none do, we reject all cloud config rather
+// than accept config we were meant to check.
+func loadSigningKeys() {
+	signingKeys = nil
+	for i, encoded := range CloudConfigSigningKeys {
+		key, err := parseSigningKey(encoded)
+		if err != nil {
+			err = fmt.Errorf("Ignoring cloud config signing key %d: %v", i, err)
+			log.Error(err)
+			reportError(ParseError, err, false)
+			continue
+		}
+		signingKeys = append(signingKeys, key)
+	}
+	if len(CloudConfigSigningKeys) > 0 {
+		log.Debugf("Checking cloud config against %d signing keys", len(signingKeys))
+	}
+}
+
+func parseSigningKey(encoded string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PublicKey(block.Bytes); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, err
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// verifyCloudConfig checks that the given signature, from the signature
+// header, is a signature of the cloud config yml by one of the signing keys.
+// Everything passes if there aren't any keys to check against.
+func verifyCloudConfig(yml []byte, signature string) error {
+	if len(CloudConfigSigningKeys) == 0 {
+		return nil
+	}
+	if signature == "" {
+		return &signatureError{"not signed"}
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return &signatureError{fmt.Sprintf("malformed signature: %v", err)}
+	}
+	digest := sha256.Sum256(yml)
+	for _, key := range signingKeys {
+		switch k := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, yml, sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		}
+	}
+	return &signatureError{"signature doesn't match any signing key"}
+}
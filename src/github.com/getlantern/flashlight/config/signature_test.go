@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/config/configtest"
+)
+
+func encodeSigningKey(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// useSigningKeys bakes in the given PEM encoded signing keys until the
+// returned function is called.
+func useSigningKeys(keys ...string) func() {
+	orig := CloudConfigSigningKeys
+	CloudConfigSigningKeys = keys
+	loadSigningKeys()
+	return func() {
+		CloudConfigSigningKeys = orig
+		loadSigningKeys()
+	}
+}
+
+func TestFetchVerifiesSignature(t *testing.T) {
+	defer useTestFetcher()()
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer useSigningKeys(encodeSigningKey(t, edPublic), encodeSigningKey(t, &rsaPrivate.PublicKey))()
+
+	yml := "proxiedsites:\n  cloud:\n  - a.com\n"
+	srv := configtest.NewCloudConfigServer(yml)
+	defer srv.Close()
+
+	_, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.IsType(t, &signatureError{}, err, "Unsigned config should be rejected")
+
+	srv.SignWith(func(yml []byte) []byte {
+		return ed25519.Sign(otherPrivate, yml)
+	})
+	_, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.IsType(t, &signatureError{}, err, "Config signed with an unknown key should be rejected")
+
+	srv.SignWith(func(yml []byte) []byte {
+		return ed25519.Sign(edPrivate, yml)
+	})
+	b, err := fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Equal(t, yml, string(b), "Rejected responses shouldn't keep us from fetching the config once it's signed")
+
+	srv.SignWith(func(yml []byte) []byte {
+		digest := sha256.Sum256(yml)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaPrivate, crypto.SHA256, digest[:])
+		return sig
+	})
+	srv.SetConfig("proxiedsites:\n  cloud:\n  - b.com\n")
+	b, err = fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.NoError(t, err)
+	assert.Equal(t, "proxiedsites:\n  cloud:\n  - b.com\n", string(b))
+}
+
+func TestFetchWithOnlyBadSigningKeys(t *testing.T) {
+	defer useTestFetcher()()
+	collected, restoreErrs := collectErrors()
+	defer restoreErrs()
+	defer useSigningKeys("not a key")()
+	assert.Equal(t, []ErrorCategory{ParseError}, categoriesOf(*collected))
+
+	srv := configtest.NewCloudConfigServer("proxiedsites:\n  cloud:\n  - a.com\n")
+	defer srv.Close()
+	srv.SignWith(func(yml []byte) []byte {
+		return []byte("signature")
+	})
+	_, err := fetchCloudConfig(context.Background(), srv.ConfigURL())
+	assert.IsType(t, &signatureError{}, err, "Config should be rejected if none of the keys are usable")
+}
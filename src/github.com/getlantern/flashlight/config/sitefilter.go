@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// defaultMaxProxiedSites is how many cloud proxied sites we accept when
+	// the config doesn't say, which is several times what's ever been
+	// published on purpose.
+	defaultMaxProxiedSites = 50000
+
+	// maxDomainLength and maxLabelLength are the longest a domain and each of
+	// its labels can be.
+	maxDomainLength = 253
+	maxLabelLength  = 63
+)
+
+// siteFilter describes what filterProxiedSites left out of the cloud proxied
+// sites.
+type siteFilter struct {
+	// implausible: the sites that aren't plausible domains
+	implausible []string
+	// truncated: how many sites were dropped to stay within the maximum
+	truncated int
+}
+
+// sortedUnique sorts the given sites, which it may reorder, and returns them
+// without duplicates. Cloud config can have tens of thousands of sites, so
+// this takes a single pass over them once sorted.
+func sortedUnique(sites []string) []string {
+	sort.Strings(sites)
+	unique := make([]string, 0, len(sites))
+	for i, site := range sites {
+		if i > 0 && site == sites[i-1] {
+			continue
+		}
+		unique = append(unique, site)
+	}
+	return unique
+}
+
+// filterProxiedSites leaves out the cloud proxied sites that aren't plausible
+// domains, like URLs or anything with spaces, along with IP addresses unless
+// AllowProxiedIPs is set. If more sites than MaxProxiedSites remain, the
+// update is rejected unless TruncateProxiedSites is set, in which case the
+// sites beyond the maximum are dropped. The sites must be sorted, so that
+// those dropped are always the same.
+func (cfg *Config) filterProxiedSites() (*siteFilter, error) {
+	filter := &siteFilter{}
+	if cfg.ProxiedSites == nil || len(cfg.ProxiedSites.Cloud) == 0 {
+		return filter, nil
+	}
+	sites := make([]string, 0, len(cfg.ProxiedSites.Cloud))
+	for _, site := range cfg.ProxiedSites.Cloud {
+		if isPlausibleDomain(site, cfg.AllowProxiedIPs) {
+			sites = append(sites, site)
+		} else {
+			filter.implausible = append(filter.implausible, site)
+		}
+	}
+	if len(filter.implausible) > 0 {
+		log.Errorf("Ignoring %d proxied sites that aren't domains: %v", len(filter.implausible), summarize(filter.implausible))
+	}
+
+	limit := cfg.MaxProxiedSites
+	if limit <= 0 {
+		limit = defaultMaxProxiedSites
+	}
+	if len(sites) > limit {
+		if !cfg.TruncateProxiedSites {
+			return nil, fmt.Errorf("Update has %d proxied sites, more than the maximum of %d", len(sites), limit)
+		}
+		filter.truncated = len(sites) - limit
+		log.Errorf("Update has %d proxied sites, ignoring all but the first %d", len(sites), limit)
+		sites = sites[:limit]
+	}
+	cfg.ProxiedSites.Cloud = sites
+	return filter, nil
+}
+
+// isPlausibleDomain returns whether the given site looks like a domain, or
+// like an IP address if allowIPs is true.
+func isPlausibleDomain(site string, allowIPs bool) bool {
+	if site == "" || len(site) > maxDomainLength {
+		return false
+	}
+	// IPv4 addresses end in a digit, unlike domains, and IPv6 addresses have
+	// colons, so most sites don't need parsing
+	if last := site[len(site)-1]; (last >= '0' && last <= '9') || strings.Contains(site, ":") {
+		if net.ParseIP(site) != nil {
+			return allowIPs
+		}
+	}
+	// This is called for every proxied site, so it checks the labels in place
+	// rather than splitting the site into them
+	for rest := site; ; {
+		label := rest
+		dot := strings.IndexByte(rest, '.')
+		if dot >= 0 {
+			label, rest = rest[:dot], rest[dot+1:]
+		}
+		if label == "" || len(label) > maxLabelLength {
+			return false
+		}
+		for _, r := range label {
+			if r != '-' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+		if dot < 0 {
+			return true
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getlantern/proxiedsites"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+const (
+	// How long updating from and marshaling a config with the most proxied
+	// sites we accept by default may take
+	maxProxiedSitesUpdateTime  = 2 * time.Second
+	maxProxiedSitesMarshalTime = time.Second
+)
+
+func configWithProxiedSites(sites ...string) *Config {
+	return &Config{
+		Client:       &client.ClientConfig{},
+		ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}, Cloud: sites},
+	}
+}
+
+// proxiedSitesUpdate returns cloud config YAML with the given number of
+// proxied sites, along with the given extra ones.
+func proxiedSitesUpdate(n int, extra ...string) []byte {
+	lines := make([]string, 0, n+len(extra)+2)
+	lines = append(lines, "proxiedsites:", "  cloud:")
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("  - site%06d.com", i))
+	}
+	for _, site := range extra {
+		lines = append(lines, fmt.Sprintf("  - %q", site))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func TestIsPlausibleDomain(t *testing.T) {
+	for _, site := range []string{"a.com", "www.example.co.uk", "xn--fiqs8s.cn", "中国.cn", "under_score.com", "localhost"} {
+		assert.True(t, isPlausibleDomain(site, false), site)
+	}
+	for _, site := range []string{"", "a b.com", "http://a.com", "a.com/path", ".a.com", "a..com", "a.com:443", "*.a.com", "1.2.3.4", "::1", strings.Repeat("a", 64) + ".com"} {
+		assert.False(t, isPlausibleDomain(site, false), site)
+	}
+	assert.True(t, isPlausibleDomain("1.2.3.4", true))
+	assert.True(t, isPlausibleDomain("::1", true))
+}
+
+func TestUpdateFiltersProxiedSites(t *testing.T) {
+	diffs, restore := captureDiffs()
+	defer restore()
+
+	cfg := configWithProxiedSites()
+	if !assert.NoError(t, cfg.updateFrom(proxiedSitesUpdate(2, "http://a.com", "b c.com", "1.2.3.4"))) {
+		return
+	}
+	assert.Equal(t, []string{"site000000.com", "site000001.com"}, cfg.ProxiedSites.Cloud)
+	if assert.Len(t, *diffs, 1) {
+		diff := (*diffs)[0]
+		assert.Equal(t, []string{"1.2.3.4", "b c.com", "http://a.com"}, diff.IgnoredProxiedSites)
+		assert.Contains(t, diff.String(), "proxiedsites ignored 3")
+	}
+
+	cfg = configWithProxiedSites()
+	cfg.AllowProxiedIPs = true
+	if assert.NoError(t, cfg.updateFrom(proxiedSitesUpdate(0, "1.2.3.4"))) {
+		assert.Equal(t, []string{"1.2.3.4"}, cfg.ProxiedSites.Cloud)
+	}
+}
+
+func TestTooManyProxiedSites(t *testing.T) {
+	diffs, restore := captureDiffs()
+	defer restore()
+
+	cfg := configWithProxiedSites("a.com")
+	cfg.MaxProxiedSites = 10
+	assert.Error(t, cfg.updateFrom(proxiedSitesUpdate(11)), "Should reject too many sites by default")
+	assert.Equal(t, []string{"a.com"}, cfg.ProxiedSites.Cloud, "Rejected update should leave sites alone")
+	assert.Empty(t, *diffs)
+
+	cfg.TruncateProxiedSites = true
+	if !assert.NoError(t, cfg.updateFrom(proxiedSitesUpdate(11))) {
+		return
+	}
+	assert.Len(t, cfg.ProxiedSites.Cloud, 10)
+	assert.Equal(t, "a.com", cfg.ProxiedSites.Cloud[0], "Sites should have been truncated in sorted order")
+	assert.NotContains(t, cfg.ProxiedSites.Cloud, "site000010.com")
+	if assert.Len(t, *diffs, 1) {
+		assert.Equal(t, 2, (*diffs)[0].TruncatedProxiedSites)
+		assert.Contains(t, (*diffs)[0].String(), "truncated 2")
+	}
+
+	cfg = configWithProxiedSites()
+	assert.NoError(t, cfg.updateFrom(proxiedSitesUpdate(defaultMaxProxiedSites)), "Should accept the default maximum")
+	assert.Len(t, cfg.ProxiedSites.Cloud, defaultMaxProxiedSites)
+}
+
+func BenchmarkUpdateFromMaxProxiedSites(b *testing.B) {
+	update := proxiedSitesUpdate(defaultMaxProxiedSites)
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if err := configWithProxiedSites().updateFrom(update); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if perOp := time.Since(start) / time.Duration(b.N); perOp > maxProxiedSitesUpdateTime {
+		b.Fatalf("Updating from %d proxied sites took %v, more than %v", defaultMaxProxiedSites, perOp, maxProxiedSitesUpdateTime)
+	}
+}
+
+func BenchmarkMarshalMaxProxiedSites(b *testing.B) {
+	cfg := configWithProxiedSites()
+	if err := cfg.updateFrom(proxiedSitesUpdate(defaultMaxProxiedSites)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if _, err := yaml.Marshal(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if perOp := time.Since(start) / time.Duration(b.N); perOp > maxProxiedSitesMarshalTime {
+		b.Fatalf("Marshaling %d proxied sites took %v, more than %v", defaultMaxProxiedSites, perOp, maxProxiedSitesMarshalTime)
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultStaleConfigThreshold is how long we go without successfully
+	// fetching cloud config before considering our config stale.
+	defaultStaleConfigThreshold = 24 * time.Hour
+)
+
+var (
+	staleness = newStalenessWatchdog()
+)
+
+// StaleConfigEvent is raised when cloud config hasn't been fetched
+// successfully for longer than the configured StaleConfigThreshold.
+type StaleConfigEvent struct {
+	// Age: how long it's been since cloud config was last fetched successfully
+	// (or since we started, if it never was)
+	Age time.Duration
+
+	// LastUpdate: when cloud config was last fetched successfully, zero if it
+	// never was
+	LastUpdate time.Time
+
+	// LastError: why the last attempt to fetch cloud config failed
+	LastError string
+}
+
+// OnStaleConfig registers a function that's called whenever our config becomes
+// stale. It's called once each time the config crosses the staleness
+// threshold, not on every poll, and is called again only after cloud config
+// has been fetched successfully and subsequently gone stale again.
+func OnStaleConfig(onStale func(*StaleConfigEvent)) {
+	staleness.onStale(onStale)
+}
+
+// stalenessWatchdog keeps track of whether our config has gone stale. Within a
+// session, ages are measured with the monotonic clock, so that a wrong or
+// changing system clock doesn't make us think the config is stale.
+type stalenessWatchdog struct {
+	started     time.Time
+	lastRefresh time.Time
+	refreshedAs string
+	stale       bool
+	handlers    []func(*StaleConfigEvent)
+	mx          sync.Mutex
+}
+
+func newStalenessWatchdog() *stalenessWatchdog {
+	return &stalenessWatchdog{started: wallClock()}
+}
+
+func (w *stalenessWatchdog) onStale(onStale func(*StaleConfigEvent)) {
+	w.mx.Lock()
+	w.handlers = append(w.handlers, onStale)
+	w.mx.Unlock()
+}
+
+// isStale returns whether our config was stale as of the last poll, in which
+// case polling should escalate to fallback mode.
+func (w *stalenessWatchdog) isStale() bool {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.stale
+}
+
+// refreshed records that cloud config was fetched successfully at the given
+// time, which is saved as the given LastCloudUpdate.
+func (w *stalenessWatchdog) refreshed(now time.Time, lastCloudUpdate string) {
+	w.mx.Lock()
+	if w.stale {
+		log.Debugf("Config is no longer stale")
+	}
+	w.stale = false
+	w.lastRefresh = now
+	w.refreshedAs = lastCloudUpdate
+	w.mx.Unlock()
+}
+
+// failed records that fetching cloud config into the given Config failed at
+// the given time with the given error, notifying handlers if that makes the
+// Config newly stale.
+func (w *stalenessWatchdog) failed(cfg *Config, now time.Time, err error) {
+	threshold := cfg.StaleConfigThreshold
+	if threshold <= 0 {
+		threshold = defaultStaleConfigThreshold
+	}
+	lastUpdate, _ := time.Parse(time.RFC3339, cfg.LastCloudUpdate)
+
+	w.mx.Lock()
+	var age time.Duration
+	if !w.lastRefresh.IsZero() && cfg.LastCloudUpdate == w.refreshedAs {
+		age = now.Sub(w.lastRefresh)
+	} else if !lastUpdate.IsZero() {
+		// Updated in an earlier session, which we can only compare with our
+		// clock corrected by how far off it is
+		age = now.Add(cfg.estimatedClockSkew()).Sub(lastUpdate)
+		if sinceStarted := now.Sub(w.started); age < sinceStarted {
+			// Our clock is off in a way we don't know about, but the config
+			// is at least as old as this session
+			age = sinceStarted
+		}
+	} else {
+		// Never updated, so we've been stale at most since we started
+		age = now.Sub(w.started)
+	}
+	if age < threshold {
+		w.mx.Unlock()
+		return
+	}
+	if w.stale {
+		// Already notified for this crossing
+		w.mx.Unlock()
+		return
+	}
+	w.stale = true
+	handlers := make([]func(*StaleConfigEvent), len(w.handlers))
+	copy(handlers, w.handlers)
+	w.mx.Unlock()
+
+	log.Errorf("Config has not been updated in %v, last error: %v", age, err)
+	event := &StaleConfigEvent{
+		Age:        age,
+		LastUpdate: lastUpdate,
+		LastError:  err.Error(),
+	}
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
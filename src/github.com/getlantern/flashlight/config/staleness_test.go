@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+// recordingFetcher records that it was used and fails.
+type recordingFetcher struct {
+	attempts *[]string
+}
+
+func (f *recordingFetcher) Do(req *http.Request) (*http.Response, error) {
+	*f.attempts = append(*f.attempts, "proxy")
+	return nil, fmt.Errorf("Local proxy unavailable")
+}
+
+func TestStaleConfigWatchdog(t *testing.T) {
+	longAgo := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	defer initTestConfig(t, fmt.Sprintf("cloudconfigs:\n- %v\nstaleconfigthreshold: %d\nlastcloudupdate: %v\n", chainedCloudConfigUrl, time.Hour, longAgo))()
+	defer useTestFetcher()()
+
+	origStaleness, origServers, origDial := staleness, bootstrapServers, chainedDial
+	defer func() {
+		staleness, bootstrapServers, chainedDial = origStaleness, origServers, origDial
+	}()
+	staleness = newStalenessWatchdog()
+
+	var attempts []string
+	cf = &recordingFetcher{&attempts}
+	bootstrapServers = func() map[string]*client.ChainedServerInfo {
+		return map[string]*client.ChainedServerInfo{
+			"bootstrap": &client.ChainedServerInfo{Addr: "127.0.0.1:1"},
+		}
+	}
+	chainedDial = func(server *client.ChainedServerInfo) (func(network, addr string) (net.Conn, error), error) {
+		attempts = append(attempts, "bootstrap")
+		return nil, fmt.Errorf("Bootstrap server unavailable")
+	}
+
+	var events []*StaleConfigEvent
+	OnStaleConfig(func(event *StaleConfigEvent) {
+		events = append(events, event)
+	})
+
+	poll := func() {
+		mutate, _, err := pollForConfig(current())
+		if assert.NoError(t, err) {
+			assert.NoError(t, m.Update(mutate))
+		}
+	}
+
+	poll()
+	poll()
+	poll()
+	if assert.Len(t, events, 1, "Should have raised a single event for crossing the threshold") {
+		assert.True(t, events[0].Age >= 2*time.Hour, "Event should report age of config")
+		assert.Contains(t, events[0].LastError, "unavailable", "Event should report last error")
+	}
+	assert.Equal(t, []string{"proxy", "bootstrap", "bootstrap", "proxy", "bootstrap", "proxy"}, attempts, "Stale config should make polling try bootstrap servers first")
+
+	// Fetch successfully, which makes the config fresh again. The failures
+	// above opened the circuit for the cloud config URL, so probe right away.
+	circuits = newCircuitBreaker()
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write(gzipped(t, "proxiedsites:\n  cloud:\n  - a.com\n"))
+	}))
+	defer srv.Close()
+	cf = &redirectingFetcher{srv}
+	poll()
+	attempts = nil
+	cf = &recordingFetcher{&attempts}
+	poll()
+	assert.Equal(t, []string{"proxy", "bootstrap"}, attempts, "Fresh config should make polling try local proxy first")
+	assert.Len(t, events, 1, "Fresh config should not raise an event")
+
+	// Go stale again
+	assert.NoError(t, Update(func(cfg *Config) error {
+		cfg.LastCloudUpdate = longAgo
+		return nil
+	}))
+	poll()
+	assert.Len(t, events, 2, "Should have raised another event after going stale again")
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/getlantern/yamlconf"
+
+	"github.com/getlantern/flashlight/client"
+	"github.com/getlantern/flashlight/util"
+)
+
+// ConfigStore is where the configuration is kept. The default store keeps it
+// in a file in the config directory, but embeddings like the mobile app can
+// supply their own storage through WithStore.
+type ConfigStore interface {
+	// Load loads the stored configuration YAML, returning empty data if
+	// nothing has been stored yet.
+	Load() ([]byte, error)
+
+	// Save replaces the stored configuration YAML.
+	Save(data []byte) error
+
+	// Watch returns a channel that signals whenever the stored configuration
+	// may have been changed by something other than this package, or nil if
+	// that can't happen.
+	Watch() <-chan struct{}
+}
+
+// Option is an option for Init.
+type Option func(*options)
+
+type options struct {
+	store             ConfigStore
+	configDir         string
+	chainedURL        string
+	frontedURL        string
+	cloudPollInterval time.Duration
+	filePollInterval  time.Duration
+	bootstrapServers  func() map[string]*client.ChainedServerInfo
+	fetcher           util.HTTPFetcher
+	country           func() string
+	readOnlyIfRunning bool
+}
+
+// WithStore makes Init keep the configuration in the given store instead of in
+// a file in the config directory. If the store is empty, it's initialized with
+// the packaged configuration.
+func WithStore(store ConfigStore) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithConfigDir makes Init keep the config file, along with the other files
+// we keep next to it like the cloud config cache, in the given directory
+// instead of in the platform's application directory. The -configdir flag
+// does the same.
+func WithConfigDir(dir string) Option {
+	return func(o *options) {
+		o.configDir = dir
+	}
+}
+
+// WithCloudConfigURLs makes us fetch cloud config from the given URLs instead
+// of from the production ones. chainedURL is fetched through chained servers
+// and frontedURL, if not empty, in parallel through domain fronting.
+func WithCloudConfigURLs(chainedURL string, frontedURL string) Option {
+	return func(o *options) {
+		o.chainedURL = chainedURL
+		o.frontedURL = frontedURL
+	}
+}
+
+// WithPollIntervals changes how often we poll for cloud config and check the
+// config file for changes when the config doesn't say. Unlike the intervals
+// in the config, these aren't limited to sensible bounds, so tests can poll
+// quickly. Zero keeps the default.
+func WithPollIntervals(cloud time.Duration, file time.Duration) Option {
+	return func(o *options) {
+		o.cloudPollInterval = cloud
+		o.filePollInterval = file
+	}
+}
+
+// WithBootstrapServers changes the servers we fall back to fetching cloud
+// config through when fetching through the local proxy fails, which are
+// otherwise the ones in the packaged config.
+func WithBootstrapServers(servers func() map[string]*client.ChainedServerInfo) Option {
+	return func(o *options) {
+		o.bootstrapServers = servers
+	}
+}
+
+// WithHTTPFetcher makes us fetch cloud config through the local proxy with
+// the given fetcher instead of racing chained and fronted servers.
+func WithHTTPFetcher(fetcher util.HTTPFetcher) Option {
+	return func(o *options) {
+		o.fetcher = fetcher
+	}
+}
+
+// apply applies the options other than the store, leaving the production
+// defaults for the ones that weren't given.
+func (o *options) apply() {
+	if o.configDir != "" {
+		*configdir = o.configDir
+	}
+	if o.chainedURL != "" {
+		chainedCloudConfigUrl = o.chainedURL
+		frontedCloudConfigUrl = o.frontedURL
+	}
+	if o.cloudPollInterval > 0 {
+		defaultCloudPollInterval = o.cloudPollInterval
+	}
+	if o.filePollInterval > 0 {
+		defaultFilePollInterval = o.filePollInterval
+	}
+	if o.bootstrapServers != nil {
+		bootstrapServers = o.bootstrapServers
+	}
+	if o.fetcher != nil {
+		cf = o.fetcher
+	}
+	if o.country != nil {
+		geoCountry = o.country
+	}
+}
+
+// newFileStore prepares the config file for the given version of Lantern,
+// reusing a good config file from an older version or the packaged config if
+// there isn't one yet, migrating it to the current schema and backing up the
+// original, and encrypting or decrypting it as specified with -encryptconfig.
+// It returns a store for that file.
+func newFileStore(version string) (ConfigStore, error) {
+	configDir, configPath, err := InConfigDir(configFileName(version))
+	if err != nil {
+		log.Errorf("Could not get config path? %v", err)
+		return nil, err
+	}
+	restoreConfigBackup(configPath)
+	// Don't mistake an encrypted config we can't decrypt for a missing one
+	if _, err := readConfigFile(configPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	corrupt := isCorruptConfig(configPath)
+	run := useGoodOldConfig(configDir, configPath, version)
+	if !run {
+
+		// If this is our first run of this version of Lantern, use the embedded configuration
+		// file and use it to download our custom config file on this first poll for our
+		// config, unless an operator gave us a config to start with.
+		if err := makeFirstRunConfig(configPath); err != nil {
+			return nil, err
+		}
+	} else if *bootstrapURL != "" {
+		log.Debugf("Already have a config, ignoring -bootstrap-url")
+	}
+	if corrupt {
+		reportError(ParseError, fmt.Errorf("Config file at %v was corrupt and has been replaced", configPath), false)
+	}
+	if err := migrateConfigFile(configPath); err != nil {
+		// Keep going with the unmigrated config, which may still be usable
+		log.Errorf("Unable to migrate config: %v", err)
+	}
+	configFile = yamlconf.NewFileStore(configPath)
+	store := newEncryptingStore(configFile, encryptionFlag())
+	if _, err := store.convert(); err != nil {
+		if isDecryptError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Unable to change encryption of config: %v", err)
+	}
+	profilesSupported = true
+	return store, nil
+}
+
+// restoreConfigBackup restores the previous version of the config file at the
+// given path, which the file store keeps when saving it, if the file is empty,
+// truncated or garbled, as it can be after losing power while it was being
+// written, and the previous version is fine. The previous version loses the
+// latest changes, but keeps the user's settings and servers, which starting
+// over from the packaged config wouldn't.
+func restoreConfigBackup(configPath string) {
+	data, err := readConfigFile(configPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil && len(bytes.TrimSpace(data)) > 0 && checkParses(data) == nil {
+		return
+	}
+	backupPath := configPath + yamlconf.BackupSuffix
+	backup, err := readConfigFile(backupPath)
+	if err != nil || len(bytes.TrimSpace(backup)) == 0 || checkParses(backup) != nil {
+		log.Debugf("Config file at %v is damaged, but there's no usable backup at %v", configPath, backupPath)
+		return
+	}
+	// Restore the backup as it's stored, encrypted or not, except that a
+	// plaintext backup never replaces an encrypted config
+	stored, err := ioutil.ReadFile(backupPath)
+	if err == nil && !isEncrypted(stored) && wantsEncryptedConfig(configPath) {
+		log.Errorf("Config file at %v is damaged, but its backup isn't encrypted, not restoring it", configPath)
+		return
+	}
+	if err == nil {
+		err = yamlconf.WriteFileAtomically(configPath, stored)
+	}
+	if err != nil {
+		log.Errorf("Unable to restore config file at %v from backup: %v", configPath, err)
+		return
+	}
+	reportError(ParseError, fmt.Errorf("Config file at %v was damaged and has been restored from its backup", configPath), false)
+}
+
+// wantsEncryptedConfig returns whether the config file at the given path is
+// encrypted or is to be encrypted with -encryptconfig.
+func wantsEncryptedConfig(configPath string) bool {
+	if encrypt := encryptionFlag(); encrypt != nil {
+		return *encrypt
+	}
+	data, err := ioutil.ReadFile(configPath)
+	return err == nil && isEncrypted(data)
+}
+
+// isCorruptConfig returns whether the config file at the given path exists but
+// can't be parsed.
+func isCorruptConfig(configPath string) bool {
+	data, err := readConfigFile(configPath)
+	if err != nil {
+		return false
+	}
+	if err := checkParses(data); err != nil {
+		log.Errorf("Config file at %v is corrupt: %v", configPath, err)
+		return true
+	}
+	return false
+}
+
+// prepareStore initializes the given store with the packaged config if it's
+// empty and migrates what it contains to the current schema.
+func prepareStore(store ConfigStore) error {
+	data, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("Unable to load config: %v", err)
+	}
+	if len(data) == 0 {
+		log.Debugf("Store is empty, using first run config")
+		data, err = firstRunConfig()
+		if err != nil {
+			return err
+		}
+	}
+	if flattened, err := flattenDocuments(data); err != nil {
+		log.Errorf("Unable to flatten config: %v", err)
+	} else {
+		data = flattened
+	}
+	migrated, from, to, err := migrate(data, migrations)
+	if err != nil {
+		// Keep going with the unmigrated config, which may still be usable
+		log.Errorf("Unable to migrate config: %v", err)
+		migrated = data
+	} else if to != from {
+		log.Debugf("Migrated config from schema version %d to %d", from, to)
+	}
+	return store.Save(migrated)
+}
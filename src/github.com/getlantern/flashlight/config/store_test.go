@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/yamlconf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitWithStore(t *testing.T) {
+	store := yamlconf.NewMemoryStore([]byte("cloudconfig: http://config.example.com/cloud.yaml\naddr: localhost:8787\nrole: client\n"))
+	cfg, err := Init("2.1.0", WithStore(store))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer m.Stop()
+
+	assert.Equal(t, []string{"http://config.example.com/cloud.yaml"}, cfg.CloudConfigs, "Stored config should have been migrated")
+	assert.Equal(t, 2, cfg.SchemaVersion)
+	assert.Equal(t, provenanceStandard, cfg.Provenance, "Stored config should have been marked with its provenance")
+
+	if !assert.NoError(t, m.Flush()) {
+		return
+	}
+	saved, _ := store.Load()
+	assert.Contains(t, string(saved), "cloudconfigs:", "Migrated config should have been saved to store")
+	assert.NotContains(t, string(saved), "cloudconfig:", "Migrated config should have been saved to store")
+}
+
+func TestPrepareEmptyStore(t *testing.T) {
+	packaged, err := packagedConfig()
+	if err != nil {
+		t.Skipf("No packaged config available: %v", err)
+	}
+	store := yamlconf.NewMemoryStore(nil)
+	if !assert.NoError(t, prepareStore(store)) {
+		return
+	}
+	saved, _ := store.Load()
+	expected, _, _, err := migrate(packaged, migrations)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(expected), string(saved), "Empty store should have been initialized with packaged config")
+	}
+}
+
+func TestDamagedConfigRestoredFromBackup(t *testing.T) {
+	collected, restore := collectErrors()
+	defer restore()
+	dir := t.TempDir()
+	origConfigdir := *configdir
+	*configdir = dir
+	defer func() {
+		*configdir = origConfigdir
+	}()
+
+	good := "client:\n  chainedservers:\n    fallback-1:\n      addr: 1.2.3.4:443\n"
+	for version, damaged := range map[string]string{"2.1.0": "", "2.1.1": "client: [\n"} {
+		*collected = nil
+		path := filepath.Join(dir, configFileName(version))
+		if err := ioutil.WriteFile(path, []byte(damaged), 0644); err != nil {
+			t.Fatalf("Unable to write config: %v", err)
+		}
+		if err := ioutil.WriteFile(path+yamlconf.BackupSuffix, []byte(good), 0644); err != nil {
+			t.Fatalf("Unable to write backup: %v", err)
+		}
+		_, err := newFileStore(version)
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, _ := ioutil.ReadFile(path)
+		assert.Contains(t, string(data), "1.2.3.4:443", "Config %q should have been restored from backup", damaged)
+		if assert.Equal(t, []ErrorCategory{ParseError}, categoriesOf(*collected)) {
+			assert.Contains(t, (*collected)[0].Err.Error(), "restored from its backup")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/getlantern/proxiedsites"
+	"github.com/getlantern/yaml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+const territoryCloudConfig = `
+client:
+  frontedservers:
+  - host: eu.example.com
+    port: 443
+    territories: [DE, FR]
+    priority: 10
+  - host: anywhere.example.com
+    port: 443
+  - host: cn.example.com
+    port: 443
+    territories: [cn]
+    priority: 5
+  - host: cn-backup.example.com
+    port: 443
+    territories: [CN]
+  chainedservers:
+    eu-1:
+      addr: 1.1.1.1:443
+      territories: [DE]
+      priority: 10
+    anywhere-1:
+      addr: 2.2.2.2:443
+    cn-1:
+      addr: 3.3.3.3:443
+      territories: [CN]
+      priority: 5
+    cn-2:
+      addr: 4.4.4.4:443
+      territories: [CN]
+      priority: 5
+`
+
+func frontedHosts(cfg *Config) []string {
+	var hosts []string
+	for _, s := range cfg.Client.FrontedServers {
+		hosts = append(hosts, s.Host)
+	}
+	return hosts
+}
+
+func TestCloudServersRankedForTerritory(t *testing.T) {
+	for _, test := range []struct {
+		territory string
+		fronted   []string
+		preferred []string
+	}{
+		{"cn", []string{"cn.example.com", "anywhere.example.com", "cn-backup.example.com", "eu.example.com"}, []string{"cn-1", "cn-2"}},
+		{"DE", []string{"eu.example.com", "anywhere.example.com", "cn.example.com", "cn-backup.example.com"}, []string{"eu-1"}},
+		{"", []string{"eu.example.com", "cn.example.com", "anywhere.example.com", "cn-backup.example.com"}, []string{"eu-1"}},
+	} {
+		cfg := &Config{
+			Client:       &client.ClientConfig{Territory: test.territory},
+			ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}},
+		}
+		if !assert.NoError(t, cfg.updateFrom([]byte(territoryCloudConfig))) {
+			continue
+		}
+		cfg.ApplyDefaults()
+		assert.Equal(t, test.fronted, frontedHosts(cfg), "Wrong order of fronted servers for %q", test.territory)
+		assert.Equal(t, test.preferred, cfg.Client.PreferredChainedServers(), "Wrong preferred chained servers for %q", test.territory)
+	}
+}
+
+func TestTerritoryOrderingDeterministic(t *testing.T) {
+	build := func(reversed bool) *Config {
+		cfg := &Config{
+			Client:       &client.ClientConfig{Territory: "CN"},
+			ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}},
+		}
+		if !assert.NoError(t, cfg.updateFrom([]byte(territoryCloudConfig))) {
+			return cfg
+		}
+		if reversed {
+			servers := cfg.Client.FrontedServers
+			for i, j := 0, len(servers)-1; i < j; i, j = i+1, j-1 {
+				servers[i], servers[j] = servers[j], servers[i]
+			}
+		}
+		cfg.ApplyDefaults()
+		return cfg
+	}
+
+	first, err := yaml.Marshal(build(false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	second, err := yaml.Marshal(build(true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, string(first), string(second), "Same servers in a different order should marshal identically")
+
+	// And stays that way when read back, like after a restart
+	cfg := &Config{}
+	if assert.NoError(t, yaml.Unmarshal(first, cfg)) {
+		cfg.ApplyDefaults()
+		assert.Equal(t, frontedHosts(build(false)), frontedHosts(cfg))
+	}
+}
+
+func TestValidateFileBadTerritories(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  territory: china
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+      territories: [CN, C1]
+      priority: -1
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	var fields []string
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	assert.Equal(t, []string{"Client.ChainedServers.fallback-1.Territories.1", "Client.ChainedServers.fallback-1.Priority", "Client.Territory"}, fields)
+}
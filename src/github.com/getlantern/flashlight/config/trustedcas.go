@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getlantern/keyman"
+)
+
+const (
+	// defaultCAOverlapWindow is how long we keep trusting a CA after cloud
+	// config stops listing it, unless CAOverlapWindow says otherwise.
+	defaultCAOverlapWindow = 30 * 24 * time.Hour
+
+	// caExpiryWarning is how long before a trusted CA's certificate expires
+	// that we start warning about it.
+	caExpiryWarning = 30 * 24 * time.Hour
+)
+
+var (
+	// systemCertPool returns the platform's root CAs.
+	systemCertPool = x509.SystemCertPool
+)
+
+// dedupCAs removes CAs whose certificates duplicate an earlier one, logging an
+// error for CAs that share a CommonName but have different certificates.
+func dedupCAs(cas []*CA) []*CA {
+	deduped := make([]*CA, 0, len(cas))
+	seen := make(map[[sha256.Size]byte]bool)
+	fingerprintsByName := make(map[string][sha256.Size]byte)
+	for _, ca := range cas {
+		fingerprint := fingerprintOf(ca.Cert)
+		if seen[fingerprint] {
+			log.Tracef("Ignoring duplicate trusted CA %v", ca.CommonName)
+			continue
+		}
+		if existing, found := fingerprintsByName[ca.CommonName]; found && existing != fingerprint {
+			log.Errorf("Trusted CAs include conflicting certificates for %v", ca.CommonName)
+		}
+		seen[fingerprint] = true
+		fingerprintsByName[ca.CommonName] = fingerprint
+		deduped = append(deduped, ca)
+	}
+	return deduped
+}
+
+// mergeTrustedCAs merges the TrustedCAs from a cloud config update with the
+// ones we trusted before it, given the old ones and the current time, so that
+// rotating a CA doesn't leave a window in which clients only trust one of the
+// old and new CAs while servers still use the other. CAs the update leaves out
+// stay trusted for CAOverlapWindow. CAs the update marks as Superseded stay
+// trusted until their NotAfter, if any, or until their certificate expires.
+// CAs the update marks as Removed, by certificate or by CommonName if they have
+// none, stop being trusted right away.
+func (updated *Config) mergeTrustedCAs(oldCAs []*CA, now time.Time) {
+	window := updated.caOverlapWindow()
+	removedCerts := make(map[[sha256.Size]byte]bool)
+	removedNames := make(map[string]bool)
+	listed := make(map[[sha256.Size]byte]bool)
+	merged := make([]*CA, 0, len(updated.TrustedCAs)+len(oldCAs))
+	for _, ca := range updated.TrustedCAs {
+		if ca.Removed {
+			if strings.TrimSpace(ca.Cert) == "" {
+				removedNames[ca.CommonName] = true
+			} else {
+				removedCerts[fingerprintOf(ca.Cert)] = true
+			}
+			continue
+		}
+		listed[fingerprintOf(ca.Cert)] = true
+		merged = append(merged, ca)
+	}
+	for _, ca := range oldCAs {
+		fingerprint := fingerprintOf(ca.Cert)
+		if listed[fingerprint] || removedCerts[fingerprint] || removedNames[ca.CommonName] {
+			continue
+		}
+		retained := *ca
+		if retained.RetainedSince == "" {
+			retained.RetainedSince = now.Format(time.RFC3339)
+		}
+		merged = append(merged, &retained)
+	}
+
+	trusted := make([]*CA, 0, len(merged))
+	for _, ca := range merged {
+		if removedCerts[fingerprintOf(ca.Cert)] || removedNames[ca.CommonName] {
+			log.Debugf("Trusted CA %v was removed", ca.CommonName)
+			continue
+		}
+		if expired, reason := ca.expired(now, window); expired {
+			log.Debugf("No longer trusting CA %v: %v", ca.CommonName, reason)
+			continue
+		}
+		trusted = append(trusted, ca)
+	}
+	updated.TrustedCAs = trusted
+
+	for _, ca := range trusted {
+		cert, err := keyman.LoadCertificateFromPEMBytes([]byte(ca.Cert))
+		if err != nil {
+			// Validate reports these
+			continue
+		}
+		notAfter := cert.X509().NotAfter
+		if !now.Before(notAfter) {
+			log.Errorf("Trusted CA %v expired on %v", ca.CommonName, notAfter.Format(time.RFC3339))
+			reportError(ValidateError, fmt.Errorf("Trusted CA %v expired on %v", ca.CommonName, notAfter.Format(time.RFC3339)), false)
+		} else if expiresIn := notAfter.Sub(now); expiresIn < caExpiryWarning {
+			log.Errorf("Trusted CA %v expires in %v, on %v", ca.CommonName, expiresIn, notAfter.Format(time.RFC3339))
+			reportError(ValidateError, fmt.Errorf("Trusted CA %v expires on %v", ca.CommonName, notAfter.Format(time.RFC3339)), false)
+		}
+	}
+}
+
+// expired returns whether we should no longer trust this CA at the given time,
+// given how long to keep trusting CAs after cloud config stops listing them,
+// along with why.
+func (ca *CA) expired(now time.Time, window time.Duration) (bool, string) {
+	if ca.RetainedSince != "" {
+		since, err := time.Parse(time.RFC3339, ca.RetainedSince)
+		if err == nil && now.Sub(since) >= window {
+			return true, fmt.Sprintf("not listed since %v", ca.RetainedSince)
+		}
+	}
+	if !ca.Superseded && ca.RetainedSince == "" {
+		return false, ""
+	}
+	if ca.NotAfter != "" {
+		notAfter, err := time.Parse(time.RFC3339, ca.NotAfter)
+		if err == nil && !now.Before(notAfter) {
+			return true, fmt.Sprintf("superseded after %v", ca.NotAfter)
+		}
+	}
+	cert, err := keyman.LoadCertificateFromPEMBytes([]byte(ca.Cert))
+	if err == nil && !now.Before(cert.X509().NotAfter) {
+		return true, fmt.Sprintf("certificate expired on %v", cert.X509().NotAfter.Format(time.RFC3339))
+	}
+	return false, ""
+}
+
+// caOverlapWindow returns how long to keep trusting a CA after cloud config
+// stops listing it.
+func (cfg *Config) caOverlapWindow() time.Duration {
+	if cfg.CAOverlapWindow <= 0 {
+		return defaultCAOverlapWindow
+	}
+	return cfg.CAOverlapWindow
+}
+
+// trustedCAsExpired returns whether mergeTrustedCAs would now stop trusting
+// any of this Config's TrustedCAs.
+func (cfg *Config) trustedCAsExpired(now time.Time) bool {
+	window := cfg.caOverlapWindow()
+	for _, ca := range cfg.TrustedCAs {
+		if expired, _ := ca.expired(now, window); expired {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error if this CA's Cert isn't a single PEM-encoded
+// certificate, or if it doesn't match the CA's SHA256 fingerprint when it has
+// one. CAs that are Removed by CommonName have no Cert to check.
+func (ca *CA) check() error {
+	if ca.Removed && strings.TrimSpace(ca.Cert) == "" {
+		return nil
+	}
+	block, rest := pem.Decode([]byte(ca.Cert))
+	if block == nil {
+		return fmt.Errorf("no PEM-encoded certificate found")
+	}
+	if block.Type != "CERTIFICATE" {
+		return fmt.Errorf("PEM block is a %v, not a CERTIFICATE", block.Type)
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return fmt.Errorf("unexpected data after certificate")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	if ca.SHA256 == "" {
+		return nil
+	}
+	expected := strings.ToLower(strings.Replace(ca.SHA256, ":", "", -1))
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != 2*sha256.Size {
+		return fmt.Errorf("not a SHA-256 fingerprint: %q", ca.SHA256)
+	}
+	fingerprint := sha256.Sum256(block.Bytes)
+	if actual := hex.EncodeToString(fingerprint[:]); actual != expected {
+		return fmt.Errorf("certificate fingerprint %v doesn't match %v", actual, expected)
+	}
+	return nil
+}
+
+// caIssues returns the issues with the given CAs found by check.
+func caIssues(cas []*CA) []Issue {
+	var issues []Issue
+	for i, ca := range cas {
+		if err := ca.check(); err != nil {
+			issues = append(issues, Issue{Field: fmt.Sprintf("TrustedCAs.%d.Cert", i), Message: fmt.Sprintf("%v: %v", ca.CommonName, err)})
+		}
+	}
+	return issues
+}
+
+// fingerprintOf returns the SHA-256 fingerprint of the given PEM-encoded
+// certificate, or of its trimmed text if it can't be parsed.
+func fingerprintOf(pemCert string) [sha256.Size]byte {
+	cert, err := keyman.LoadCertificateFromPEMBytes([]byte(pemCert))
+	if err != nil {
+		return sha256.Sum256([]byte(strings.TrimSpace(pemCert)))
+	}
+	return sha256.Sum256(cert.X509().Raw)
+}
+
+// poolWithSystemCAs returns a pool containing the platform's root CAs along
+// with the given PEM-encoded certificates. If the platform's root CAs can't be
+// loaded, the pool contains only the given certificates.
+func poolWithSystemCAs(certs []string) (*x509.CertPool, error) {
+	pool, err := systemCertPool()
+	if err != nil || pool == nil {
+		log.Errorf("Unable to load system root CAs, using only configured CAs: %v", err)
+		pool = x509.NewCertPool()
+	}
+	for _, pemCert := range certs {
+		cert, err := keyman.LoadCertificateFromPEMBytes([]byte(pemCert))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse trusted CA: %v", err)
+		}
+		pool.AddCert(cert.X509())
+	}
+	return pool, nil
+}
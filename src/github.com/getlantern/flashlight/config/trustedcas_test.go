@@ -0,0 +1,212 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getlantern/keyman"
+	"github.com/getlantern/proxiedsites"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+func generateCA(t *testing.T, name string) *keyman.Certificate {
+	return generateCAExpiring(t, name, time.Now().Add(365*24*time.Hour))
+}
+
+func generateCAExpiring(t *testing.T, name string, notAfter time.Time) *keyman.Certificate {
+	pk, err := keyman.GeneratePK(2048)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	cert, err := pk.TLSCertificateFor("Lantern", name, notAfter, true, nil)
+	if err != nil {
+		t.Fatalf("Unable to generate certificate: %v", err)
+	}
+	return cert
+}
+
+func TestDuplicateTrustedCAsCollapse(t *testing.T) {
+	a := string(generateCA(t, "CA A").PEMEncoded())
+	b := string(generateCA(t, "CA B").PEMEncoded())
+	conflicting := string(generateCA(t, "CA A").PEMEncoded())
+
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	update := fmt.Sprintf("trustedcas:\n- commonname: CA A\n  cert: %q\n- commonname: CA B\n  cert: %q\n- commonname: CA A again\n  cert: %q\n- commonname: CA A\n  cert: %q\n", a, b, a, conflicting)
+	if !assert.NoError(t, cfg.updateFrom([]byte(update))) {
+		return
+	}
+	if assert.Len(t, cfg.TrustedCAs, 3, "Duplicate certificate should have collapsed to one") {
+		assert.Equal(t, "CA A", cfg.TrustedCAs[0].CommonName)
+		assert.Equal(t, "CA B", cfg.TrustedCAs[1].CommonName)
+		assert.Equal(t, conflicting, cfg.TrustedCAs[2].Cert, "Conflicting certificate should be kept")
+	}
+}
+
+func TestIncludeSystemCAs(t *testing.T) {
+	system := generateCA(t, "System CA")
+	origSystemCertPool := systemCertPool
+	defer func() {
+		systemCertPool = origSystemCertPool
+	}()
+	systemCertPool = func() (*x509.CertPool, error) {
+		return system.PoolContainingCert(), nil
+	}
+
+	cfg := &Config{
+		TrustedCAs: []*CA{&CA{CommonName: "CA A", Cert: string(generateCA(t, "CA A").PEMEncoded())}},
+	}
+	pool, err := cfg.GetTrustedCACerts()
+	if assert.NoError(t, err) {
+		assert.Len(t, pool.Subjects(), 1, "Without IncludeSystemCAs, only configured CAs should be trusted")
+	}
+
+	cfg.IncludeSystemCAs = true
+	pool, err = cfg.GetTrustedCACerts()
+	if assert.NoError(t, err) {
+		assert.Len(t, pool.Subjects(), 2, "With IncludeSystemCAs, system CAs should also be trusted")
+	}
+
+	systemCertPool = func() (*x509.CertPool, error) {
+		return nil, fmt.Errorf("No system roots here")
+	}
+	pool, err = cfg.GetTrustedCACerts()
+	if assert.NoError(t, err, "Failing to load system CAs should not be fatal") {
+		assert.Len(t, pool.Subjects(), 1, "Without system CAs, configured CAs should still be trusted")
+	}
+}
+
+// trustedCANames returns the CommonNames of the given config's TrustedCAs,
+// checking that its trust pool has the same number of certificates.
+func trustedCANames(t *testing.T, cfg *Config) []string {
+	pool, err := cfg.GetTrustedCACerts()
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.TrustedCAs))
+	for _, ca := range cfg.TrustedCAs {
+		names = append(names, ca.CommonName)
+	}
+	assert.Len(t, pool.Subjects(), len(names), "Trust pool should have each trusted CA")
+	return names
+}
+
+func TestTrustedCARotation(t *testing.T) {
+	oldCA := string(generateCA(t, "Old CA").PEMEncoded())
+	newCA := string(generateCA(t, "New CA").PEMEncoded())
+	notAfter := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
+
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	publish := func(update string) {
+		updated, err := cfg.candidateFrom([]byte(update))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		cfg = updated
+	}
+
+	publish(fmt.Sprintf("trustedcas:\n- commonname: Old CA\n  cert: %q\n", oldCA))
+	assert.Equal(t, []string{"Old CA"}, trustedCANames(t, cfg))
+
+	// The new CA is published alongside the old one, which is superseded
+	publish(fmt.Sprintf("trustedcas:\n- commonname: New CA\n  cert: %q\n- commonname: Old CA\n  cert: %q\n  superseded: true\n  notafter: %v\n", newCA, oldCA, notAfter))
+	assert.Equal(t, []string{"New CA", "Old CA"}, trustedCANames(t, cfg))
+
+	// The old CA is left out, but stays trusted until its NotAfter
+	third := fmt.Sprintf("trustedcas:\n- commonname: New CA\n  cert: %q\n", newCA)
+	publish(third)
+	assert.Equal(t, []string{"New CA", "Old CA"}, trustedCANames(t, cfg), "Old CA should be trusted during the overlap")
+	assert.True(t, cfg.TrustedCAs[1].Superseded)
+	assert.NotEmpty(t, cfg.TrustedCAs[1].RetainedSince)
+
+	defer useWallClock(3 * time.Hour)()
+	publish(third)
+	assert.Equal(t, []string{"New CA"}, trustedCANames(t, cfg), "Old CA should not be trusted after its NotAfter")
+}
+
+func TestTrustedCARemovalAndOverlapWindow(t *testing.T) {
+	oldCA := string(generateCA(t, "Old CA").PEMEncoded())
+	newCA := string(generateCA(t, "New CA").PEMEncoded())
+	both := fmt.Sprintf("trustedcas:\n- commonname: Old CA\n  cert: %q\n- commonname: New CA\n  cert: %q\n", oldCA, newCA)
+	onlyNew := fmt.Sprintf("trustedcas:\n- commonname: New CA\n  cert: %q\n", newCA)
+
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	assert.NoError(t, cfg.updateFrom([]byte(both)))
+	assert.NoError(t, cfg.updateFrom([]byte(onlyNew)))
+	assert.Equal(t, []string{"New CA", "Old CA"}, trustedCANames(t, cfg), "Left out CA should be trusted for the overlap window")
+
+	// An explicit removal takes effect right away, by certificate or by name
+	removed := *cfg
+	assert.NoError(t, removed.updateFrom([]byte(onlyNew+fmt.Sprintf("- commonname: Old CA\n  cert: %q\n  removed: true\n", oldCA))))
+	assert.Equal(t, []string{"New CA"}, trustedCANames(t, &removed))
+	removed = *cfg
+	assert.NoError(t, removed.updateFrom([]byte(onlyNew+"- commonname: Old CA\n  removed: true\n")))
+	assert.Equal(t, []string{"New CA"}, trustedCANames(t, &removed))
+
+	// Otherwise, it's dropped once the overlap window passes
+	cfg.CAOverlapWindow = time.Hour
+	restore := useWallClock(59 * time.Minute)
+	assert.NoError(t, cfg.updateFrom([]byte(onlyNew)))
+	restore()
+	assert.Equal(t, []string{"New CA", "Old CA"}, trustedCANames(t, cfg))
+	defer useWallClock(61 * time.Minute)()
+	assert.NoError(t, cfg.updateFrom([]byte(onlyNew)))
+	assert.Equal(t, []string{"New CA"}, trustedCANames(t, cfg), "Left out CA should not be trusted after the overlap window")
+}
+
+func TestWarnOnExpiringTrustedCA(t *testing.T) {
+	collected, restore := collectErrors()
+	defer restore()
+	expiring := string(generateCAExpiring(t, "Expiring CA", time.Now().Add(10*24*time.Hour)).PEMEncoded())
+	fine := string(generateCA(t, "Fine CA").PEMEncoded())
+
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	assert.NoError(t, cfg.updateFrom([]byte(fmt.Sprintf("trustedcas:\n- commonname: Fine CA\n  cert: %q\n", fine))))
+	assert.Empty(t, *collected)
+	assert.NoError(t, cfg.updateFrom([]byte(fmt.Sprintf("trustedcas:\n- commonname: Fine CA\n  cert: %q\n- commonname: Expiring CA\n  cert: %q\n", fine, expiring))))
+	if assert.Len(t, *collected, 1) {
+		assert.Equal(t, ValidateError, (*collected)[0].Category)
+		assert.Contains(t, (*collected)[0].Error(), "Expiring CA")
+	}
+}
+
+func TestTrustedCAsChecked(t *testing.T) {
+	ca := string(generateCA(t, "CA A").PEMEncoded())
+	fingerprint := fingerprintOf(ca)
+	pinned := fmt.Sprintf("%x", fingerprint)
+
+	assert.NoError(t, (&CA{Cert: ca}).check())
+	assert.NoError(t, (&CA{Cert: ca, SHA256: strings.ToUpper(pinned)}).check())
+	assert.NoError(t, (&CA{CommonName: "CA A", Removed: true}).check(), "CAs removed by name need no certificate")
+	assert.Error(t, (&CA{Cert: "not a cert"}).check())
+	assert.Error(t, (&CA{Cert: "-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n"}).check())
+	assert.Error(t, (&CA{Cert: ca + "trailing"}).check())
+	assert.Error(t, (&CA{Cert: ca, SHA256: "abcd"}).check())
+	assert.Error(t, (&CA{Cert: ca, SHA256: fmt.Sprintf("%x", fingerprintOf(defaultTrustedCAs[0].Cert))}).check())
+
+	cfg := &Config{Client: &client.ClientConfig{}, ProxiedSites: &proxiedsites.Config{Delta: &proxiedsites.Delta{}}}
+	if !assert.NoError(t, cfg.updateFrom([]byte(fmt.Sprintf("trustedcas:\n- commonname: CA A\n  cert: %q\n  sha256: %v\n", ca, pinned)))) {
+		return
+	}
+	swapped := string(generateCA(t, "CA A").PEMEncoded())
+	err := cfg.updateFrom([]byte(fmt.Sprintf("trustedcas:\n- commonname: CA A\n  cert: %q\n  sha256: %v\n", swapped, pinned)))
+	if assert.IsType(t, &ValidationError{}, err, "Update with a CA that doesn't match its fingerprint should be refused") {
+		assert.Equal(t, "TrustedCAs.0.Cert", err.(*ValidationError).Issues[0].Field)
+	}
+	err = cfg.updateFrom([]byte("trustedcas:\n- commonname: CA B\n  cert: bad\n"))
+	assert.IsType(t, &ValidationError{}, err, "Update with a malformed CA should be refused")
+	assert.Equal(t, []string{"CA A"}, trustedCANames(t, cfg), "Refused updates should leave the CAs as they were")
+
+	cfg.TrustedCAs = append(cfg.TrustedCAs, &CA{CommonName: "CA B", Cert: swapped, SHA256: pinned})
+	pool, err := cfg.GetTrustedCACerts()
+	if assert.NoError(t, err) {
+		assert.Len(t, pool.Subjects(), 1, "CAs that don't match their fingerprint shouldn't be trusted")
+	}
+	if issues := caIssues(cfg.TrustedCAs); assert.Len(t, issues, 1) {
+		assert.Equal(t, "TrustedCAs.1.Cert", issues[0].Field)
+	}
+}
@@ -0,0 +1,331 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getlantern/keyman"
+	"github.com/getlantern/yaml"
+)
+
+// Issue describes a problem found while validating a Config.
+type Issue struct {
+	// Field: the path to the offending field, for example
+	// Client.ChainedServers.fallback-1.Addr
+	Field string
+
+	// Message: a description of the problem
+	Message string
+
+	// Line: the line in the source YAML on which the field was found, or 0 if
+	// unknown
+	Line int
+}
+
+func (issue Issue) String() string {
+	if issue.Line > 0 {
+		return fmt.Sprintf("line %d: %v: %v", issue.Line, issue.Field, issue.Message)
+	}
+	return fmt.Sprintf("%v: %v", issue.Field, issue.Message)
+}
+
+// ValidationError is returned when a Config fails validation.
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		msgs = append(msgs, issue.String())
+	}
+	return fmt.Sprintf("Invalid config: %v", strings.Join(msgs, "; "))
+}
+
+// newIssues returns the issues in after that aren't in before.
+func newIssues(before []Issue, after []Issue) []Issue {
+	existing := make(map[string]bool, len(before))
+	for _, issue := range before {
+		existing[issue.String()] = true
+	}
+	var added []Issue
+	for _, issue := range after {
+		if !existing[issue.String()] {
+			added = append(added, issue)
+		}
+	}
+	return added
+}
+
+// Validate checks this Config for settings that would prevent Lantern from
+// running properly, returning any issues found.
+func (cfg *Config) Validate() []Issue {
+	var issues []Issue
+	add := func(field string, msg string, args ...interface{}) {
+		issues = append(issues, Issue{Field: field, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	if cfg.Role != "client" && cfg.Role != "server" {
+		add("Role", "must be either client or server, not %q", cfg.Role)
+	}
+	if err := validateAddr(cfg.Addr); err != nil {
+		add("Addr", "%v", err)
+	}
+	if cfg.UIAddr != "" {
+		if err := validateAddr(cfg.UIAddr); err != nil {
+			add("UIAddr", "%v", err)
+		}
+	}
+	for i, cloudConfig := range cfg.CloudConfigs {
+		if u, err := url.Parse(cloudConfig); err != nil || u.Host == "" {
+			add(fmt.Sprintf("CloudConfigs.%d", i), "not a valid URL: %q", cloudConfig)
+		}
+	}
+	for i, resolver := range cfg.DoHResolvers {
+		if u, err := url.Parse(resolver); err != nil || u.Host == "" {
+			add(fmt.Sprintf("DoHResolvers.%d", i), "not a valid URL: %q", resolver)
+		}
+	}
+	if cfg.DNSConfigDomain != "" && !isPlausibleDomain(strings.TrimSuffix(cfg.DNSConfigDomain, "."), false) {
+		add("DNSConfigDomain", "not a valid domain: %q", cfg.DNSConfigDomain)
+	}
+	if cfg.CloudConfigCA != "" {
+		if _, err := keyman.LoadCertificateFromPEMBytes([]byte(cfg.CloudConfigCA)); err != nil {
+			add("CloudConfigCA", "unable to parse certificate: %v", err)
+		}
+	}
+	issues = append(issues, caIssues(cfg.TrustedCAs)...)
+	for i, ca := range cfg.TrustedCAs {
+		if ca.NotAfter != "" {
+			if _, err := time.Parse(time.RFC3339, ca.NotAfter); err != nil {
+				add(fmt.Sprintf("TrustedCAs.%d.NotAfter", i), "not an RFC 3339 time: %q", ca.NotAfter)
+			}
+		}
+	}
+	for name, percent := range cfg.FeatureRollouts {
+		if percent < 0 || percent > 100 {
+			add("FeatureRollouts."+name, "must be between 0 and 100: %d", percent)
+		}
+	}
+	switch cfg.MeteredConnection {
+	case "", meteredAuto, meteredAlways, meteredNever:
+	default:
+		add("MeteredConnection", "must be auto, always or never, not %q", cfg.MeteredConnection)
+	}
+	if cfg.ConfigProxy != "" {
+		if _, err := parseConfigProxy(cfg.ConfigProxy); err != nil {
+			add("ConfigProxy", "%v", err)
+		}
+	}
+
+	if cfg.Role == "server" && cfg.Server != nil && cfg.Server.RegisterAt != "" {
+		if u, err := url.Parse(cfg.Server.RegisterAt); err != nil || u.Host == "" {
+			add("Server.RegisterAt", "not a valid URL: %q", cfg.Server.RegisterAt)
+		}
+	}
+
+	if cfg.Client != nil {
+		for name, server := range cfg.Client.ChainedServers {
+			field := "Client.ChainedServers." + name
+			if err := validateAddr(server.Addr); err != nil {
+				add(field+".Addr", "%v", err)
+			}
+			if server.Cert != "" {
+				if _, err := keyman.LoadCertificateFromPEMBytes([]byte(server.Cert)); err != nil {
+					add(field+".Cert", "unable to parse certificate: %v", err)
+				}
+			}
+			validateServerRank(add, field, server.Territories, server.Priority)
+		}
+		for i, server := range cfg.Client.FrontedServers {
+			field := fmt.Sprintf("Client.FrontedServers.%d", i)
+			if server.Host == "" {
+				add(field+".Host", "must be specified")
+			}
+			if _, found := cfg.Client.MasqueradeSets[server.MasqueradeSet]; !found {
+				add(field+".MasqueradeSet", "unknown masquerade set %q, configured sets are %v", server.MasqueradeSet, cfg.masqueradeSetNames())
+			}
+			validateServerRank(add, field, server.Territories, server.Priority)
+		}
+		if t := cfg.Client.Territory; t != "" && !isTerritoryCode(t) {
+			add("Client.Territory", "not a 2-letter territory code: %q", t)
+		}
+		if name := cfg.Client.DefaultMasqueradeSet; name != "" {
+			_, configured := cfg.Client.MasqueradeSets[name]
+			_, builtin := builtinMasqueradeSets[name]
+			if !configured && !builtin {
+				add("Client.DefaultMasqueradeSet", "unknown masquerade set %q, configured sets are %v", name, cfg.masqueradeSetNames())
+			}
+		}
+	}
+
+	return issues
+}
+
+// validateServerRank checks the territories and priority of the server at
+// field.
+func validateServerRank(add func(field string, msg string, args ...interface{}), field string, territories []string, priority int) {
+	for i, t := range territories {
+		if !isTerritoryCode(t) {
+			add(fmt.Sprintf("%v.Territories.%d", field, i), "not a 2-letter territory code: %q", t)
+		}
+	}
+	if priority < 0 {
+		add(field+".Priority", "must not be negative: %d", priority)
+	}
+}
+
+// isTerritoryCode returns whether s looks like a 2-letter territory code, in
+// either case.
+func isTerritoryCode(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// masqueradeSetNames returns the sorted names of the configured masquerade
+// sets.
+func (cfg *Config) masqueradeSetNames() []string {
+	names := make([]string, 0, len(cfg.Client.MasqueradeSets))
+	for name := range cfg.Client.MasqueradeSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateAddr(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("must be specified")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("not a valid host:port: %v", err)
+	}
+	return nil
+}
+
+// ValidateFile loads the config file at the given path, applies defaults to
+// it as a normal start would and validates the result. It returns the issues
+// found, with the line on which each one occurs where possible, or an error
+// if the file can't be read or parsed at all. ValidateFile doesn't touch the
+// config directory or start polling.
+func ValidateFile(path string) ([]Issue, error) {
+	_, _, issues, err := loadAndValidateFile(path)
+	return issues, err
+}
+
+// loadAndValidateFile is ValidateFile, also returning the config loaded from
+// the file and the file itself.
+func loadAndValidateFile(path string) (*Config, []byte, []Issue, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Unable to read config file %v: %v", path, err)
+	}
+	// Issues point at lines in the file as written, even if it has several
+	// documents
+	flattened, err := flattenDocuments(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Unable to parse config file %v: %v", path, err)
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(flattened, cfg); err != nil {
+		return nil, nil, nil, fmt.Errorf("Unable to parse config file %v: %v", path, err)
+	}
+	cfg.ApplyDefaults()
+
+	issues := cfg.Validate()
+	for i := range issues {
+		issues[i].Line = lineOf(data, issues[i].Field)
+	}
+	return cfg, data, issues, nil
+}
+
+// DryRunFile is ValidateFile followed by a simulated updateFrom: the file is
+// merged, as cloud config would be, into the config loaded from it, and the
+// result is validated too. It returns the effective config that Lantern would
+// run with, along with the issues found in the file and any new ones that
+// merging it introduced. If the merge fails, the error is returned as an
+// issue with the config as loaded. Like ValidateFile, DryRunFile doesn't
+// change anything.
+func DryRunFile(path string) (*Config, []Issue, error) {
+	cfg, data, issues, err := loadAndValidateFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err := cfg.candidateFrom(data)
+	if err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			// Like the CA checks, which Validate also does
+			return cfg, append(issues, newIssues(issues, verr.Issues)...), nil
+		}
+		return cfg, append(issues, Issue{Field: "updateFrom", Message: err.Error()}), nil
+	}
+	added := newIssues(cfg.Validate(), merged.Validate())
+	for i := range added {
+		added[i].Line = lineOf(data, added[i].Field)
+	}
+	return merged, append(issues, added...), nil
+}
+
+// CheckConfigFile dry runs the config file given with the -check-config flag
+// with DryRunFile, printing the effective config, with secrets masked, in the
+// format given with -dump-format and then any issues to w. checked is false if
+// no file was specified. ok indicates whether the file is valid.
+func CheckConfigFile(w io.Writer) (checked bool, ok bool) {
+	if *checkConfig == "" {
+		return false, false
+	}
+	cfg, issues, err := DryRunFile(*checkConfig)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return true, false
+	}
+	if err := writeRedacted(w, cfg, *dumpFormat); err != nil {
+		fmt.Fprintln(w, err)
+		return true, false
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(w, issue)
+	}
+	if len(issues) > 0 {
+		fmt.Fprintf(w, "%v: found %d issue(s)\n", *checkConfig, len(issues))
+		return true, false
+	}
+	fmt.Fprintf(w, "%v: OK\n", *checkConfig)
+	return true, true
+}
+
+// lineOf makes a best effort at finding the line in the given YAML on which
+// the field at the given dotted path is defined, returning 0 if it can't be
+// found.
+func lineOf(data []byte, field string) int {
+	lines := bytes.Split(data, []byte("\n"))
+	line := 0
+	for _, key := range strings.Split(field, ".") {
+		found := false
+		for i := line; i < len(lines); i++ {
+			trimmed := strings.TrimLeft(string(lines[i]), " -")
+			if len(trimmed) > len(key) && strings.EqualFold(trimmed[:len(key)+1], key+":") {
+				line = i
+				found = true
+				break
+			}
+		}
+		if !found && line == 0 {
+			return 0
+		}
+	}
+	return line + 1
+}
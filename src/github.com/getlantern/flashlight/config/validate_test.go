@@ -0,0 +1,178 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTempConfig(t *testing.T, yml string) string {
+	file, err := ioutil.TempFile("", "lantern-validate-")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %v", err)
+	}
+	if _, err := file.WriteString(yml); err != nil {
+		t.Fatalf("Unable to write temp file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Unable to close temp file: %v", err)
+	}
+	return file.Name()
+}
+
+func TestValidateFileGood(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestValidateFileBadCert(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+      cert: "-----BEGIN CERTIFICATE-----\nnotacert\n-----END CERTIFICATE-----\n"
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "Client.ChainedServers.fallback-1.Cert", issues[0].Field)
+		assert.Equal(t, 7, issues[0].Line)
+	}
+}
+
+func TestValidateFileBadAddr(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "Client.ChainedServers.fallback-1.Addr", issues[0].Field)
+		assert.Equal(t, 6, issues[0].Line)
+	}
+}
+
+func TestValidateFileUnparseable(t *testing.T) {
+	path := writeTempConfig(t, "addr: [")
+	defer os.Remove(path)
+
+	_, err := ValidateFile(path)
+	assert.Error(t, err)
+}
+
+func TestValidateFileNewMasqueradeProvider(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  defaultmasqueradeset: akamai
+  masqueradesets:
+    akamai:
+    - domain: a.akamai.example.com
+      ipaddress: 1.2.3.4
+  frontedservers:
+  - host: fronted.example.com
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, issues, "Fronted server should use the default masquerade set")
+}
+
+func TestValidateFileUnknownMasqueradeSet(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  masqueradesets:
+    akamai:
+    - domain: a.akamai.example.com
+  frontedservers:
+  - host: fronted.example.com
+    masqueradeset: fastly
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "Client.FrontedServers.0.MasqueradeSet", issues[0].Field)
+		assert.Equal(t, `unknown masquerade set "fastly", configured sets are [akamai]`, issues[0].Message)
+	}
+}
+
+func TestDryRunFile(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+      authtoken: supersecret
+`)
+	defer os.Remove(path)
+
+	cfg, issues, err := DryRunFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, issues)
+	assert.Equal(t, "1.2.3.4:443", cfg.Client.ChainedServers["fallback-1"].Addr)
+	assert.NotEmpty(t, cfg.TrustedCAs, "Defaults should have been applied")
+
+	defer func(path string, format string) {
+		*checkConfig, *dumpFormat = path, format
+	}(*checkConfig, *dumpFormat)
+	*checkConfig, *dumpFormat = path, "json"
+	var out bytes.Buffer
+	checked, ok := CheckConfigFile(&out)
+	assert.True(t, checked)
+	assert.True(t, ok, out.String())
+	assert.Contains(t, out.String(), `"Addr": "1.2.3.4:443"`, "Effective config should be printed")
+	assert.NotContains(t, out.String(), "supersecret", "Auth token should be masked")
+	assert.Contains(t, out.String(), path+": OK")
+}
+
+func TestDryRunFileMergeFails(t *testing.T) {
+	path := writeTempConfig(t, `
+addr: 127.0.0.1:8787
+minclientversion: not-a-version
+client:
+  chainedservers:
+    fallback-1:
+      addr: 1.2.3.4:443
+`)
+	defer os.Remove(path)
+
+	issues, err := ValidateFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, issues, "File should be valid as loaded")
+	cfg, issues, err := DryRunFile(path)
+	if assert.NoError(t, err) && assert.Len(t, issues, 1) {
+		assert.Equal(t, "updateFrom", issues[0].Field)
+		assert.Contains(t, issues[0].Message, "not-a-version")
+	}
+	assert.NotNil(t, cfg, "Config as loaded should be returned")
+}
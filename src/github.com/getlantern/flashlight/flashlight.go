@@ -10,6 +10,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -56,12 +57,14 @@ var (
 
 	showui = true
 
-	configUpdates = make(chan *config.Config)
-	exitCh        = make(chan error, 1)
+	exitCh = make(chan error, 1)
 
 	// use buffered channel to avoid blocking the caller of 'addExitFunc'
 	// the number 10 is arbitrary
 	chExitFuncs = make(chan func(), 10)
+
+	finishProfiling func()
+	profilingMx     sync.Mutex
 )
 
 func init() {
@@ -85,8 +88,6 @@ func init() {
 	autoupdate.Version = packageVersion
 
 	rand.Seed(time.Now().UnixNano())
-
-	settings.Load(version, revisionDate, buildDate)
 }
 
 func logPanic(msg string) {
@@ -107,6 +108,15 @@ func logPanic(msg string) {
 }
 
 func main() {
+	// Flags are parsed before anything else so that we know whether to run
+	// portable before touching the user's profile.
+	parseFlags()
+	if dir, ok := config.PortableDir(); ok {
+		settings.UsePortableDir(dir)
+		logging.UseLogDir(filepath.Join(dir, "logs"))
+	}
+	settings.Load(version, revisionDate, buildDate)
+
 	// panicwrap works by re-executing the running program (retaining arguments,
 	// environmental variables, etc.) and monitoring the stderr of the program.
 	exitStatus, err := panicwrap.BasicWrap(
@@ -128,7 +138,26 @@ func main() {
 		}
 	}
 
-	parseFlags()
+	if checked, ok := config.CheckConfigFile(os.Stdout); checked {
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if dumped, ok := config.DumpConfig(os.Stdout, packageVersion); dumped {
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if exported, ok := config.ExportConfig(os.Stdout, packageVersion); exported {
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	if *pprofAddr != "" {
 		go func() {
@@ -187,16 +216,21 @@ func doMain() error {
 	// Run below in separate goroutine as config.Init() can potentially block when Lantern runs
 	// for the first time. User can still quit Lantern through systray menu when it happens.
 	go func() {
-		cfg, err := config.Init(packageVersion)
+		cfg, err := config.Init(packageVersion, config.WithCountry(geolookup.GetCountry))
 		if err != nil {
 			exit(fmt.Errorf("Unable to initialize configuration: %v", err))
 			return
 		}
+		addExitFunc(config.Stop)
+		stopAdminAPI, err := config.ServeAdminAPI()
+		if err != nil {
+			exit(err)
+			return
+		}
+		addExitFunc(stopAdminAPI)
 
 		go func() {
-			err := config.Run(func(updated *config.Config) {
-				configUpdates <- updated
-			})
+			err := config.Run()
 			if err != nil {
 				exit(err)
 			}
@@ -207,14 +241,14 @@ func doMain() error {
 			exit(fmt.Errorf("Wrong arguments"))
 		}
 
-		if cfg.CpuProfile != "" || cfg.MemProfile != "" {
-			log.Debugf("Start profiling with cpu file %s and mem file %s", cfg.CpuProfile, cfg.MemProfile)
-			finishProfiling := profiling.Start(cfg.CpuProfile, cfg.MemProfile)
-			addExitFunc(finishProfiling)
-		}
+		setProfiling(cfg.CpuProfile, cfg.MemProfile)
+		config.OnProfilingChange(setProfiling)
+		addExitFunc(func() {
+			setProfiling("", "")
+		})
 
 		// Configure stats initially
-		if err := statreporter.Configure(cfg.Stats, settings.GetInstanceID()); err != nil {
+		if err := configureStats(cfg.Stats); err != nil {
 			exit(err)
 		}
 
@@ -243,6 +277,22 @@ func displayVersion() {
 	log.Debugf("---- flashlight version: %s, release: %s, build revision date: %s ----", version, packageVersion, revisionDate)
 }
 
+// setProfiling stops any profiling that's running, saving the profiles, and
+// starts profiling to the given cpu and mem files, if any.
+func setProfiling(cpu string, mem string) {
+	profilingMx.Lock()
+	defer profilingMx.Unlock()
+	if finishProfiling != nil {
+		log.Debug("Finishing profiling")
+		finishProfiling()
+		finishProfiling = nil
+	}
+	if cpu != "" || mem != "" {
+		log.Debugf("Start profiling with cpu file %s and mem file %s", cpu, mem)
+		finishProfiling = profiling.Start(cpu, mem)
+	}
+}
+
 func parseFlags() {
 	args := os.Args[1:]
 	// On OS X, the first time that the program is run after download it is
@@ -301,6 +351,10 @@ func runClientProxy(cfg *config.Config) {
 		exit(fmt.Errorf("Unable to start UI: %s", err))
 		return
 	}
+	configMux := http.NewServeMux()
+	config.RegisterHandlers(configMux, ui.SessionToken())
+	ui.Handle("/config", configMux)
+	ui.Handle("/config/export", configMux)
 
 	// Create the client-side proxy.
 	client := &client.Client{
@@ -317,13 +371,43 @@ func runClientProxy(cfg *config.Config) {
 	addExitFunc(analytics.Configure(cfg, version))
 	geolookup.Start()
 
-	// Continually poll for config updates and update client accordingly
-	go func() {
-		for {
-			cfg := <-configUpdates
-			applyClientConfig(client, cfg)
-		}
-	}()
+	// Reconfigure only what changed where we can, so that for example a change
+	// to the proxied sites doesn't reconfigure the client's servers
+	config.Subscribe(config.ClientSection, func(_ *config.Config, cfg *config.Config) {
+		cfgMutex.Lock()
+		defer cfgMutex.Unlock()
+		configureFronted(cfg)
+		client.Configure(cfg.Client)
+	})
+	config.Subscribe(config.TrustedCAsSection, func(_ *config.Config, cfg *config.Config) {
+		cfgMutex.Lock()
+		defer cfgMutex.Unlock()
+		configureFronted(cfg)
+	})
+	config.Subscribe(config.ProxiedSitesSection, func(_ *config.Config, cfg *config.Config) {
+		cfgMutex.Lock()
+		defer cfgMutex.Unlock()
+		proxiedsites.Configure(cfg.ProxiedSites)
+	})
+	config.Subscribe(config.StatsSection, func(_ *config.Config, cfg *config.Config) {
+		cfgMutex.Lock()
+		defer cfgMutex.Unlock()
+		// Note - we deliberately ignore the error from statreporter.Configure here
+		_ = configureStats(cfg.Stats)
+	})
+	// Stop or resume reporting as soon as the user changes their mind
+	config.OnAutoReportChange(func(enabled bool) {
+		cfgMutex.Lock()
+		defer cfgMutex.Unlock()
+		settings.SetAutoReport(enabled)
+		stats := config.StatsConfig()
+		_ = configureStats(&stats)
+	})
+
+	// Anything else could affect any part of the client
+	config.Subscribe(config.OtherSection, func(_ *config.Config, cfg *config.Config) {
+		applyClientConfig(client, cfg)
+	})
 
 	/*
 		      Temporarily disabling localdiscover. See:
@@ -385,16 +469,20 @@ func addExitFunc(exitFunc func()) {
 	chExitFuncs <- exitFunc
 }
 
+// configureStats reports stats as given, unless the user has turned off
+// reporting, in which case any reporting is stopped.
+func configureStats(stats *statreporter.Config) error {
+	if stats != nil && !settings.IsAutoReport() {
+		stats = &statreporter.Config{StatshubAddr: stats.StatshubAddr}
+	}
+	return statreporter.Configure(stats, settings.GetInstanceID())
+}
+
 func applyClientConfig(client *client.Client, cfg *config.Config) {
 	cfgMutex.Lock()
 	defer cfgMutex.Unlock()
 
-	certs, err := cfg.GetTrustedCACerts()
-	if err != nil {
-		log.Errorf("Unable to get trusted ca certs, not configure fronted: %s", err)
-	} else {
-		fronted.Configure(certs, cfg.Client.MasqueradeSets)
-	}
+	configureFronted(cfg)
 
 	autoupdate.Configure(cfg)
 	logging.Configure(cfg.Addr, cfg.CloudConfigCA, settings.GetInstanceID(),
@@ -403,7 +491,7 @@ func applyClientConfig(client *client.Client, cfg *config.Config) {
 	log.Debugf("Proxy all traffic or not: %v", settings.GetProxyAll())
 	ServeProxyAllPacFile(settings.GetProxyAll())
 	// Note - we deliberately ignore the error from statreporter.Configure here
-	_ = statreporter.Configure(cfg.Stats, settings.GetInstanceID())
+	_ = configureStats(cfg.Stats)
 
 	// Update client configuration and get the highest QOS dialer available.
 	client.Configure(cfg.Client)
@@ -425,6 +513,17 @@ func withHttpClient(addr string, withClient func(client *http.Client)) {
 	}
 }
 
+// configureFronted configures domain fronting with the trusted CAs and
+// masquerades in the given config.
+func configureFronted(cfg *config.Config) {
+	certs, err := cfg.GetTrustedCACerts()
+	if err != nil {
+		log.Errorf("Unable to get trusted ca certs, not configure fronted: %s", err)
+	} else {
+		fronted.Configure(certs, cfg.Client.MasqueradeSets)
+	}
+}
+
 // Runs the server-side proxy
 func runServerProxy(cfg *config.Config) {
 	useAllCores()
@@ -455,17 +554,15 @@ func runServerProxy(cfg *config.Config) {
 
 	srv.Configure(cfg.Server)
 
-	// Continually poll for config updates and update server accordingly
-	go func() {
-		for {
-			cfg := <-configUpdates
-			if err := statreporter.Configure(cfg.Stats, settings.GetInstanceID()); err != nil {
-				log.Debugf("Error configuring statreporter: %v", err)
-			}
-
-			srv.Configure(cfg.Server)
+	// Reconfigure the server as its config changes
+	config.Subscribe(config.StatsSection, func(_ *config.Config, cfg *config.Config) {
+		if err := statreporter.Configure(cfg.Stats, settings.GetInstanceID()); err != nil {
+			log.Debugf("Error configuring statreporter: %v", err)
 		}
-	}()
+	})
+	config.Subscribe(config.OtherSection, func(_ *config.Config, cfg *config.Config) {
+		srv.Configure(cfg.Server)
+	})
 
 	err = srv.ListenAndServe(func(update func(*server.ServerConfig) error) {
 		err := config.Update(func(cfg *config.Config) error {
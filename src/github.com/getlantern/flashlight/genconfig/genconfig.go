@@ -343,9 +343,9 @@ func buildModel(cas map[string]*castat, masquerades []*masquerade, useFallbacks
 		for _, f := range fallbacks {
 			fb := make(map[string]interface{})
 			fb["ip"] = f.Addr
-			fb["auth_token"] = f.AuthToken
+			fb["auth_token"] = string(f.AuthToken)
 
-			cert := f.Cert
+			cert := string(f.Cert)
 			// Replace newlines in cert with newline literals
 			fb["cert"] = strings.Replace(cert, "\n", "\\n", -1)
 
@@ -44,10 +44,17 @@ var (
 	lastAddr   string
 	duplicates = make(map[string]bool)
 	dupLock    sync.Mutex
+
+	logdir = appdir.Logs("Lantern")
 )
 
+// UseLogDir places logs in the given directory instead of the default one,
+// for when Lantern runs in portable mode. It must be called before Init.
+func UseLogDir(dir string) {
+	logdir = dir
+}
+
 func Init() error {
-	logdir := appdir.Logs("Lantern")
 	log.Debugf("Placing logs in %v", logdir)
 	if _, err := os.Stat(logdir); err != nil {
 		if os.IsNotExist(err) {
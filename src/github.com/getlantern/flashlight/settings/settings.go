@@ -28,7 +28,11 @@ var (
 	settings   *Settings
 	httpClient *http.Client
 	path       = filepath.Join(appdir.General("Lantern"), "settings.yaml")
-	once       = &sync.Once{}
+
+	// Whether to launch Lantern on system startup unless the user said
+	// otherwise
+	defaultAutoLaunch = true
+	once              = &sync.Once{}
 )
 
 // Settings is a struct of all settings unique to this particular Lantern instance.
@@ -50,7 +54,7 @@ func Load(version, revisionDate, buildDate string) {
 	// on disk.
 	settings = &Settings{
 		AutoReport: true,
-		AutoLaunch: true,
+		AutoLaunch: defaultAutoLaunch,
 		ProxyAll:   false,
 		// There is no true privacy or security in instance ID.  For that, we rely on
 		// transport security.  Hashing MAC would buy us nothing, since the space of
@@ -87,6 +91,15 @@ func Load(version, revisionDate, buildDate string) {
 	})
 }
 
+// UsePortableDir keeps settings in the given directory instead of in the
+// user's profile and doesn't launch Lantern on system startup unless the user
+// asks for it, for when Lantern runs in portable mode. It must be called
+// before Load.
+func UsePortableDir(dir string) {
+	path = filepath.Join(dir, "settings.yaml")
+	defaultAutoLaunch = false
+}
+
 // GetInstanceID returns the unique identifier for Lantern on this machine.
 func GetInstanceID() string {
 	settings.RLock()
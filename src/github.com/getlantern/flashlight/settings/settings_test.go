@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,3 +32,18 @@ func TestNotPersistVersion(t *testing.T) {
 	Load(version, revisionDate, buildDate)
 	assert.Equal(t, settings.Version, version, "Should be set to version")
 }
+
+func TestUsePortableDir(t *testing.T) {
+	origPath, origAutoLaunch := path, defaultAutoLaunch
+	defer func() {
+		path, defaultAutoLaunch = origPath, origAutoLaunch
+	}()
+	dir := t.TempDir()
+	UsePortableDir(dir)
+	Load("test", "test", "test")
+	assert.False(t, settings.AutoLaunch, "Should not auto launch by default when portable")
+
+	Save()
+	_, err := os.Stat(filepath.Join(dir, "settings.yaml"))
+	assert.NoError(t, err, "Should have saved settings in portable dir")
+}
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
@@ -31,6 +33,8 @@ var (
 	openedExternal = false
 	externalUrl    string
 	r              = http.NewServeMux()
+
+	sessionToken = newSessionToken()
 )
 
 func init() {
@@ -59,6 +63,25 @@ func init() {
 	Translations = fs.SubDir("locale")
 }
 
+// newSessionToken returns a random token for this session.
+func newSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Panicking here because without randomness nothing local can be
+		// protected.
+		panic(fmt.Errorf("Unable to generate session token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// SessionToken returns the token that the UI is given, in the token query
+// parameter of the URL that Show opens, for this run of Lantern. Handlers
+// that change settings, like the config handler, require it so that other
+// web pages and local processes can't use them.
+func SessionToken() string {
+	return sessionToken
+}
+
 func Handle(p string, handler http.Handler) string {
 	r.Handle(p, handler)
 	return uiaddr + p
@@ -111,7 +134,7 @@ func Start(tcpAddr *net.TCPAddr, allowRemote bool, extUrl string) (err error) {
 // asynchronously is not a problem.
 func Show() {
 	go func() {
-		err := open.Run(uiaddr)
+		err := open.Run(uiaddr + "/?token=" + sessionToken)
 		if err != nil {
 			log.Errorf("Error opening page to `%v`: %v", uiaddr, err)
 		}
@@ -1,12 +1,15 @@
 package util
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/getlantern/fronted"
@@ -39,26 +42,73 @@ func success(resp *http.Response) bool {
 // NewChainedAndFronted creates a new struct for accessing resources using chained
 // and direct fronted servers in parallel.
 func NewChainedAndFronted() *chainedAndFronted {
-	cf := &chainedAndFronted{}
-	cf.fetcher = &dualFetcher{cf}
-	return cf
+	return NewChainedAndFrontedWith(direct)
+}
+
+// NewChainedAndFrontedWith is like NewChainedAndFronted but fetches from
+// fronted servers with the given fetcher, for example one that retries with
+// different masquerades.
+func NewChainedAndFrontedWith(fronted HTTPFetcher) *chainedAndFronted {
+	return &chainedAndFronted{fronted: fronted, preferred: -1}
 }
 
 // ChainedAndFronted fetches HTTP data in parallel using both chained and fronted
 // servers.
 type chainedAndFronted struct {
-	fetcher HTTPFetcher
+	fronted HTTPFetcher
+
+	// The route that got the last successful response, which gets a head
+	// start next time, or -1 if none did
+	preferred   int
+	preferredMx sync.Mutex
 }
 
-// Do will attempt to execute the specified HTTP request using only a chained fetcher
+const (
+	chainedRoute = iota
+	frontedRoute
+)
+
+var (
+	// How long the route that last worked gets to fetch on its own before we
+	// also try the other, so that we don't fetch everything twice while one
+	// works but still get through when it's degraded
+	preferredHeadStart = 5 * time.Second
+)
+
+// Do races the specified HTTP request through chained and fronted servers,
+// returning the first successful response. If one of them got the last
+// successful response, it gets a head start of preferredHeadStart. Callers
+// MUST use the Lantern-Fronted-URL HTTP header to specify the fronted URL to
+// use.
 func (cf *chainedAndFronted) Do(req *http.Request) (*http.Response, error) {
-	resp, err := cf.fetcher.Do(req)
+	frontedUrl := req.Header.Get("Lantern-Fronted-URL")
+	req.Header.Del("Lantern-Fronted-URL")
+	if frontedUrl == "" {
+		return nil, errors.New("Callers MUST specify the fronted URL in the Lantern-Fronted-URL header")
+	}
+
+	routes := []int{chainedRoute, frontedRoute}
+	fetchers := []HTTPFetcher{&chainedFetcher{}, &frontedFetcher{cf.fronted, frontedUrl}}
+	headStart := time.Duration(0)
+	cf.preferredMx.Lock()
+	preferred := cf.preferred
+	cf.preferredMx.Unlock()
+	if preferred == frontedRoute {
+		routes[0], routes[1] = routes[1], routes[0]
+		fetchers[0], fetchers[1] = fetchers[1], fetchers[0]
+	}
+	if preferred >= 0 {
+		headStart = preferredHeadStart
+	}
+
+	resp, winner, err := Race(req, headStart, fetchers...)
+	cf.preferredMx.Lock()
 	if err != nil {
-		// If there's an error, switch back to using the dual fetcher.
-		cf.fetcher = &dualFetcher{cf}
-	} else if !success(resp) {
-		cf.fetcher = &dualFetcher{cf}
+		cf.preferred = -1
+	} else {
+		cf.preferred = routes[winner]
 	}
+	cf.preferredMx.Unlock()
 	return resp, err
 }
 
@@ -76,128 +126,114 @@ func (cf *chainedFetcher) Do(req *http.Request) (*http.Response, error) {
 	}
 }
 
-type dualFetcher struct {
-	cf *chainedAndFronted
+// frontedFetcher fetches the fronted URL for a request, rather than the URL
+// in the request, with direct domain fronting.
+type frontedFetcher struct {
+	fronted HTTPFetcher
+	url     string
 }
 
-// Do will attempt to execute the specified HTTP request using both
-// chained and fronted servers, simply returning the first response to
-// arrive. Callers MUST use the Lantern-Fronted-URL HTTP header to
-// specify the fronted URL to use.
-func (df *dualFetcher) Do(req *http.Request) (*http.Response, error) {
-	log.Debugf("Using dual fronter")
-	frontedUrl := req.Header.Get("Lantern-Fronted-URL")
-	req.Header.Del("Lantern-Fronted-URL")
+func (ff *frontedFetcher) Do(req *http.Request) (*http.Response, error) {
+	log.Debug("Sending request via DDF")
+	frontedReq, err := http.NewRequest("GET", ff.url, nil)
+	if err != nil {
+		log.Errorf("Could not create request for: %v, %v", ff.url, err)
+		return nil, err
+	}
+	return ff.fronted.Do(frontedReq.WithContext(req.Context()))
+}
 
-	if frontedUrl == "" {
-		return nil, errors.New("Callers MUST specify the fronted URL in the Lantern-Fronted-URL header")
+// raceResult is the outcome of one of the requests sent by Race.
+type raceResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// Race sends the given request, which must not have a body, through each of
+// the given fetchers, returning the first successful response along with the
+// index of the fetcher that got it. The requests still going are canceled and
+// any responses they get are closed. Each fetcher after the first joins the
+// race once the one before it has had headStart to itself, or as soon as all
+// the fetchers racing so far have failed, so with no head start they all
+// start at once. If all of them fail, the last error is returned.
+func Race(req *http.Request, headStart time.Duration, fetchers ...HTTPFetcher) (*http.Response, int, error) {
+	if len(fetchers) == 0 {
+		return nil, -1, errors.New("Nothing to race")
 	}
-	responses := make(chan *http.Response, 2)
-	errs := make(chan error, 2)
-
-	request := func(client HTTPFetcher, req *http.Request) error {
-		if resp, err := client.Do(req); err != nil {
-			log.Errorf("Could not complete request with: %v, %v", frontedUrl, err)
-			errs <- err
-			return err
-		} else {
-			if success(resp) {
-				log.Debugf("Got successful HTTP call!")
-				responses <- resp
-				return nil
-			} else {
-				// If the local proxy can't connect to any upstread proxies, for example,
-				// it will return a 502.
-				err := fmt.Errorf("Bad response code: %v", resp.StatusCode)
-				errs <- err
-				return err
+	results := make(chan *raceResult, len(fetchers))
+	cancels := make([]context.CancelFunc, 0, len(fetchers))
+	var nextStart <-chan time.Time
+	start := func() {
+		index := len(cancels)
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := fetchers[index].Do(req.WithContext(ctx))
+			if err == nil && !success(resp) {
+				// If the local proxy can't connect to any upstream proxies, for
+				// example, it will return a 502.
+				_ = resp.Body.Close()
+				resp, err = nil, fmt.Errorf("Bad response code: %v", resp.StatusCode)
 			}
+			results <- &raceResult{index, resp, err}
+		}()
+		nextStart = nil
+		if len(cancels) < len(fetchers) {
+			nextStart = time.After(headStart)
 		}
 	}
 
-	go func() {
-		if req, err := http.NewRequest("GET", frontedUrl, nil); err != nil {
-			log.Errorf("Could not create request for: %v, %v", frontedUrl, err)
-			errs <- err
-		} else {
-			log.Debug("Sending request via DDF")
-			if err := request(direct, req); err != nil {
-				log.Errorf("Fronted request failed: %v", err)
-			} else {
-				log.Debug("Fronted request succeeded")
+	start()
+	pending := 1
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-nextStart:
+			start()
+			pending++
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				log.Debugf("Request %d of %d failed: %v", result.index+1, len(fetchers), result.err)
+				cancels[result.index]()
+				lastErr = result.err
+				if pending == 0 && len(cancels) < len(fetchers) {
+					start()
+					pending++
+				}
+				continue
 			}
-		}
-	}()
-	go func() {
-		if client, err := HTTPClient("", defaultAddr); err != nil {
-			log.Errorf("Could not create HTTP client: %v", err)
-			errs <- err
-		} else {
-			log.Debug("Sending chained request")
-			if err := request(client, req); err != nil {
-				log.Errorf("Chained request failed %v", err)
-			} else {
-				log.Debug("Switching to chained fronter for future requests since it succeeded")
-				df.cf.fetcher = &chainedFetcher{}
+			for i, cancel := range cancels {
+				if i != result.index {
+					cancel()
+				}
 			}
+			go func(remaining int) {
+				for ; remaining > 0; remaining-- {
+					if loser := <-results; loser.resp != nil {
+						_ = loser.resp.Body.Close()
+					}
+				}
+			}(pending)
+			// The winner's request stays alive until its body is closed
+			result.resp.Body = &cancelOnClose{result.resp.Body, cancels[result.index]}
+			return result.resp, result.index, nil
 		}
-	}()
-
-	// Create channels for the final response or error. The response channel will be filled
-	// in the case of any successful response as well as a non-error response for the second
-	// response received. The error channel will only be filled if the first response is
-	// unsuccessful and the second is an error.
-	finalResponseCh := make(chan *http.Response, 1)
-	finalErrorCh := make(chan error, 1)
-
-	go readResponses(finalResponseCh, responses, finalErrorCh, errs)
-
-	select {
-	case resp := <-finalResponseCh:
-		return resp, nil
-	case err := <-finalErrorCh:
-		return nil, err
 	}
+	return nil, -1, lastErr
 }
 
-func readResponses(finalResponse chan *http.Response, responses chan *http.Response, finalErr chan error, errs chan error) {
-	select {
-	case resp := <-responses:
-		if success(resp) {
-			log.Debug("Got good first response")
-			finalResponse <- resp
-
-			// Just ignore the second response, but still process it.
-			select {
-			case resp := <-responses:
-				log.Debug("Closing second response body")
-				_ = resp.Body.Close()
-				return
-			case <-errs:
-				log.Debug("Ignoring error on second response")
-				return
-			}
-		} else {
-			log.Debugf("Got bad first response -- wait for second")
-			_ = resp.Body.Close()
-			// Just use whatever we get from the second response.
-			select {
-			case resp := <-responses:
-				finalResponse <- resp
-			case err := <-errs:
-				finalErr <- err
-			}
-		}
-	case err := <-errs:
-		log.Debugf("Got an error: %v", err)
-		// Just use whatever we get from the second response.
-		select {
-		case resp := <-responses:
-			finalResponse <- resp
-		case err := <-errs:
-			finalErr <- err
-		}
-	}
+// cancelOnClose is a response body that cancels its request once closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
 
 // PersistentHTTPClient creates an http.Client that persists across requests.
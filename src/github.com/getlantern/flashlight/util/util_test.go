@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -87,6 +88,66 @@ func TestChainedAndFronted(t *testing.T) {
 	_ = resp.Body.Close()
 }
 
+type fetcherFunc func(req *http.Request) (*http.Response, error)
+
+func (f fetcherFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// respondAfter returns a fetcher that responds with the given status and body
+// after the given delay, unless the request is canceled first, counting the
+// requests it gets.
+func respondAfter(delay time.Duration, status int, body string, requests *int32) HTTPFetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(requests, 1)
+		select {
+		case <-time.After(delay):
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	})
+}
+
+func TestRace(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://config.example.com/cloud.yaml.gz", nil)
+	readWinner := func(headStart time.Duration, fetchers ...HTTPFetcher) (string, int) {
+		resp, winner, err := Race(req, headStart, fetchers...)
+		if !assert.NoError(t, err) {
+			return "", winner
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body), winner
+	}
+
+	var slow, fast int32
+	body, winner := readWinner(0, respondAfter(time.Second, 200, "slow", &slow), respondAfter(0, 200, "fast", &fast))
+	assert.Equal(t, "fast", body)
+	assert.Equal(t, 1, winner)
+
+	slow, fast = 0, 0
+	body, winner = readWinner(time.Hour, respondAfter(0, 200, "first", &fast), respondAfter(0, 200, "second", &slow))
+	assert.Equal(t, "first", body)
+	assert.Equal(t, 0, winner)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&slow), "Second fetcher shouldn't have been tried while the first had a head start")
+
+	var failing, second int32
+	start := time.Now()
+	body, winner = readWinner(time.Hour, respondAfter(0, 502, "", &failing), respondAfter(0, 200, "second", &second))
+	assert.Equal(t, "second", body, "Second fetcher should have been tried as soon as the first failed")
+	assert.Equal(t, 1, winner)
+	assert.True(t, time.Now().Sub(start) < time.Second)
+
+	slow = 0
+	body, winner = readWinner(50*time.Millisecond, respondAfter(time.Minute, 200, "stuck", &slow), respondAfter(0, 200, "second", &second))
+	assert.Equal(t, "second", body, "Second fetcher should have joined once the head start passed")
+	assert.Equal(t, 1, winner)
+
+	_, _, err := Race(req, 0, respondAfter(0, 502, "", &failing), respondAfter(0, 404, "", &failing))
+	assert.Error(t, err, "Race should fail if every fetcher does")
+}
+
 func trustedCATestCerts() *x509.CertPool {
 	certs := make([]string, 0, len(defaultTrustedCAs))
 	for _, ca := range defaultTrustedCAs {
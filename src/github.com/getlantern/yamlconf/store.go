@@ -0,0 +1,79 @@
+package yamlconf
+
+import (
+	"sync"
+)
+
+// Store is where a Manager keeps the YAML for its config.
+type Store interface {
+	// Load loads the stored YAML.
+	Load() ([]byte, error)
+
+	// Save replaces the stored YAML.
+	Save(data []byte) error
+
+	// Watch returns a channel that signals whenever the stored YAML may have
+	// been changed by something other than the Manager. Stores that can't be
+	// changed externally may return nil.
+	Watch() <-chan struct{}
+}
+
+// MemoryStore is a Store that keeps the YAML in memory, for example for
+// embedding applications that persist the config themselves, or for tests.
+type MemoryStore struct {
+	data      []byte
+	mx        sync.Mutex
+	changedCh chan struct{}
+}
+
+// NewMemoryStore creates a MemoryStore initially containing the given YAML.
+func NewMemoryStore(data []byte) *MemoryStore {
+	return &MemoryStore{
+		data:      data,
+		changedCh: make(chan struct{}, 1),
+	}
+}
+
+// Load implements the method from Store.
+func (s *MemoryStore) Load() ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return copyBytes(s.data), nil
+}
+
+// Save implements the method from Store.
+func (s *MemoryStore) Save(data []byte) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.data = copyBytes(data)
+	return nil
+}
+
+// Watch implements the method from Store.
+func (s *MemoryStore) Watch() <-chan struct{} {
+	return s.changedCh
+}
+
+// Set changes the stored YAML as if by an external edit, notifying watchers.
+func (s *MemoryStore) Set(data []byte) {
+	s.Save(data)
+	notify(s.changedCh)
+}
+
+// notify signals ch without blocking. Signals that arrive while one is already
+// waiting to be processed are coalesced.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	copied := make([]byte, len(b))
+	copy(copied, b)
+	return copied
+}
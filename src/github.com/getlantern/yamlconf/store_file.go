@@ -0,0 +1,243 @@
+package yamlconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFilePollInterval is how often the config file is checked for
+	// changes when file system notifications aren't available.
+	DefaultFilePollInterval = 10 * time.Second
+
+	// fileEventDebounce is how long the file has to go without notifications
+	// before we signal that it changed, so that an editor saving it in several
+	// steps causes one reload of the saved file rather than some of a partly
+	// written one.
+	fileEventDebounce = 100 * time.Millisecond
+
+	// BackupSuffix is appended to the path of a FileStore's file to get the
+	// path at which it keeps the previous version of the file.
+	BackupSuffix = ".bak"
+)
+
+// FileStore is a Store that keeps the YAML in a file. It watches the file for
+// changes using file system notifications where available and falls back to
+// polling every PollInterval otherwise.
+type FileStore struct {
+	// Path: required, path to the config file
+	Path string
+
+	// PollInterval: optionally, how often to check the file for changes on
+	// platforms where it can't be watched with file system notifications.
+	// Defaults to DefaultFilePollInterval. Use SetPollInterval to change it
+	// once the FileStore is in use.
+	PollInterval time.Duration
+
+	pollIntervalMx sync.RWMutex
+	initOnce       sync.Once
+	watchOnce      sync.Once
+	closeOnce      sync.Once
+	changedCh      chan struct{}
+	eventCh        chan struct{}
+	intervalCh     chan struct{}
+	stopCh         chan interface{}
+}
+
+// NewFileStore creates a FileStore for the file at the given path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load implements the method from Store.
+func (s *FileStore) Load() ([]byte, error) {
+	return ioutil.ReadFile(s.Path)
+}
+
+// Save implements the method from Store. The file is replaced atomically, so
+// that it's never left partly written, and the previous version is kept at
+// the path with BackupSuffix, from which it can be restored if the file is
+// damaged anyway, for example by a file system that doesn't honor fsync.
+func (s *FileStore) Save(data []byte) error {
+	if err := backUpFile(s.Path); err != nil {
+		// Better to save without a backup than not at all
+		log.Errorf("Unable to back up %v: %v", s.Path, err)
+	}
+	return WriteFileAtomically(s.Path, data)
+}
+
+// WriteFileAtomically replaces the file at the given path with the given data
+// by writing it to a temporary file in the same directory, syncing it to disk
+// and renaming it over the original, so that losing power part way through
+// leaves either the original or the new file but never a mix, or an empty
+// file. The file keeps the permissions of the original, or gets 0644 if there
+// wasn't one.
+func WriteFileAtomically(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, name+".tmp-")
+	if err != nil {
+		return err
+	}
+	// Doesn't do anything once the temp file has been renamed
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes a best effort at syncing the directory at the given path, so
+// that a file renamed into it survives losing power. Not all platforms can
+// sync directories, like Windows, where renames are durable anyway.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
+
+// backUpFile replaces the backup of the file at the given path with a copy of
+// the file, if there is one. It's a copy rather than a hard link so that
+// writing to the file in place, as some editors do, can't damage the backup
+// too.
+func backUpFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomically(path+BackupSuffix, data)
+}
+
+// Watch implements the method from Store. The first call starts watching the
+// file, which continues until the FileStore is closed.
+func (s *FileStore) Watch() <-chan struct{} {
+	s.init()
+	s.watchOnce.Do(func() {
+		go s.watch()
+	})
+	return s.changedCh
+}
+
+// Close stops watching the file.
+func (s *FileStore) Close() error {
+	s.init()
+	s.closeOnce.Do(func() {
+		close(s.stopCh)
+	})
+	return nil
+}
+
+// SetPollInterval changes how often the file is checked for changes when
+// polling, taking effect immediately.
+func (s *FileStore) SetPollInterval(interval time.Duration) {
+	s.init()
+	s.pollIntervalMx.Lock()
+	s.PollInterval = interval
+	s.pollIntervalMx.Unlock()
+	notify(s.intervalCh)
+}
+
+func (s *FileStore) pollInterval() time.Duration {
+	s.pollIntervalMx.RLock()
+	defer s.pollIntervalMx.RUnlock()
+	if s.PollInterval <= 0 {
+		return DefaultFilePollInterval
+	}
+	return s.PollInterval
+}
+
+func (s *FileStore) init() {
+	s.initOnce.Do(func() {
+		s.changedCh = make(chan struct{}, 1)
+		s.eventCh = make(chan struct{}, 1)
+		s.intervalCh = make(chan struct{}, 1)
+		s.stopCh = make(chan interface{})
+	})
+}
+
+// watch signals changedCh whenever the file may have changed.
+func (s *FileStore) watch() {
+	go s.debounce()
+	err := s.watchNotifications()
+	if err == nil {
+		return
+	}
+	select {
+	case <-s.stopCh:
+		return
+	default:
+	}
+	log.Debugf("Unable to watch %v for changes, polling instead: %v", s.Path, err)
+	s.poll()
+}
+
+func (s *FileStore) poll() {
+	timer := time.NewTimer(s.pollInterval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			notify(s.changedCh)
+		case <-s.intervalCh:
+			// Start waiting again with the new interval
+			timer.Stop()
+		case <-s.stopCh:
+			return
+		}
+		timer.Reset(s.pollInterval())
+	}
+}
+
+// fileEvent records a notification that the file may have changed, for
+// debounce.
+func (s *FileStore) fileEvent() {
+	notify(s.eventCh)
+}
+
+// debounce signals changedCh once fileEventDebounce passes without another
+// file event.
+func (s *FileStore) debounce() {
+	timer := time.NewTimer(fileEventDebounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.eventCh:
+			timer.Reset(fileEventDebounce)
+		case <-timer.C:
+			notify(s.changedCh)
+		case <-s.stopCh:
+			return
+		}
+	}
+}
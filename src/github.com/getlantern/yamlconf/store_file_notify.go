@@ -0,0 +1,62 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd windows
+
+package yamlconf
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchNotifications watches the file using fsnotify, blocking until the
+// FileStore is closed or watching fails. It watches the directory containing
+// the file rather than the file itself so that the watch survives the file
+// being replaced by a rename, which means that there's no window in which a
+// new watch needs to be established and edits could be missed.
+func (s *FileStore) watchNotifications() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Unable to initialize file system notifications: %v", err)
+	}
+	defer watcher.Close()
+
+	path := filepath.Clean(s.Path)
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("Unable to watch %v: %v", dir, err)
+	}
+	log.Debugf("Watching %v for changes", s.Path)
+
+	// Catch any changes made before the watch was established
+	s.fileEvent()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("Stopped getting notifications for %v", dir)
+			}
+			name := filepath.Clean(event.Name)
+			switch {
+			case name == dir && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				return fmt.Errorf("%v is no longer available", dir)
+			case name == path && event.Op != fsnotify.Chmod:
+				log.Tracef("Got notification %v for %v", event.Op, s.Path)
+				s.fileEvent()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("Stopped getting notifications for %v", dir)
+			}
+			if err == fsnotify.ErrEventOverflow {
+				// We may have missed changes to the file
+				s.fileEvent()
+				continue
+			}
+			return fmt.Errorf("Unable to watch %v: %v", dir, err)
+		case <-s.stopCh:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package yamlconf
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// watchNotifications always fails on platforms without file system
+// notifications, causing the FileStore to poll the file instead.
+func (s *FileStore) watchNotifications() error {
+	return fmt.Errorf("File system notifications are not supported on %v", runtime.GOOS)
+}
@@ -2,7 +2,7 @@ package yamlconf
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"sync"
 	"time"
 
@@ -24,6 +24,22 @@ type Config interface {
 	ApplyDefaults()
 }
 
+// Revisioned is optionally implemented by Configs that want to know their
+// revision, which counts the configs the Manager has applied in this session.
+// Each config published through Next has a higher revision than the last.
+type Revisioned interface {
+	// SetRevision sets the revision of the config.
+	SetRevision(revision int64)
+}
+
+// Bookkeeper is optionally implemented by Configs that contain fields that are
+// only used for bookkeeping, like the time of the last poll. Updates that only
+// change those fields are saved but not published through Next.
+type Bookkeeper interface {
+	// ClearBookkeeping zeroes the bookkeeping fields.
+	ClearBookkeeping()
+}
+
 // Manager exposes a facility for managing configuration a YAML configuration
 // file. After creating a Manager, one must call the Init() method to start the
 // necessary background processing.  If you set a CustomPoll function, you need
@@ -36,7 +52,8 @@ type Config interface {
 // The config can be updated in several ways:
 //
 // 1. Programmatically - Clients can call the Manager's Update() method.
-// 2. Updating the file on disk directly
+// 2. Updating the file on disk (or other Store) directly, which the Manager
+// watches for changes
 // 3. Using the optional HTTP config server
 // 4. Optionally specifying a custom polling mechanism (e.g. for fetching updates)
 // from a server.
@@ -50,9 +67,9 @@ type Config interface {
 // file will be rejected and overwritten with the latest Version from memory.
 //
 // Programmatic updates (including ones via the HTTP config server and custom
-// polling) are processed serialy. Since these operations are all defined as
-// mutators that receive the current version of the config, the order of
-// processing doesn't really matter.
+// polling) are processed serialy, in the order Update was called, each one
+// against the config left by the one before. Configs are published through
+// Next in the order they were applied.
 //
 // The optional HTTP config server provides an HTTP REST endpoint that allows
 // making updates to portions of the config. The portion of the config is
@@ -87,9 +104,14 @@ type Config interface {
 //
 //
 type Manager struct {
-	// FilePath: required, path to the config file on disk
+	// FilePath: path to the config file on disk, required unless Store is
+	// specified
 	FilePath string
 
+	// Store: optionally, where to keep the config instead of the file at
+	// FilePath
+	Store Store
+
 	// EmptyConfig: required, factor for new empty Configs
 	EmptyConfig func() Config
 
@@ -103,19 +125,47 @@ type Manager struct {
 	// example for fetching config updates from a remote server.
 	CustomPoll func(currentCfg Config) (mutate func(cfg Config) error, waitTime time.Duration, err error)
 
-	once      sync.Once
-	cfg       Config
-	cfgMutex  sync.RWMutex
-	fileInfo  os.FileInfo
-	deltasCh  chan *delta
-	nextCfgCh chan Config
+	// WriteInterval: optionally, the minimum time between saves of the config.
+	// Updates are applied in memory and published immediately, but saving
+	// them is deferred so that a burst of updates results in a single write.
+	// If zero, every update is saved immediately.
+	WriteInterval time.Duration
+
+	// FilePollInterval: optionally, how often to check the file at FilePath
+	// for changes made outside of the Manager on platforms where it can't be
+	// watched with file system notifications. Defaults to
+	// DefaultFilePollInterval.
+	FilePollInterval time.Duration
+
+	once           sync.Once
+	stopOnce       sync.Once
+	cfg            Config
+	cfgMutex       sync.RWMutex
+	stored         []byte
+	queue          []*delta
+	queueMutex     sync.Mutex
+	queuedCh       chan struct{}
+	revision       int64
+	nextCfgCh      chan Config
+	storeChangedCh <-chan struct{}
+	stopCh         chan interface{}
+	writeMutex     sync.Mutex
+	pending        Config
+	writeTimer     *time.Timer
+	lastWrite      time.Time
+	stopped        bool
+	writes         int
 }
 
 type mutator func(cfg Config) error
 
-// delta is an operation that changes to the configuration
+// delta is an operation that changes to the configuration, either by
+// mutating it, if store is set, by switching to the config in that Store or,
+// if reload is set, by reloading the config from the current Store
 type delta struct {
 	mutate mutator
+	store  Store
+	reload bool
 	errCh  chan error
 }
 
@@ -125,11 +175,66 @@ func (m *Manager) Next() Config {
 	return <-m.nextCfgCh
 }
 
-// Update updates the config by using the given mutator function.
+// Current returns the most recently applied version of the Config without
+// blocking. The returned Config is shared and must not be modified.
+func (m *Manager) Current() Config {
+	return m.getCfg()
+}
+
+// Update updates the config by using the given mutator function, returning
+// once the updated config has been applied, though not necessarily saved.
 func (m *Manager) Update(mutate func(cfg Config) error) error {
-	errCh := make(chan error)
-	m.deltasCh <- &delta{mutator(mutate), errCh}
-	return <-errCh
+	return m.enqueue(&delta{mutate: mutator(mutate)})
+}
+
+// SwitchStore switches to the config kept in the given Store, returning once
+// it has been applied. The current config is saved to the current Store
+// first, which is closed if it's an io.Closer. The config loaded from the new
+// Store goes through PerSessionSetup like the initial one, and is saved back
+// to it with its version continuing from the current config's. From then on,
+// the new Store is the one that's watched and saved to.
+func (m *Manager) SwitchStore(store Store) error {
+	return m.enqueue(&delta{store: store})
+}
+
+// Reload reloads the config from the Store right away if it changed there,
+// without waiting for the Store to notice the change, returning once any
+// changed config has been applied. This is useful when something else has just
+// written to the Store and wants its change picked up.
+func (m *Manager) Reload() error {
+	return m.enqueue(&delta{reload: true})
+}
+
+// enqueue queues the given delta for the worker, returning its outcome once
+// it has been applied.
+func (m *Manager) enqueue(d *delta) error {
+	d.errCh = make(chan error, 1)
+	m.queueMutex.Lock()
+	m.queue = append(m.queue, d)
+	m.queueMutex.Unlock()
+	select {
+	case m.queuedCh <- struct{}{}:
+	default:
+		// Already signaled, the worker will find this delta in the queue
+	}
+	return <-d.errCh
+}
+
+// UpdateAndFlush is like Update but also returns only once the updated config
+// has been saved.
+func (m *Manager) UpdateAndFlush(mutate func(cfg Config) error) error {
+	if err := m.Update(mutate); err != nil {
+		return err
+	}
+	return m.Flush()
+}
+
+// Revision returns the revision of the most recently applied config, see
+// Revisioned.
+func (m *Manager) Revision() int64 {
+	m.cfgMutex.RLock()
+	defer m.cfgMutex.RUnlock()
+	return m.revision
 }
 
 // Init starts the Manager, returning the initial Config (i.e. what was on
@@ -139,13 +244,17 @@ func (m *Manager) Init() (Config, error) {
 	if m.EmptyConfig == nil {
 		return nil, fmt.Errorf("EmptyConfig must be specified")
 	}
-	if m.FilePath == "" {
-		return nil, fmt.Errorf("FilePath must be specified")
+	if m.Store == nil {
+		if m.FilePath == "" {
+			return nil, fmt.Errorf("FilePath or Store must be specified")
+		}
+		m.Store = &FileStore{Path: m.FilePath, PollInterval: m.FilePollInterval}
 	}
-	m.deltasCh = make(chan *delta)
+	m.queuedCh = make(chan struct{}, 1)
 	m.nextCfgCh = make(chan Config)
+	m.stopCh = make(chan interface{})
 
-	err := m.loadFromDisk()
+	err := m.loadFromStore()
 	if err != nil {
 		return nil, fmt.Errorf("Could not load config? %v", err)
 	} else {
@@ -161,13 +270,18 @@ func (m *Manager) Init() (Config, error) {
 			}
 		}
 		if err == nil {
-			_, err = m.saveToDiskAndUpdate(copied)
+			_, err = m.saveAndUpdate(copied)
+		}
+		if err == nil {
+			// Make sure the initial config is saved right away
+			err = m.Flush()
 		}
 		if err != nil {
-			return nil, fmt.Errorf("Unable to perform initial update of config on disk: %s", err)
+			return nil, fmt.Errorf("Unable to perform initial update of stored config: %s", err)
 		}
 	}
 
+	m.storeChangedCh = m.Store.Watch()
 	go m.processUpdates()
 
 	return m.getCfg(), nil
@@ -180,37 +294,104 @@ func (m *Manager) StartPolling() {
 	}
 }
 
+// Flush saves any config that is waiting to be saved because of WriteInterval,
+// blocking until it has been saved.
+func (m *Manager) Flush() error {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	return m.doFlush()
+}
+
+// Stop stops custom polling and watching the Store and flushes any pending
+// config. Updates made after Stop are still applied, but are saved
+// immediately.
+func (m *Manager) Stop() error {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+		if closer, ok := m.Store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Errorf("Unable to close store: %v", err)
+			}
+		}
+	})
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	m.stopped = true
+	return m.doFlush()
+}
+
 func (m *Manager) processUpdates() {
 	for {
 		log.Trace("Waiting for next update")
-		changed := false
 		select {
-		case delta := <-m.deltasCh:
-			log.Trace("Apply delta")
-			updated, err := m.copy(m.getCfg())
-			err = delta.mutate(updated)
-			if err != nil {
+		case <-m.queuedCh:
+			for _, delta := range m.dequeue() {
+				log.Trace("Apply delta")
+				changed, err := m.applyDelta(delta)
 				delta.errCh <- err
-				continue
+				if changed {
+					m.publish()
+				}
 			}
-			changed, err = m.saveToDiskAndUpdate(updated)
-			delta.errCh <- err
+		case <-m.storeChangedCh:
+			log.Trace("Reload from store")
+			changed, err := m.reloadFromStoreIfChanged()
 			if err != nil {
+				log.Errorf("Unable to reload stored config: %v", err)
 				continue
 			}
+			if changed {
+				m.publish()
+			}
 		}
+	}
+}
 
-		if changed {
-			log.Trace("Publish changed config")
-			m.nextCfgCh <- m.cfg
-		}
+// dequeue takes the deltas queued by Update, in the order they were queued.
+func (m *Manager) dequeue() []*delta {
+	m.queueMutex.Lock()
+	defer m.queueMutex.Unlock()
+	deltas := m.queue
+	m.queue = nil
+	return deltas
+}
+
+// applyDelta applies the given delta to the current config, returning whether
+// the result should be published.
+func (m *Manager) applyDelta(delta *delta) (bool, error) {
+	if delta.store != nil {
+		return m.switchStore(delta.store)
+	}
+	if delta.reload {
+		return m.reloadFromStoreIfChanged()
+	}
+	updated, err := m.copy(m.getCfg())
+	if err != nil {
+		return false, fmt.Errorf("Unable to copy config for update: %v", err)
+	}
+	if err := delta.mutate(updated); err != nil {
+		return false, err
 	}
+	return m.saveAndUpdate(updated)
+}
+
+// publish makes the current config available through Next, blocking until
+// it's taken so that configs are seen in the order they were applied.
+func (m *Manager) publish() {
+	log.Trace("Publish changed config")
+	m.nextCfgCh <- m.getCfg()
 }
 
 func (m *Manager) processCustomPolling() {
 	for {
 		waitTime := m.poll()
-		time.Sleep(waitTime)
+		select {
+		case <-time.After(waitTime):
+			// continue polling
+		case <-m.stopCh:
+			log.Debug("Stopped polling")
+			return
+		}
 	}
 }
 
@@ -228,9 +409,21 @@ func (m *Manager) poll() time.Duration {
 	return waitTime
 }
 
+// setRevision sets the revision the given config will have once it's applied
+// with setCfg. It has to be set before the config is handed to persist, which
+// may encode it in the background. Like setCfg, it must only be called by the
+// worker.
+func (m *Manager) setRevision(cfg Config) {
+	if revisioned, ok := cfg.(Revisioned); ok {
+		revisioned.SetRevision(m.Revision() + 1)
+	}
+}
+
+// setCfg applies the given config as the next revision, see setRevision.
 func (m *Manager) setCfg(cfg Config) {
 	m.cfgMutex.Lock()
 	defer m.cfgMutex.Unlock()
+	m.revision++
 	m.cfg = cfg
 }
 
@@ -0,0 +1,248 @@
+package yamlconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/getlantern/yaml"
+)
+
+func (m *Manager) loadFromStore() error {
+	_, err := m.reloadFromStore()
+	return err
+}
+
+// reloadFromStoreIfChanged reloads the config from the Store if what's stored
+// has changed since it was last loaded or saved.
+func (m *Manager) reloadFromStoreIfChanged() (bool, error) {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	return m.reloadFromStore()
+}
+
+func (m *Manager) reloadFromStore() (bool, error) {
+	cfg := m.EmptyConfig()
+
+	data, err := m.Store.Load()
+	if err != nil {
+		return false, fmt.Errorf("Error loading config: %s", err)
+	}
+	if m.stored != nil && bytes.Equal(data, m.stored) {
+		log.Trace("Config unchanged in store")
+		return false, nil
+	}
+	if m.cfg != nil && len(data) == 0 {
+		// Most likely caught a file in the middle of being rewritten, wait for
+		// the rest of the write
+		log.Trace("Stored config empty, ignoring")
+		return false, nil
+	}
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return false, fmt.Errorf("Error unmarshaling config yaml: %s", err)
+	}
+
+	if m.cfg != nil && m.cfg.GetVersion() != cfg.GetVersion() {
+		log.Trace("Version mismatch in store, overwriting what's stored with current version")
+		// What's stored is no longer what we last saved
+		m.stored = nil
+		m.pending = m.cfg
+		if err := m.doFlush(); err != nil {
+			log.Errorf("Unable to save config: %v", err)
+		}
+		return false, fmt.Errorf("Version of stored config did not match expected. Expected %d, found %d", m.cfg.GetVersion(), cfg.GetVersion())
+	}
+
+	if m.cfg != nil {
+		// Saved configs always have defaults applied, so apply them to manual
+		// edits too
+		cfg.ApplyDefaults()
+	}
+
+	m.stored = data
+	if reflect.DeepEqual(m.cfg, cfg) {
+		log.Trace("Stored config is same as in memory, ignoring")
+		return false, nil
+	}
+
+	log.Debugf("Stored configuration changed, applying")
+
+	m.setRevision(cfg)
+	m.setCfg(cfg)
+
+	return true, nil
+}
+
+// switchStore implements SwitchStore. It must only be called by the worker,
+// which is what reads storeChangedCh.
+func (m *Manager) switchStore(store Store) (bool, error) {
+	data, err := store.Load()
+	if err != nil {
+		return false, fmt.Errorf("Error loading config: %s", err)
+	}
+	cfg := m.EmptyConfig()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return false, fmt.Errorf("Error unmarshaling config yaml: %s", err)
+	}
+	if m.PerSessionSetup != nil {
+		if err := m.PerSessionSetup(cfg); err != nil {
+			return false, fmt.Errorf("Unable to perform one-time setup: %s", err)
+		}
+	}
+
+	m.writeMutex.Lock()
+	if err := m.doFlush(); err != nil {
+		m.writeMutex.Unlock()
+		return false, err
+	}
+	if closer, ok := m.Store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("Unable to close store: %v", err)
+		}
+	}
+	m.Store = store
+	m.stored = data
+	m.writeMutex.Unlock()
+	m.storeChangedCh = store.Watch()
+
+	log.Debugf("Switched to another store")
+	if _, err := m.saveAndUpdate(cfg); err != nil {
+		return false, err
+	}
+	// Even if only bookkeeping differs, it's a different config
+	return true, nil
+}
+
+func (m *Manager) saveAndUpdate(updated Config) (bool, error) {
+	log.Trace("Applying defaults before saving")
+	updated.ApplyDefaults()
+
+	log.Trace("Remembering current version")
+	original := m.cfg
+	nextVersion := 0
+	if original != nil {
+		log.Trace("Copying original config in preparation for comparison")
+		var err error
+		original, err = m.copy(m.cfg)
+		if err != nil {
+			return false, fmt.Errorf("Unable to copy original config for comparison")
+		}
+		log.Trace("Set version to 0 prior to comparison")
+		original.SetVersion(0)
+		log.Trace("Incrementing version")
+		nextVersion = m.cfg.GetVersion() + 1
+	}
+
+	log.Trace("Compare config without version")
+	updated.SetVersion(0)
+	if reflect.DeepEqual(original, updated) {
+		log.Trace("Configuration unchanged, do nothing")
+		return false, nil
+	}
+
+	publish, err := m.changedBeyondBookkeeping(original, updated)
+	if err != nil {
+		return false, err
+	}
+
+	log.Debug("Configuration changed programmatically, saving")
+	log.Trace("Increment version")
+	updated.SetVersion(nextVersion)
+	m.setRevision(updated)
+
+	log.Trace("Save updated")
+	err = m.persist(updated)
+	if err != nil {
+		return false, err
+	}
+
+	log.Trace("Point to updated")
+	m.setCfg(updated)
+	return publish, nil
+}
+
+// changedBeyondBookkeeping returns whether updated differs from original in
+// more than just bookkeeping fields.
+func (m *Manager) changedBeyondBookkeeping(original Config, updated Config) (bool, error) {
+	if original == nil {
+		return true, nil
+	}
+	if _, ok := updated.(Bookkeeper); !ok {
+		return true, nil
+	}
+	originalCopy, err := m.copy(original)
+	if err != nil {
+		return false, fmt.Errorf("Unable to copy original config for comparison: %v", err)
+	}
+	updatedCopy, err := m.copy(updated)
+	if err != nil {
+		return false, fmt.Errorf("Unable to copy updated config for comparison: %v", err)
+	}
+	originalCopy.(Bookkeeper).ClearBookkeeping()
+	updatedCopy.(Bookkeeper).ClearBookkeeping()
+	return !reflect.DeepEqual(originalCopy, updatedCopy), nil
+}
+
+// persist saves the given config to the Store, or, if a WriteInterval is set,
+// schedules it to be saved once at least WriteInterval has passed since the
+// last save. Only the most recent config scheduled in that time is saved.
+func (m *Manager) persist(cfg Config) error {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	m.pending = cfg
+	if m.WriteInterval <= 0 || m.stopped {
+		return m.doFlush()
+	}
+	if m.writeTimer == nil {
+		wait := m.WriteInterval - time.Now().Sub(m.lastWrite)
+		if wait < 0 {
+			wait = 0
+		}
+		log.Tracef("Saving config in %v", wait)
+		m.writeTimer = time.AfterFunc(wait, func() {
+			if err := m.Flush(); err != nil {
+				log.Errorf("Unable to save pending config: %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// doFlush saves the pending config, if any. It must be called with
+// writeMutex held.
+func (m *Manager) doFlush() error {
+	if m.writeTimer != nil {
+		m.writeTimer.Stop()
+		m.writeTimer = nil
+	}
+	if m.pending == nil {
+		return nil
+	}
+	cfg := m.pending
+	m.pending = nil
+	m.lastWrite = time.Now()
+	return m.save(cfg)
+}
+
+func (m *Manager) save(cfg Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to marshal config yaml: %s", err)
+	}
+	if m.stored != nil && bytes.Equal(data, m.stored) {
+		// Large configs are slow to write on some devices, so don't write
+		// what's already stored
+		log.Trace("Config unchanged since last saved, not saving")
+		return nil
+	}
+	err = m.Store.Save(data)
+	if err != nil {
+		return fmt.Errorf("Unable to save config yaml: %s", err)
+	}
+	m.writes++
+	m.stored = data
+	return nil
+}
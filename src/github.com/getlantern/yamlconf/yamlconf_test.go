@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -24,6 +25,7 @@ var (
 type TestCfg struct {
 	Version int
 	N       *Nested
+	Polled  int
 }
 
 type Nested struct {
@@ -39,6 +41,10 @@ func (c *TestCfg) SetVersion(version int) {
 	c.Version = version
 }
 
+func (c *TestCfg) ClearBookkeeping() {
+	c.Polled = 0
+}
+
 func (c *TestCfg) ApplyDefaults() {
 	if c.N == nil {
 		c.N = &Nested{}
@@ -189,6 +195,425 @@ func TestCustomPoll(t *testing.T) {
 	}, updated, "Custom polled config should contain correct data")
 }
 
+func TestWriteInterval(t *testing.T) {
+	file, err := ioutil.TempFile("", "yamlconf_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %s", err)
+	}
+	defer func() {
+		if err := os.Remove(file.Name()); err != nil {
+			t.Fatalf("Unable to remove file: %s", err)
+		}
+	}()
+
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		FilePath:      file.Name(),
+		WriteInterval: 100 * time.Hour,
+	}
+	_, err = m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	assert.Equal(t, 1, m.writeCount(), "Initial config should be written immediately")
+
+	go func() {
+		for {
+			m.Next()
+		}
+	}()
+
+	for i := 1; i <= 50; i++ {
+		n := i
+		err := m.Update(func(cfg Config) error {
+			cfg.(*TestCfg).N.I = n
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unable to update: %s", err)
+		}
+	}
+	assert.Equal(t, 50, m.Current().(*TestCfg).N.I, "Updates should be applied in memory immediately")
+	assert.Equal(t, 1, m.writeCount(), "Updates should not have been written yet")
+	assertSavedConfigEquals(t, file, &TestCfg{
+		Version: 1,
+		N: &Nested{
+			I: FIXED_I,
+		},
+	})
+
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Unable to flush: %s", err)
+	}
+	assert.Equal(t, 2, m.writeCount(), "Burst of updates should have been written once")
+	assertSavedConfigEquals(t, file, &TestCfg{
+		Version: 51,
+		N: &Nested{
+			I: 50,
+		},
+	})
+
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Unable to flush: %s", err)
+	}
+	assert.Equal(t, 2, m.writeCount(), "Flushing with nothing pending should not write")
+
+	if err := m.Update(func(cfg Config) error {
+		cfg.(*TestCfg).N.S = "Stopping"
+		return nil
+	}); err != nil {
+		t.Fatalf("Unable to update: %s", err)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatalf("Unable to stop: %s", err)
+	}
+	assert.Equal(t, 3, m.writeCount(), "Stop should flush pending config")
+
+	if err := m.Update(func(cfg Config) error {
+		cfg.(*TestCfg).N.S = "Stopped"
+		return nil
+	}); err != nil {
+		t.Fatalf("Unable to update: %s", err)
+	}
+	assert.Equal(t, 4, m.writeCount(), "Updates after Stop should be written immediately")
+	assertSavedConfigEquals(t, file, &TestCfg{
+		Version: 53,
+		N: &Nested{
+			S: "Stopped",
+			I: 50,
+		},
+	})
+}
+
+func TestFileWatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yamlconf_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+		t.Fatalf("Unable to create config file: %s", err)
+	}
+
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		FilePath: path,
+		// Long enough that only notifications could pick up changes in time
+		FilePollInterval: 100 * time.Hour,
+	}
+	_, err = m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+
+	nextWithin := func(timeout time.Duration) *TestCfg {
+		select {
+		case cfg := <-m.nextCfgCh:
+			return cfg.(*TestCfg)
+		case <-time.After(timeout):
+			return nil
+		}
+	}
+
+	// Edit in place
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(path, []byte("version: 1\nn:\n  s: edited\n  i: 1\n"), 0644); err != nil {
+		t.Fatalf("Unable to edit config: %s", err)
+	}
+	updated := nextWithin(500 * time.Millisecond)
+	if assert.NotNil(t, updated, "Edit in place should have been picked up promptly") {
+		assert.Equal(t, &Nested{S: "edited", I: 1}, updated.N)
+	}
+
+	// Replace with an atomic rename, then edit the new file right away
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte("version: 1\nn:\n  s: renamed\n  i: 2\n"), 0644); err != nil {
+		t.Fatalf("Unable to write replacement config: %s", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		t.Fatalf("Unable to replace config: %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("version: 1\nn:\n  s: edited after rename\n  i: 3\n"), 0644); err != nil {
+		t.Fatalf("Unable to edit config: %s", err)
+	}
+	var last *TestCfg
+	for {
+		updated := nextWithin(500 * time.Millisecond)
+		if updated == nil {
+			break
+		}
+		last = updated
+	}
+	if assert.NotNil(t, last, "Replacement should have been picked up promptly") {
+		assert.Equal(t, &Nested{S: "edited after rename", I: 3}, last.N, "Edit after rename should not have been missed")
+	}
+}
+
+func TestFilePolling(t *testing.T) {
+	file, err := ioutil.TempFile("", "yamlconf_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	store := &FileStore{
+		Path:         file.Name(),
+		PollInterval: 50 * time.Millisecond,
+	}
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		Store: store,
+	}
+	_, err = m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+	// Poll as we would if notifications weren't available
+	go store.poll()
+
+	time.Sleep(50 * time.Millisecond)
+	saveConfig(t, file, &TestCfg{
+		Version: 1,
+		N: &Nested{
+			S: "polled",
+			I: 5,
+		},
+	})
+	select {
+	case cfg := <-m.nextCfgCh:
+		assert.Equal(t, &Nested{S: "polled", I: 5}, cfg.(*TestCfg).N)
+	case <-time.After(time.Second):
+		t.Fatal("Polling should have picked up change")
+	}
+}
+
+func TestSetFilePollInterval(t *testing.T) {
+	store := &FileStore{
+		Path:         "unused",
+		PollInterval: time.Hour,
+	}
+	store.init()
+	defer store.Close()
+	go store.poll()
+
+	store.SetPollInterval(20 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-store.changedCh:
+			// okay
+		case <-time.After(time.Second):
+			t.Fatal("New poll interval should have taken effect immediately")
+		}
+	}
+}
+
+func TestFileEventsDebounced(t *testing.T) {
+	store := &FileStore{Path: "unused"}
+	store.init()
+	defer store.Close()
+	go store.debounce()
+
+	// An editor saving in several steps
+	for i := 0; i < 5; i++ {
+		store.fileEvent()
+		time.Sleep(fileEventDebounce / 4)
+	}
+	select {
+	case <-store.changedCh:
+		t.Fatal("Change should not be signaled while events keep arriving")
+	default:
+	}
+	select {
+	case <-store.changedCh:
+		// okay
+	case <-time.After(time.Second):
+		t.Fatal("Change should have been signaled once events stopped")
+	}
+	select {
+	case <-store.changedCh:
+		t.Fatal("Burst of events should have been signaled once")
+	case <-time.After(2 * fileEventDebounce):
+		// okay
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore([]byte("version: 1\nn:\n  s: initial\n"))
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		Store: store,
+	}
+	first, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+	assert.Equal(t, &Nested{S: "initial", I: FIXED_I}, first.(*TestCfg).N, "Initial config should come from store")
+
+	go func() {
+		if err := m.Update(func(cfg Config) error {
+			cfg.(*TestCfg).N.S = "updated"
+			return nil
+		}); err != nil {
+			t.Errorf("Unable to update: %s", err)
+		}
+	}()
+	updated := m.Next().(*TestCfg)
+	assert.Equal(t, "updated", updated.N.S)
+	saved, _ := store.Load()
+	stored := &TestCfg{}
+	if err := yaml.Unmarshal(saved, stored); err != nil {
+		t.Fatalf("Unable to unmarshal stored config: %s", err)
+	}
+	assert.Equal(t, updated, stored, "Update should have been saved to store")
+
+	store.Set([]byte(fmt.Sprintf("version: %d\nn:\n  s: external\n  i: 1\n", updated.Version)))
+	select {
+	case cfg := <-m.nextCfgCh:
+		assert.Equal(t, &Nested{S: "external", I: 1}, cfg.(*TestCfg).N, "External change should have been applied")
+	case <-time.After(time.Second):
+		t.Fatal("External change should have been picked up")
+	}
+}
+
+func TestSwitchStore(t *testing.T) {
+	first := NewMemoryStore([]byte("version: 1\nn:\n  s: first\n"))
+	second := NewMemoryStore([]byte("version: 7\nn:\n  s: second\n"))
+	setups := 0
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		PerSessionSetup: func(cfg Config) error {
+			setups++
+			return nil
+		},
+		Store:         first,
+		WriteInterval: time.Hour,
+	}
+	_, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+	go func() {
+		for {
+			m.Next()
+		}
+	}()
+
+	assert.NoError(t, m.Update(func(cfg Config) error {
+		cfg.(*TestCfg).N.S = "first updated"
+		return nil
+	}))
+	version := m.Current().GetVersion()
+	assert.NoError(t, m.SwitchStore(second))
+	current := m.Current().(*TestCfg)
+	assert.Equal(t, "second", current.N.S, "Config should come from new store")
+	assert.Equal(t, version+1, current.Version, "Version should continue from the current config")
+	assert.Equal(t, 2, setups, "Per session setup should have been done for the new store")
+	stored := &TestCfg{}
+	saved, _ := first.Load()
+	if assert.NoError(t, yaml.Unmarshal(saved, stored)) {
+		assert.Equal(t, "first updated", stored.N.S, "Pending config should have been saved to old store")
+	}
+
+	assert.NoError(t, m.UpdateAndFlush(func(cfg Config) error {
+		cfg.(*TestCfg).N.S = "second updated"
+		return nil
+	}))
+	saved, _ = second.Load()
+	if assert.NoError(t, yaml.Unmarshal(saved, stored)) {
+		assert.Equal(t, "second updated", stored.N.S, "Updates should be saved to new store")
+	}
+	saved, _ = first.Load()
+	assert.NotContains(t, string(saved), "second", "Old store should be left alone")
+
+	second.Set([]byte(fmt.Sprintf("version: %d\nn:\n  s: external\n", m.Current().GetVersion())))
+	for i := 0; i < 100 && m.Current().(*TestCfg).N.S != "external"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "external", m.Current().(*TestCfg).N.S, "New store should be watched")
+}
+
+func TestReload(t *testing.T) {
+	store := NewMemoryStore([]byte("version: 1\nn:\n  s: stored\n"))
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		Store: store,
+	}
+	_, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+	go func() {
+		for {
+			m.Next()
+		}
+	}()
+
+	store.Set([]byte(fmt.Sprintf("version: %d\nn:\n  s: reloaded\n", m.Current().GetVersion())))
+	assert.NoError(t, m.Reload())
+	assert.Equal(t, "reloaded", m.Current().(*TestCfg).N.S, "Change in store should have been applied by the time Reload returns")
+	assert.NoError(t, m.Reload(), "Reloading an unchanged store should be fine")
+}
+
+func TestBookkeepingNotPublished(t *testing.T) {
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		Store: NewMemoryStore(nil),
+	}
+	_, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+
+	go func() {
+		for _, mutate := range []func(cfg *TestCfg){
+			func(cfg *TestCfg) { cfg.Polled = 1 },
+			func(cfg *TestCfg) { cfg.Polled = 2 },
+			func(cfg *TestCfg) { cfg.N.S = "changed" },
+		} {
+			mut := mutate
+			if err := m.Update(func(cfg Config) error {
+				mut(cfg.(*TestCfg))
+				return nil
+			}); err != nil {
+				t.Errorf("Unable to update: %s", err)
+			}
+		}
+	}()
+
+	next := m.Next().(*TestCfg)
+	assert.Equal(t, "changed", next.N.S, "Bookkeeping-only updates should not have been published")
+	assert.Equal(t, 2, next.Polled, "Bookkeeping should still have been applied")
+	saved, _ := m.Store.Load()
+	assert.Contains(t, string(saved), "polled: 2", "Bookkeeping should have been saved")
+}
+
+func (m *Manager) writeCount() int {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	return m.writes
+}
+
 func assertSavedConfigEquals(t *testing.T, file *os.File, expected *TestCfg) {
 	b, err := yaml.Marshal(expected)
 	if err != nil {
@@ -213,3 +638,137 @@ func saveConfig(t *testing.T, file *os.File, updated *TestCfg) {
 		t.Fatalf("Unable to save test config: %s", err)
 	}
 }
+
+func TestUnchangedNotSaved(t *testing.T) {
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		Store: NewMemoryStore(nil),
+	}
+	_, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+
+	writes := m.writeCount()
+	cfg, err := m.copy(m.Current())
+	if err != nil {
+		t.Fatalf("Unable to copy config: %s", err)
+	}
+	m.writeMutex.Lock()
+	assert.NoError(t, m.save(cfg))
+	m.writeMutex.Unlock()
+	assert.Equal(t, writes, m.writeCount(), "Saving what's already stored should not have written")
+
+	cfg.(*TestCfg).N = &Nested{S: "changed"}
+	m.writeMutex.Lock()
+	assert.NoError(t, m.save(cfg))
+	m.writeMutex.Unlock()
+	assert.Equal(t, writes+1, m.writeCount(), "Saving a change should have written")
+}
+
+// revisionedCfg is a TestCfg that knows its revision.
+type revisionedCfg struct {
+	TestCfg
+	revision int64
+}
+
+func (c *revisionedCfg) SetRevision(revision int64) {
+	c.revision = revision
+}
+
+func TestConcurrentUpdatesOrdered(t *testing.T) {
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &revisionedCfg{}
+		},
+		Store:         NewMemoryStore(nil),
+		WriteInterval: 200 * time.Millisecond,
+	}
+	_, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to init manager: %s", err)
+	}
+	defer m.Stop()
+	initialWrites := m.writeCount()
+
+	const updates = 50
+	type seen struct {
+		revision int64
+		i        int
+	}
+	seenCh := make(chan seen)
+	go func() {
+		for {
+			cfg := m.Next().(*revisionedCfg)
+			seenCh <- seen{cfg.revision, cfg.N.I}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(updates)
+	for i := 0; i < updates; i++ {
+		go func() {
+			defer wg.Done()
+			if err := m.Update(func(cfg Config) error {
+				cfg.(*revisionedCfg).N.I++
+				return nil
+			}); err != nil {
+				t.Errorf("Unable to update: %s", err)
+			}
+		}()
+	}
+
+	var last seen
+	for i := 0; i < updates; i++ {
+		select {
+		case next := <-seenCh:
+			if next.revision <= last.revision || next.i <= last.i {
+				t.Fatalf("Published %+v after %+v", next, last)
+			}
+			last = next
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Only saw %d of %d updates", i, updates)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, FIXED_I+updates, last.i, "Every update should have been applied to the one before")
+	assert.Equal(t, m.Revision(), last.revision, "Last config published should be the current one")
+	assert.True(t, m.writeCount()-initialWrites < updates, "Writes should have been coalesced")
+
+	assert.NoError(t, m.UpdateAndFlush(func(cfg Config) error {
+		cfg.(*revisionedCfg).N.S = "flushed"
+		return nil
+	}))
+	saved, _ := m.Store.Load()
+	assert.Contains(t, string(saved), "flushed", "UpdateAndFlush should have saved the update")
+	<-seenCh
+}
+
+func TestFileStoreSaveKeepsBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yamlconf_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	store := NewFileStore(path)
+
+	assert.NoError(t, store.Save([]byte("version: 1\n")))
+	_, err = os.Stat(path + BackupSuffix)
+	assert.True(t, os.IsNotExist(err), "There should be nothing to back up at first")
+	assert.NoError(t, os.Chmod(path, 0600))
+	assert.NoError(t, store.Save([]byte("version: 2\n")))
+
+	data, _ := store.Load()
+	assert.Equal(t, "version: 2\n", string(data))
+	backup, _ := ioutil.ReadFile(path + BackupSuffix)
+	assert.Equal(t, "version: 1\n", string(backup), "Previous version should have been backed up")
+	if fi, err := os.Stat(path); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "Permissions should have been kept")
+	}
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 2, "Temporary files should have been renamed into place")
+}
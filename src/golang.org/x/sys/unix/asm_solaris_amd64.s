@@ -2,23 +2,16 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build !gccgo
+//go:build gc
+
+#include "textflag.h"
 
 //
-// System calls for amd64, Solaris are implemented in runtime/syscall_solaris.goc
+// System calls for amd64, Solaris are implemented in runtime/syscall_solaris.go
 //
 
-TEXT ·sysvicall6(SB), 7, $0-64
+TEXT ·sysvicall6(SB),NOSPLIT,$0-88
 	JMP	syscall·sysvicall6(SB)
 
-TEXT ·rawSysvicall6(SB), 7, $0-64
+TEXT ·rawSysvicall6(SB),NOSPLIT,$0-88
 	JMP	syscall·rawSysvicall6(SB)
-
-TEXT ·dlopen(SB), 7, $0-16
-	JMP	syscall·dlopen(SB)
-
-TEXT ·dlclose(SB), 7, $0-8
-	JMP	syscall·dlclose(SB)
-
-TEXT ·dlsym(SB), 7, $0-16
-	JMP	syscall·dlsym(SB)
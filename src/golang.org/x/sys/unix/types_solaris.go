@@ -2,10 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build ignore
+//go:build ignore
 
 /*
-Input to cgo -godefs.  See also mkerrors.sh and mkall.sh
+Input to cgo -godefs.  See README.md
 */
 
 // +godefs map struct_in_addr [4]byte /* in_addr */
@@ -15,22 +15,37 @@ package unix
 
 /*
 #define KERNEL
+// These defines ensure that builds done on newer versions of Solaris are
+// backwards-compatible with older versions of Solaris and
+// OpenSolaris-based derivatives.
+#define __USE_SUNOS_SOCKETS__          // msghdr
+#define __USE_LEGACY_PROTOTYPES__      // iovec
 #include <dirent.h>
 #include <fcntl.h>
+#include <netdb.h>
+#include <limits.h>
+#include <poll.h>
 #include <signal.h>
 #include <termios.h>
+#include <termio.h>
 #include <stdio.h>
 #include <unistd.h>
 #include <sys/mman.h>
 #include <sys/mount.h>
 #include <sys/param.h>
+#include <sys/port.h>
 #include <sys/resource.h>
 #include <sys/select.h>
 #include <sys/signal.h>
 #include <sys/socket.h>
+#include <sys/sockio.h>
 #include <sys/stat.h>
+#include <sys/statvfs.h>
+#include <sys/stropts.h>
 #include <sys/time.h>
+#include <sys/times.h>
 #include <sys/types.h>
+#include <sys/utsname.h>
 #include <sys/un.h>
 #include <sys/wait.h>
 #include <net/bpf.h>
@@ -40,6 +55,8 @@ package unix
 #include <netinet/in.h>
 #include <netinet/icmp6.h>
 #include <netinet/tcp.h>
+#include <ustat.h>
+#include <utime.h>
 
 enum {
 	sizeofPtr = sizeof(void*),
@@ -58,17 +75,25 @@ struct sockaddr_any {
 	char pad[sizeof(union sockaddr_all) - sizeof(struct sockaddr)];
 };
 
+// Solaris and the major illumos distributions ship a 3rd party tun/tap driver
+// from https://github.com/kaizawa/tuntap
+// It supports a pair of IOCTLs defined at
+// https://github.com/kaizawa/tuntap/blob/master/if_tun.h#L91-L93
+#define TUNNEWPPA	(('T'<<16) | 0x0001)
+#define TUNSETPPA	(('T'<<16) | 0x0002)
 */
 import "C"
 
-// Machine characteristics; for internal use.
+// Machine characteristics
 
 const (
-	sizeofPtr      = C.sizeofPtr
-	sizeofShort    = C.sizeof_short
-	sizeofInt      = C.sizeof_int
-	sizeofLong     = C.sizeof_long
-	sizeofLongLong = C.sizeof_longlong
+	SizeofPtr      = C.sizeofPtr
+	SizeofShort    = C.sizeof_short
+	SizeofInt      = C.sizeof_int
+	SizeofLong     = C.sizeof_long
+	SizeofLongLong = C.sizeof_longlong
+	PathMax        = C.PATH_MAX
+	MaxHostNameLen = C.MAXHOSTNAMELEN
 )
 
 // Basic types
@@ -88,6 +113,10 @@ type Timeval C.struct_timeval
 
 type Timeval32 C.struct_timeval32
 
+type Tms C.struct_tms
+
+type Utimbuf C.struct_utimbuf
+
 // Processes
 
 type Rusage C.struct_rusage
@@ -98,29 +127,18 @@ type _Gid_t C.gid_t
 
 // Files
 
-const ( // Directory mode bits
-	S_IFMT   = C.S_IFMT
-	S_IFIFO  = C.S_IFIFO
-	S_IFCHR  = C.S_IFCHR
-	S_IFDIR  = C.S_IFDIR
-	S_IFBLK  = C.S_IFBLK
-	S_IFREG  = C.S_IFREG
-	S_IFLNK  = C.S_IFLNK
-	S_IFSOCK = C.S_IFSOCK
-	S_ISUID  = C.S_ISUID
-	S_ISGID  = C.S_ISGID
-	S_ISVTX  = C.S_ISVTX
-	S_IRUSR  = C.S_IRUSR
-	S_IWUSR  = C.S_IWUSR
-	S_IXUSR  = C.S_IXUSR
-)
-
 type Stat_t C.struct_stat
 
 type Flock_t C.struct_flock
 
 type Dirent C.struct_dirent
 
+// Filesystems
+
+type _Fsblkcnt_t C.fsblkcnt_t
+
+type Statvfs_t C.struct_statvfs
+
 // Sockets
 
 type RawSockaddrInet4 C.struct_sockaddr_in
@@ -149,6 +167,8 @@ type Msghdr C.struct_msghdr
 
 type Cmsghdr C.struct_cmsghdr
 
+type Inet4Pktinfo C.struct_in_pktinfo
+
 type Inet6Pktinfo C.struct_in6_pktinfo
 
 type IPv6MTUInfo C.struct_ip6_mtuinfo
@@ -162,10 +182,12 @@ const (
 	SizeofSockaddrUnix     = C.sizeof_struct_sockaddr_un
 	SizeofSockaddrDatalink = C.sizeof_struct_sockaddr_dl
 	SizeofLinger           = C.sizeof_struct_linger
+	SizeofIovec            = C.sizeof_struct_iovec
 	SizeofIPMreq           = C.sizeof_struct_ip_mreq
 	SizeofIPv6Mreq         = C.sizeof_struct_ipv6_mreq
 	SizeofMsghdr           = C.sizeof_struct_msghdr
 	SizeofCmsghdr          = C.sizeof_struct_cmsghdr
+	SizeofInet4Pktinfo     = C.sizeof_struct_in_pktinfo
 	SizeofInet6Pktinfo     = C.sizeof_struct_in6_pktinfo
 	SizeofIPv6MTUInfo      = C.sizeof_struct_ip6_mtuinfo
 	SizeofICMPv6Filter     = C.sizeof_struct_icmp6_filter
@@ -175,6 +197,20 @@ const (
 
 type FdSet C.fd_set
 
+// Misc
+
+type Utsname C.struct_utsname
+
+type Ustat_t C.struct_ustat
+
+const (
+	AT_FDCWD            = C.AT_FDCWD
+	AT_SYMLINK_NOFOLLOW = C.AT_SYMLINK_NOFOLLOW
+	AT_SYMLINK_FOLLOW   = C.AT_SYMLINK_FOLLOW
+	AT_REMOVEDIR        = C.AT_REMOVEDIR
+	AT_EACCESS          = C.AT_EACCESS
+)
+
 // Routing and interface messages
 
 const (
@@ -220,3 +256,79 @@ type BpfHdr C.struct_bpf_hdr
 // Terminal handling
 
 type Termios C.struct_termios
+
+type Termio C.struct_termio
+
+type Winsize C.struct_winsize
+
+// poll
+
+type PollFd C.struct_pollfd
+
+const (
+	POLLERR    = C.POLLERR
+	POLLHUP    = C.POLLHUP
+	POLLIN     = C.POLLIN
+	POLLNVAL   = C.POLLNVAL
+	POLLOUT    = C.POLLOUT
+	POLLPRI    = C.POLLPRI
+	POLLRDBAND = C.POLLRDBAND
+	POLLRDNORM = C.POLLRDNORM
+	POLLWRBAND = C.POLLWRBAND
+	POLLWRNORM = C.POLLWRNORM
+)
+
+// Event Ports
+
+type fileObj C.struct_file_obj
+
+type portEvent C.struct_port_event
+
+const (
+	PORT_SOURCE_AIO    = C.PORT_SOURCE_AIO
+	PORT_SOURCE_TIMER  = C.PORT_SOURCE_TIMER
+	PORT_SOURCE_USER   = C.PORT_SOURCE_USER
+	PORT_SOURCE_FD     = C.PORT_SOURCE_FD
+	PORT_SOURCE_ALERT  = C.PORT_SOURCE_ALERT
+	PORT_SOURCE_MQ     = C.PORT_SOURCE_MQ
+	PORT_SOURCE_FILE   = C.PORT_SOURCE_FILE
+	PORT_ALERT_SET     = C.PORT_ALERT_SET
+	PORT_ALERT_UPDATE  = C.PORT_ALERT_UPDATE
+	PORT_ALERT_INVALID = C.PORT_ALERT_INVALID
+	FILE_ACCESS        = C.FILE_ACCESS
+	FILE_MODIFIED      = C.FILE_MODIFIED
+	FILE_ATTRIB        = C.FILE_ATTRIB
+	FILE_TRUNC         = C.FILE_TRUNC
+	FILE_NOFOLLOW      = C.FILE_NOFOLLOW
+	FILE_DELETE        = C.FILE_DELETE
+	FILE_RENAME_TO     = C.FILE_RENAME_TO
+	FILE_RENAME_FROM   = C.FILE_RENAME_FROM
+	UNMOUNTED          = C.UNMOUNTED
+	MOUNTEDOVER        = C.MOUNTEDOVER
+	FILE_EXCEPTION     = C.FILE_EXCEPTION
+)
+
+// STREAMS and Tun
+
+const (
+	TUNNEWPPA = C.TUNNEWPPA
+	TUNSETPPA = C.TUNSETPPA
+
+	// sys/stropts.h:
+	I_STR     = C.I_STR
+	I_POP     = C.I_POP
+	I_PUSH    = C.I_PUSH
+	I_LINK    = C.I_LINK
+	I_UNLINK  = C.I_UNLINK
+	I_PLINK   = C.I_PLINK
+	I_PUNLINK = C.I_PUNLINK
+
+	// sys/sockio.h:
+	IF_UNITSEL = C.IF_UNITSEL
+)
+
+type strbuf C.struct_strbuf
+
+type Strioctl C.struct_strioctl
+
+type Lifreq C.struct_lifreq